@@ -2,13 +2,19 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"faultline/cli"
 	"faultline/codeanalysis"
+	"faultline/metrics"
 	"faultline/openapi"
 	"faultline/state"
+	"faultline/tcp"
 	"log"
 	"net/http"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -18,6 +24,7 @@ import (
 type ApiHandler struct {
 	ruleState    *state.RuleState
 	ruleManager  *cli.RuleManager
+	events       *state.EventLog
 	openAPISpecs []string // Cache for discovered OpenAPI specs
 }
 
@@ -26,6 +33,7 @@ func NewApiHandler(rm *cli.RuleManager) *ApiHandler {
 	return &ApiHandler{
 		ruleState:   rm.GetRuleState(),
 		ruleManager: rm,
+		events:      rm.GetEventLog(),
 	}
 }
 
@@ -37,8 +45,31 @@ func RegisterHandlers(router *mux.Router, rm *cli.RuleManager) {
 	// Define the API routes and link them to the handler methods
 	router.HandleFunc("/api/rules", h.GetRules).Methods("GET")
 	router.HandleFunc("/api/rules", h.AddRule).Methods("POST")
+	router.HandleFunc("/api/rules/import", h.ImportRules).Methods("POST")
+	router.HandleFunc("/api/rules/enable", h.EnableRulesByTarget).Methods("POST")
+	router.HandleFunc("/api/rules/disable", h.DisableRulesByTarget).Methods("POST")
+	router.HandleFunc("/api/rules/suggest", h.SuggestRules).Methods("POST")
 	router.HandleFunc("/api/rules/{id}", h.UpdateRule).Methods("PUT")
 	router.HandleFunc("/api/rules/{id}", h.DeleteRule).Methods("DELETE")
+	router.HandleFunc("/api/categories", h.GetCategories).Methods("GET")
+	router.HandleFunc("/api/inject-once", h.GetOneShots).Methods("GET")
+	router.HandleFunc("/api/inject-once", h.InjectOnce).Methods("POST")
+	router.HandleFunc("/api/maintenance", h.GetMaintenance).Methods("GET")
+	router.HandleFunc("/api/maintenance", h.SetMaintenance).Methods("POST")
+
+	// DB/TCP proxy rules
+	router.HandleFunc("/api/tcp-rules", h.GetTCPRules).Methods("GET")
+	router.HandleFunc("/api/tcp-rules", h.AddTCPRule).Methods("POST")
+	router.HandleFunc("/api/tcp-rules/{id}", h.UpdateTCPRule).Methods("PUT")
+	router.HandleFunc("/api/tcp-rules/{id}", h.DeleteTCPRule).Methods("DELETE")
+	router.HandleFunc("/api/tcp-stats", h.GetTCPStats).Methods("GET")
+
+	// Proxy activity
+	router.HandleFunc("/api/events", h.GetEvents).Methods("GET")
+	router.HandleFunc("/api/metrics", h.GetMetrics).Methods("GET")
+
+	// Prometheus scrape endpoint
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
 
 	// OpenAPI endpoints discovery routes
 	router.HandleFunc("/api/endpoints", h.GetEndpoints).Methods("GET")
@@ -59,10 +90,43 @@ func (h *ApiHandler) GetRules(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rules := h.ruleState.GetRules()
+	if category := r.URL.Query().Get("category"); category != "" {
+		if err := state.ValidateCategory(category); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rules = h.ruleState.GetRulesByCategory(category)
+	}
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		tagged := []state.Rule{}
+		for _, rule := range rules {
+			if rule.HasTag(tag) {
+				tagged = append(tagged, rule)
+			}
+		}
+		rules = tagged
+	}
+	if rules == nil {
+		rules = []state.Rule{}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(rules)
 }
 
+// validateRule returns the first problem with a rule posted to the API.
+func validateRule(rule *state.Rule) error {
+	if err := state.ValidateCategory(rule.Category); err != nil {
+		return err
+	}
+	if err := state.ValidateRuleName(rule.Name); err != nil {
+		return err
+	}
+	if err := state.ValidateResponseMatch(rule.ResponseMatch); err != nil {
+		return err
+	}
+	return rule.Failure.Validate()
+}
+
 // AddRule adds a new failure rule from a JSON payload.
 func (h *ApiHandler) AddRule(w http.ResponseWriter, r *http.Request) {
 	var newRule state.Rule
@@ -71,22 +135,147 @@ func (h *ApiHandler) AddRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validateRule(&newRule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Assign a new UUID and enable by default
 	newRule.ID = uuid.New().String()
 	newRule.Enabled = true
 
 	// Default category to "api" if not provided, to preserve current behavior
 	if newRule.Category == "" {
-		newRule.Category = "api"
+		newRule.Category = state.DefaultCategory
+	}
+	// Creating the same rule twice returns the existing one instead of a copy.
+	stored, added, err := h.ruleState.AddRuleIfNew(newRule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
 	}
-	h.ruleState.AddRule(newRule)
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(newRule)
+	if added {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(stored)
+}
+
+// importResult reports the outcome of a bulk rule import.
+type importResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"` // duplicates of rules already present
+	// Conflicts counts rules not imported because their name is taken.
+	Conflicts int `json:"conflicts,omitempty"`
+}
+
+// ImportRules adds a JSON array of rules, skipping any that duplicate an
+// existing rule.
+func (h *ApiHandler) ImportRules(w http.ResponseWriter, r *http.Request) {
+	var rules []state.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for _, rule := range rules {
+		if err := validateRule(&rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var result importResult
+	for _, rule := range rules {
+		// Generate new ID to avoid conflicts
+		rule.ID = uuid.New().String()
+		if rule.Category == "" {
+			rule.Category = state.DefaultCategory
+		}
+		_, added, err := h.ruleState.AddRuleIfNew(rule)
+		switch {
+		case err != nil:
+			result.Conflicts++
+		case added:
+			result.Imported++
+		default:
+			result.Skipped++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// EnableRulesByTarget enables every rule whose target matches the "target"
+// query parameter (a substring, or a glob with * and ?).
+func (h *ApiHandler) EnableRulesByTarget(w http.ResponseWriter, r *http.Request) {
+	h.setEnabledByTarget(w, r, true)
+}
+
+// DisableRulesByTarget disables every rule whose target matches the "target"
+// query parameter.
+func (h *ApiHandler) DisableRulesByTarget(w http.ResponseWriter, r *http.Request) {
+	h.setEnabledByTarget(w, r, false)
+}
+
+func (h *ApiHandler) setEnabledByTarget(w http.ResponseWriter, r *http.Request, enabled bool) {
+	pattern := r.URL.Query().Get("target")
+	if pattern == "" {
+		http.Error(w, "target query parameter is required", http.StatusBadRequest)
+		return
+	}
+	n := h.ruleState.SetEnabledByTarget(pattern, enabled)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"affected": n})
+}
+
+// SuggestRules returns disabled rules reproducing the upstream errors the
+// proxy saw recently. The "min" query parameter is how many errors a target
+// needs (default 1), "status" limits them to codes or classes (e.g. 5xx),
+// and with "create=true" the suggestions are also added, disabled and
+// tagged "suggested".
+func (h *ApiHandler) SuggestRules(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	minObserved := 1
+	if m := q.Get("min"); m != "" {
+		n, err := strconv.Atoi(m)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid min", http.StatusBadRequest)
+			return
+		}
+		minObserved = n
+	}
+	var status []string
+	if s := q.Get("status"); s != "" {
+		status = strings.Split(s, ",")
+	}
+	suggestions, err := state.SuggestRules(h.events.Recent(0), h.ruleState.GetRules(), minObserved, status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code := http.StatusOK
+	if create, _ := strconv.ParseBool(q.Get("create")); create {
+		for i := range suggestions {
+			rule := suggestions[i].Rule
+			rule.ID = uuid.New().String()
+			stored, _, err := h.ruleState.AddRuleIfNew(rule)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			suggestions[i].Rule = stored
+		}
+		code = http.StatusCreated
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(suggestions)
 }
 
-// UpdateRule updates an existing rule from a JSON payload.
+// UpdateRule updates an existing rule, given by ID or name, from a JSON payload.
 func (h *ApiHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -96,21 +285,36 @@ func (h *ApiHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if rule, ok := h.ruleState.RuleByRef(id); ok {
+		id = rule.ID // the URL may name the rule instead
+	}
 	updatedRule.ID = id // Ensure the ID from the URL is used
+	if err := validateRule(&updatedRule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if !h.ruleState.UpdateRule(updatedRule) {
+	switch err := h.ruleState.UpdateRule(updatedRule); err {
+	case nil:
+	case state.ErrNotFound:
 		http.Error(w, "Rule not found", http.StatusNotFound)
 		return
+	default:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updatedRule)
 }
 
-// DeleteRule removes a rule by its ID.
+// DeleteRule removes a rule by its ID or name.
 func (h *ApiHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	if rule, ok := h.ruleState.RuleByRef(id); ok {
+		id = rule.ID
+	}
 
 	if !h.ruleState.DeleteRule(id) {
 		http.Error(w, "Rule not found", http.StatusNotFound)
@@ -120,9 +324,225 @@ func (h *ApiHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// GetEndpoints returns discovered endpoints from OpenAPI specs
+// InjectOnce arms a one-shot fault: the next request matching the posted
+// rule gets its failure, then the rule is gone. Nothing is persisted.
+func (h *ApiHandler) InjectOnce(w http.ResponseWriter, r *http.Request) {
+	var rule state.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if rule.Target == "" && rule.HostMatch == "" || rule.Failure.Type == "" {
+		http.Error(w, "target (or hostMatch) and failure.type are required", http.StatusBadRequest)
+		return
+	}
+	if err := validateRule(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h.ruleState.ArmOneShot(rule))
+}
+
+// GetOneShots returns the one-shot faults that have not fired yet.
+func (h *ApiHandler) GetOneShots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.ruleState.OneShots())
+}
+
+// GetCategories returns the known rule categories.
+func (h *ApiHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.Categories)
+}
+
+// GetMaintenance returns the maintenance mode setting.
+func (h *ApiHandler) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.ruleState.Maintenance())
+}
+
+// SetMaintenance switches maintenance mode, which fails every proxied
+// request, on or off from a JSON payload.
+func (h *ApiHandler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var m state.Maintenance
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := state.ValidateMaintenance(m); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m = h.ruleState.SetMaintenance(m)
+	if m.Enabled {
+		code, _ := m.Response()
+		log.Printf("🚧 Maintenance mode on: every proxied request gets HTTP %d", code)
+	} else {
+		log.Println("✅ Maintenance mode off: proxying normally")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// GetTCPRules returns the list of DB/TCP proxy rules as JSON.
+func (h *ApiHandler) GetTCPRules(w http.ResponseWriter, r *http.Request) {
+	if err := h.ruleState.CheckAndReloadTCPIfModified(); err != nil {
+		log.Printf("[WARNING] Failed to reload TCP rules: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.ruleState.GetTCPRules())
+}
+
+// AddTCPRule adds a new DB/TCP proxy rule from a JSON payload.
+func (h *ApiHandler) AddTCPRule(w http.ResponseWriter, r *http.Request) {
+	var newRule state.TCPRule
+	if err := json.NewDecoder(r.Body).Decode(&newRule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if newRule.Listen == "" || newRule.Upstream == "" {
+		http.Error(w, "listen and upstream are required", http.StatusBadRequest)
+		return
+	}
+	if err := tcp.ValidateProtocol(newRule.Protocol); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Assign a new UUID and enable by default
+	newRule.ID = uuid.New().String()
+	newRule.Enabled = true
+
+	if !h.ruleState.AddTCPRule(newRule) {
+		http.Error(w, state.ErrListenInUse.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newRule)
+}
+
+// UpdateTCPRule updates an existing DB/TCP proxy rule from a JSON payload.
+func (h *ApiHandler) UpdateTCPRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var updatedRule state.TCPRule
+	if err := json.NewDecoder(r.Body).Decode(&updatedRule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedRule.Listen == "" || updatedRule.Upstream == "" {
+		http.Error(w, "listen and upstream are required", http.StatusBadRequest)
+		return
+	}
+	if err := tcp.ValidateProtocol(updatedRule.Protocol); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updatedRule.ID = id // Ensure the ID from the URL is used
+
+	switch err := h.ruleState.UpdateTCPRule(updatedRule); err {
+	case nil:
+	case state.ErrNotFound:
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updatedRule)
+}
+
+// DeleteTCPRule removes a DB/TCP proxy rule by its ID.
+func (h *ApiHandler) DeleteTCPRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !h.ruleState.DeleteTCPRule(id) {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTCPStats returns aggregated fault-injection counters per TCP listen address.
+// Only proxies running in this process (e.g. under start-all) are reported.
+func (h *ApiHandler) GetTCPStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tcp.AllStats())
+}
+
+// GetEvents returns recent proxy events, optionally limited by the "limit" query parameter.
+func (h *ApiHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.events.Recent(limit))
+}
+
+// MetricsSummary is the JSON form of the proxy's counters served at
+// /api/metrics, for clients that don't speak the Prometheus format.
+type MetricsSummary struct {
+	RequestsTotal  uint64              `json:"requestsTotal"`
+	FaultsInjected int64               `json:"faultsInjected"`
+	Rules          []RuleMetrics       `json:"rules"` // most faults first
+	TCP            []tcp.StatsSnapshot `json:"tcp,omitempty"`
+}
+
+// RuleMetrics counts the faults one rule injected. Name and Target are empty
+// once the rule is gone, e.g. a fired one-shot rule.
+type RuleMetrics struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Target string `json:"target,omitempty"`
+	Type   string `json:"type"`
+	Faults int64  `json:"faults"`
+}
+
+// GetMetrics returns the request and per-rule fault counters as JSON, along
+// with the TCP proxy stats of this process.
+func (h *ApiHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	summary := MetricsSummary{
+		RequestsTotal: metrics.Requests(),
+		Rules:         []RuleMetrics{},
+		TCP:           tcp.AllStats(),
+	}
+	metrics.EachFault(func(faultType, rule string, n int64) {
+		rm := RuleMetrics{Type: faultType, ID: rule, Faults: n}
+		if rule, ok := h.ruleState.RuleByRef(rm.ID); ok {
+			rm.Name, rm.Target = rule.Name, rule.TargetLabel()
+		}
+		summary.Rules = append(summary.Rules, rm)
+		summary.FaultsInjected += n
+	})
+	sort.SliceStable(summary.Rules, func(i, j int) bool { return summary.Rules[i].Faults > summary.Rules[j].Faults })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// GetEndpoints returns discovered endpoints from OpenAPI specs, optionally
+// only those with the operationIds in the "operations" query parameter.
 func (h *ApiHandler) GetEndpoints(w http.ResponseWriter, r *http.Request) {
 	specPath := r.URL.Query().Get("spec")
+	strict := r.URL.Query().Get("strict") == "true"
 
 	if specPath == "" {
 		// If no specific spec provided, try to find OpenAPI specs in current directory
@@ -136,26 +556,101 @@ func (h *ApiHandler) GetEndpoints(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		specPath = specs[0] // Use first found spec
+
+		// Parse every discovered spec and merge their endpoints
+		var discovered []openapi.DiscoveredEndpoints
+		var invalid []*openapi.ValidationError
+		for _, spec := range specs {
+			if !openapi.ValidateOpenAPIFile(spec) {
+				log.Printf("[WARNING] Skipping invalid OpenAPI file: %s", spec)
+				continue
+			}
+			d, err := openapi.ParseSpec(spec, strict)
+			var verr *openapi.ValidationError
+			if errors.As(err, &verr) {
+				invalid = append(invalid, verr)
+				continue
+			}
+			if err != nil {
+				log.Printf("[WARNING] Failed to parse OpenAPI spec %s: %v", spec, err)
+				continue
+			}
+			discovered = append(discovered, *d)
+		}
+		if len(invalid) > 0 {
+			writeValidationErrors(w, invalid)
+			return
+		}
+
+		merged := openapi.MergeDiscovered(discovered)
+		if !filterOperations(w, r, merged) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(merged)
+		return
 	}
 
 	// Parse the OpenAPI spec and extract endpoints
-	discovered, err := openapi.ParseOpenAPISpec(specPath)
+	discovered, err := openapi.ParseSpec(specPath, strict)
+	var verr *openapi.ValidationError
+	if errors.As(err, &verr) {
+		writeValidationErrors(w, []*openapi.ValidationError{verr})
+		return
+	}
+	var aerr *openapi.RemoteAuthError
+	if errors.As(err, &aerr) {
+		log.Printf("[ERROR] %v", aerr)
+		http.Error(w, aerr.Error(), http.StatusBadGateway)
+		return
+	}
 	if err != nil {
 		log.Printf("[ERROR] Failed to parse OpenAPI spec %s: %v", specPath, err)
 		http.Error(w, "Failed to parse OpenAPI specification", http.StatusBadRequest)
 		return
 	}
 
+	if !filterOperations(w, r, discovered) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(discovered)
 }
 
+// filterOperations keeps only the endpoints named by the comma-separated
+// "operations" query parameter, if given. It answers 400 and returns false
+// when an operationId is unknown.
+func filterOperations(w http.ResponseWriter, r *http.Request, d *openapi.DiscoveredEndpoints) bool {
+	ops := r.URL.Query().Get("operations")
+	if ops == "" {
+		return true
+	}
+	selected, err := openapi.SelectOperations(d.Endpoints, strings.Split(ops, ","))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	d.Endpoints = selected
+	return true
+}
+
+// writeValidationErrors reports specs rejected by strict validation.
+func writeValidationErrors(w http.ResponseWriter, invalid []*openapi.ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":        "OpenAPI specification failed strict validation",
+		"invalidSpecs": invalid,
+	})
+}
+
 // DiscoverEndpoints searches for OpenAPI specs and parses them
 func (h *ApiHandler) DiscoverEndpoints(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Directory string `json:"directory,omitempty"`
 		SpecPath  string `json:"specPath,omitempty"`
+		Strict    bool   `json:"strict,omitempty"` // reject specs failing validation
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -164,10 +659,16 @@ func (h *ApiHandler) DiscoverEndpoints(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var allEndpoints []openapi.DiscoveredEndpoints
+	var invalid []*openapi.ValidationError
 
 	if req.SpecPath != "" {
 		// Parse specific spec file
-		discovered, err := openapi.ParseOpenAPISpec(req.SpecPath)
+		discovered, err := openapi.ParseSpec(req.SpecPath, req.Strict)
+		var verr *openapi.ValidationError
+		if errors.As(err, &verr) {
+			writeValidationErrors(w, []*openapi.ValidationError{verr})
+			return
+		}
 		if err != nil {
 			log.Printf("[ERROR] Failed to parse OpenAPI spec %s: %v", req.SpecPath, err)
 			http.Error(w, "Failed to parse OpenAPI specification", http.StatusBadRequest)
@@ -196,7 +697,12 @@ func (h *ApiHandler) DiscoverEndpoints(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 
-			discovered, err := openapi.ParseOpenAPISpec(specPath)
+			discovered, err := openapi.ParseSpec(specPath, req.Strict)
+			var verr *openapi.ValidationError
+			if errors.As(err, &verr) {
+				invalid = append(invalid, verr)
+				continue
+			}
 			if err != nil {
 				log.Printf("[WARNING] Failed to parse OpenAPI spec %s: %v", specPath, err)
 				continue
@@ -210,6 +716,9 @@ func (h *ApiHandler) DiscoverEndpoints(w http.ResponseWriter, r *http.Request) {
 		"totalEndpoints":  getTotalEndpoints(allEndpoints),
 		"discoveredSpecs": len(allEndpoints),
 	}
+	if len(invalid) > 0 {
+		response["invalidSpecs"] = invalid
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -0,0 +1,414 @@
+package api
+
+import (
+	"encoding/json"
+	"faultline/cli"
+	"faultline/openapi"
+	"faultline/proxy"
+	"faultline/state"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestHandler() *ApiHandler {
+	return NewApiHandler(cli.NewRuleManager(state.NewRuleState(nil, "")))
+}
+
+// newTestRouter returns the API routes over an empty in-memory rule state.
+func newTestRouter() (*mux.Router, *state.RuleState) {
+	rs := state.NewRuleState(nil, "")
+	router := mux.NewRouter()
+	RegisterHandlers(router, cli.NewRuleManager(rs))
+	return router, rs
+}
+
+// call sends a request with body (none when empty) to router and decodes a
+// JSON response into out, when given.
+func call(t *testing.T, router http.Handler, method, path, body string, out any) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, path, r))
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+func TestAddRuleRejectsInvalidFailures(t *testing.T) {
+	h := newTestHandler()
+	for _, body := range []string{
+		`{"target": "http://api.local", "failure": {"type": "error", "errorCode": 0}}`,
+		`{"target": "http://api.local", "failure": {"type": "ratelimit", "requestsPerSecond": 0}}`,
+		`{"target": "http://api.local", "failure": {"type": "ratelimit", "requestsPerSecond": 5, "burst": -1}}`,
+		`{"target": "http://api.local", "failure": {"type": "sequence", "sequence": []}}`,
+	} {
+		rec := httptest.NewRecorder()
+		h.AddRule(rec, httptest.NewRequest(http.MethodPost, "/api/rules", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, rec.Code)
+		}
+	}
+	if n := len(h.ruleState.GetRules()); n != 0 {
+		t.Errorf("%d invalid rule(s) were stored", n)
+	}
+
+	rec := httptest.NewRecorder()
+	h.AddRule(rec, httptest.NewRequest(http.MethodPost, "/api/rules", strings.NewReader(`{"target": "http://api.local", "failure": {"type": "error", "errorCode": 503}}`)))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("valid rule: status %d, want 201", rec.Code)
+	}
+}
+
+func TestEveryWritePathValidatesRules(t *testing.T) {
+	h := newTestHandler()
+	badName := `{"name": "Not A Slug", "target": "http://api.local", "failure": {"type": "error", "errorCode": 500}}`
+	badCode := `{"target": "http://api.local", "failure": {"type": "error", "errorCode": 0}}`
+
+	paths := []struct {
+		name string
+		call func(w http.ResponseWriter, body string)
+	}{
+		{"AddRule", func(w http.ResponseWriter, body string) {
+			h.AddRule(w, httptest.NewRequest(http.MethodPost, "/api/rules", strings.NewReader(body)))
+		}},
+		{"ImportRules", func(w http.ResponseWriter, body string) {
+			h.ImportRules(w, httptest.NewRequest(http.MethodPost, "/api/rules/import", strings.NewReader("["+body+"]")))
+		}},
+		{"UpdateRule", func(w http.ResponseWriter, body string) {
+			req := httptest.NewRequest(http.MethodPut, "/api/rules/pay", strings.NewReader(body))
+			h.UpdateRule(w, mux.SetURLVars(req, map[string]string{"id": "pay"}))
+		}},
+		{"InjectOnce", func(w http.ResponseWriter, body string) {
+			h.InjectOnce(w, httptest.NewRequest(http.MethodPost, "/api/inject-once", strings.NewReader(body)))
+		}},
+	}
+	for _, path := range paths {
+		for _, body := range []string{badName, badCode} {
+			rec := httptest.NewRecorder()
+			path.call(rec, body)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s %s: status %d, want 400", path.name, body, rec.Code)
+			}
+		}
+	}
+	if n, armed := len(h.ruleState.GetRules()), len(h.ruleState.OneShots()); n+armed != 0 {
+		t.Errorf("%d rule(s) and %d one-shot(s) stored from invalid input", n, armed)
+	}
+}
+
+func TestTCPRuleCRUD(t *testing.T) {
+	router, _ := newTestRouter()
+
+	var created state.TCPRule
+	rec := call(t, router, http.MethodPost, "/api/tcp-rules", `{"listen": "127.0.0.1:55432", "upstream": "localhost:5432", "faults": {"latencyMs": 100}}`, &created)
+	if rec.Code != http.StatusCreated || created.ID == "" || !created.Enabled || created.Faults.LatencyMs != 100 {
+		t.Fatalf("create: %d %+v, want 201 with an enabled rule and a new ID", rec.Code, created)
+	}
+	if rec := call(t, router, http.MethodPost, "/api/tcp-rules", `{"listen": "127.0.0.1:55432", "upstream": "localhost:5433"}`, nil); rec.Code != http.StatusConflict {
+		t.Errorf("second rule on the same listen address: status %d, want 409", rec.Code)
+	}
+	for _, body := range []string{`{"listen": "127.0.0.1:55433"}`, `{"listen": "127.0.0.1:55433", "upstream": "localhost:5432", "protocol": "oracle"}`} {
+		if rec := call(t, router, http.MethodPost, "/api/tcp-rules", body, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status %d, want 400", body, rec.Code)
+		}
+	}
+
+	var updated state.TCPRule
+	rec = call(t, router, http.MethodPut, "/api/tcp-rules/"+created.ID, `{"listen": "127.0.0.1:55432", "upstream": "localhost:5432", "protocol": "postgres", "enabled": true}`, &updated)
+	if rec.Code != http.StatusOK || updated.ID != created.ID || updated.Protocol != "postgres" {
+		t.Errorf("update: %d %+v, want the rule updated in place", rec.Code, updated)
+	}
+	if rec := call(t, router, http.MethodPut, "/api/tcp-rules/missing", `{"listen": "127.0.0.1:1", "upstream": "localhost:1"}`, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("update of a missing rule: status %d, want 404", rec.Code)
+	}
+
+	var rules []state.TCPRule
+	call(t, router, http.MethodGet, "/api/tcp-rules", "", &rules)
+	if len(rules) != 1 || rules[0].Protocol != "postgres" || rules[0].Faults.LatencyMs != 0 {
+		t.Errorf("list: %+v, want the one updated rule", rules)
+	}
+
+	if rec := call(t, router, http.MethodDelete, "/api/tcp-rules/"+created.ID, "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: status %d, want 204", rec.Code)
+	}
+	if rec := call(t, router, http.MethodDelete, "/api/tcp-rules/"+created.ID, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete: status %d, want 404", rec.Code)
+	}
+	call(t, router, http.MethodGet, "/api/tcp-rules", "", &rules)
+	if len(rules) != 0 {
+		t.Errorf("list after delete: %+v, want none", rules)
+	}
+}
+
+func TestCategories(t *testing.T) {
+	router, _ := newTestRouter()
+
+	var categories []string
+	call(t, router, http.MethodGet, "/api/categories", "", &categories)
+	if !slices.Equal(categories, state.Categories) {
+		t.Errorf("GET /api/categories = %v, want %v", categories, state.Categories)
+	}
+
+	if rec := call(t, router, http.MethodPost, "/api/rules", `{"target": "http://db.local", "category": "mainframe", "failure": {"type": "error", "errorCode": 500}}`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown category: status %d, want 400", rec.Code)
+	}
+	var created state.Rule
+	call(t, router, http.MethodPost, "/api/rules", `{"target": "http://api.local", "failure": {"type": "error", "errorCode": 500}}`, &created)
+	if created.Category != state.DefaultCategory {
+		t.Errorf("rule without a category got %q, want %q", created.Category, state.DefaultCategory)
+	}
+	call(t, router, http.MethodPost, "/api/rules", `{"target": "http://db.local", "category": "database", "failure": {"type": "latency", "latencyMs": 100}}`, nil)
+
+	var rules []state.Rule
+	call(t, router, http.MethodGet, "/api/rules?category=database", "", &rules)
+	if len(rules) != 1 || rules[0].Target != "http://db.local" {
+		t.Errorf("?category=database listed %+v, want the database rule", rules)
+	}
+	if rec := call(t, router, http.MethodGet, "/api/rules?category=mainframe", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("?category=mainframe: status %d, want 400", rec.Code)
+	}
+}
+
+func TestInjectOnceFiresForOneRequest(t *testing.T) {
+	router, rs := newTestRouter()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(upstream.Close)
+	p := proxy.NewProxy(cli.NewRuleManager(rs), proxy.Options{DefaultUpstream: upstream.URL})
+
+	for _, body := range []string{`{"failure": {"type": "error", "errorCode": 500}}`, `{"target": "http://127.0.0.1"}`, `{"target": "http://127.0.0.1", "failure": {"type": "error"}}`} {
+		if rec := call(t, router, http.MethodPost, "/api/inject-once", body, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("arming %s: status %d, want 400", body, rec.Code)
+		}
+	}
+
+	var armed state.Rule
+	rec := call(t, router, http.MethodPost, "/api/inject-once", `{"target": "http://127.0.0.1", "failure": {"type": "error", "errorCode": 503}}`, &armed)
+	if rec.Code != http.StatusCreated || armed.ID == "" || !armed.Enabled {
+		t.Fatalf("arm: %d %+v, want 201 with an enabled rule and a new ID", rec.Code, armed)
+	}
+	var pending []state.Rule
+	call(t, router, http.MethodGet, "/api/inject-once", "", &pending)
+	if len(pending) != 1 || pending[0].ID != armed.ID {
+		t.Errorf("pending one-shots %+v, want the armed rule", pending)
+	}
+	if rules := rs.GetRules(); len(rules) != 0 {
+		t.Errorf("one-shot stored as a rule: %+v", rules)
+	}
+
+	for i, want := range []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusOK} {
+		rec := httptest.NewRecorder()
+		p.HandleRequest(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+		if rec.Code != want {
+			t.Errorf("request %d: status %d, want %d", i+1, rec.Code, want)
+		}
+	}
+	call(t, router, http.MethodGet, "/api/inject-once", "", &pending)
+	if len(pending) != 0 {
+		t.Errorf("pending one-shots after firing: %+v, want none", pending)
+	}
+}
+
+func TestMaintenanceModeOnAndOff(t *testing.T) {
+	router, rs := newTestRouter()
+	rs.AddRule(state.Rule{ID: "slow", Target: "http://127.0.0.1", Enabled: true, Failure: state.Failure{Type: "latency", LatencyMs: 1}})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(upstream.Close)
+	p := proxy.NewProxy(cli.NewRuleManager(rs), proxy.Options{DefaultUpstream: upstream.URL})
+	proxied := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		p.HandleRequest(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+		return rec
+	}
+
+	if rec := call(t, router, http.MethodPost, "/api/maintenance", `{"enabled": true, "statusCode": 200}`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("non-error status code: status %d, want 400", rec.Code)
+	}
+
+	var m state.Maintenance
+	call(t, router, http.MethodPost, "/api/maintenance", `{"enabled": true}`, &m)
+	if !m.Enabled || m.Since == nil {
+		t.Fatalf("switched on: %+v, want enabled with a start time", m)
+	}
+	since := *m.Since
+	if rec := proxied(); rec.Code != http.StatusServiceUnavailable || rec.Body.String() != state.DefaultMaintenanceBody || rec.Header().Get(proxy.RuleHeader) != "maintenance" {
+		t.Errorf("on by default: %d %q, want 503 with the default body over the latency rule", rec.Code, rec.Body)
+	}
+
+	call(t, router, http.MethodPost, "/api/maintenance", `{"enabled": true, "statusCode": 500, "body": "down for upgrades"}`, &m)
+	if m.Since == nil || !m.Since.Equal(since) {
+		t.Errorf("changing the response moved Since from %s to %v", since, m.Since)
+	}
+	if rec := proxied(); rec.Code != http.StatusInternalServerError || rec.Body.String() != "down for upgrades" {
+		t.Errorf("custom response: %d %q, want 500 down for upgrades", rec.Code, rec.Body)
+	}
+
+	call(t, router, http.MethodPost, "/api/maintenance", `{"enabled": false}`, nil)
+	var off state.Maintenance
+	call(t, router, http.MethodGet, "/api/maintenance", "", &off)
+	if off.Enabled || off.StatusCode != 0 || off.Since != nil {
+		t.Errorf("switched off: %+v, want the setting cleared", off)
+	}
+	if rec := proxied(); rec.Code != http.StatusOK || rec.Header().Get(proxy.RuleHeader) != "slow" {
+		t.Errorf("off: %d with rule %q, want the request proxied under its rule", rec.Code, rec.Header().Get(proxy.RuleHeader))
+	}
+}
+
+func TestListRulesByTag(t *testing.T) {
+	router, _ := newTestRouter()
+	for _, body := range []string{
+		`{"name": "checkout-500", "target": "http://pay.local", "tags": ["payments"], "failure": {"type": "error", "errorCode": 500}}`,
+		`{"name": "search-slow", "target": "http://search.local", "category": "database", "tags": ["search", "Payments"], "failure": {"type": "latency", "latencyMs": 100}}`,
+		`{"name": "orders-slow", "target": "http://orders.local", "failure": {"type": "latency", "latencyMs": 100}}`,
+	} {
+		if rec := call(t, router, http.MethodPost, "/api/rules", body, nil); rec.Code != http.StatusCreated {
+			t.Fatalf("adding %s: status %d", body, rec.Code)
+		}
+	}
+	names := func(path string) []string {
+		var rules []state.Rule
+		call(t, router, http.MethodGet, path, "", &rules)
+		var names []string
+		for _, rule := range rules {
+			names = append(names, rule.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	if got := names("/api/rules?tag=payments"); !slices.Equal(got, []string{"checkout-500", "search-slow"}) {
+		t.Errorf("?tag=payments listed %v", got)
+	}
+	if got := names("/api/rules?tag=payments&category=database"); !slices.Equal(got, []string{"search-slow"}) {
+		t.Errorf("?tag=payments&category=database listed %v", got)
+	}
+	var rules []state.Rule
+	call(t, router, http.MethodGet, "/api/rules?tag=nothing", "", &rules)
+	if rules == nil || len(rules) != 0 {
+		t.Errorf("?tag=nothing gave %v, want an empty list", rules)
+	}
+}
+
+func TestGetEndpointsMergesDiscoveredSpecs(t *testing.T) {
+	dir := t.TempDir()
+	writeSpec := func(name string, paths ...string) {
+		t.Helper()
+		ops := make([]string, len(paths))
+		for i, p := range paths {
+			ops[i] = fmt.Sprintf(`%q: {"get": {"responses": {"200": {"description": "ok"}}}}`, p)
+		}
+		spec := `{"swagger": "2.0", "info": {"title": "t", "version": "1"}, "host": "api.local", "schemes": ["http"], "paths": {` + strings.Join(ops, ", ") + `}}`
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(spec), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSpec("orders-api.json", "/orders", "/users")
+	writeSpec("users-api.json", "/users", "/users/{id}")
+	t.Chdir(dir)
+
+	router, _ := newTestRouter()
+	var merged openapi.DiscoveredEndpoints
+	if rec := call(t, router, http.MethodGet, "/api/endpoints", "", &merged); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	sources := map[string]string{}
+	for _, ep := range merged.Endpoints {
+		if _, dup := sources[ep.Path]; dup {
+			t.Errorf("%s %s listed twice", ep.Method, ep.Path)
+		}
+		sources[ep.Path] = ep.Source
+	}
+	want := map[string]string{"/orders": "orders-api.json", "/users": "orders-api.json", "/users/{id}": "users-api.json"}
+	if !maps.Equal(sources, want) {
+		t.Errorf("endpoint sources %v, want %v", sources, want)
+	}
+	if merged.Source != "orders-api.json, users-api.json" || !slices.Equal(merged.BaseURLs, []string{"http://api.local"}) {
+		t.Errorf("merged source %q and base URLs %v", merged.Source, merged.BaseURLs)
+	}
+}
+
+func TestSuggestRulesFromUpstreamErrors(t *testing.T) {
+	rs := state.NewRuleState(nil, "")
+	rm := cli.NewRuleManager(rs)
+	router := mux.NewRouter()
+	RegisterHandlers(router, rm)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /orders":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "POST /orders":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "GET /users/1":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	p := proxy.NewProxy(rm, proxy.Options{DefaultUpstream: upstream.URL})
+	for _, req := range []string{"GET /orders", "GET /orders?page=2", "POST /orders", "GET /orders", "GET /users/1", "GET /health"} {
+		method, path, _ := strings.Cut(req, " ")
+		p.HandleRequest(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+	}
+
+	suggested := func(query string) []string {
+		t.Helper()
+		var suggestions []state.RuleSuggestion
+		if rec := call(t, router, http.MethodPost, "/api/rules/suggest"+query, "", &suggestions); rec.Code >= 300 {
+			t.Fatalf("suggest%s: status %d", query, rec.Code)
+		}
+		var got []string
+		for _, s := range suggestions {
+			r := s.Rule
+			if r.Enabled || !slices.Equal(r.Tags, []string{state.SuggestedTag}) || r.Failure.Type != "error" {
+				t.Errorf("suggest%s: got %+v, want a disabled, tagged error rule", query, r)
+			}
+			got = append(got, fmt.Sprintf("%s %s %d x%d", r.Method, strings.TrimPrefix(r.Target, upstream.URL), r.Failure.ErrorCode, s.Observed))
+		}
+		return got
+	}
+	for query, want := range map[string][]string{
+		"":                  {"GET /orders 503 x3", "POST /orders 500 x1", "GET /users/1 404 x1"},
+		"?min=2":            {"GET /orders 503 x3"},
+		"?status=4xx":       {"GET /users/1 404 x1"},
+		"?status=500,404":   {"POST /orders 500 x1", "GET /users/1 404 x1"},
+		"?status=5xx&min=2": {"GET /orders 503 x3"},
+	} {
+		if got := suggested(query); !slices.Equal(got, want) {
+			t.Errorf("suggest%s: got %q, want %q", query, got, want)
+		}
+	}
+	for _, query := range []string{"?min=0", "?status=5x"} {
+		if rec := call(t, router, http.MethodPost, "/api/rules/suggest"+query, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("suggest%s: status %d, want 400", query, rec.Code)
+		}
+	}
+	if len(rs.GetRules()) != 0 {
+		t.Fatalf("suggesting created rules: %+v", rs.GetRules())
+	}
+
+	var created []state.RuleSuggestion
+	if rec := call(t, router, http.MethodPost, "/api/rules/suggest?status=5xx&create=true", "", &created); rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, want 201", rec.Code)
+	}
+	rules := rs.GetRules()
+	if len(created) != 2 || len(rules) != 2 || created[0].Rule.ID == "" {
+		t.Errorf("create: returned %+v and stored %+v, want the two 5xx rules with IDs", created, rules)
+	}
+	if got := suggested("?status=5xx"); len(got) != 0 {
+		t.Errorf("suggesting again: got %q, want the created rules left out", got)
+	}
+}
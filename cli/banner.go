@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"faultline/state"
 	"fmt"
 	"os"
 	"strings"
@@ -48,3 +49,52 @@ func PrintBanner() {
 
 	printedBanner = true
 }
+
+// StartupSummary is the setup a start command runs with.
+type StartupSummary struct {
+	ConfigFile string // empty when no config file was loaded
+	DataFile   string
+	Rules      []state.Rule
+	ProxyPort  int // 0 when the HTTP proxy isn't started
+	APIPort    int // 0 when the control API isn't started
+	// DB is set when the DB (TCP) proxies are started, for TCPRules.
+	DB       bool
+	TCPRules []state.TCPRule
+}
+
+// PrintStartupSummary prints the config file, rule counts and ports a start
+// command runs with, so a wrong port or an empty rules file is noticed
+// before the first request. Unlike the banner it is always shown.
+func PrintStartupSummary(s StartupSummary) {
+	headerColor.Println("📋 Setup")
+	if s.ConfigFile != "" {
+		fmt.Printf("   Config:       %s\n", s.ConfigFile)
+	} else {
+		subtleColor.Println("   Config:       none")
+	}
+	if s.ProxyPort > 0 || s.APIPort > 0 {
+		enabled := 0
+		for _, r := range s.Rules {
+			if r.Enabled {
+				enabled++
+			}
+		}
+		fmt.Printf("   HTTP rules:   %d (%d enabled) in %s\n", len(s.Rules), enabled, s.DataFile)
+	}
+	if s.DB {
+		enabled := 0
+		for _, r := range s.TCPRules {
+			if r.Enabled {
+				enabled++
+			}
+		}
+		fmt.Printf("   TCP rules:    %d (%d enabled)\n", len(s.TCPRules), enabled)
+	}
+	if s.ProxyPort > 0 {
+		fmt.Printf("   Proxy:        http://localhost:%d\n", s.ProxyPort)
+	}
+	if s.APIPort > 0 {
+		fmt.Printf("   Control API:  http://localhost:%d\n", s.APIPort)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"faultline/state"
+	"strings"
+	"testing"
+)
+
+func TestBannerCanBeTurnedOff(t *testing.T) {
+	t.Cleanup(func() { printedBanner = false })
+
+	printedBanner = false
+	t.Setenv("FAULTLINE_NO_BANNER", "1")
+	if out := captureStdout(t, PrintBanner); out != "" {
+		t.Errorf("FAULTLINE_NO_BANNER=1: printed %q", out)
+	}
+
+	t.Setenv("FAULTLINE_NO_BANNER", "")
+	if out := captureStdout(t, PrintBanner); !strings.Contains(out, "FaultLine — Failure injection") {
+		t.Errorf("banner missing:\n%s", out)
+	}
+	if out := captureStdout(t, PrintBanner); out != "" {
+		t.Errorf("printed the banner twice:\n%s", out)
+	}
+}
+
+func TestStartupSummaryListsRules(t *testing.T) {
+	t.Setenv("FAULTLINE_NO_BANNER", "1") // the summary is shown regardless
+	out := captureStdout(t, func() {
+		PrintStartupSummary(StartupSummary{
+			ConfigFile: "faultline.yaml",
+			DataFile:   "faultline-rules.json",
+			Rules: []state.Rule{
+				{ID: "a", Enabled: true},
+				{ID: "b"},
+				{ID: "c", Enabled: true},
+			},
+			ProxyPort: 8080,
+			APIPort:   8081,
+			DB:        true,
+			TCPRules:  []state.TCPRule{{ID: "db"}},
+		})
+	})
+	for _, want := range []string{
+		"Config:       faultline.yaml",
+		"HTTP rules:   3 (2 enabled) in faultline-rules.json",
+		"TCP rules:    1 (0 enabled)",
+		"Proxy:        http://localhost:8080",
+		"Control API:  http://localhost:8081",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary lacks %q:\n%s", want, out)
+		}
+	}
+
+	// start-db runs neither the HTTP proxy nor the API, and no config.
+	out = captureStdout(t, func() { PrintStartupSummary(StartupSummary{DB: true}) })
+	if !strings.Contains(out, "Config:       none") || strings.Contains(out, "HTTP rules") || strings.Contains(out, "Proxy:") {
+		t.Errorf("DB-only summary:\n%s", out)
+	}
+}
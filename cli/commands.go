@@ -2,10 +2,12 @@ package cli
 
 import (
 	"encoding/json"
+	"errors"
 	"faultline/codeanalysis"
 	"faultline/openapi"
 	"faultline/state"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -17,6 +19,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -30,11 +33,13 @@ var (
 
 type RuleManager struct {
 	ruleState *state.RuleState
+	events    *state.EventLog
 }
 
 func NewRuleManager(ruleState *state.RuleState) *RuleManager {
 	return &RuleManager{
 		ruleState: ruleState,
+		events:    state.NewEventLog(500),
 	}
 }
 
@@ -51,6 +56,11 @@ func (rm *RuleManager) GetRuleState() *state.RuleState {
 	return rm.ruleState
 }
 
+// GetEventLog returns the in-memory log of recent proxy events.
+func (rm *RuleManager) GetEventLog() *state.EventLog {
+	return rm.events
+}
+
 func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 	var commands []*cobra.Command
 
@@ -73,17 +83,19 @@ func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 		},
 	}
 
+	var listTag string
 	listCmd := &cobra.Command{
 		Use:     "list",
 		Short:   "List all failure injection rules",
 		Aliases: []string{"ls", "show"},
 		Run: func(cmd *cobra.Command, args []string) {
-			listRules(rm)
+			listRules(rm, listTag)
 		},
 	}
+	listCmd.Flags().StringVar(&listTag, "tag", "", "Only list rules with this tag")
 
 	deleteCmd := &cobra.Command{
-		Use:     "delete [rule-id]",
+		Use:     "delete [rule-id|name]",
 		Short:   "Delete a failure injection rule",
 		Aliases: []string{"del", "rm", "remove"},
 		Args:    cobra.MaximumNArgs(1),
@@ -96,45 +108,54 @@ func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 		},
 	}
 
+	var toggleTarget string
 	enableCmd := &cobra.Command{
-		Use:   "enable [rule-number]",
-		Short: "Enable a failure injection rule by number",
-		Long:  "Enable a failure injection rule using its number from the list (e.g., 'faultline rules enable 1')",
+		Use:   "enable [rule-number|name]",
+		Short: "Enable a failure injection rule by number, name or ID",
+		Long:  "Enable a failure injection rule using its number from the list, its name or its ID (e.g., 'faultline rules enable 1' or 'faultline rules enable payment-latency'), or every rule whose target matches --target",
 		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) == 0 {
+			if toggleTarget != "" {
+				toggleRulesByTarget(rm, toggleTarget, args, true)
+			} else if len(args) == 0 {
 				toggleRuleInteractive(rm, true)
 			} else {
 				if num, err := strconv.Atoi(args[0]); err == nil {
 					toggleRuleByNumber(rm, num, true)
 				} else {
-					errorColor.Printf("❌ Invalid rule number: %s\n", args[0])
+					toggleRuleByRef(rm, args[0], true)
 				}
 			}
 		},
 	}
 
 	disableCmd := &cobra.Command{
-		Use:   "disable [rule-number]",
-		Short: "Disable a failure injection rule by number",
-		Long:  "Disable a failure injection rule using its number from the list (e.g., 'faultline rules disable 1')",
+		Use:   "disable [rule-number|name]",
+		Short: "Disable a failure injection rule by number, name or ID",
+		Long:  "Disable a failure injection rule using its number from the list, its name or its ID (e.g., 'faultline rules disable 1' or 'faultline rules disable payment-latency'), or every rule whose target matches --target",
 		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) == 0 {
+			if toggleTarget != "" {
+				toggleRulesByTarget(rm, toggleTarget, args, false)
+			} else if len(args) == 0 {
 				toggleRuleInteractive(rm, false)
 			} else {
 				if num, err := strconv.Atoi(args[0]); err == nil {
 					toggleRuleByNumber(rm, num, false)
 				} else {
-					errorColor.Printf("❌ Invalid rule number: %s\n", args[0])
+					toggleRuleByRef(rm, args[0], false)
 				}
 			}
 		},
 	}
 
+	for _, c := range []*cobra.Command{enableCmd, disableCmd} {
+		c.Flags().StringVar(&toggleTarget, "target", "", "Toggle every rule whose target contains this text, or matches it as a glob with * and ? (e.g. 'https://*.example.com/*')")
+	}
+
 	exportCmd := &cobra.Command{
 		Use:   "export [filename]",
-		Short: "Export rules to a JSON file",
+		Short: "Export rules to a JSON or YAML file (by extension)",
 		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			filename := "faultline-rules.json"
@@ -147,7 +168,7 @@ func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 
 	importCmd := &cobra.Command{
 		Use:   "import [filename]",
-		Short: "Import rules from a JSON file",
+		Short: "Import rules from a JSON or YAML file (by extension)",
 		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
@@ -158,6 +179,16 @@ func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 		},
 	}
 
+	diffCmd := &cobra.Command{
+		Use:   "diff <filename>",
+		Short: "Show how the rules in a JSON or YAML file differ from the current rules",
+		Long:  "Compare the rules in a file with the current rules by content, ignoring IDs, and list added, changed and missing rules (e.g., before 'faultline rules import').",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			diffRulesFile(rm, args[0])
+		},
+	}
+
 	statusCmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show rules status and statistics",
@@ -166,8 +197,44 @@ func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 		},
 	}
 
-	rulesCmd.AddCommand(addCmd, listCmd, deleteCmd, enableCmd, disableCmd, exportCmd, importCmd, statusCmd)
-	commands = append(commands, rulesCmd)
+	var testMethod, testBody string
+	var testHeaders []string
+	testCmd := &cobra.Command{
+		Use:   "test <url>",
+		Short: "Show which rule (if any) a request to the URL would hit",
+		Long:  "Run the proxy's rule matching against a URL without sending traffic (e.g., 'faultline rules test https://api.example.com/users --method POST')",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			testRuleMatch(rm, args[0], testMethod, testBody, testHeaders)
+		},
+	}
+	testCmd.Flags().StringVarP(&testMethod, "method", "m", "GET", "HTTP method of the simulated request")
+	testCmd.Flags().StringVar(&testBody, "body", "", "Request body of the simulated request (for body-matching rules)")
+	testCmd.Flags().StringArrayVarP(&testHeaders, "header", "H", nil, "Header of the simulated request as 'Name: value' (repeatable)")
+
+	var bulkCategory string
+	enableAllCmd := &cobra.Command{
+		Use:   "enable-all",
+		Short: "Enable all rules, or all rules in a category",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			toggleAllRules(rm, bulkCategory, true)
+		},
+	}
+	disableAllCmd := &cobra.Command{
+		Use:   "disable-all",
+		Short: "Disable all rules, or all rules in a category",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			toggleAllRules(rm, bulkCategory, false)
+		},
+	}
+	for _, c := range []*cobra.Command{enableAllCmd, disableAllCmd} {
+		c.Flags().StringVar(&bulkCategory, "category", "", "Only toggle rules in this category ("+strings.Join(state.Categories, ", ")+")")
+	}
+
+	rulesCmd.AddCommand(addCmd, listCmd, deleteCmd, enableCmd, disableCmd, enableAllCmd, disableAllCmd, exportCmd, importCmd, diffCmd, statusCmd, testCmd)
+	commands = append(commands, rulesCmd, newScenarioCommand(rm))
 
 	quickAddCmd := &cobra.Command{
 		Use:   "add-rule",
@@ -188,6 +255,8 @@ func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 		},
 	}
 
+	var strictSpecs bool
+	var specAuthHeader, specBasicAuth string
 	listEndpointsCmd := &cobra.Command{
 		Use:     "list [spec-file]",
 		Short:   "List endpoints from OpenAPI specifications",
@@ -198,7 +267,11 @@ func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 			if len(args) > 0 {
 				specFile = args[0]
 			}
-			listEndpoints(rm, specFile)
+			if err := configureSpecAuth(specAuthHeader, specBasicAuth); err != nil {
+				errorColor.Printf("❌ %v\n", err)
+				return
+			}
+			listEndpoints(rm, specFile, strictSpecs)
 		},
 	}
 
@@ -211,23 +284,35 @@ func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 			if len(args) > 0 {
 				directory = args[0]
 			}
-			discoverSpecs(directory)
+			discoverSpecs(directory, strictSpecs)
 		},
 	}
 
+	var operations []string
 	createRulesCmd := &cobra.Command{
 		Use:   "create-rules [spec-file]",
 		Short: "Create failure rules from discovered endpoints",
+		Long:  "Create failure rules from the endpoints of an OpenAPI spec, chosen interactively or, with --operations, by operationId (e.g., 'faultline endpoints create-rules api.yaml --operations getUser,createOrder')",
 		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			specFile := ""
 			if len(args) > 0 {
 				specFile = args[0]
 			}
-			createRulesFromEndpoints(rm, specFile)
+			if err := configureSpecAuth(specAuthHeader, specBasicAuth); err != nil {
+				errorColor.Printf("❌ %v\n", err)
+				return
+			}
+			if len(operations) > 0 && specFile == "" {
+				errorColor.Println("❌ --operations needs a spec file")
+				return
+			}
+			createRulesFromEndpoints(rm, specFile, strictSpecs, operations)
 		},
 	}
+	createRulesCmd.Flags().StringSliceVar(&operations, "operations", nil, "Create rules for the endpoints with these operationIds, without prompting")
 
+	var analyzeOutput string
 	analyzeCodeCmd := &cobra.Command{
 		Use:   "analyze-code [directory]",
 		Short: "Analyze source code to find actual API endpoints being used",
@@ -237,9 +322,25 @@ func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 			if len(args) > 0 {
 				directory = args[0]
 			}
-			analyzeCodeEndpoints(directory)
+			analyzeCodeEndpoints(directory, analyzeOutput)
+		},
+	}
+	analyzeCodeCmd.Flags().StringVarP(&analyzeOutput, "output", "o", "", "Also write the results to a file (.json, .csv or .html)")
+
+	var codeBaseURL string
+	createRulesFromCodeCmd := &cobra.Command{
+		Use:   "create-rules-from-code [directory]",
+		Short: "Create failure rules from API endpoints found in source code",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			directory := "./showcase-app"
+			if len(args) > 0 {
+				directory = args[0]
+			}
+			createRulesFromCode(rm, directory, codeBaseURL)
 		},
 	}
+	createRulesFromCodeCmd.Flags().StringVar(&codeBaseURL, "base-url", "", "Base URL for relative endpoints such as /api/users (e.g. http://localhost:3000)")
 
 	compareCmd := &cobra.Command{
 		Use:   "compare [directory]",
@@ -254,7 +355,28 @@ func CreateCLICommands(rm *RuleManager) []*cobra.Command {
 		},
 	}
 
-	endpointsCmd.AddCommand(listEndpointsCmd, discoverSpecsCmd, createRulesCmd, analyzeCodeCmd, compareCmd)
+	var exampleStatus int
+	var exampleSet []string
+	exampleCmd := &cobra.Command{
+		Use:   "example <spec-file> <method> <path>",
+		Short: "Print an example JSON response for an endpoint, generated from its schema",
+		Long:  "Print an example JSON response for an endpoint (e.g., 'faultline endpoints example api.yaml GET /users/{id} --set name=Ada'), using the spec's examples or a value generated from the response schema.",
+		Args:  cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureSpecAuth(specAuthHeader, specBasicAuth); err != nil {
+				errorColor.Printf("❌ %v\n", err)
+				return
+			}
+			printEndpointExample(args[0], args[1], args[2], exampleStatus, exampleSet)
+		},
+	}
+	exampleCmd.Flags().IntVar(&exampleStatus, "status", 0, "Response status code to describe (default: the lowest 2xx)")
+	exampleCmd.Flags().StringArrayVar(&exampleSet, "set", nil, "Override a field as path=value, e.g. user.name=Ada (value parsed as JSON when possible; repeatable)")
+
+	endpointsCmd.PersistentFlags().StringVar(&specAuthHeader, "spec-auth-header", "", "Header sent when fetching a spec URL, e.g. 'Authorization: Bearer <token>' (or set "+openapi.EnvSpecAuthHeader+")")
+	endpointsCmd.PersistentFlags().StringVar(&specBasicAuth, "spec-basic-auth", "", "user:password for spec URLs behind basic auth (or set "+openapi.EnvSpecBasicAuth+")")
+	endpointsCmd.PersistentFlags().BoolVar(&strictSpecs, "strict", false, "Validate OpenAPI specs and reject invalid ones instead of parsing them best-effort")
+	endpointsCmd.AddCommand(listEndpointsCmd, discoverSpecsCmd, createRulesCmd, exampleCmd, analyzeCodeCmd, createRulesFromCodeCmd, compareCmd)
 	commands = append(commands, endpointsCmd)
 
 	return commands
@@ -270,15 +392,75 @@ func addRuleInteractive(rm *RuleManager) {
 
 	targetPrompt := &survey.Input{
 		Message: "Target URL or pattern:",
-		Help:    "The URL pattern to match (e.g., https://api.example.com/users)",
+		Help:    "The URL pattern to match (e.g., https://api.example.com/users), or * for a default applied when no other rule matches",
 	}
 	survey.AskOne(targetPrompt, &rule.Target, survey.WithValidator(survey.Required))
 
+	namePrompt := &survey.Input{
+		Message: "Name (optional):",
+		Help:    "A unique slug such as payment-latency, usable instead of the ID or number in commands like 'faultline rules disable payment-latency'",
+	}
+	survey.AskOne(namePrompt, &rule.Name, survey.WithValidator(func(ans interface{}) error {
+		name, _ := ans.(string)
+		if err := state.ValidateRuleName(name); err != nil {
+			return err
+		}
+		if _, taken := rm.ruleState.RuleByRef(name); taken && name != "" {
+			return state.ErrNameInUse
+		}
+		return nil
+	}))
+
+	methodPrompt := &survey.Input{
+		Message: "HTTP method (leave blank for any):",
+		Help:    "Only requests with this method will match (e.g., GET, POST)",
+	}
+	survey.AskOne(methodPrompt, &rule.Method)
+	rule.Method = strings.ToUpper(strings.TrimSpace(rule.Method))
+
+	categoryPrompt := &survey.Select{
+		Message: "Category:",
+		Options: state.Categories,
+		Default: state.DefaultCategory,
+		Help:    "Used to group rules in the control panel",
+	}
+	survey.AskOne(categoryPrompt, &rule.Category)
+
+	headersStr := ""
+	headersPrompt := &survey.Input{
+		Message: "Only match requests with headers (Name: value, comma-separated; blank for any):",
+		Help:    "All listed headers must be present with exactly these values, e.g. X-Tenant: beta",
+	}
+	survey.AskOne(headersPrompt, &headersStr, survey.WithValidator(func(ans interface{}) error {
+		_, err := parseHeaderMatch(strings.Split(ans.(string), ","))
+		return err
+	}))
+	rule.HeaderMatch, _ = parseHeaderMatch(strings.Split(headersStr, ","))
+
+	queryStr := ""
+	queryPrompt := &survey.Input{
+		Message: "Only match requests with query parameters (name=value, comma-separated; blank for any):",
+		Help:    "All listed parameters must be present with these values, in any order, e.g. debug=true",
+	}
+	survey.AskOne(queryPrompt, &queryStr, survey.WithValidator(func(ans interface{}) error {
+		_, err := parseQueryMatch(strings.Split(ans.(string), ","))
+		return err
+	}))
+	rule.QueryMatch, _ = parseQueryMatch(strings.Split(queryStr, ","))
+
+	tagsStr := ""
+	tagsPrompt := &survey.Input{
+		Message: "Tags (comma-separated, optional):",
+		Help:    "Labels such as release-1.2 or payment-team; filter with 'faultline rules list --tag'",
+	}
+	survey.AskOne(tagsPrompt, &tagsStr)
+	rule.Tags = parseTags(tagsStr)
+
 	failureType := ""
 	failurePrompt := &survey.Select{
 		Message: "Choose failure type:",
-		Options: []string{"latency", "error", "timeout"},
-		Help:    "latency: Add delay, error: Return HTTP error, timeout: Simulate timeout",
+		Options: []string{"latency", "error", "timeout", "sequence", "ratelimit", "quota", "mock", "stream", "request-mutation", "dns", "refused"},
+		Help:    "latency: Add delay, error: Return HTTP error, timeout: Simulate timeout, sequence: Cycle through status codes, ratelimit: Return 429 above a request rate, quota: Return 429 once a request quota is used up, mock: Serve a canned response without any upstream, stream: Delay, drop or cut WebSocket messages, request-mutation: Rewrite the method, headers or body sent upstream, dns: Fail as if the upstream's host name didn't resolve, refused: Drop the connection without any response",
 	}
 	survey.AskOne(failurePrompt, &failureType)
 
@@ -299,6 +481,18 @@ func addRuleInteractive(rm *RuleManager) {
 			rule.Failure.LatencyMs = latency
 		}
 
+		stepStr := ""
+		stepPrompt := &survey.Input{
+			Message: "Increase per request in milliseconds (0 for a constant delay):",
+			Default: "0",
+			Help:    "Each matching request waits this much longer than the previous one, like a backend degrading towards an outage",
+		}
+		survey.AskOne(stepPrompt, &stepStr)
+
+		if step, err := strconv.Atoi(stepStr); err == nil && step > 0 {
+			rule.Failure.LatencyStepMs = step
+		}
+
 	case "error":
 		errorCodeStr := ""
 		errorPrompt := &survey.Input{
@@ -312,9 +506,204 @@ func addRuleInteractive(rm *RuleManager) {
 			rule.Failure.ErrorCode = errorCode
 		}
 
+		// Throttling/unavailable responses can tell clients when to retry
+		if rule.Failure.ErrorCode == 429 || rule.Failure.ErrorCode == 503 {
+			retryAfterStr := ""
+			retryAfterPrompt := &survey.Input{
+				Message: "Retry-After seconds (0 to omit):",
+				Default: "0",
+				Help:    "Sent as a Retry-After header so clients can test their backoff logic",
+			}
+			survey.AskOne(retryAfterPrompt, &retryAfterStr)
+
+			if retryAfter, err := strconv.Atoi(retryAfterStr); err == nil && retryAfter > 0 {
+				rule.Failure.RetryAfterSeconds = retryAfter
+			}
+		}
+
+		delayStr := ""
+		delayPrompt := &survey.Input{
+			Message: "Delay before the error in milliseconds (0 for none):",
+			Default: "0",
+			Help:    "Models a degraded backend that is slow before failing",
+		}
+		survey.AskOne(delayPrompt, &delayStr)
+
+		if delay, err := strconv.Atoi(delayStr); err == nil && delay > 0 {
+			rule.Failure.LatencyMs = delay
+		}
+
+		failFirstStr := ""
+		failFirstPrompt := &survey.Input{
+			Message: "Fail only the first N requests (0 to fail every request):",
+			Default: "0",
+			Help:    "Later requests reach the real upstream, so clients can test that their retries recover",
+		}
+		survey.AskOne(failFirstPrompt, &failFirstStr)
+
+		if n, err := strconv.Atoi(failFirstStr); err == nil && n > 0 {
+			rule.Failure.FailFirstN = n
+		}
+
 	case "timeout":
 		// Timeout doesn't need additional configuration
 		rule.Failure.LatencyMs = 30000 // Default 30 second timeout
+
+	case "ratelimit":
+		rateStr := ""
+		ratePrompt := &survey.Input{
+			Message: "Requests per second:",
+			Default: "5",
+			Help:    "Sustained rate let through to the upstream; requests above it get a 429 with Retry-After",
+		}
+		survey.AskOne(ratePrompt, &rateStr, survey.WithValidator(survey.Required))
+
+		if rps, err := strconv.ParseFloat(rateStr, 64); err == nil {
+			rule.Failure.RequestsPerSecond = rps
+		}
+
+		burstStr := ""
+		burstPrompt := &survey.Input{
+			Message: "Burst size:",
+			Default: "1",
+			Help:    "How many requests may arrive at once before the rate applies",
+		}
+		survey.AskOne(burstPrompt, &burstStr)
+
+		if burst, err := strconv.Atoi(burstStr); err == nil && burst > 0 {
+			rule.Failure.Burst = burst
+		}
+
+	case "quota":
+		maxStr := ""
+		maxPrompt := &survey.Input{
+			Message: "Requests allowed per window:",
+			Default: "100",
+		}
+		survey.AskOne(maxPrompt, &maxStr, survey.WithValidator(survey.Required))
+
+		if n, err := strconv.Atoi(maxStr); err == nil {
+			rule.Failure.MaxRequests = n
+		}
+
+		windowStr := ""
+		windowPrompt := &survey.Input{
+			Message: "Window in seconds (0 for a quota that never resets):",
+			Default: "3600",
+			Help:    "The window starts with its first request; the count resets when it ends",
+		}
+		survey.AskOne(windowPrompt, &windowStr)
+
+		if window, err := strconv.Atoi(windowStr); err == nil && window > 0 {
+			rule.Failure.WindowSeconds = window
+		}
+
+	case "mock":
+		statusStr := ""
+		statusPrompt := &survey.Input{
+			Message: "Response status code:",
+			Default: "200",
+		}
+		survey.AskOne(statusPrompt, &statusStr)
+
+		if status, err := strconv.Atoi(statusStr); err == nil {
+			rule.Failure.StatusCode = status
+		}
+
+		bodyPrompt := &survey.Input{
+			Message: "Response body:",
+			Help:    "Served as-is; JSON bodies get a Content-Type of application/json",
+		}
+		survey.AskOne(bodyPrompt, &rule.Failure.Body)
+
+	case "stream":
+		latencyStr := ""
+		latencyPrompt := &survey.Input{
+			Message: "Delay per message in milliseconds (0 for none):",
+			Default: "0",
+		}
+		survey.AskOne(latencyPrompt, &latencyStr)
+
+		if latency, err := strconv.Atoi(latencyStr); err == nil && latency > 0 {
+			rule.Failure.LatencyMs = latency
+		}
+
+		dropStr := ""
+		dropPrompt := &survey.Input{
+			Message: "Message drop probability (0-1):",
+			Default: "0",
+			Help:    "Chance that a text or binary message is silently discarded; control frames always pass",
+		}
+		survey.AskOne(dropPrompt, &dropStr)
+
+		if drop, err := strconv.ParseFloat(dropStr, 64); err == nil && drop > 0 {
+			rule.Failure.DropProbability = drop
+		}
+
+		closeStr := ""
+		closePrompt := &survey.Input{
+			Message: "Close the connection after N messages (0 to keep it open):",
+			Default: "0",
+		}
+		survey.AskOne(closePrompt, &closeStr)
+
+		if n, err := strconv.Atoi(closeStr); err == nil && n > 0 {
+			rule.Failure.CloseAfterFrames = n
+		}
+
+	case "request-mutation":
+		m := &state.RequestMutation{}
+		methodPrompt := &survey.Input{
+			Message: "Send with method (blank to keep the client's):",
+		}
+		survey.AskOne(methodPrompt, &m.Method)
+		m.Method = strings.ToUpper(strings.TrimSpace(m.Method))
+
+		removeStr := ""
+		removePrompt := &survey.Input{
+			Message: "Headers to remove (comma-separated, optional):",
+			Help:    "e.g. Authorization to see how the upstream handles a missing token",
+		}
+		survey.AskOne(removePrompt, &removeStr)
+		m.RemoveHeaders = parseTags(removeStr)
+
+		setStr := ""
+		setPrompt := &survey.Input{
+			Message: "Headers to set (Name: value, comma-separated, optional):",
+		}
+		survey.AskOne(setPrompt, &setStr, survey.WithValidator(func(ans interface{}) error {
+			_, err := parseHeaderMatch(strings.Split(ans.(string), ","))
+			return err
+		}))
+		m.SetHeaders, _ = parseHeaderMatch(strings.Split(setStr, ","))
+
+		replaceBody := false
+		survey.AskOne(&survey.Confirm{Message: "Replace the request body?"}, &replaceBody)
+		if replaceBody {
+			body := ""
+			bodyPrompt := &survey.Input{
+				Message: "Request body (blank to send none):",
+				Help:    "Sent as-is, e.g. malformed JSON such as {\"amount\":",
+			}
+			survey.AskOne(bodyPrompt, &body)
+			m.Body = &body
+		}
+		rule.Failure.RequestMutation = m
+
+	case "sequence":
+		sequenceStr := ""
+		sequencePrompt := &survey.Input{
+			Message: "Status code sequence (comma-separated):",
+			Default: "200,500,200,503",
+			Help:    "Codes returned in order on each matching request, wrapping around. Codes below 400 pass through to the real upstream.",
+		}
+		survey.AskOne(sequencePrompt, &sequenceStr, survey.WithValidator(survey.Required))
+
+		for _, part := range strings.Split(sequenceStr, ",") {
+			if code, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+				rule.Failure.Sequence = append(rule.Failure.Sequence, code)
+			}
+		}
 	}
 
 	// Enable by default confirmation
@@ -326,13 +715,36 @@ func addRuleInteractive(rm *RuleManager) {
 	survey.AskOne(enablePrompt, &enabled)
 	rule.Enabled = enabled
 
+	if err := rule.Failure.Validate(); err != nil {
+		errorColor.Printf("❌ %v\n", err)
+		return
+	}
+
 	// Add the rule
-	rm.ruleState.AddRule(rule)
+	if !rm.ruleState.AddRule(rule) {
+		errorColor.Printf("❌ %v: %s\n", state.ErrNameInUse, rule.Name)
+		return
+	}
 
 	// Success message
 	successColor.Println("\n✅ Rule created successfully!")
 	infoColor.Printf("   ID: %s\n", rule.ID)
+	if rule.Name != "" {
+		infoColor.Printf("   Name: %s\n", rule.Name)
+	}
 	infoColor.Printf("   Target: %s\n", rule.Target)
+	if rule.Method != "" {
+		infoColor.Printf("   Method: %s\n", rule.Method)
+	}
+	for name, value := range rule.HeaderMatch {
+		infoColor.Printf("   Header: %s: %s\n", name, value)
+	}
+	for name, value := range rule.QueryMatch {
+		infoColor.Printf("   Query: %s=%s\n", name, value)
+	}
+	if len(rule.Tags) > 0 {
+		infoColor.Printf("   Tags: %s\n", strings.Join(rule.Tags, ", "))
+	}
 	infoColor.Printf("   Type: %s\n", rule.Failure.Type)
 	if rule.Failure.LatencyMs > 0 {
 		infoColor.Printf("   Latency: %dms\n", rule.Failure.LatencyMs)
@@ -340,6 +752,30 @@ func addRuleInteractive(rm *RuleManager) {
 	if rule.Failure.ErrorCode > 0 {
 		infoColor.Printf("   Error Code: %d\n", rule.Failure.ErrorCode)
 	}
+	if len(rule.Failure.Sequence) > 0 {
+		infoColor.Printf("   Sequence: %s\n", rule.Failure.Summary())
+	}
+	if rule.Failure.RetryAfterSeconds > 0 {
+		infoColor.Printf("   Retry-After: %ds\n", rule.Failure.RetryAfterSeconds)
+	}
+	if rule.Failure.Type == "ratelimit" {
+		infoColor.Printf("   Rate limit: %s\n", rule.Failure.Summary())
+	}
+	if rule.Failure.Type == "mock" {
+		infoColor.Printf("   Mock: %s\n", rule.Failure.Summary())
+	}
+	if rule.Failure.Type == "quota" {
+		infoColor.Printf("   Quota: %s\n", rule.Failure.Summary())
+	}
+	if rule.Failure.Type == "stream" {
+		infoColor.Printf("   Stream: %s\n", rule.Failure.Summary())
+	}
+	if rule.Failure.Type == "request-mutation" {
+		infoColor.Printf("   Mutation: %s\n", rule.Failure.Summary())
+	}
+	if rule.Failure.FailFirstN > 0 {
+		infoColor.Printf("   Fails first: %d request(s)\n", rule.Failure.FailFirstN)
+	}
 	if rule.Enabled {
 		successColor.Println("   Status: ENABLED")
 	} else {
@@ -347,7 +783,7 @@ func addRuleInteractive(rm *RuleManager) {
 	}
 }
 
-func listRules(rm *RuleManager) {
+func listRules(rm *RuleManager, tag string) {
 	rules := rm.ruleState.GetRules()
 
 	if len(rules) == 0 {
@@ -355,38 +791,43 @@ func listRules(rm *RuleManager) {
 		return
 	}
 
-	headerColor.Printf("\n🔍 Found %d rule(s):\n\n", len(rules))
+	shown := len(rules)
+	if tag != "" {
+		shown = len(rm.ruleState.GetRulesByTag(tag))
+		if shown == 0 {
+			warningColor.Printf("⚠️  No rules tagged '%s'\n", tag)
+			return
+		}
+	}
+
+	headerColor.Printf("\n🔍 Found %d rule(s):\n\n", shown)
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.Header("#", "Target", "Type", "Details", "Status")
+	table.Header("#", "Name", "Target", "Type", "Details", "Tags", "Last Fired", "Status")
 
 	for i, rule := range rules {
+		// Numbers refer to the full list so they still work with enable/disable.
+		if tag != "" && !rule.HasTag(tag) {
+			continue
+		}
 		ruleNum := fmt.Sprintf("%d", i+1)
 
-		target := wrapURL(rule.Target, 88)
+		target := wrapURL(rule.TargetLabel(), 88)
 
-		details := ""
-		switch rule.Failure.Type {
-		case "latency":
-			details = fmt.Sprintf("%dms delay", rule.Failure.LatencyMs)
-		case "error":
-			details = fmt.Sprintf("HTTP %d", rule.Failure.ErrorCode)
-		case "timeout":
-			details = "Timeout"
-		}
+		details := rule.Failure.Summary()
 
 		status := "🔴 DISABLED"
 		if rule.Enabled {
 			status = "🟢 ENABLED"
 		}
 
-		table.Append(ruleNum, target, rule.Failure.Type, details, status)
+		table.Append(ruleNum, rule.Name, target, rule.Failure.Type, details, strings.Join(rule.Tags, ", "), formatLastFired(rule.LastFired), status)
 	}
 
 	table.Render()
 
 	fmt.Println()
-	subtleColor.Println("💡 Tip: Use 'faultline rules enable <number>' or 'faultline rules disable <number>'")
+	subtleColor.Println("💡 Tip: Use 'faultline rules enable <number|name>' or 'faultline rules disable <number|name>'")
 	subtleColor.Println("   Example: faultline rules enable 1")
 	fmt.Println()
 } // deleteRuleInteractive deletes a rule with interactive selection
@@ -402,7 +843,7 @@ func deleteRuleInteractive(rm *RuleManager) {
 	var ruleMap = make(map[string]state.Rule)
 
 	for _, rule := range rules {
-		option := fmt.Sprintf("%s - %s (%s)", rule.ID[:8], rule.Target, rule.Failure.Type)
+		option := fmt.Sprintf("%s - %s (%s)", rule.ID[:8], rule.TargetLabel(), rule.Failure.Type)
 		options = append(options, option)
 		ruleMap[option] = rule
 	}
@@ -422,7 +863,7 @@ func deleteRuleInteractive(rm *RuleManager) {
 	// Confirmation
 	confirm := false
 	confirmPrompt := &survey.Confirm{
-		Message: fmt.Sprintf("Are you sure you want to delete rule '%s'?", rule.Target),
+		Message: fmt.Sprintf("Are you sure you want to delete rule '%s'?", rule.TargetLabel()),
 		Default: false,
 	}
 
@@ -488,6 +929,9 @@ func hardWrap(s string, width int) string {
 
 // deleteRule deletes a rule by ID
 func deleteRule(rm *RuleManager, id string) {
+	if rule, ok := rm.ruleState.RuleByRef(id); ok {
+		id = rule.ID
+	}
 	if rm.ruleState.DeleteRule(id) {
 		successColor.Printf("✅ Rule '%s' deleted successfully\n", id)
 	} else {
@@ -517,7 +961,7 @@ func toggleRuleInteractive(rm *RuleManager, enable bool) {
 			continue // Skip already enabled/disabled rules
 		}
 		ruleNum := i + 1
-		option := fmt.Sprintf("%d - %s (%s)", ruleNum, rule.Target, rule.Failure.Type)
+		option := fmt.Sprintf("%d - %s (%s)", ruleNum, rule.TargetLabel(), rule.Failure.Type)
 		options = append(options, option)
 		ruleNumbers = append(ruleNumbers, ruleNum)
 	}
@@ -575,12 +1019,103 @@ func toggleRuleByNumber(rm *RuleManager, number int, enable bool) {
 	}
 
 	successColor.Printf("✅ Rule %d %s successfully!\n", number, action)
-	infoColor.Printf("   %s %s (%s)\n", emoji, rule.Target, rule.Failure.Type)
-} // exportRules exports rules to a JSON file
+	infoColor.Printf("   %s %s (%s)\n", emoji, rule.TargetLabel(), rule.Failure.Type)
+}
+
+// toggleRuleByRef enables/disables a rule given by name or ID.
+func toggleRuleByRef(rm *RuleManager, ref string, enable bool) {
+	rule, ok := rm.ruleState.RuleByRef(ref)
+	if !ok {
+		errorColor.Printf("❌ No rule with name or ID '%s'. Use 'faultline rules list' to see available rules.\n", ref)
+		return
+	}
+	for i, r := range rm.ruleState.GetRules() {
+		if r.ID == rule.ID {
+			toggleRuleByNumber(rm, i+1, enable)
+			return
+		}
+	}
+}
+
+// toggleAllRules enables or disables every rule, or every rule in category,
+// with a single write to the rules file.
+func toggleAllRules(rm *RuleManager, category string, enable bool) {
+	action, emoji := "Enabled", "🟢"
+	if !enable {
+		action, emoji = "Disabled", "🔴"
+	}
+
+	if category != "" {
+		if err := state.ValidateCategory(category); err != nil {
+			errorColor.Printf("❌ %v\n", err)
+			return
+		}
+		n := rm.ruleState.SetEnabledByCategory(category, enable)
+		if n == 0 {
+			warningColor.Printf("⚠️  No rules in category '%s'\n", category)
+			return
+		}
+		successColor.Printf("%s %s %d %s rule(s)\n", emoji, action, n, category)
+		return
+	}
+
+	rules := rm.ruleState.GetRules()
+	if len(rules) == 0 {
+		warningColor.Println("⚠️  No rules configured")
+		return
+	}
+	ids := make([]string, len(rules))
+	for i, rule := range rules {
+		ids[i] = rule.ID
+	}
+	if err := rm.ruleState.SetEnabledBulk(ids, enable); err != nil {
+		errorColor.Printf("❌ Failed to update rules: %v\n", err)
+		return
+	}
+	successColor.Printf("%s %s %d rule(s)\n", emoji, action, len(ids))
+}
+
+// formatLastFired describes when a rule last fired relative to now, e.g. "2m ago".
+func formatLastFired(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	switch d := time.Since(*t); {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// toggleRulesByTarget enables or disables every rule whose target matches
+// pattern, with a single write to the rules file.
+func toggleRulesByTarget(rm *RuleManager, pattern string, args []string, enable bool) {
+	if len(args) > 0 {
+		errorColor.Println("❌ Give either a rule or --target, not both")
+		return
+	}
+	action, emoji := "Enabled", "🟢"
+	if !enable {
+		action, emoji = "Disabled", "🔴"
+	}
+	n := rm.ruleState.SetEnabledByTarget(pattern, enable)
+	if n == 0 {
+		warningColor.Printf("⚠️  No rule targets match '%s'\n", pattern)
+		return
+	}
+	successColor.Printf("%s %s %d rule(s) matching '%s'\n", emoji, action, n, pattern)
+}
+
+// exportRules exports rules to a JSON or YAML file, chosen by extension
 func exportRules(rm *RuleManager, filename string) {
 	rules := rm.ruleState.GetRules()
 
-	data, err := json.MarshalIndent(rules, "", "  ")
+	data, err := marshalRules(filename, rules)
 	if err != nil {
 		errorColor.Printf("❌ Failed to marshal rules: %v\n", err)
 		return
@@ -594,7 +1129,7 @@ func exportRules(rm *RuleManager, filename string) {
 	successColor.Printf("✅ Exported %d rule(s) to '%s'\n", len(rules), filename)
 }
 
-// importRules imports rules from a JSON file
+// importRules imports rules from a JSON or YAML file, chosen by extension
 func importRules(rm *RuleManager, filename string) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
@@ -602,21 +1137,214 @@ func importRules(rm *RuleManager, filename string) {
 		return
 	}
 
-	var rules []state.Rule
-	if err := json.Unmarshal(data, &rules); err != nil {
-		errorColor.Printf("❌ Failed to parse JSON: %v\n", err)
+	rules, err := unmarshalRules(filename, data)
+	if err != nil {
+		errorColor.Printf("❌ Failed to parse %s: %v\n", filename, err)
 		return
 	}
 
-	imported := 0
+	imported, skipped := 0, 0
 	for _, rule := range rules {
 		// Generate new ID to avoid conflicts
 		rule.ID = uuid.New().String()
-		rm.ruleState.AddRule(rule)
-		imported++
+		if err := state.ValidateRuleName(rule.Name); err != nil {
+			warningColor.Printf("⏭️  Skipped rule for %s: %v\n", rule.TargetLabel(), err)
+			continue
+		}
+		if err := rule.Failure.Validate(); err != nil {
+			warningColor.Printf("⏭️  Skipped rule for %s: %v\n", rule.TargetLabel(), err)
+			continue
+		}
+		_, added, err := rm.ruleState.AddRuleIfNew(rule)
+		switch {
+		case err != nil:
+			warningColor.Printf("⏭️  Skipped rule %q: %v\n", rule.Name, err)
+		case added:
+			imported++
+		default:
+			skipped++
+		}
 	}
 
 	successColor.Printf("✅ Imported %d rule(s) from '%s'\n", imported, filename)
+	if skipped > 0 {
+		warningColor.Printf("⏭️  Skipped %d duplicate rule(s) already present\n", skipped)
+	}
+}
+
+// isYAMLFile reports whether the filename has a YAML extension.
+func isYAMLFile(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// marshalRules encodes rules as YAML for .yaml/.yml files and JSON otherwise.
+func marshalRules(filename string, rules []state.Rule) ([]byte, error) {
+	if isYAMLFile(filename) {
+		return yaml.Marshal(rules)
+	}
+	return json.MarshalIndent(rules, "", "  ")
+}
+
+// unmarshalRules decodes rules as YAML for .yaml/.yml files and JSON otherwise.
+func unmarshalRules(filename string, data []byte) ([]state.Rule, error) {
+	var rules []state.Rule
+	if isYAMLFile(filename) {
+		err := yaml.Unmarshal(data, &rules)
+		return rules, err
+	}
+	err := json.Unmarshal(data, &rules)
+	return rules, err
+}
+
+// testRuleMatch reports which rule the proxy would apply to a request, and why.
+func testRuleMatch(rm *RuleManager, target, method, body string, headers []string) {
+	headerMatch, err := parseHeaderMatch(headers)
+	if err != nil {
+		errorColor.Printf("❌ %v\n", err)
+		return
+	}
+	req := state.Request{
+		Target: target,
+		Method: strings.ToUpper(method),
+		Body:   []byte(body),
+		Header: http.Header{},
+	}
+	for name, value := range headerMatch {
+		req.Header.Set(name, value)
+	}
+	// The proxy's own lookup decides, so this can't drift from what it does.
+	found, ok := rm.ruleState.FindRuleForRequest(req)
+
+	headerColor.Printf("\n🧪 Testing %s %s\n\n", req.Method, target)
+
+	if !ok {
+		warningColor.Println("⚠️  No enabled rule matches this request; it would be proxied normally")
+		fmt.Println()
+		return
+	}
+
+	rule := *found
+	successColor.Printf("✅ Matched rule %s\n", ruleLabel(rm, rule))
+	infoColor.Printf("   Target: %s\n", rule.TargetLabel())
+	infoColor.Printf("   Failure: %s", rule.Failure.Type)
+	if summary := rule.Failure.Summary(); summary != "" {
+		fmt.Printf(" (%s)", summary)
+	}
+	fmt.Println()
+
+	subtleColor.Println("\n   Why it matched:")
+	if rule.IsCatchAll() {
+		subtleColor.Println("   • rule is the catch-all default and no more specific rule matches")
+	} else if rule.Target != "" {
+		subtleColor.Printf("   • target is a prefix of %s\n", strings.SplitN(target, "?", 2)[0])
+	}
+	if rule.HostMatch != "" {
+		subtleColor.Printf("   • host matches %s\n", rule.HostMatch)
+	}
+	if rule.Method != "" {
+		subtleColor.Printf("   • method %s matches\n", rule.Method)
+	} else {
+		subtleColor.Println("   • rule applies to any method")
+	}
+	if rule.BodyMatch != nil {
+		subtleColor.Println("   • request body matches the rule's body condition")
+	}
+	for name, value := range rule.HeaderMatch {
+		subtleColor.Printf("   • header %s is %q\n", name, value)
+	}
+	for name, value := range rule.QueryMatch {
+		subtleColor.Printf("   • query parameter %s is %q\n", name, value)
+	}
+	if rule.ResponseMatch != nil {
+		subtleColor.Println("   • the fault is only applied if the upstream's response matches the rule's response condition")
+	}
+
+	var others []state.Rule
+	for _, other := range rm.ruleState.FindMatchingRules(req) {
+		if other.ID != rule.ID {
+			others = append(others, other)
+		}
+	}
+	if len(others) > 0 {
+		subtleColor.Printf("   • chosen over %d other matching rule(s) by priority %d", len(others), rule.Priority)
+		subtleColor.Println(", then target length, then ID:")
+		for _, other := range others {
+			subtleColor.Printf("       - %s %s (priority %d)\n", ruleLabel(rm, other), other.Target, other.Priority)
+		}
+	}
+	fmt.Println()
+}
+
+// parseHeaderMatch parses "Name: value" pairs into a header condition. Blank
+// entries are skipped; nil is returned when there are none.
+func parseHeaderMatch(pairs []string) (map[string]string, error) {
+	var headers map[string]string
+	for _, pair := range pairs {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q: expected 'Name: value'", strings.TrimSpace(pair))
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// parseQueryMatch parses "name=value" pairs into a query condition. Blank
+// entries are skipped; nil is returned when there are none.
+func parseQueryMatch(pairs []string) (map[string]string, error) {
+	var query map[string]string
+	for _, pair := range pairs {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid query parameter %q: expected 'name=value'", strings.TrimSpace(pair))
+		}
+		if query == nil {
+			query = make(map[string]string)
+		}
+		query[name] = strings.TrimSpace(value)
+	}
+	return query, nil
+}
+
+// parseTags splits a comma-separated tag list, dropping blanks.
+func parseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ruleLabel describes a rule by its list number and its name, or short ID
+// when it has none.
+func ruleLabel(rm *RuleManager, rule state.Rule) string {
+	shortID := rule.ID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+	if rule.Name != "" {
+		shortID = rule.Name
+	}
+	for i, r := range rm.ruleState.GetRules() {
+		if r.ID == rule.ID {
+			return fmt.Sprintf("#%d [%s]", i+1, shortID)
+		}
+	}
+	return fmt.Sprintf("[%s]", shortID)
 }
 
 // showStatus displays rules status and statistics
@@ -664,19 +1392,19 @@ func showStatus(rm *RuleManager) {
 }
 
 // listEndpoints lists endpoints from OpenAPI specifications
-func listEndpoints(rm *RuleManager, specFile string) {
+func listEndpoints(rm *RuleManager, specFile string, strict bool) {
 	headerColor.Println("\n🔍 Discovering API Endpoints...")
 
 	var allEndpoints []openapi.Endpoint
 
 	if specFile != "" {
 		// Parse specific spec file
-		if !openapi.ValidateOpenAPIFile(specFile) {
-			errorColor.Printf("❌ Invalid OpenAPI specification file: %s\n", specFile)
+		if err := openapi.CheckSpec(specFile); err != nil {
+			errorColor.Printf("❌ %v\n", err)
 			return
 		}
 
-		discovered, err := openapi.ParseOpenAPISpec(specFile)
+		discovered, err := openapi.ParseSpec(specFile, strict)
 		if err != nil {
 			errorColor.Printf("❌ Failed to parse OpenAPI spec %s: %v\n", specFile, err)
 			return
@@ -713,7 +1441,7 @@ func listEndpoints(rm *RuleManager, specFile string) {
 				continue
 			}
 
-			discovered, err := openapi.ParseOpenAPISpec(spec)
+			discovered, err := openapi.ParseSpec(spec, strict)
 			if err != nil {
 				warningColor.Printf("⚠️  Failed to parse %s: %v\n", spec, err)
 				continue
@@ -733,7 +1461,7 @@ func listEndpoints(rm *RuleManager, specFile string) {
 
 	// Display endpoints in a table
 	table := tablewriter.NewWriter(os.Stdout)
-	table.Header("#", "Method", "Path", "Full URL", "Summary")
+	table.Header("#", "Method", "Path", "Operation", "Full URL", "Summary")
 
 	for i, endpoint := range allEndpoints {
 		fullURL := endpoint.FullURL
@@ -753,6 +1481,7 @@ func listEndpoints(rm *RuleManager, specFile string) {
 			fmt.Sprintf("%d", i+1),
 			endpoint.Method,
 			endpoint.Path,
+			endpoint.OperationID,
 			fullURL,
 			summary,
 		})
@@ -766,7 +1495,7 @@ func listEndpoints(rm *RuleManager, specFile string) {
 }
 
 // discoverSpecs discovers OpenAPI specification files
-func discoverSpecs(directory string) {
+func discoverSpecs(directory string, strict bool) {
 	headerColor.Printf("\n🔍 Discovering OpenAPI specifications in: %s\n\n", directory)
 
 	specs, err := openapi.FindOpenAPISpecs(directory)
@@ -788,6 +1517,7 @@ func discoverSpecs(directory string) {
 	table.Header("#", "File", "Valid", "Title", "Version", "Endpoints")
 
 	validCount := 0
+	var invalid []*openapi.ValidationError
 	for i, specPath := range specs {
 		fileName := filepath.Base(specPath)
 		isValid := openapi.ValidateOpenAPIFile(specPath)
@@ -801,7 +1531,14 @@ func discoverSpecs(directory string) {
 			validCount++
 
 			// Try to get additional info
-			if discovered, err := openapi.ParseOpenAPISpec(specPath); err == nil {
+			discovered, err := openapi.ParseSpec(specPath, strict)
+			var verr *openapi.ValidationError
+			if errors.As(err, &verr) {
+				validIcon = "❌"
+				validCount--
+				invalid = append(invalid, verr)
+			}
+			if err == nil {
 				if discovered.Info.Title != "" {
 					title = discovered.Info.Title
 					if len(title) > 30 {
@@ -827,26 +1564,36 @@ func discoverSpecs(directory string) {
 
 	table.Render()
 
+	for _, verr := range invalid {
+		fmt.Println()
+		errorColor.Printf("❌ %s failed strict validation:\n", verr.Spec)
+		for _, problem := range verr.Problems {
+			fmt.Printf("   • %s\n", problem)
+		}
+	}
+
 	fmt.Println()
 	infoColor.Printf("💡 Found %d valid OpenAPI specification(s) out of %d total\n", validCount, len(specs))
 	infoColor.Printf("💡 Use 'faultline endpoints list [spec-file]' to see endpoints\n")
 	fmt.Println()
 }
 
-// createRulesFromEndpoints creates failure rules from discovered endpoints
-func createRulesFromEndpoints(rm *RuleManager, specFile string) {
+// createRulesFromEndpoints creates failure rules from discovered endpoints.
+// With operations, the endpoints with those operationIds are used instead of
+// asking which ones to use.
+func createRulesFromEndpoints(rm *RuleManager, specFile string, strict bool, operations []string) {
 	headerColor.Println("\n🚀 Creating failure rules from endpoints...")
 
 	var allEndpoints []openapi.Endpoint
 
 	if specFile != "" {
 		// Parse specific spec file
-		if !openapi.ValidateOpenAPIFile(specFile) {
-			errorColor.Printf("❌ Invalid OpenAPI specification file: %s\n", specFile)
+		if err := openapi.CheckSpec(specFile); err != nil {
+			errorColor.Printf("❌ %v\n", err)
 			return
 		}
 
-		discovered, err := openapi.ParseOpenAPISpec(specFile)
+		discovered, err := openapi.ParseSpec(specFile, strict)
 		if err != nil {
 			errorColor.Printf("❌ Failed to parse OpenAPI spec %s: %v\n", specFile, err)
 			return
@@ -876,7 +1623,7 @@ func createRulesFromEndpoints(rm *RuleManager, specFile string) {
 
 				// Get title for display
 				title := filepath.Base(spec)
-				if discovered, err := openapi.ParseOpenAPISpec(spec); err == nil && discovered.Info.Title != "" {
+				if discovered, err := openapi.ParseSpec(spec, strict); err == nil && discovered.Info.Title != "" {
 					title = fmt.Sprintf("%s (%s)", discovered.Info.Title, filepath.Base(spec))
 				}
 				specTitles = append(specTitles, title)
@@ -904,7 +1651,7 @@ func createRulesFromEndpoints(rm *RuleManager, specFile string) {
 		selectedSpec = validSpecs[selectedIndex]
 
 		// Parse selected spec
-		discovered, err := openapi.ParseOpenAPISpec(selectedSpec)
+		discovered, err := openapi.ParseSpec(selectedSpec, strict)
 		if err != nil {
 			errorColor.Printf("❌ Failed to parse selected spec: %v\n", err)
 			return
@@ -918,43 +1665,20 @@ func createRulesFromEndpoints(rm *RuleManager, specFile string) {
 		return
 	}
 
-	// Interactive rule creation options
-	var createAll bool
-	prompt := &survey.Confirm{
-		Message: fmt.Sprintf("Create failure rules for all %d endpoints?", len(allEndpoints)),
-		Default: false,
-	}
-	survey.AskOne(prompt, &createAll)
-
 	var endpointsToProcess []openapi.Endpoint
-	if createAll {
-		endpointsToProcess = allEndpoints
-	} else {
-		// Let user select specific endpoints
-		var options []string
-		for _, endpoint := range allEndpoints {
-			fullURL := endpoint.FullURL
-			if fullURL == "" && endpoint.BaseURL != "" {
-				fullURL = endpoint.BaseURL + endpoint.Path
-			}
-			option := fmt.Sprintf("%s %s (%s)", endpoint.Method, endpoint.Path, fullURL)
-			options = append(options, option)
-		}
-
-		var selectedIndices []int
-		multiPrompt := &survey.MultiSelect{
-			Message: "Select endpoints to create rules for:",
-			Options: options,
-		}
-
-		if err := survey.AskOne(multiPrompt, &selectedIndices); err != nil {
-			errorColor.Printf("❌ Selection cancelled: %v\n", err)
+	if len(operations) > 0 {
+		selected, err := openapi.SelectOperations(allEndpoints, operations)
+		if err != nil {
+			errorColor.Printf("❌ %v\n", err)
 			return
 		}
-
-		for _, index := range selectedIndices {
-			endpointsToProcess = append(endpointsToProcess, allEndpoints[index])
+		endpointsToProcess = selected
+	} else {
+		selected, ok := selectEndpointsInteractive(allEndpoints)
+		if !ok {
+			return
 		}
+		endpointsToProcess = selected
 	}
 
 	if len(endpointsToProcess) == 0 {
@@ -993,8 +1717,201 @@ func createRulesFromEndpoints(rm *RuleManager, specFile string) {
 	fmt.Println()
 }
 
+// selectEndpointsInteractive asks whether to use all endpoints or which ones.
+// It returns false if the selection was cancelled.
+func selectEndpointsInteractive(allEndpoints []openapi.Endpoint) ([]openapi.Endpoint, bool) {
+	var createAll bool
+	prompt := &survey.Confirm{
+		Message: fmt.Sprintf("Create failure rules for all %d endpoints?", len(allEndpoints)),
+		Default: false,
+	}
+	survey.AskOne(prompt, &createAll)
+	if createAll {
+		return allEndpoints, true
+	}
+
+	// Let user select specific endpoints
+	var options []string
+	for _, endpoint := range allEndpoints {
+		fullURL := endpoint.FullURL
+		if fullURL == "" && endpoint.BaseURL != "" {
+			fullURL = endpoint.BaseURL + endpoint.Path
+		}
+		option := fmt.Sprintf("%s %s (%s)", endpoint.Method, endpoint.Path, fullURL)
+		options = append(options, option)
+	}
+
+	var selectedIndices []int
+	multiPrompt := &survey.MultiSelect{
+		Message: "Select endpoints to create rules for:",
+		Options: options,
+	}
+
+	if err := survey.AskOne(multiPrompt, &selectedIndices); err != nil {
+		errorColor.Printf("❌ Selection cancelled: %v\n", err)
+		return nil, false
+	}
+
+	var selected []openapi.Endpoint
+	for _, index := range selectedIndices {
+		selected = append(selected, allEndpoints[index])
+	}
+	return selected, true
+}
+
+// createRulesFromCode creates disabled failure rules for API endpoints found in source code.
+// Relative URLs are resolved against baseURL and skipped when none is given.
+func createRulesFromCode(rm *RuleManager, directory, baseURL string) {
+	headerColor.Printf("\n🚀 Creating failure rules from code in: %s\n\n", directory)
+
+	result, err := codeanalysis.AnalyzeDirectory(directory)
+	if err != nil {
+		errorColor.Printf("❌ Failed to analyze code: %v\n", err)
+		return
+	}
+
+	endpoints, skippedRelative := codeEndpoints(result, baseURL)
+	if skippedRelative > 0 {
+		warningColor.Printf("⚠️  Skipped %d relative endpoint(s); pass --base-url to include them\n", skippedRelative)
+	}
+
+	if len(endpoints) == 0 {
+		warningColor.Println("⚠️  No endpoints found to create rules from")
+		return
+	}
+
+	var options []string
+	for _, e := range endpoints {
+		options = append(options, fmt.Sprintf("%s %s", e.method, e.url))
+	}
+
+	var selectedIndices []int
+	multiPrompt := &survey.MultiSelect{
+		Message: "Select endpoints to create rules for:",
+		Options: options,
+	}
+	if err := survey.AskOne(multiPrompt, &selectedIndices); err != nil {
+		errorColor.Printf("❌ Selection cancelled: %v\n", err)
+		return
+	}
+
+	if len(selectedIndices) == 0 {
+		warningColor.Println("⚠️  No endpoints selected")
+		return
+	}
+
+	created := 0
+	for _, index := range selectedIndices {
+		e := endpoints[index]
+		if _, added, _ := rm.ruleState.AddRuleIfNew(e.rule()); !added {
+			subtleColor.Printf("  • Rule for %s %s already exists\n", e.method, e.url)
+			continue
+		}
+		created++
+		subtleColor.Printf("  ✓ Created rule for %s %s\n", e.method, e.url)
+	}
+
+	fmt.Println()
+	successColor.Printf("✅ Created %d failure rule(s) from code\n", created)
+	infoColor.Println("💡 Use 'faultline rules list' to see all rules")
+	infoColor.Println("💡 Enable rules with 'faultline rules enable <rule-number>'")
+	fmt.Println()
+}
+
+// printEndpointExample prints an example response body for an endpoint.
+// Override values that parse as JSON are used as such, others as strings.
+func printEndpointExample(specFile, method, path string, status int, set []string) {
+	overrides := make(map[string]any, len(set))
+	for _, kv := range set {
+		field, raw, ok := strings.Cut(kv, "=")
+		if !ok || field == "" {
+			errorColor.Printf("❌ Invalid --set %q: expected path=value\n", kv)
+			return
+		}
+		var value any
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		overrides[field] = value
+	}
+
+	body, err := openapi.GenerateExample(specFile, method, path, status, overrides)
+	if err != nil {
+		errorColor.Printf("❌ %v\n", err)
+		return
+	}
+	fmt.Println(string(body))
+}
+
+// configureSpecAuth applies the credentials given on the command line to
+// remote spec fetches; without flags the environment is used.
+func configureSpecAuth(header, basic string) error {
+	switch {
+	case header != "":
+		return openapi.SetRemoteAuth(openapi.RemoteAuth{Header: header})
+	case basic != "":
+		auth, err := openapi.ParseBasicAuth(basic)
+		if err != nil {
+			return err
+		}
+		return openapi.SetRemoteAuth(auth)
+	}
+	return nil
+}
+
+// codeEndpoint is a method and rule target found in source code.
+type codeEndpoint struct{ method, url string }
+
+// rule returns a disabled 2s latency rule for the endpoint.
+func (e codeEndpoint) rule() state.Rule {
+	return state.Rule{
+		ID:      uuid.New().String(),
+		Target:  e.url,
+		Method:  e.method,
+		Enabled: false, // Start disabled by default
+		Failure: state.Failure{
+			Type:      "latency",
+			LatencyMs: 2000,
+		},
+	}
+}
+
+// codeEndpoints returns the endpoints of an analysis that rules can target,
+// in order and without repeats (the same call often appears in several
+// places), and how many relative URLs were skipped for want of baseURL.
+func codeEndpoints(result *codeanalysis.CodeAnalysisResult, baseURL string) ([]codeEndpoint, int) {
+	var endpoints []codeEndpoint
+	seen := make(map[codeEndpoint]bool)
+	skippedRelative := 0
+	for _, usage := range result.Endpoints {
+		target, ok := codeTargetURL(usage.URL, baseURL)
+		if !ok {
+			skippedRelative++
+			continue
+		}
+		e := codeEndpoint{strings.ToUpper(usage.Method), target}
+		if !seen[e] {
+			seen[e] = true
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints, skippedRelative
+}
+
+// codeTargetURL turns a URL found in source code into a rule target. Absolute
+// URLs are used as-is; paths are joined to baseURL when one is given.
+func codeTargetURL(raw, baseURL string) (string, bool) {
+	if strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://") {
+		return raw, true
+	}
+	if baseURL == "" || !strings.HasPrefix(raw, "/") {
+		return "", false
+	}
+	return strings.TrimSuffix(baseURL, "/") + raw, true
+}
+
 // analyzeCodeEndpoints analyzes source code to discover actual API endpoints
-func analyzeCodeEndpoints(directory string) {
+func analyzeCodeEndpoints(directory, output string) {
 	headerColor.Printf("\n🔍 Analyzing source code in: %s\n\n", directory)
 
 	result, err := codeanalysis.AnalyzeDirectory(directory)
@@ -1003,6 +1920,14 @@ func analyzeCodeEndpoints(directory string) {
 		return
 	}
 
+	if output != "" {
+		if err := codeanalysis.WriteReport(output, result); err != nil {
+			errorColor.Printf("❌ Failed to write report: %v\n", err)
+		} else {
+			successColor.Printf("📄 Wrote analysis report to %s\n\n", output)
+		}
+	}
+
 	if len(result.Endpoints) == 0 {
 		warningColor.Println("⚠️  No API endpoints found in source code")
 		return
@@ -1086,33 +2011,58 @@ func compareEndpoints(directory string) {
 	fmt.Printf("  Code Files: %d\n", len(codeResult.Files))
 	fmt.Println()
 
-	// Find endpoints only in OpenAPI
-	codeURLs := make(map[string]bool)
+	// Compare on normalized paths so /users/{id} in a spec matches
+	// /users/123 or /users/${id} in code.
+	endpointKey := func(method, path string) string {
+		return strings.ToUpper(method) + " " + codeanalysis.NormalizePath(path)
+	}
+
+	codeByKey := make(map[string][]codeanalysis.EndpointUsage)
+	var codeKeys []string
 	for _, ep := range codeResult.Endpoints {
-		key := fmt.Sprintf("%s %s", ep.Method, ep.URL)
-		codeURLs[key] = true
+		key := endpointKey(ep.Method, ep.URL)
+		if _, ok := codeByKey[key]; !ok {
+			codeKeys = append(codeKeys, key)
+		}
+		codeByKey[key] = append(codeByKey[key], ep)
 	}
 
-	openAPIURLs := make(map[string]bool)
+	specByKey := make(map[string]openapi.Endpoint)
 	var onlyInOpenAPI []openapi.Endpoint
+	var fuzzyMatches []string
 	for _, ep := range allOpenAPIEndpoints {
-		key := fmt.Sprintf("%s %s", ep.Method, ep.Path)
-		openAPIURLs[key] = true
-		if !codeURLs[key] {
+		key := endpointKey(ep.Method, ep.Path)
+		if _, dup := specByKey[key]; dup {
+			continue
+		}
+		specByKey[key] = ep
+		usages, ok := codeByKey[key]
+		if !ok {
 			onlyInOpenAPI = append(onlyInOpenAPI, ep)
+			continue
+		}
+		if usages[0].URL != ep.Path {
+			fuzzyMatches = append(fuzzyMatches, fmt.Sprintf("%s %s ≈ %s", ep.Method, ep.Path, usages[0].URL))
 		}
 	}
 
-	// Find endpoints only in code
+	// Find endpoints only in code, one entry per normalized endpoint
 	var onlyInCode []codeanalysis.EndpointUsage
-	for _, ep := range codeResult.Endpoints {
-		key := fmt.Sprintf("%s %s", ep.Method, ep.URL)
-		if !openAPIURLs[key] {
-			onlyInCode = append(onlyInCode, ep)
+	for _, key := range codeKeys {
+		if _, ok := specByKey[key]; !ok {
+			onlyInCode = append(onlyInCode, codeByKey[key][0])
 		}
 	}
 
 	// Display differences
+	if len(fuzzyMatches) > 0 {
+		infoColor.Printf("🔗 Matched after normalizing path parameters (%d):\n", len(fuzzyMatches))
+		for _, m := range fuzzyMatches {
+			fmt.Printf("  %s\n", m)
+		}
+		fmt.Println()
+	}
+
 	if len(onlyInOpenAPI) > 0 {
 		warningColor.Printf("⚠️  Endpoints in OpenAPI but not used in code (%d):\n", len(onlyInOpenAPI))
 		for _, ep := range onlyInOpenAPI {
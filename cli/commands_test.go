@@ -0,0 +1,313 @@
+package cli
+
+import (
+	"faultline/codeanalysis"
+	"faultline/state"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// captureStdout returns what f prints, including colored output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, colorOutput := os.Stdout, color.Output
+	os.Stdout, color.Output = w, w
+	defer func() { os.Stdout, color.Output = stdout, colorOutput }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+// fullRule returns a rule with every field set, so a field lost in a round
+// trip shows up as a difference.
+func fullRule(t *testing.T) state.Rule {
+	t.Helper()
+	fired := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	body := `{"injected":true}`
+	r := state.Rule{
+		ID:            "r1",
+		Name:          "payment-latency",
+		Target:        "https://api.example.com/pay",
+		HostMatch:     "api.example.com",
+		Enabled:       true,
+		Category:      "network",
+		Priority:      3,
+		Method:        "POST",
+		Weight:        70,
+		BodyMatch:     &state.BodyMatch{Contains: "card", Path: "order.status", Equals: "new"},
+		HeaderMatch:   map[string]string{"X-Tenant": "beta"},
+		QueryMatch:    map[string]string{"debug": "true"},
+		ResponseMatch: &state.ResponseMatch{Status: []string{"5xx", "429"}, BodyContains: "overloaded"},
+		Tags:          []string{"payment-team", "release-1.2"},
+		ScenarioID:    "black-friday",
+		FromConfig:    true,
+		LastFired:     &fired,
+		Failure: state.Failure{
+			Type:              "error",
+			LatencyMs:         50,
+			ErrorCode:         503,
+			LatencyStepMs:     10,
+			RetryAfterSeconds: 30,
+			ResponseHeaders:   map[string]string{"X-Fault": "yes"},
+			Sequence:          []int{200, 503},
+			FailFirstN:        2,
+			ResetAfterSeconds: 60,
+			RequestsPerSecond: 2.5,
+			Burst:             4,
+			MaxRequests:       100,
+			WindowSeconds:     3600,
+			StatusCode:        202,
+			Body:              "maintenance",
+			DropProbability:   0.25,
+			CloseAfterFrames:  5,
+			MaxConcurrent:     1,
+			QueueTimeoutMs:    200,
+			Rollout:           &state.Rollout{Percent: 10, Header: "X-User"},
+			Probability:       0.5,
+			RequestMutation: &state.RequestMutation{
+				Method:        "PUT",
+				SetHeaders:    map[string]string{"X-Mutated": "1"},
+				RemoveHeaders: []string{"Authorization"},
+				Body:          &body,
+			},
+		},
+	}
+	for _, v := range []reflect.Value{reflect.ValueOf(r), reflect.ValueOf(r.Failure)} {
+		for i := range v.NumField() {
+			if v.Field(i).IsZero() {
+				t.Fatalf("fullRule leaves %s.%s unset", v.Type().Name(), v.Type().Field(i).Name)
+			}
+		}
+	}
+	return r
+}
+
+func TestYAMLExportRoundTrip(t *testing.T) {
+	want := fullRule(t)
+	from := state.NewRuleState(nil, "")
+	from.AddRule(want)
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	exportRules(NewRuleManager(from), file)
+
+	to := state.NewRuleState(nil, "")
+	importRules(NewRuleManager(to), file)
+	rules := to.GetRules()
+	if len(rules) != 1 {
+		t.Fatalf("imported %d rules, want 1", len(rules))
+	}
+	got := rules[0]
+	got.ID = want.ID // import assigns a fresh ID
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rule changed in a YAML round trip:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestListRulesByTag(t *testing.T) {
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(state.Rule{ID: "a", Name: "checkout-500", Target: "http://pay.local", Tags: []string{"payments", "release-1.2"}, Failure: state.Failure{Type: "error", ErrorCode: 500}})
+	rs.AddRule(state.Rule{ID: "b", Name: "search-slow", Target: "http://search.local", Tags: []string{"search"}, Failure: state.Failure{Type: "latency", LatencyMs: 100}})
+	rs.AddRule(state.Rule{ID: "c", Name: "refund-503", Target: "http://pay.local/refunds", Tags: []string{"Payments"}, Failure: state.Failure{Type: "error", ErrorCode: 503}})
+	rm := NewRuleManager(rs)
+
+	out := captureStdout(t, func() { listRules(rm, "PAYMENTS") })
+	if !strings.Contains(out, "Found 2 rule(s)") || !strings.Contains(out, "checkout-500") || !strings.Contains(out, "refund-503") || strings.Contains(out, "search-slow") {
+		t.Errorf("--tag PAYMENTS listed:\n%s\nwant both payments rules only", out)
+	}
+	if out := captureStdout(t, func() { listRules(rm, "release-9") }); !strings.Contains(out, "No rules tagged 'release-9'") {
+		t.Errorf("unknown tag printed:\n%s", out)
+	}
+	if out := captureStdout(t, func() { listRules(rm, "") }); !strings.Contains(out, "Found 3 rule(s)") {
+		t.Errorf("no tag listed:\n%s\nwant every rule", out)
+	}
+}
+
+func TestRulesTestReportsTheProxysChoice(t *testing.T) {
+	rs := state.NewRuleState(nil, "")
+	for _, rule := range []state.Rule{
+		{ID: "1", Name: "api-500", Target: "http://api.local", Enabled: true, Failure: state.Failure{Type: "error", ErrorCode: 500}},
+		{ID: "2", Name: "create-slow", Target: "http://api.local/users", Method: "POST", Enabled: true, Failure: state.Failure{Type: "latency", LatencyMs: 300}},
+		{ID: "3", Name: "beta-503", Target: "http://api.local/users", Priority: 5, HeaderMatch: map[string]string{"X-Tenant": "beta"}, Enabled: true, Failure: state.Failure{Type: "error", ErrorCode: 503}},
+		{ID: "4", Name: "debug-off", Target: "http://api.local/users", QueryMatch: map[string]string{"debug": "1"}, Failure: state.Failure{Type: "error", ErrorCode: 418}},
+	} {
+		rs.AddRule(rule)
+	}
+	rm := NewRuleManager(rs)
+
+	for _, tc := range []struct {
+		target, method string
+		headers        []string
+		want           string // rule name, empty for none
+	}{
+		{"http://api.local/users", "get", nil, "api-500"},
+		{"http://api.local/users", "post", nil, "create-slow"},
+		{"http://api.local/users", "post", []string{"X-Tenant: beta"}, "beta-503"},
+		{"http://api.local/users?debug=1", "get", nil, "api-500"}, // disabled rule
+		{"http://other.local/users", "get", nil, ""},
+	} {
+		out := captureStdout(t, func() { testRuleMatch(rm, tc.target, tc.method, "", tc.headers) })
+		header := http.Header{}
+		for _, h := range tc.headers {
+			name, value, _ := strings.Cut(h, ":")
+			header.Set(name, strings.TrimSpace(value))
+		}
+		found, ok := rs.FindRuleForRequest(state.Request{Target: tc.target, Method: strings.ToUpper(tc.method), Header: header})
+		if tc.want == "" {
+			if ok || !strings.Contains(out, "No enabled rule matches") {
+				t.Errorf("%s %s: printed\n%s\nwant no match", tc.method, tc.target, out)
+			}
+			continue
+		}
+		if !ok || found.Name != tc.want {
+			t.Fatalf("%s %s %v: proxy picks %+v, want %s", tc.method, tc.target, tc.headers, found, tc.want)
+		}
+		if !strings.Contains(out, "✅ Matched rule "+ruleLabel(rm, *found)+"\n") {
+			t.Errorf("%s %s %v: printed\n%s\nwant %s", tc.method, tc.target, tc.headers, out, ruleLabel(rm, *found))
+		}
+	}
+
+	out := captureStdout(t, func() { testRuleMatch(rm, "http://api.local/users", "POST", "", []string{"X-Tenant: beta"}) })
+	if !strings.Contains(out, "chosen over 2 other matching rule(s) by priority 5") {
+		t.Errorf("overlapping rules printed\n%s\nwant the two rules it was chosen over", out)
+	}
+}
+
+func TestCreateRulesFromCodeFixture(t *testing.T) {
+	result, err := codeanalysis.AnalyzeDirectory("../codeanalysis/testdata/webapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, skipped := codeEndpoints(result, "")
+	if skipped != 3 || !slices.Equal(endpoints, []codeEndpoint{
+		{"GET", "https://pay.example.com/v1/charges"},
+		{"POST", "https://pay.example.com/v1/charges"},
+		{"DELETE", "https://shop.example.com/api/orders/"},
+	}) {
+		t.Errorf("without a base URL: %v (%d skipped), want the absolute URLs and 3 relative ones skipped", endpoints, skipped)
+	}
+
+	endpoints, skipped = codeEndpoints(result, "http://localhost:3000/")
+	if skipped != 0 || len(endpoints) != 6 || endpoints[0] != (codeEndpoint{"GET", "http://localhost:3000/api/health"}) {
+		t.Errorf("with a base URL: %v (%d skipped), want every endpoint with paths joined to it", endpoints, skipped)
+	}
+
+	rs := state.NewRuleState(nil, "")
+	for range 2 {
+		for _, e := range endpoints {
+			rs.AddRuleIfNew(e.rule())
+		}
+	}
+	rules := rs.GetRules()
+	if len(rules) != len(endpoints) {
+		t.Fatalf("%d rules after adding the endpoints twice, want %d", len(rules), len(endpoints))
+	}
+	for _, rule := range rules {
+		if rule.Enabled || rule.Failure.Type != "latency" || rule.Failure.LatencyMs != 2000 || rule.Method == "" {
+			t.Errorf("rule %+v, want a disabled 2s latency rule for one method", rule)
+		}
+	}
+}
+
+func TestCompareMatchesParametrizedPaths(t *testing.T) {
+	dir := t.TempDir()
+	spec := `openapi: 3.0.0
+info: {title: Shop, version: "1.0"}
+paths:
+  /users/{id}:
+    get:
+      responses: {"200": {description: ok}}
+  /orders:
+    post:
+      responses: {"201": {description: created}}
+  /health:
+    get:
+      responses: {"200": {description: ok}}
+`
+	code := `fetch("https://api.example.com/users/42");
+fetch("https://api.example.com/users/43");
+axios.post("/orders", order);
+fetch("/legacy/report");
+`
+	for name, content := range map[string]string{"openapi.yaml": spec, "src/app.js": code} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	out := captureStdout(t, func() { compareEndpoints("src") })
+	for _, want := range []string{
+		"Matched after normalizing path parameters (1):\n  GET /users/{id} ≈ https://api.example.com/users/42\n",
+		"Endpoints in OpenAPI but not used in code (1):",
+		"/health",
+		"Endpoints used in code but not in OpenAPI (1):",
+		"/legacy/report",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("compare output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "/users/43") {
+		t.Errorf("a second call to the same parametrized endpoint was listed:\n%s", out)
+	}
+}
+
+func TestCreateRulesByOperationID(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "shop.yaml")
+	if err := os.WriteFile(spec, []byte(`swagger: "2.0"
+info: {title: Shop, version: "1"}
+host: shop.local
+schemes: [http]
+paths:
+  /users/{id}:
+    get: {operationId: getUser, responses: {"200": {description: ok}}}
+  /orders:
+    get: {operationId: listOrders, responses: {"200": {description: ok}}}
+    post: {operationId: createOrder, responses: {"201": {description: created}}}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rs := state.NewRuleState(nil, "")
+	rm := NewRuleManager(rs)
+
+	out := captureStdout(t, func() {
+		createRulesFromEndpoints(rm, spec, false, []string{"getUser", "nope", "createOrder", "missing"})
+	})
+	if !strings.Contains(out, "unknown operationId(s): nope, missing") || len(rs.GetRules()) != 0 {
+		t.Errorf("unknown operationIds: printed\n%s\nand created %d rule(s), want an error and none", out, len(rs.GetRules()))
+	}
+
+	out = captureStdout(t, func() { createRulesFromEndpoints(rm, spec, false, []string{"createOrder", "getUser"}) })
+	if !strings.Contains(out, "Created rule for POST /orders\n") || !strings.Contains(out, "Created rule for GET /users/{id}\n") || strings.Contains(out, "GET /orders") {
+		t.Errorf("printed\n%s\nwant rules for createOrder and getUser only", out)
+	}
+	var targets []string
+	for _, rule := range rs.GetRules() {
+		targets = append(targets, rule.Target)
+	}
+	slices.Sort(targets)
+	if len(targets) != 2 || targets[0] != "http://shop.local/orders" || !strings.HasPrefix(targets[1], "http://shop.local/users/") {
+		t.Errorf("rule targets %v, want the orders and user endpoints", targets)
+	}
+}
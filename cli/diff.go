@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"faultline/state"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// ruleChange pairs a current rule with its differing counterpart in a file.
+type ruleChange struct {
+	from, to state.Rule
+	fields   []string
+}
+
+// diffRules compares rules from a file with the current ones by content,
+// ignoring IDs. Rules pair up when they are duplicates (see Rule.Duplicates),
+// or else when they share target and method; paired rules that differ are
+// changes. Unpaired file rules are additions, unpaired current rules removals.
+func diffRules(current, incoming []state.Rule) (added, removed []state.Rule, changed []ruleChange, unchanged int) {
+	paired := make([]bool, len(current))
+	partner := make([]int, len(incoming))
+	for i := range partner {
+		partner[i] = -1
+	}
+
+	pair := func(match func(cur, in state.Rule) bool) {
+		for i, in := range incoming {
+			if partner[i] >= 0 {
+				continue
+			}
+			for j, cur := range current {
+				if !paired[j] && match(cur, in) {
+					partner[i], paired[j] = j, true
+					break
+				}
+			}
+		}
+	}
+	pair(func(cur, in state.Rule) bool { return cur.Duplicates(in) })
+	pair(func(cur, in state.Rule) bool {
+		return cur.Target == in.Target && strings.EqualFold(cur.HostMatch, in.HostMatch) && strings.EqualFold(cur.Method, in.Method)
+	})
+
+	for i, in := range incoming {
+		if partner[i] < 0 {
+			added = append(added, in)
+			continue
+		}
+		cur := current[partner[i]]
+		if fields := changedFields(cur, in); len(fields) > 0 {
+			changed = append(changed, ruleChange{from: cur, to: in, fields: fields})
+		} else {
+			unchanged++
+		}
+	}
+	for j, cur := range current {
+		if !paired[j] {
+			removed = append(removed, cur)
+		}
+	}
+	return added, removed, changed, unchanged
+}
+
+// changedFields lists the fields that differ between two rules, ignoring IDs.
+func changedFields(a, b state.Rule) []string {
+	var fields []string
+	diff := func(name string, x, y any) {
+		if !reflect.DeepEqual(x, y) {
+			fields = append(fields, name)
+		}
+	}
+	diff("name", a.Name, b.Name)
+	diff("failure", a.Failure, b.Failure)
+	diff("enabled", a.Enabled, b.Enabled)
+	diff("category", a.EffectiveCategory(), b.EffectiveCategory())
+	diff("priority", a.Priority, b.Priority)
+	diff("weight", a.Weight, b.Weight)
+	diff("bodyMatch", a.BodyMatch, b.BodyMatch)
+	diff("headerMatch", emptyToNil(a.HeaderMatch), emptyToNil(b.HeaderMatch))
+	diff("queryMatch", emptyToNil(a.QueryMatch), emptyToNil(b.QueryMatch))
+	diff("responseMatch", a.ResponseMatch, b.ResponseMatch)
+	diff("tags", strings.Join(a.Tags, ","), strings.Join(b.Tags, ","))
+	return fields
+}
+
+// emptyToNil treats empty and missing match conditions alike.
+func emptyToNil(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// diffRulesFile prints how the rules in a file differ from the current ones.
+func diffRulesFile(rm *RuleManager, filename string) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		errorColor.Printf("❌ Failed to read file: %v\n", err)
+		return
+	}
+	incoming, err := unmarshalRules(filename, data)
+	if err != nil {
+		errorColor.Printf("❌ Failed to parse %s: %v\n", filename, err)
+		return
+	}
+
+	added, removed, changed, unchanged := diffRules(rm.ruleState.GetRules(), incoming)
+	headerColor.Printf("\n🔀 Current rules vs '%s'\n\n", filename)
+
+	if len(added)+len(removed)+len(changed) == 0 {
+		successColor.Printf("✅ No differences (%d identical rule(s))\n\n", unchanged)
+		return
+	}
+	for _, rule := range added {
+		successColor.Printf("+ %s %s\n", ruleDiffLabel(rule), rule.Failure.Summary())
+	}
+	for _, c := range changed {
+		warningColor.Printf("~ %s (%s)\n", ruleDiffLabel(c.to), strings.Join(c.fields, ", "))
+		for _, field := range c.fields {
+			if field == "failure" {
+				subtleColor.Printf("    failure: %s → %s\n", describeFailure(c.from.Failure), describeFailure(c.to.Failure))
+			}
+		}
+	}
+	for _, rule := range removed {
+		errorColor.Printf("- %s %s\n", ruleDiffLabel(rule), rule.Failure.Summary())
+	}
+
+	fmt.Println()
+	infoColor.Printf("💡 %d added, %d changed, %d only in current rules, %d unchanged\n", len(added), len(changed), len(removed), unchanged)
+	subtleColor.Println("   'rules import' adds every rule that isn't a duplicate; it never modifies or removes existing ones.")
+	fmt.Println()
+}
+
+// ruleDiffLabel names a rule by method and target.
+func ruleDiffLabel(rule state.Rule) string {
+	method := rule.Method
+	if method == "" {
+		method = "*"
+	}
+	return fmt.Sprintf("%s %s", strings.ToUpper(method), rule.TargetLabel())
+}
+
+// describeFailure formats a failure as its type and summary.
+func describeFailure(f state.Failure) string {
+	if summary := f.Summary(); summary != "" {
+		return f.Type + " (" + summary + ")"
+	}
+	return f.Type
+}
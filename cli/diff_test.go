@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"faultline/state"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestDiffRules(t *testing.T) {
+	checkout := state.Rule{ID: "1", Target: "http://pay.local/checkout", Method: "POST", Enabled: true, Failure: state.Failure{Type: "error", ErrorCode: 500}}
+	search := state.Rule{ID: "2", Target: "http://search.local", Enabled: true, Failure: state.Failure{Type: "latency", LatencyMs: 100}}
+	orders := state.Rule{ID: "3", Target: "http://orders.local", Enabled: true, Failure: state.Failure{Type: "timeout", LatencyMs: 5000}}
+	current := []state.Rule{checkout, search, orders}
+
+	sameCheckout := checkout
+	sameCheckout.ID = "other"
+	slowerSearch := search
+	slowerSearch.ID = ""
+	slowerSearch.Enabled = false
+	slowerSearch.Failure.LatencyMs = 300
+	slowerSearch.Tags = []string{"search"}
+	inventory := state.Rule{Target: "http://inventory.local", Failure: state.Failure{Type: "error", ErrorCode: 503}}
+	incoming := []state.Rule{inventory, slowerSearch, sameCheckout}
+
+	added, removed, changed, unchanged := diffRules(current, incoming)
+	if len(added) != 1 || added[0].Target != inventory.Target {
+		t.Errorf("added %+v, want the inventory rule", added)
+	}
+	if len(removed) != 1 || removed[0].ID != orders.ID {
+		t.Errorf("removed %+v, want the orders rule", removed)
+	}
+	if len(changed) != 1 || changed[0].from.ID != search.ID || !slices.Equal(changed[0].fields, []string{"failure", "enabled", "tags"}) {
+		t.Errorf("changed %+v, want the search rule's failure, enabled and tags", changed)
+	}
+	if unchanged != 1 {
+		t.Errorf("%d unchanged, want 1 (IDs are ignored)", unchanged)
+	}
+
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	data, err := yaml.Marshal(incoming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rs := state.NewRuleState(nil, "")
+	for _, rule := range current {
+		rs.AddRule(rule)
+	}
+	out := captureStdout(t, func() { diffRulesFile(NewRuleManager(rs), file) })
+	for _, want := range []string{
+		"+ * http://inventory.local",
+		"~ * http://search.local (failure, enabled, tags)",
+		"failure: latency (100ms delay) → latency (300ms delay)",
+		"- * http://orders.local",
+		"1 added, 1 changed, 1 only in current rules, 1 unchanged",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("diff output lacks %q:\n%s", want, out)
+		}
+	}
+}
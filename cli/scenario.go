@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"encoding/json"
+	"faultline/state"
+	"fmt"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// newScenarioCommand builds the `scenario` command, which loads and unloads
+// named bundles of rules together.
+func newScenarioCommand(rm *RuleManager) *cobra.Command {
+	scenarioCmd := &cobra.Command{
+		Use:   "scenario",
+		Short: "Load and unload chaos scenarios (named bundles of rules)",
+		Long:  "A scenario file has a name, an optional description and a list of rules in the same format as 'rules export'. Loading it enables all its rules; unloading removes them again.",
+		Run: func(cmd *cobra.Command, args []string) {
+			PrintBanner()
+			_ = cmd.Help()
+		},
+	}
+
+	loadCmd := &cobra.Command{
+		Use:   "load <file>",
+		Short: "Add and enable every rule of a scenario file (JSON or YAML by extension)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			loadScenario(rm, args[0])
+		},
+	}
+
+	var keep bool
+	unloadCmd := &cobra.Command{
+		Use:   "unload <name>",
+		Short: "Remove the rules of a loaded scenario",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			unloadScenario(rm, args[0], keep)
+		},
+	}
+	unloadCmd.Flags().BoolVar(&keep, "keep", false, "Disable the scenario's rules instead of removing them")
+
+	enableCmd := &cobra.Command{
+		Use:   "enable <name>",
+		Short: "Re-enable the rules of a loaded scenario",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			toggleScenario(rm, args[0], true)
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List loaded scenarios",
+		Aliases: []string{"ls"},
+		Run: func(cmd *cobra.Command, args []string) {
+			listScenarios(rm)
+		},
+	}
+
+	scenarioCmd.AddCommand(loadCmd, unloadCmd, enableCmd, listCmd)
+	return scenarioCmd
+}
+
+// loadScenario reads a scenario file and loads its rules.
+func loadScenario(rm *RuleManager, filename string) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		errorColor.Printf("❌ Failed to read file: %v\n", err)
+		return
+	}
+
+	var sc state.Scenario
+	if isYAMLFile(filename) {
+		err = yaml.Unmarshal(data, &sc)
+	} else {
+		err = json.Unmarshal(data, &sc)
+	}
+	if err != nil {
+		errorColor.Printf("❌ Failed to parse %s: %v\n", filename, err)
+		return
+	}
+
+	rules, err := rm.ruleState.LoadScenario(sc)
+	if err != nil {
+		errorColor.Printf("❌ Invalid scenario %s: %v\n", filename, err)
+		return
+	}
+
+	successColor.Printf("✅ Loaded scenario '%s' with %d enabled rule(s)\n", sc.Name, len(rules))
+	if sc.Description != "" {
+		subtleColor.Printf("   %s\n", sc.Description)
+	}
+	for _, rule := range rules {
+		infoColor.Printf("   🟢 %s (%s)\n", rule.TargetLabel(), rule.Failure.Type)
+	}
+}
+
+// unloadScenario removes (or, with keep, disables) the rules of a scenario.
+func unloadScenario(rm *RuleManager, name string, keep bool) {
+	if keep {
+		toggleScenario(rm, name, false)
+		return
+	}
+	n := rm.ruleState.RemoveScenario(name)
+	if n == 0 {
+		errorColor.Printf("❌ No rules found for scenario '%s'\n", name)
+		return
+	}
+	successColor.Printf("✅ Unloaded scenario '%s' (%d rule(s) removed)\n", name, n)
+}
+
+// toggleScenario enables or disables every rule of a scenario.
+func toggleScenario(rm *RuleManager, name string, enable bool) {
+	n := rm.ruleState.SetScenarioEnabled(name, enable)
+	if n == 0 {
+		errorColor.Printf("❌ No rules found for scenario '%s'\n", name)
+		return
+	}
+	action, emoji := "enabled", "🟢"
+	if !enable {
+		action, emoji = "disabled", "🔴"
+	}
+	successColor.Printf("%s Scenario '%s' %s (%d rule(s))\n", emoji, name, action, n)
+}
+
+// listScenarios prints the loaded scenarios and how many of their rules are enabled.
+func listScenarios(rm *RuleManager) {
+	scenarios := rm.ruleState.Scenarios()
+	if len(scenarios) == 0 {
+		warningColor.Println("⚠️  No scenarios loaded")
+		infoColor.Println("💡 Use 'faultline scenario load <file>' to load one")
+		return
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header("Scenario", "Rules", "Enabled")
+	for _, s := range scenarios {
+		table.Append([]string{s.Name, fmt.Sprintf("%d", s.Rules), fmt.Sprintf("%d/%d", s.Enabled, s.Rules)})
+	}
+	table.Render()
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"faultline/state"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadAndUnloadScenario(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db-outage.yaml")
+	yaml := `name: db-outage
+description: Primary database unreachable
+rules:
+  - name: orders-503
+    target: http://orders.local
+    failure: {type: error, errorCode: 503}
+  - target: http://inventory.local
+    failure: {type: latency, latencyMs: 2000}
+  - target: http://payments.local
+    method: POST
+    failure: {type: timeout, latencyMs: 5000}
+`
+	if err := os.WriteFile(file, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(state.Rule{ID: "own", Target: "http://search.local", Failure: state.Failure{Type: "latency", LatencyMs: 100}})
+	rm := NewRuleManager(rs)
+	summary := func() state.ScenarioSummary {
+		t.Helper()
+		for _, s := range rs.Scenarios() {
+			if s.Name == "db-outage" {
+				return s
+			}
+		}
+		return state.ScenarioSummary{}
+	}
+
+	for range 2 { // loading again replaces the earlier load
+		out := captureStdout(t, func() { loadScenario(rm, file) })
+		if !strings.Contains(out, "Loaded scenario 'db-outage' with 3 enabled rule(s)") || !strings.Contains(out, "Primary database unreachable") {
+			t.Errorf("load printed:\n%s", out)
+		}
+		if s := summary(); s.Rules != 3 || s.Enabled != 3 {
+			t.Errorf("after load: %+v, want 3 enabled rules", s)
+		}
+		if n := len(rs.GetRules()); n != 4 {
+			t.Errorf("after load: %d rules stored, want 3 plus the unrelated one", n)
+		}
+	}
+
+	captureStdout(t, func() { unloadScenario(rm, "db-outage", true) })
+	if s := summary(); s.Rules != 3 || s.Enabled != 0 {
+		t.Errorf("after unload --keep: %+v, want 3 disabled rules", s)
+	}
+	captureStdout(t, func() { toggleScenario(rm, "db-outage", true) })
+	if s := summary(); s.Enabled != 3 {
+		t.Errorf("after enable: %+v, want 3 enabled rules", s)
+	}
+
+	if out := captureStdout(t, func() { unloadScenario(rm, "db-outage", false) }); !strings.Contains(out, "Unloaded scenario 'db-outage' (3 rule(s) removed)") {
+		t.Errorf("unload printed:\n%s", out)
+	}
+	if rules := rs.GetRules(); len(rules) != 1 || rules[0].ID != "own" {
+		t.Errorf("after unload: %+v, want only the unrelated rule", rules)
+	}
+	if out := captureStdout(t, func() { unloadScenario(rm, "db-outage", false) }); !strings.Contains(out, "No rules found for scenario 'db-outage'") {
+		t.Errorf("second unload printed:\n%s", out)
+	}
+}
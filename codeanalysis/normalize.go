@@ -0,0 +1,58 @@
+package codeanalysis
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// paramPlaceholder replaces path segments that vary per request.
+const paramPlaceholder = "{}"
+
+var (
+	numericSegment = regexp.MustCompile(`^\d+$`)
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// NormalizePath reduces a URL or path from code or an OpenAPI spec to a
+// canonical path so templated and concrete forms compare equal:
+// "/users/{id}", "/users/${id}", "/users/:id" and
+// "https://api.example.com/users/123?x=1" all become "/users/{}".
+func NormalizePath(raw string) string {
+	p := raw
+	// A leading template variable is usually the base URL: ${API_URL}/users
+	if strings.HasPrefix(p, "${") {
+		if i := strings.Index(p, "}"); i >= 0 {
+			p = p[i+1:]
+		}
+	}
+	p, _, _ = strings.Cut(p, "?")
+	p, _, _ = strings.Cut(p, "#")
+	if strings.Contains(p, "://") {
+		if u, err := url.Parse(p); err == nil {
+			p = u.Path
+		}
+	}
+
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i, s := range segments {
+		if isParamSegment(s) {
+			segments[i] = paramPlaceholder
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// isParamSegment reports whether a path segment is a parameter placeholder
+// or looks like a concrete identifier.
+func isParamSegment(s string) bool {
+	switch {
+	case strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}"),
+		strings.Contains(s, "${"),
+		strings.HasPrefix(s, ":") && len(s) > 1,
+		numericSegment.MatchString(s),
+		uuidSegment.MatchString(s):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package codeanalysis
+
+import "testing"
+
+func TestNormalizePath(t *testing.T) {
+	for raw, want := range map[string]string{
+		"/users/{id}":             "/users/{}",
+		"/users/${userId}/orders": "/users/{}/orders",
+		"/users/:id":              "/users/{}",
+		"/users/123":              "/users/{}",
+		"/users/550e8400-e29b-41d4-a716-446655440000": "/users/{}",
+		"https://api.example.com/users/42?expand=1":   "/users/{}",
+		"${API_URL}/users/7#top":                      "/users/{}",
+		"/users/me/":                                  "/users/me",
+		"/v2/users":                                   "/v2/users",
+		"/":                                           "/",
+	} {
+		if got := NormalizePath(raw); got != want {
+			t.Errorf("NormalizePath(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
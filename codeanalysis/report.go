@@ -0,0 +1,115 @@
+package codeanalysis
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteReport writes the analysis result to path. The format follows the
+// extension: .csv lists endpoints, .html renders a summary report, and
+// anything else is written as JSON.
+func WriteReport(path string, result *CodeAnalysisResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		err = WriteCSV(f, result)
+	case ".html", ".htm":
+		err = WriteHTML(f, result)
+	default:
+		err = WriteJSON(f, result)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// WriteJSON writes the full result as indented JSON.
+func WriteJSON(w io.Writer, result *CodeAnalysisResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// WriteCSV writes one row per discovered endpoint.
+func WriteCSV(w io.Writer, result *CodeAnalysisResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"method", "url", "file", "line", "type", "context"}); err != nil {
+		return err
+	}
+	for _, e := range result.Endpoints {
+		if err := cw.Write([]string{e.Method, e.URL, e.File, strconv.Itoa(e.Line), e.Type, e.Context}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// methodCount is a row of the HTML report's methods table.
+type methodCount struct {
+	Method string
+	Count  int
+}
+
+// WriteHTML renders a standalone HTML report of the discovered endpoints.
+func WriteHTML(w io.Writer, result *CodeAnalysisResult) error {
+	methods := make([]methodCount, 0, len(result.MethodCounts))
+	for m, n := range result.MethodCounts {
+		methods = append(methods, methodCount{m, n})
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Method < methods[j].Method })
+
+	return reportTemplate.Execute(w, struct {
+		*CodeAnalysisResult
+		Methods []methodCount
+	}{result, methods})
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>FaultLine code analysis: {{.Source}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2rem; }
+th, td { border: 1px solid #ddd; padding: 0.4rem 0.8rem; text-align: left; }
+th { background: #f4f4f4; }
+code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>FaultLine code analysis: {{.Source}}</h1>
+<p>{{len .Endpoints}} endpoint(s) in {{len .Files}} file(s), {{.TotalLines}} line(s) scanned.</p>
+
+<h2>HTTP methods</h2>
+<table>
+<tr><th>Method</th><th>Count</th></tr>
+{{range .Methods}}<tr><td>{{.Method}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+
+<h2>Unique URLs</h2>
+<ul>
+{{range .UniqueURLs}}<li><code>{{.}}</code></li>
+{{end}}</ul>
+
+<h2>Endpoints</h2>
+<table>
+<tr><th>Method</th><th>URL</th><th>File</th><th>Line</th><th>Type</th></tr>
+{{range .Endpoints}}<tr><td>{{.Method}}</td><td><code>{{.URL}}</code></td><td>{{.File}}</td><td>{{.Line}}</td><td>{{.Type}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
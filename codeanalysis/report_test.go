@@ -0,0 +1,98 @@
+package codeanalysis
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteReportJSON(t *testing.T) {
+	result, err := AnalyzeDirectory("testdata/webapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, e := range result.Endpoints {
+		found = append(found, e.Method+" "+e.URL)
+	}
+	want := []string{
+		"GET /api/health",
+		"GET /api/orders",
+		"POST /api/orders",
+		"GET https://pay.example.com/v1/charges",
+		"POST https://pay.example.com/v1/charges",
+		"DELETE https://shop.example.com/api/orders/",
+	}
+	if !slices.Equal(found, want) {
+		t.Fatalf("fixture endpoints %q, want %q", found, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := WriteReport(path, result); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded CodeAnalysisResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("report isn't JSON: %v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(&decoded, result) {
+		t.Errorf("JSON report decodes to\n%+v\nwant\n%+v", decoded, *result)
+	}
+	if decoded.MethodCounts["GET"] != 3 || decoded.MethodCounts["POST"] != 2 || decoded.MethodCounts["DELETE"] != 1 {
+		t.Errorf("methodCounts %v", decoded.MethodCounts)
+	}
+	if !slices.Equal(decoded.Files, []string{"testdata/webapp/src/api.js", "testdata/webapp/src/components/Status.jsx"}) {
+		t.Errorf("files %v", decoded.Files)
+	}
+}
+
+func TestWriteReportByExtension(t *testing.T) {
+	result, err := AnalyzeDirectory("testdata/webapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "report.csv")
+	if err := WriteReport(csvPath, result); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("report.csv: %v", err)
+	}
+	if len(rows) != len(result.Endpoints)+1 || strings.Join(rows[0], ",") != "method,url,file,line,type,context" {
+		t.Errorf("report.csv has %d rows starting %v, want a header and one row per endpoint", len(rows), rows[0])
+	}
+	if got := rows[3]; got[0] != "POST" || got[1] != "/api/orders" || got[3] != "10" || got[4] != "axios-post" {
+		t.Errorf("report.csv row %v, want the axios.post call on line 10", got)
+	}
+
+	htmlPath := filepath.Join(dir, "report.HTML")
+	if err := WriteReport(htmlPath, result); err != nil {
+		t.Fatal(err)
+	}
+	html, err := os.ReadFile(htmlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<!DOCTYPE html>", "6 endpoint(s) in 2 file(s)", "<code>https://pay.example.com/v1/charges</code>"} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("report.HTML lacks %q", want)
+		}
+	}
+}
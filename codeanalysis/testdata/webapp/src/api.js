@@ -0,0 +1,19 @@
+import axios from "axios";
+
+// Orders and payments used by the checkout page.
+export async function listOrders() {
+  const res = await fetch("/api/orders");
+  return res.json();
+}
+
+export function createOrder(order) {
+  return axios.post("/api/orders", order);
+}
+
+export function cancelOrder(id) {
+  return axios.delete("https://shop.example.com/api/orders/" + id);
+}
+
+export function charge(payment) {
+  return fetch("https://pay.example.com/v1/charges", { method: "post", body: JSON.stringify(payment) });
+}
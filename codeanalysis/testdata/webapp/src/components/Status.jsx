@@ -0,0 +1,4 @@
+export function Status() {
+  // <Card endpoint="/api/health" />
+  return <Card endpoint="/api/health" title="Health" />;
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// openPTY returns the master and the terminal end of a new pseudo-terminal.
+func openPTY(t *testing.T) (master, tty *os.File) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+	var n, unlock uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		t.Fatal(errno)
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		t.Fatal(errno)
+	}
+	tty, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master, tty
+}
+
+func TestColorOnlyOnATerminal(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+	dir := t.TempDir()
+
+	// run returns what "rules list" prints, to a terminal or to a pipe.
+	run := func(terminal bool, env []string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(bin, append([]string{"rules", "list"}, args...)...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "TERM=xterm", "NO_COLOR=")
+		cmd.Env = append(cmd.Env, env...)
+		if !terminal {
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(out)
+		}
+		master, tty := openPTY(t)
+		cmd.Stdout, cmd.Stderr = tty, tty
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		tty.Close()
+		// Reading fails with EIO once the command exits and closes its end.
+		out, _ := io.ReadAll(master)
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	if out := run(true, nil); !strings.Contains(out, "\x1b[") {
+		t.Fatalf("terminal: no color codes in %q", out)
+	}
+	for name, out := range map[string]string{
+		"piped":      run(false, nil),
+		"NO_COLOR":   run(true, []string{"NO_COLOR=1"}),
+		"--no-color": run(true, nil, "--no-color"),
+	} {
+		if strings.Contains(out, "\x1b[") || !strings.Contains(out, "No rules configured yet") {
+			t.Errorf("%s: got %q, want the message without color codes", name, out)
+		}
+	}
+}
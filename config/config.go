@@ -1,16 +1,39 @@
 package config
 
-import (
-	"os"
-
-	"gopkg.in/yaml.v2"
-)
-
 // Config is the main configuration structure.
 type Config struct {
+	// Include lists further config files (relative to this one, globs
+	// allowed) whose rules and tcpRules are merged into this config.
+	Include  []string    `yaml:"include,omitempty"`
 	Rules    []Rule      `yaml:"rules"`
 	TCPRules []TCPRule   `yaml:"tcpRules"`
 	OpenAPI  OpenAPIConf `yaml:"openapi"`
+	Server   ServerConf  `yaml:"server"`
+}
+
+// ServerConf pins the HTTP listeners so a shared config file can fully
+// describe a setup. Zero values fall back to the command-line flags.
+type ServerConf struct {
+	ProxyPort   int      `yaml:"proxyPort"`
+	APIPort     int      `yaml:"apiPort"`
+	CORSOrigins []string `yaml:"corsOrigins"` // origins allowed to call the control API
+
+	// AllowedHosts and BlockedHosts restrict which upstreams the HTTP proxy
+	// forwards to, so it can't be used as an open proxy.
+	AllowedHosts []string `yaml:"allowedHosts"`
+	BlockedHosts []string `yaml:"blockedHosts"`
+
+	// MatchStrategy chooses between overlapping rules: "priority" (default)
+	// or "weighted".
+	MatchStrategy string `yaml:"matchStrategy"`
+
+	// PassthroughCORS forwards CORS preflight requests to the upstream
+	// instead of answering them with permissive headers.
+	PassthroughCORS bool `yaml:"passthroughCors"`
+
+	// ShutdownTimeoutSeconds is how long a graceful shutdown waits for
+	// in-flight requests before closing them.
+	ShutdownTimeoutSeconds int `yaml:"shutdownTimeoutSeconds"`
 }
 
 // OpenAPIConf contains OpenAPI/Swagger discovery configuration
@@ -38,31 +61,63 @@ type Failure struct {
 // TCPRule defines a TCP-level proxy for DB/network fault injection
 type TCPRule struct {
 	Listen   string    `yaml:"listen"`   // e.g., 127.0.0.1:55432
-	Upstream string    `yaml:"upstream"` // e.g., localhost:5432
+	Upstream string    `yaml:"upstream"` // e.g., localhost:5432, or EchoUpstream
 	Faults   TCPFaults `yaml:"faults"`
+	// Protocol enables protocol-aware faults ("postgres" or "mysql"); empty proxies bytes opaquely.
+	Protocol string `yaml:"protocol,omitempty"`
 }
 
+// EchoUpstream as a TCPRule's upstream sends the client's bytes straight
+// back, with the rule's faults applied, so faults can be tried out without
+// a database.
+const EchoUpstream = "echo"
+
 // TCPFaults contains knobs to simulate network failures at L4
 type TCPFaults struct {
-	LatencyMs         int     `yaml:"latency_ms,omitempty"`
-	DropProbability   float64 `yaml:"drop_probability,omitempty"`
-	ResetProbability  float64 `yaml:"reset_probability,omitempty"`
-	BandwidthKbps     int     `yaml:"bandwidth_kbps,omitempty"`
-	RefuseConnections bool    `yaml:"refuse_connections,omitempty"`
+	// LatencyMs delays every byte by this long in each direction, like a
+	// slow network link; it doesn't depend on how the stream is chunked.
+	LatencyMs int `yaml:"latency_ms,omitempty" json:"latencyMs,omitempty"`
+	// LatencyRampMsPerSec adds this much to the per-byte delay for every
+	// second the connection has been open, modelling a degrading backend.
+	LatencyRampMsPerSec int `yaml:"latency_ramp_ms_per_sec,omitempty" json:"latencyRampMsPerSec,omitempty"`
+	// DropProbability is the chance per chunk that data is lost; as TCP
+	// can't recover from that, the connection is reset.
+	DropProbability  float64 `yaml:"drop_probability,omitempty" json:"dropProbability,omitempty"`
+	ResetProbability float64 `yaml:"reset_probability,omitempty" json:"resetProbability,omitempty"`
+	// CorruptProbability is the chance per chunk that one of its bytes is
+	// altered in transit. Unlike a drop, the connection stays up and the
+	// damage is left for the protocol to notice.
+	CorruptProbability float64 `yaml:"corrupt_probability,omitempty" json:"corruptProbability,omitempty"`
+	BandwidthKbps      int     `yaml:"bandwidth_kbps,omitempty" json:"bandwidthKbps,omitempty"`
+	RefuseConnections  bool    `yaml:"refuse_connections,omitempty" json:"refuseConnections,omitempty"`
+	// SimulateUpstreamDown accepts clients but never dials the upstream,
+	// resetting them as if it were unreachable. RefuseConnections instead
+	// closes clients before anything else happens.
+	SimulateUpstreamDown bool `yaml:"simulate_upstream_down,omitempty" json:"simulateUpstreamDown,omitempty"`
+	// MaxConnections models a saturated pool: once more clients are connected,
+	// new ones are stalled for AcceptDelayMs, or refused when no delay is set.
+	MaxConnections int `yaml:"max_connections,omitempty" json:"maxConnections,omitempty"`
+	AcceptDelayMs  int `yaml:"accept_delay_ms,omitempty" json:"acceptDelayMs,omitempty"`
+	// BufferSize is the read size in bytes (default 32 KiB); drops and
+	// throttling act on chunks of at most this size.
+	BufferSize int `yaml:"buffer_size,omitempty" json:"bufferSize,omitempty"`
+	// IdleTimeoutMs closes connections with no traffic in either direction for this long.
+	IdleTimeoutMs int `yaml:"idle_timeout_ms,omitempty" json:"idleTimeoutMs,omitempty"`
+	// QueryError answers queries with a database error; it needs a Protocol.
+	QueryError QueryError `yaml:"query_error,omitempty" json:"queryError,omitempty"`
 }
 
-// LoadConfig reads a YAML file and returns a Config struct.
-func LoadConfig(filePath string) (*Config, error) {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, err
-	}
-
-	var cfg Config
-	err = yaml.Unmarshal(data, &cfg)
-	if err != nil {
-		return nil, err
-	}
+// QueryError describes the database error returned to a query by
+// protocol-aware TCP rules instead of forwarding it upstream.
+type QueryError struct {
+	Code        string  `yaml:"code,omitempty" json:"code,omitempty"`               // Postgres SQLSTATE (57014) or MySQL error number (1205)
+	SQLState    string  `yaml:"sql_state,omitempty" json:"sqlState,omitempty"`      // MySQL only; defaults to the code's usual SQLSTATE
+	Message     string  `yaml:"message,omitempty" json:"message,omitempty"`         // defaults to the server's usual text for Code
+	Probability float64 `yaml:"probability,omitempty" json:"probability,omitempty"` // share of queries failed; 0 fails every query
+}
 
-	return &cfg, nil
+// LoadConfig reads a YAML file and returns a Config struct, with the rules
+// of any included files merged in.
+func LoadConfig(filePath string) (*Config, error) {
+	return loadConfig(filePath, nil)
 }
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateHTTPRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure Failure
+		want    string // expected problem path, empty for none
+	}{
+		{"error", Failure{Type: "error", ErrorCode: 503}, ""},
+		{"error without code", Failure{Type: "error"}, "rules[0].failure.error_code"},
+		{"error code out of range", Failure{Type: "error", ErrorCode: 700}, "rules[0].failure.error_code"},
+		{"latency", Failure{Type: "latency", LatencyMs: 200}, ""},
+		{"latency without delay", Failure{Type: "latency"}, "rules[0].failure.latency_ms"},
+		{"probability above 1", Failure{Type: "error", ErrorCode: 500, Probability: 1.5}, "rules[0].failure.probability"},
+		{"unknown type", Failure{Type: "explode"}, "rules[0].failure.type"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Rules: []Rule{{Target: "http://api.local", Failure: tt.failure}}}
+		problems := cfg.Validate()
+		if tt.want == "" {
+			if len(problems) > 0 {
+				t.Errorf("%s: unexpected problems %v", tt.name, problems)
+			}
+			continue
+		}
+		if len(problems) != 1 || problems[0].Path != tt.want {
+			t.Errorf("%s: got %v, want one problem at %s", tt.name, problems, tt.want)
+		}
+	}
+}
+
+func TestValidateRequiresTarget(t *testing.T) {
+	cfg := &Config{Rules: []Rule{{Failure: Failure{Type: "error", ErrorCode: 500}}}}
+	problems := cfg.Validate()
+	if len(problems) != 1 || !strings.HasSuffix(problems[0].Path, ".target") {
+		t.Errorf("got %v, want a missing target", problems)
+	}
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// loadConfig reads the config at path and merges its includes. stack holds
+// the absolute paths of the files currently being loaded, to detect cycles.
+//
+// A file's own rules and tcpRules take precedence over included ones with
+// the same target or listen address, which lets a config override a shared
+// file. Included files have no precedence among each other, so a target or
+// listen address defined by two of them is an error. Only rules and tcpRules
+// are taken from included files; their other sections are ignored.
+func loadConfig(path string, stack []string) (*Config, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if i := slices.Index(stack, abs); i >= 0 {
+		return nil, includeCycleError(append(stack[i:len(stack):len(stack)], abs))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Include) == 0 {
+		return &cfg, nil
+	}
+
+	files, err := resolveIncludes(filepath.Dir(path), cfg.Include)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	stack = append(stack[:len(stack):len(stack)], abs)
+
+	ownTargets := make(map[string]bool, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		ownTargets[r.Target] = true
+	}
+	ownListens := make(map[string]bool, len(cfg.TCPRules))
+	for _, r := range cfg.TCPRules {
+		ownListens[r.Listen] = true
+	}
+
+	targetFrom := make(map[string]string) // rule target -> included file defining it
+	listenFrom := make(map[string]string) // TCP listen address -> included file defining it
+	for _, file := range files {
+		inc, err := loadConfig(file, stack)
+		var cycle includeCycleError
+		if errors.As(err, &cycle) {
+			return nil, err // already names every file involved
+		} else if err != nil {
+			return nil, fmt.Errorf("including %s: %w", file, err)
+		}
+		for _, r := range inc.Rules {
+			if ownTargets[r.Target] {
+				continue
+			}
+			if prev, ok := targetFrom[r.Target]; ok {
+				return nil, fmt.Errorf("%s: rule for %s is defined in both %s and %s", path, r.Target, prev, file)
+			}
+			targetFrom[r.Target] = file
+			cfg.Rules = append(cfg.Rules, r)
+		}
+		for _, r := range inc.TCPRules {
+			if ownListens[r.Listen] {
+				continue
+			}
+			if prev, ok := listenFrom[r.Listen]; ok {
+				return nil, fmt.Errorf("%s: tcpRule listening on %s is defined in both %s and %s", path, r.Listen, prev, file)
+			}
+			listenFrom[r.Listen] = file
+			cfg.TCPRules = append(cfg.TCPRules, r)
+		}
+	}
+	return &cfg, nil
+}
+
+// includeCycleError lists the files of an include cycle, starting and
+// ending with the same one.
+type includeCycleError []string
+
+func (e includeCycleError) Error() string {
+	return "include cycle: " + strings.Join(e, " -> ")
+}
+
+// resolveIncludes expands include patterns relative to dir, in order and
+// without repeats. A plain path must exist; a glob may match nothing.
+func resolveIncludes(dir string, patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			// Not wrapping os.ErrNotExist: callers treat that as "no config at all".
+			return nil, fmt.Errorf("included file %s does not exist", pattern)
+		}
+		for _, m := range matches {
+			if !slices.Contains(files, m) {
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the named files under a new directory and returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestNestedIncludes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"faultline.yaml": `
+include: [teams/*.yaml]
+rules:
+  - target: http://pay.local
+    failure: {type: error, error_code: 500}
+`,
+		"teams/payments.yaml": `
+include: [../shared/base.yaml]
+rules:
+  - target: http://pay.local
+    failure: {type: latency, latency_ms: 100}
+`,
+		"teams/search.yaml": `
+rules:
+  - target: http://search.local
+    failure: {type: latency, latency_ms: 200}
+tcpRules:
+  - listen: 127.0.0.1:55432
+    upstream: localhost:5432
+`,
+		"shared/base.yaml": `
+rules:
+  - target: http://auth.local
+    failure: {type: error, error_code: 503}
+`,
+	})
+
+	cfg, err := LoadConfig(filepath.Join(dir, "faultline.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]Failure{}
+	for _, r := range cfg.Rules {
+		if _, dup := got[r.Target]; dup {
+			t.Errorf("%s merged twice", r.Target)
+		}
+		got[r.Target] = r.Failure
+	}
+	want := map[string]Failure{
+		"http://pay.local":    {Type: "error", ErrorCode: 500}, // own rule wins over the include
+		"http://auth.local":   {Type: "error", ErrorCode: 503}, // two levels down
+		"http://search.local": {Type: "latency", LatencyMs: 200},
+	}
+	if len(got) != len(want) {
+		t.Errorf("rules %v, want %v", got, want)
+	}
+	for target, f := range want {
+		if got[target] != f {
+			t.Errorf("%s: %+v, want %+v", target, got[target], f)
+		}
+	}
+	if len(cfg.TCPRules) != 1 || cfg.TCPRules[0].Listen != "127.0.0.1:55432" {
+		t.Errorf("tcpRules %+v, want the one from search.yaml", cfg.TCPRules)
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"cycle.yaml":   "include: [a.yaml]\n",
+		"a.yaml":       "include: [b.yaml]\n",
+		"b.yaml":       "include: [a.yaml]\n",
+		"missing.yaml": "include: [nowhere.yaml]\n",
+		"clash.yaml":   "include: [one.yaml, two.yaml]\n",
+		"one.yaml":     "rules: [{target: http://api.local, failure: {type: error, error_code: 500}}]\n",
+		"two.yaml":     "rules: [{target: http://api.local, failure: {type: error, error_code: 503}}]\n",
+	})
+
+	_, err := LoadConfig(filepath.Join(dir, "cycle.yaml"))
+	var cycle includeCycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("cycle: got %v, want an include cycle error", err)
+	}
+	a, b := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")
+	if want := "include cycle: " + a + " -> " + b + " -> " + a; err.Error() != want {
+		t.Errorf("cycle: %q, want %q", err, want)
+	}
+
+	_, err = LoadConfig(filepath.Join(dir, "missing.yaml"))
+	if err == nil || errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "nowhere.yaml does not exist") {
+		t.Errorf("missing include: %v", err)
+	}
+	_, err = LoadConfig(filepath.Join(dir, "clash.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "rule for http://api.local is defined in both") {
+		t.Errorf("same target in two includes: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Problem is one issue found in a config file.
+type Problem struct {
+	Path    string // field path, e.g. tcpRules[0].faults.drop_probability
+	Message string
+	Line    int // line in the file, 0 when unknown
+}
+
+func (p Problem) String() string {
+	s := p.Message
+	if p.Path != "" {
+		s = p.Path + ": " + s
+	}
+	if p.Line > 0 {
+		s = fmt.Sprintf("line %d: %s", p.Line, s)
+	}
+	return s
+}
+
+// Validate checks the config for values the servers would reject or
+// silently ignore. It returns nil when the config is usable.
+func (c *Config) Validate() []Problem {
+	var problems []Problem
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for i, r := range c.Rules {
+		path := fmt.Sprintf("rules[%d]", i)
+		if strings.TrimSpace(r.Target) == "" {
+			add(path+".target", "is required")
+		}
+		switch r.Failure.Type {
+		case "latency":
+			if r.Failure.LatencyMs <= 0 {
+				add(path+".failure.latency_ms", "must be greater than 0 for a latency failure")
+			}
+		case "error":
+			if r.Failure.ErrorCode < 100 || r.Failure.ErrorCode > 599 {
+				add(path+".failure.error_code", "must be an HTTP status code (100-599), got %d", r.Failure.ErrorCode)
+			}
+		case "":
+			add(path+".failure.type", "is required (latency or error)")
+		default:
+			add(path+".failure.type", "unsupported type %q (latency or error)", r.Failure.Type)
+		}
+		if r.Failure.LatencyMs < 0 {
+			add(path+".failure.latency_ms", "must not be negative")
+		}
+		checkProbability(add, path+".failure.probability", r.Failure.Probability)
+	}
+
+	listens := make(map[string]int)
+	for i, r := range c.TCPRules {
+		path := fmt.Sprintf("tcpRules[%d]", i)
+		checkAddr(add, path+".listen", r.Listen)
+		if r.Upstream != EchoUpstream {
+			checkAddr(add, path+".upstream", r.Upstream)
+		}
+		if prev, ok := listens[r.Listen]; ok && r.Listen != "" {
+			add(path+".listen", "%s is already used by tcpRules[%d]", r.Listen, prev)
+		} else {
+			listens[r.Listen] = i
+		}
+		switch r.Protocol {
+		case "", "postgres", "mysql":
+		default:
+			add(path+".protocol", "unsupported protocol %q (postgres or mysql)", r.Protocol)
+		}
+
+		f := r.Faults
+		fpath := path + ".faults."
+		checkProbability(add, fpath+"drop_probability", f.DropProbability)
+		checkProbability(add, fpath+"reset_probability", f.ResetProbability)
+		checkProbability(add, fpath+"corrupt_probability", f.CorruptProbability)
+		for name, v := range map[string]int{
+			"latency_ms":              f.LatencyMs,
+			"latency_ramp_ms_per_sec": f.LatencyRampMsPerSec,
+			"bandwidth_kbps":          f.BandwidthKbps,
+			"max_connections":         f.MaxConnections,
+			"accept_delay_ms":         f.AcceptDelayMs,
+			"idle_timeout_ms":         f.IdleTimeoutMs,
+			"buffer_size":             f.BufferSize,
+		} {
+			if v < 0 {
+				add(fpath+name, "must not be negative")
+			}
+		}
+		if f.AcceptDelayMs > 0 && f.MaxConnections == 0 {
+			add(fpath+"accept_delay_ms", "has no effect without max_connections")
+		}
+		if f.QueryError.Code != "" && r.Protocol == "" {
+			add(fpath+"query_error", "needs the rule's protocol to be set")
+		}
+		checkProbability(add, fpath+"query_error.probability", f.QueryError.Probability)
+	}
+
+	for name, port := range map[string]int{"server.proxyPort": c.Server.ProxyPort, "server.apiPort": c.Server.APIPort} {
+		if port < 0 || port > 65535 {
+			add(name, "must be a port number (1-65535), got %d", port)
+		}
+	}
+	if c.Server.ProxyPort != 0 && c.Server.ProxyPort == c.Server.APIPort {
+		add("server.apiPort", "must differ from server.proxyPort")
+	}
+	if c.Server.ShutdownTimeoutSeconds < 0 {
+		add("server.shutdownTimeoutSeconds", "must not be negative, got %d", c.Server.ShutdownTimeoutSeconds)
+	}
+	switch c.Server.MatchStrategy {
+	case "", "priority", "weighted":
+	default:
+		add("server.matchStrategy", "unknown strategy %q (priority or weighted)", c.Server.MatchStrategy)
+	}
+	for i, origin := range c.Server.CORSOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "") {
+			add(fmt.Sprintf("server.corsOrigins[%d]", i), "%q is not an origin such as http://localhost:5173", origin)
+		}
+	}
+
+	// Map iteration above is unordered; keep reports stable.
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems
+}
+
+func checkProbability(add func(string, string, ...interface{}), path string, p float64) {
+	if p < 0 || p > 1 {
+		add(path, "must be between 0 and 1, got %g", p)
+	}
+}
+
+func checkAddr(add func(string, string, ...interface{}), path, addr string) {
+	if addr == "" {
+		add(path, "is required")
+		return
+	}
+	if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+		add(path, "%q is not a host:port address", addr)
+	}
+}
+
+// lineRe extracts the line number from yaml.v2 error messages.
+var lineRe = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// ValidateFile loads the config at path and validates it. Unknown keys (often
+// a camelCase/snake_case mix-up) are reported as problems too, and problems
+// carry the line of the field they refer to when it can be found. err is set
+// only when the file can't be read or parsed at all.
+func ValidateFile(path string) (*Config, []Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var problems []Problem
+	var strict Config
+	if err := yaml.UnmarshalStrict(data, &strict); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, nil, err
+		}
+		for _, msg := range typeErr.Errors {
+			p := Problem{Message: msg}
+			if m := lineRe.FindStringSubmatch(msg); m != nil {
+				p.Line, _ = strconv.Atoi(m[1])
+				p.Message = m[2]
+			}
+			problems = append(problems, p)
+		}
+	}
+
+	fieldProblems := cfg.Validate()
+	var root yamlv3.Node
+	if yamlv3.Unmarshal(data, &root) == nil {
+		for i := range fieldProblems {
+			// Entries merged in from included files have no line in this file.
+			if !fromIncludedFile(fieldProblems[i].Path, &strict) {
+				fieldProblems[i].Line = lineOf(&root, fieldProblems[i].Path)
+			}
+		}
+	}
+	return cfg, append(problems, fieldProblems...), nil
+}
+
+// entryRe matches the list entry a field path starts with.
+var entryRe = regexp.MustCompile(`^(rules|tcpRules)\[(\d+)\]`)
+
+// fromIncludedFile reports whether path refers to a rule that isn't among
+// own's, the file's own entries, which come first in the merged config.
+func fromIncludedFile(path string, own *Config) bool {
+	m := entryRe.FindStringSubmatch(path)
+	if m == nil {
+		return false
+	}
+	i, _ := strconv.Atoi(m[2])
+	if m[1] == "rules" {
+		return i >= len(own.Rules)
+	}
+	return i >= len(own.TCPRules)
+}
+
+// pathRe splits a field path into keys and list indexes.
+var pathRe = regexp.MustCompile(`([^.\[\]]+)|\[(\d+)\]`)
+
+// lineOf returns the line of the deepest node found along path, so a
+// missing field points at its parent.
+func lineOf(root *yamlv3.Node, path string) int {
+	n := root
+	if n.Kind == yamlv3.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	line := 0
+	for _, m := range pathRe.FindAllStringSubmatch(path, -1) {
+		var next *yamlv3.Node
+		switch {
+		case m[2] != "" && n.Kind == yamlv3.SequenceNode:
+			if i, _ := strconv.Atoi(m[2]); i < len(n.Content) {
+				next = n.Content[i]
+			}
+		case m[1] != "" && n.Kind == yamlv3.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == m[1] {
+					line = n.Content[i].Line
+					next = n.Content[i+1]
+					break
+				}
+			}
+		}
+		if next == nil {
+			break
+		}
+		n = next
+		if m[2] != "" {
+			line = n.Line
+		}
+	}
+	return line
+}
@@ -6,7 +6,8 @@ import StatCard from './components/StatCard.jsx';
 import RuleTable from './components/RuleTable.jsx';
 import EndpointAnalysis from './components/EndpointAnalysis.jsx';
 
-const API_URL = 'http://localhost:8081';
+// Served by `faultline start --ui`, the panel shares the API's origin.
+const API_URL = import.meta.env.DEV ? 'http://localhost:8081' : '';
 
 function App() {
   const [rules, setRules] = useState([]);
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"faultline/config"
+	"faultline/openapi"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// doctorCheck is one line of the doctor report.
+type doctorCheck struct {
+	name   string
+	status string // "ok", "warn" or "fail"
+	detail string
+	hint   string // remediation shown for warnings and failures
+}
+
+// runDoctor checks the local setup for the problems new users run into most
+// and returns the results in display order. Zero ports fall back to the
+// config's server section, then to the defaults.
+func runDoctor(configPath string, apiPort, proxyPort int) []doctorCheck {
+	var checks []doctorCheck
+	checks = append(checks, checkModuleName("go.mod"))
+
+	cfg, cfgCheck := checkConfig(configPath)
+	checks = append(checks, cfgCheck)
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+
+	// Ports given on the command line win over the config, as with start.
+	if apiPort == 0 {
+		apiPort = cmp.Or(cfg.Server.APIPort, 8081)
+	}
+	if proxyPort == 0 {
+		proxyPort = cmp.Or(cfg.Server.ProxyPort, 8080)
+	}
+	checks = append(checks,
+		checkListen("Control API port", fmt.Sprintf(":%d", apiPort), "--api-port"),
+		checkListen("HTTP proxy port", fmt.Sprintf(":%d", proxyPort), "--proxy-port"),
+	)
+	for _, r := range cfg.TCPRules {
+		if r.Listen != "" {
+			checks = append(checks, checkListen("DB proxy "+r.Listen, r.Listen, "the rule's listen address"))
+		}
+	}
+
+	for _, spec := range cfg.OpenAPI.SpecFiles {
+		checks = append(checks, checkSpecFile(spec))
+	}
+	for _, dir := range cfg.OpenAPI.SearchPaths {
+		c := doctorCheck{name: "Spec search path " + dir, status: "ok"}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			c.status, c.detail = "fail", "not a directory"
+			c.hint = "Fix or remove it under openapi.searchPaths in " + configPath
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// checkModuleName verifies that a source checkout declares the module name
+// the import paths expect. Binary installs have no go.mod and pass.
+func checkModuleName(path string) doctorCheck {
+	c := doctorCheck{name: "Go module name", status: "ok"}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		c.detail = "no go.mod here (not building from source)"
+		return c
+	}
+	if err != nil {
+		c.status, c.detail = "warn", err.Error()
+		return c
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "module "); ok {
+			name = strings.Trim(strings.TrimSpace(name), `"`)
+			if name == "faultline" {
+				c.detail = "module faultline"
+				return c
+			}
+			c.status, c.detail = "fail", fmt.Sprintf("module is %q", name)
+			c.hint = "Change the first line of go.mod to 'module faultline', then run 'go mod tidy'"
+			return c
+		}
+	}
+	c.status, c.detail = "fail", "go.mod has no module line"
+	c.hint = "Add 'module faultline' as the first line of go.mod, then run 'go mod tidy'"
+	return c
+}
+
+// checkConfig loads and validates the config file. A missing file is only a
+// warning since every setting has a default.
+func checkConfig(path string) (*config.Config, doctorCheck) {
+	c := doctorCheck{name: "Config " + path, status: "ok"}
+	cfg, problems, err := config.ValidateFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		c.status, c.detail = "warn", "not found; defaults will be used"
+		c.hint = "Create " + path + " to define rules, tcpRules or server settings"
+		return nil, c
+	case err != nil:
+		c.status, c.detail = "fail", err.Error()
+		c.hint = "Fix the YAML syntax, then run 'faultline validate-config " + path + "'"
+		return nil, c
+	case len(problems) > 0:
+		c.status, c.detail = "fail", fmt.Sprintf("%d problem(s), first: %s", len(problems), problems[0])
+		c.hint = "Run 'faultline validate-config " + path + "' for the full list"
+		return cfg, c
+	}
+	c.detail = fmt.Sprintf("%d rule(s), %d TCP rule(s)", len(cfg.Rules), len(cfg.TCPRules))
+	return cfg, c
+}
+
+// checkListen reports whether addr can be listened on right now.
+func checkListen(name, addr, flag string) doctorCheck {
+	c := doctorCheck{name: name, status: "ok", detail: addr + " is free"}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		c.status, c.detail = "fail", err.Error()
+		c.hint = "Stop whatever is using " + addr + " (e.g. another FaultLine) or change " + flag
+		return c
+	}
+	l.Close()
+	return c
+}
+
+// checkSpecFile verifies that a configured OpenAPI spec exists and parses.
+func checkSpecFile(path string) doctorCheck {
+	c := doctorCheck{name: "Spec " + path, status: "ok"}
+	if !openapi.IsRemoteSpec(path) {
+		if _, err := os.Stat(path); err != nil {
+			c.status, c.detail = "fail", "file not found"
+			c.hint = "Fix or remove it under openapi.specFiles"
+			return c
+		}
+	}
+	if err := openapi.CheckSpec(path); err != nil {
+		c.status, c.detail = "fail", err.Error()
+		c.hint = "Check the spec with 'faultline endpoints list " + path + " --strict'"
+	}
+	return c
+}
+
+// printDoctorReport prints the checklist and returns how many checks failed.
+func printDoctorReport(checks []doctorCheck) int {
+	failed := 0
+	for _, c := range checks {
+		switch c.status {
+		case "ok":
+			color.New(color.FgGreen).Print("✅ ")
+		case "warn":
+			color.New(color.FgYellow).Print("⚠️  ")
+		default:
+			color.New(color.FgRed).Print("❌ ")
+			failed++
+		}
+		fmt.Print(c.name)
+		if c.detail != "" {
+			fmt.Print(": " + c.detail)
+		}
+		fmt.Println()
+		if c.status != "ok" && c.hint != "" {
+			color.New(color.FgHiBlack).Println("   → " + c.hint)
+		}
+	}
+	fmt.Println()
+	return failed
+}
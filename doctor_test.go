@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// doctorCheckNamed returns the check whose name starts with prefix.
+func doctorCheckNamed(t *testing.T, checks []doctorCheck, prefix string) doctorCheck {
+	t.Helper()
+	for _, c := range checks {
+		if strings.HasPrefix(c.name, prefix) {
+			return c
+		}
+	}
+	t.Fatalf("no %q check in %+v", prefix, checks)
+	return doctorCheck{}
+}
+
+func TestDoctorReportsBusyPorts(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+	dbAddr := fmt.Sprintf("127.0.0.1:%d", busyPort)
+
+	cfg := filepath.Join(t.TempDir(), "faultline.yaml")
+	yaml := "tcpRules:\n  - listen: " + dbAddr + "\n    upstream: echo\n"
+	if err := os.WriteFile(cfg, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := runDoctor(cfg, freePort(t), busyPort)
+	if c := doctorCheckNamed(t, checks, "Control API port"); c.status != "ok" {
+		t.Errorf("free API port: %+v, want ok", c)
+	}
+	c := doctorCheckNamed(t, checks, "HTTP proxy port")
+	if c.status != "fail" || !strings.Contains(c.detail, "address already in use") || !strings.Contains(c.hint, "--proxy-port") {
+		t.Errorf("busy proxy port: %+v, want a failure pointing at --proxy-port", c)
+	}
+	if c := doctorCheckNamed(t, checks, "DB proxy "+dbAddr); c.status != "fail" {
+		t.Errorf("busy TCP rule listen address: %+v, want a failure", c)
+	}
+	if failed := printDoctorReport(checks); failed != 2 {
+		t.Errorf("report counted %d failure(s), want 2", failed)
+	}
+}
+
+func TestDoctorChecksTheConfig(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"good.yaml":    "rules:\n  - target: http://api.local\n    failure: {type: latency, latency_ms: 100}\n",
+		"invalid.yaml": "rules:\n  - target: http://api.local\n    failure: {type: error}\n",
+		"broken.yaml":  "rules: [\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		file, status, detail, hint string
+	}{
+		{"good.yaml", "ok", "1 rule(s), 0 TCP rule(s)", ""},
+		{"missing.yaml", "warn", "not found; defaults will be used", "Create "},
+		{"broken.yaml", "fail", "yaml:", "Fix the YAML syntax"},
+		{"invalid.yaml", "fail", "1 problem(s), first: line 3: rules[0].failure.error_code", "faultline validate-config"},
+	} {
+		path := filepath.Join(dir, tc.file)
+		c := doctorCheckNamed(t, runDoctor(path, freePort(t), freePort(t)), "Config "+path)
+		if c.status != tc.status || !strings.Contains(c.detail, tc.detail) || !strings.Contains(c.hint, tc.hint) {
+			t.Errorf("%s: %+v, want %s with %q and hint %q", tc.file, c, tc.status, tc.detail, tc.hint)
+		}
+	}
+}
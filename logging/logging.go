@@ -0,0 +1,56 @@
+// Package logging gates FaultLine's chatty logs behind a process-wide level.
+// Lines are written through the standard logger, so they keep its format;
+// startup messages, warnings and errors are logged with log.Printf directly
+// and always appear.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Level selects which gated log lines are written.
+type Level int32
+
+const (
+	// Quiet drops the per-request and per-connection logs as well.
+	Quiet Level = -1
+	// Info logs one line per injected fault or finished connection (default).
+	Info Level = 0
+	// Debug adds every forwarded request, URL rewrite and dropped chunk.
+	Debug Level = 1
+)
+
+var level atomic.Int32
+
+// SetLevel changes the level for all packages.
+func SetLevel(l Level) { level.Store(int32(l)) }
+
+// Enabled reports whether lines at l are written.
+func Enabled(l Level) bool { return Level(level.Load()) >= l }
+
+// Infof logs per-request and per-connection events, unless quiet.
+func Infof(format string, args ...interface{}) {
+	if Enabled(Info) {
+		log.Output(2, fmt.Sprintf(format, args...))
+	}
+}
+
+// Debugf logs details that are only useful when diagnosing FaultLine itself.
+func Debugf(format string, args ...interface{}) {
+	if Enabled(Debug) {
+		log.Output(2, fmt.Sprintf(format, args...))
+	}
+}
+
+// LevelFor maps the --verbose count and --quiet flag to a level.
+func LevelFor(verbose int, quiet bool) Level {
+	switch {
+	case quiet:
+		return Quiet
+	case verbose > 0:
+		return Debug
+	}
+	return Info
+}
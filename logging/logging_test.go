@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	var buf strings.Builder
+	flags := log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+		SetLevel(Info)
+	})
+
+	tests := []struct {
+		verbose int
+		quiet   bool
+		want    string
+	}{
+		{0, false, "info\n"},
+		{1, false, "info\ndebug\n"},
+		{2, false, "info\ndebug\n"},
+		{0, true, ""},
+		{1, true, ""}, // --quiet wins
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		SetLevel(LevelFor(tt.verbose, tt.quiet))
+		Infof("%s", "info")
+		Debugf("%s", "debug")
+		if buf.String() != tt.want {
+			t.Errorf("-v x%d, quiet %t: logged %q, want %q", tt.verbose, tt.quiet, buf.String(), tt.want)
+		}
+	}
+}
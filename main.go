@@ -1,6 +1,7 @@
 package main
 
-// TROUBLESHOOTING: If you see an "undefined: api.RegisterHandlers" error,
+// TROUBLESHOOTING: `faultline doctor` checks the following automatically.
+// If you see an "undefined: api.RegisterHandlers" error,
 // please check your go.mod file. The first line MUST be exactly:
 // module faultline
 //
@@ -12,36 +13,120 @@ package main
 // the import paths used in the code.
 
 import (
-	"context"
-	"faultline/api"
+	"errors"
 	"faultline/cli"
 	"faultline/config"
+	"faultline/logging"
+	"faultline/openapi"
 	"faultline/proxy"
 	"faultline/state"
 	"faultline/tcp"
 	"fmt"
 	"log"
-	"net/http"
+	"net/url"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
 	"github.com/fatih/color"
-	"github.com/gorilla/mux"
-	"github.com/rs/cors"
 	"github.com/spf13/cobra"
 )
 
+// defaultConfigFile is the configuration file used when none is given.
+const defaultConfigFile = "faultline.yaml"
+
 func main() {
 	var proxyPort int
 	var apiPort int
 	var configFile string
+	var dryRun bool
+	var dialTimeout, responseHeaderTimeout, upstreamTimeout time.Duration
+	var drainTimeout, shutdownTimeout time.Duration
+	var defaultUpstream string
+	var traceBodies bool
+	var traceBodyLimit int
+	var traceRedact []string
+	var matchStrategy string
+	var slowThreshold time.Duration
+	var hideFaultHeaders bool
+	var passthroughCORS bool
+	var contractSpecs []string
+	var recordFile string
+	var recordBodyLimit int
+	var maxBodyBuffer int
+	var smoke bool
+	var serveUI bool
+	var verbose int
+	var quiet bool
+	var noColor bool
 	var dataFile = "faultline-rules.json" // Default value
 
 	// Colors for CLI output
 	successColor := color.New(color.FgGreen, color.Bold)
 
+	// proxyOptions builds the HTTP proxy options from the parsed flags and
+	// the config's server section.
+	proxyOptions := func(sc config.ServerConf) proxy.Options {
+		opts := proxy.Options{
+			DryRun:                dryRun || os.Getenv("FAULTLINE_DRY_RUN") == "1",
+			DialTimeout:           dialTimeout,
+			ResponseHeaderTimeout: responseHeaderTimeout,
+			RequestTimeout:        upstreamTimeout,
+			DefaultUpstream:       defaultUpstream,
+			TraceBodies:           traceBodies,
+			TraceBodyLimit:        traceBodyLimit,
+			TraceRedact:           traceRedact,
+			AllowedHosts:          sc.AllowedHosts,
+			BlockedHosts:          sc.BlockedHosts,
+			MatchStrategy:         matchStrategy,
+			SlowRequestThreshold:  slowThreshold,
+			HideFaultHeaders:      hideFaultHeaders,
+			PassthroughCORS:       passthroughCORS || sc.PassthroughCORS,
+			MaxBodyBuffer:         maxBodyBuffer,
+		}
+		if opts.MatchStrategy == "" {
+			opts.MatchStrategy = sc.MatchStrategy
+		}
+		if err := state.ValidateMatchStrategy(opts.MatchStrategy); err != nil {
+			log.Fatalf("Invalid match strategy: %v", err)
+		}
+		if opts.MatchStrategy == state.MatchWeighted {
+			log.Println("🎲 Weighted matching: overlapping rules are chosen in proportion to their weight")
+		}
+		if opts.DefaultUpstream != "" {
+			if u, err := url.Parse(opts.DefaultUpstream); err != nil || u.Scheme == "" || u.Host == "" {
+				log.Fatalf("Invalid --default-upstream %q: expected an absolute URL such as http://localhost:3000", opts.DefaultUpstream)
+			}
+			log.Printf("↪️  Relative requests are forwarded to %s", opts.DefaultUpstream)
+		}
+		if opts.TraceBodies {
+			log.Printf("🔎 Tracing proxied bodies (first %d bytes, redacting %s)", opts.TraceBodyLimit, strings.Join(opts.TraceRedact, ", "))
+		}
+		if recordFile != "" {
+			rec, err := proxy.NewRecorder(recordFile, recordBodyLimit, opts.TraceRedact)
+			if err != nil {
+				log.Fatalf("Failed to open --record file: %v", err)
+			}
+			opts.Recorder = rec
+			log.Printf("⏺️  Recording proxied requests and responses to %s", recordFile)
+		}
+		if opts.PassthroughCORS {
+			log.Println("🌐 CORS preflights are forwarded to upstreams")
+		}
+		if len(contractSpecs) > 0 {
+			contract, err := openapi.LoadContract(contractSpecs)
+			if err != nil {
+				log.Fatalf("Failed to load --contract spec: %v", err)
+			}
+			opts.Contract = contract
+			log.Printf("📜 Checking upstream responses against %d operation(s) from %s", contract.Operations(), strings.Join(contractSpecs, ", "))
+		}
+		if opts.DryRun {
+			log.Println("🧪 Dry-run mode: matching rules are logged but no faults are injected")
+		}
+		return opts
+	}
+
 	var rootCmd = &cobra.Command{
 		Use:   "faultline",
 		Short: "A tool for injecting failure scenarios into your dev environment.",
@@ -53,21 +138,94 @@ func main() {
 	ruleState := state.NewRuleState(nil, dataFile)
 	rm := cli.NewRuleManager(ruleState)
 
+	// The rule state is created before flags are parsed; switch to the
+	// requested data file once --data is known.
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		logging.SetLevel(logging.LevelFor(verbose, quiet))
+		// color already turns itself off for NO_COLOR and non-terminal output.
+		if noColor {
+			color.NoColor = true
+		}
+		if cmd.Flags().Changed("data") {
+			return ruleState.SetDataFile(dataFile)
+		}
+		return nil
+	}
+
 	var startCmd = &cobra.Command{
-		Use:   "start",
-		Short: "Starts the FaultLine proxy and control API servers",
+		Use:     "start",
+		Aliases: []string{"start-api"},
+		Short:   "Starts the FaultLine proxy and control API servers",
 		Run: func(cmd *cobra.Command, args []string) {
 			cli.PrintBanner()
 			successColor.Println("🚀 Starting FaultLine servers...")
-			runServers(apiPort, proxyPort, rm)
+			// An explicit --config must load; the default file is optional.
+			var cfg *config.Config
+			var err error
+			loadedConfig := configFile
+			if cmd.Flags().Changed("config") {
+				cfg, err = config.LoadConfig(configFile)
+				if err != nil {
+					log.Fatalf("Failed to load config %s: %v", configFile, err)
+				}
+			} else if cfg, err = loadOptionalConfig(configFile); err != nil {
+				log.Printf("[WARNING] Failed to load %s: %v", configFile, err)
+				cfg = &config.Config{}
+				loadedConfig = ""
+			} else if cfg == nil {
+				cfg = &config.Config{}
+				loadedConfig = ""
+			}
+			// Rules are only seeded from an explicit --config; without it
+			// the default file just supplies server settings.
+			if cmd.Flags().Changed("config") {
+				seedConfigRules(cfg, configFile, ruleState)
+			}
+			corsOrigins := applyServerConfig(cmd, cfg.Server, &apiPort, &proxyPort, &shutdownTimeout)
+			cli.PrintStartupSummary(cli.StartupSummary{
+				ConfigFile: loadedConfig,
+				DataFile:   dataFile,
+				Rules:      ruleState.GetRules(),
+				ProxyPort:  proxyPort,
+				APIPort:    apiPort,
+			})
+			runServers(apiPort, proxyPort, corsOrigins, rm, proxyOptions(cfg.Server), shutdownTimeout, serveUI, smoke)
 		},
 	}
 
-	startCmd.Flags().IntVarP(&proxyPort, "proxy-port", "p", 8080, "Port for the failure injection proxy")
-	startCmd.Flags().IntVarP(&apiPort, "api-port", "a", 8081, "Port for the control panel API")
+	// addHTTPFlags registers the proxy/API flags shared by start and start-all.
+	addHTTPFlags := func(cmd *cobra.Command) {
+		cmd.Flags().IntVarP(&proxyPort, "proxy-port", "p", 8080, "Port for the failure injection proxy")
+		cmd.Flags().IntVarP(&apiPort, "api-port", "a", 8081, "Port for the control panel API")
+		cmd.Flags().DurationVar(&dialTimeout, "dial-timeout", 10*time.Second, "Timeout for connecting to upstreams (0 = no limit)")
+		cmd.Flags().DurationVar(&responseHeaderTimeout, "response-header-timeout", 0, "Timeout waiting for upstream response headers (0 = no limit)")
+		cmd.Flags().DurationVar(&upstreamTimeout, "upstream-timeout", 0, "Timeout for the whole upstream request (0 = no limit)")
+		cmd.Flags().StringVar(&defaultUpstream, "default-upstream", "", "Upstream base URL for requests whose path doesn't embed a target URL (e.g. http://localhost:3000)")
+		cmd.Flags().BoolVar(&traceBodies, "trace-bodies", false, "Log headers and (truncated) bodies of proxied requests and responses")
+		cmd.Flags().IntVar(&traceBodyLimit, "trace-body-limit", proxy.DefaultTraceBodyLimit, "Bytes of each body to log with --trace-bodies")
+		cmd.Flags().StringSliceVar(&traceRedact, "trace-redact", proxy.DefaultTraceRedact, "Headers masked in --trace-bodies output")
+		cmd.Flags().StringVar(&recordFile, "record", "", "Append each forwarded request and its upstream response to this JSONL file (replayable with 'faultline replay')")
+		cmd.Flags().IntVar(&recordBodyLimit, "record-body-limit", proxy.DefaultRecordBodyLimit, "Bytes of each body kept with --record")
+		cmd.Flags().IntVar(&maxBodyBuffer, "max-body-buffer", proxy.DefaultMaxBodyBuffer, "Bytes of a request body held in memory for bodyMatch rules; larger bodies are streamed through unmatched")
+		cmd.Flags().DurationVar(&slowThreshold, "slow-threshold", 0, "Warn about forwarded requests taking at least this long, e.g. 2s (0 = off)")
+		cmd.Flags().StringVar(&matchStrategy, "match-strategy", "", "How to choose between overlapping rules: priority (default) or weighted")
+		cmd.Flags().BoolVar(&hideFaultHeaders, "hide-fault-headers", false, "Don't mark injected responses with X-FaultLine-* headers, so faults look like real upstream failures")
+		cmd.Flags().StringSliceVar(&contractSpecs, "contract", nil, "OpenAPI spec (file or URL) to check upstream responses against, recording contract-violation events")
+		cmd.Flags().BoolVar(&passthroughCORS, "passthrough-cors", false, "Forward CORS preflight (OPTIONS) requests to the upstream instead of allowing every origin, to test the upstream's real CORS policy")
+		cmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", defaultShutdownTimeout, "How long to wait on SIGINT/SIGTERM for in-flight requests, including injected latency, before closing them")
+		cmd.Flags().BoolVar(&serveUI, "ui", false, "Serve the control panel embedded in the binary at / on the control API port")
+		cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Log faults that would be injected without applying them (or set FAULTLINE_DRY_RUN=1)")
+	}
+	addHTTPFlags(startCmd)
+	startCmd.Flags().StringVarP(&configFile, "config", "c", defaultConfigFile, "Path to the configuration file (rules and server settings)")
+	startCmd.Flags().BoolVar(&smoke, "smoke", false, "Exit once both servers are listening (status 0, or non-zero if a port can't be bound) instead of running; for CI boot checks")
+	startCmd.Flags().BoolVar(&smoke, "once", false, "Alias for --smoke")
 
 	// Global flags
 	rootCmd.PersistentFlags().StringVarP(&dataFile, "data", "d", "faultline-rules.json", "File to store rules data")
+	rootCmd.PersistentFlags().CountVarP(&verbose, "verbose", "v", "Also log every forwarded request, URL rewrite and TCP chunk drop")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only log startup messages, warnings and errors")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Don't color output (also off when NO_COLOR is set or output isn't a terminal)")
 
 	// Add CLI commands for rule management
 	cliCommands := cli.CreateCLICommands(rm)
@@ -80,101 +238,286 @@ func main() {
 	// start-db: run TCP fault-injection proxies based on config
 	var startDBCmd = &cobra.Command{
 		Use:   "start-db",
-		Short: "Start DB (TCP) fault-injection proxies from tcpRules",
+		Short: "Start DB (TCP) fault-injection proxies from tcpRules and runtime TCP rules",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.LoadConfig(configFile)
 			if err != nil {
 				return fmt.Errorf("load config: %w", err)
 			}
-			if len(cfg.TCPRules) == 0 {
-				log.Println("[DB] No tcpRules found in config. Nothing to start.")
-				return nil
-			}
-			stop := make(chan struct{})
-			for _, r := range cfg.TCPRules {
-				rp := tcp.NewProxy(r)
-				go func(rule config.TCPRule) {
-					if err := rp.Start(stop); err != nil {
-						log.Printf("[DB] Proxy %s -> %s exited: %v", rule.Listen, rule.Upstream, err)
-					}
-				}(r)
-			}
-			log.Printf("[DB] Started %d DB network proxies (latency/drops/throttle/refuse). Press Ctrl+C to stop.", len(cfg.TCPRules))
-			// Wait on signal
-			sig := make(chan os.Signal, 1)
-			signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-			<-sig
-			close(stop)
+			cli.PrintBanner()
+			ruleState.SeedTCPRules(state.TCPRulesFromConfig(cfg.TCPRules))
+			cli.PrintStartupSummary(cli.StartupSummary{
+				ConfigFile: configFile,
+				DB:         true,
+				TCPRules:   ruleState.GetTCPRules(),
+			})
+			if len(ruleState.GetTCPRules()) == 0 {
+				log.Println("[DB] No TCP rules yet; add tcpRules to the config or create them via the API.")
+			}
+
+			dbProxies, err := startTCPProxies(ruleState, drainTimeout)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("start DB proxies: %w", err)
+			}
+			log.Printf("[DB] Started %d DB network proxies (latency/drops/throttle/refuse). Press Ctrl+C to stop.", len(dbProxies.manager.Rules()))
+			waitForSignal()
+			dbProxies.stop()
 			return nil
 		},
 	}
-	startDBCmd.Flags().StringVarP(&configFile, "config", "c", "faultline.yaml", "Path to the configuration file")
+	startDBCmd.Flags().StringVarP(&configFile, "config", "c", defaultConfigFile, "Path to the configuration file")
+	startDBCmd.Flags().DurationVar(&drainTimeout, "drain-timeout", tcp.DefaultDrainTimeout, "How long to wait for active connections on shutdown before force-closing them")
 	rootCmd.AddCommand(startDBCmd)
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-}
 
-// runServers sets up and starts the API and proxy servers.
-func runServers(apiPort, proxyPort int, rm *cli.RuleManager) {
+	// start-all: run the control API, HTTP proxy and TCP proxies together
+	var startAllCmd = &cobra.Command{
+		Use:   "start-all",
+		Short: "Start the control API, HTTP proxy and DB (TCP) proxies together",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadConfig(configFile)
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			cli.PrintBanner()
+			successColor.Println("🚀 Starting all FaultLine servers...")
+			seedConfigRules(cfg, configFile, ruleState)
+			ruleState.SeedTCPRules(state.TCPRulesFromConfig(cfg.TCPRules))
+			corsOrigins := applyServerConfig(cmd, cfg.Server, &apiPort, &proxyPort, &shutdownTimeout)
+			cli.PrintStartupSummary(cli.StartupSummary{
+				ConfigFile: configFile,
+				DataFile:   dataFile,
+				Rules:      ruleState.GetRules(),
+				ProxyPort:  proxyPort,
+				APIPort:    apiPort,
+				DB:         true,
+				TCPRules:   ruleState.GetTCPRules(),
+			})
+
+			dbProxies, err := startTCPProxies(ruleState, drainTimeout)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("start DB proxies: %w", err)
+			}
+			servers, err := startHTTPServers(apiPort, proxyPort, corsOrigins, rm, proxyOptions(cfg.Server), shutdownTimeout, serveUI)
+			if err != nil {
+				dbProxies.stop()
+				cmd.SilenceUsage = true
+				return fmt.Errorf("start HTTP servers: %w", err)
+			}
+			log.Println("Press Ctrl+C to stop.")
 
-	// --- Setup Control API Server ---
-	apiRouter := mux.NewRouter()
-	api.RegisterHandlers(apiRouter, rm)
+			waitForSignal()
+			log.Println("Shutting down all servers...")
+			servers.shutdown()
+			dbProxies.stop()
+			return nil
+		},
+	}
+	addHTTPFlags(startAllCmd)
+	startAllCmd.Flags().StringVarP(&configFile, "config", "c", defaultConfigFile, "Path to the configuration file")
+	startAllCmd.Flags().DurationVar(&drainTimeout, "drain-timeout", tcp.DefaultDrainTimeout, "How long to wait for active DB connections on shutdown before force-closing them")
+	rootCmd.AddCommand(startAllCmd)
 
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173", "http://localhost:5174"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type"},
-		AllowCredentials: true,
-	})
-	apiHandler := c.Handler(apiRouter)
+	// replay: drive recorded requests through a running proxy
+	var replayProxy string
+	var replayConcurrency int
+	var replayTimeout time.Duration
+	var replayCmd = &cobra.Command{
+		Use:   "replay <file>",
+		Short: "Send recorded requests (JSON list or HAR) through the proxy and report the results",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reqs, err := loadReplayFile(args[0])
+			if err != nil {
+				return err
+			}
+			if len(reqs) == 0 {
+				return fmt.Errorf("no requests found in %s", args[0])
+			}
+			successColor.Printf("▶️  Replaying %d request(s) through %s (concurrency %d)\n\n", len(reqs), replayProxy, replayConcurrency)
+			printReplayReport(replay(reqs, replayProxy, replayConcurrency, replayTimeout))
+			return nil
+		},
+	}
+	replayCmd.Flags().StringVar(&replayProxy, "proxy", "http://localhost:8080", "Base URL of the running FaultLine proxy")
+	replayCmd.Flags().IntVarP(&replayConcurrency, "concurrency", "n", 1, "Number of requests in flight at once")
+	replayCmd.Flags().DurationVar(&replayTimeout, "timeout", 60*time.Second, "Timeout per request")
+	rootCmd.AddCommand(replayCmd)
 
-	apiServer := &http.Server{
-		Addr:    fmt.Sprintf(":%d", apiPort),
-		Handler: apiHandler,
+	// validate-config: check a config file without starting anything
+	var validateCmd = &cobra.Command{
+		Use:   "validate-config [file]",
+		Short: "Check a FaultLine config file and report any problems",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Problems are reported below; main prints the final error once.
+			cmd.SilenceUsage, cmd.SilenceErrors = true, true
+			path := defaultConfigFile
+			if len(args) == 1 {
+				path = args[0]
+			}
+			_, problems, err := config.ValidateFile(path)
+			if err != nil {
+				return fmt.Errorf("load %s: %w", path, err)
+			}
+			if len(problems) > 0 {
+				color.New(color.FgRed, color.Bold).Printf("❌ %s has %d problem(s):\n", path, len(problems))
+				for _, p := range problems {
+					fmt.Printf("  • %s\n", p)
+				}
+				return fmt.Errorf("%s is invalid", path)
+			}
+			successColor.Printf("✅ %s is valid\n", path)
+			return nil
+		},
 	}
+	rootCmd.AddCommand(validateCmd)
 
-	// --- Setup Proxy Server ---
-	p := proxy.NewProxy(rm)
-	proxyServer := &http.Server{
-		Addr:    fmt.Sprintf(":%d", proxyPort),
-		Handler: http.HandlerFunc(p.HandleRequest),
+	// doctor: diagnose common setup problems
+	var doctorConfig string
+	var doctorAPIPort, doctorProxyPort int
+	var doctorCmd = &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the local setup (module name, ports, config, spec files) and suggest fixes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage, cmd.SilenceErrors = true, true
+			successColor.Println("🩺 Checking your FaultLine setup...")
+			fmt.Println()
+			apiPort, proxyPort := doctorAPIPort, doctorProxyPort
+			if !cmd.Flags().Changed("api-port") {
+				apiPort = 0
+			}
+			if !cmd.Flags().Changed("proxy-port") {
+				proxyPort = 0
+			}
+			if failed := printDoctorReport(runDoctor(doctorConfig, apiPort, proxyPort)); failed > 0 {
+				return fmt.Errorf("❌ %d check(s) failed", failed)
+			}
+			successColor.Println("✅ All checks passed")
+			return nil
+		},
 	}
+	doctorCmd.Flags().StringVarP(&doctorConfig, "config", "c", defaultConfigFile, "Path to the configuration file")
+	doctorCmd.Flags().IntVarP(&doctorAPIPort, "api-port", "a", 8081, "Control API port to check")
+	doctorCmd.Flags().IntVarP(&doctorProxyPort, "proxy-port", "p", 8080, "Proxy port to check")
+	rootCmd.AddCommand(doctorCmd)
 
-	// --- Graceful Shutdown Setup ---
-	stopChan := make(chan os.Signal, 1)
-	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
+	// stats: show a running instance's counters
+	var statsAPIURL, statsOutput string
+	var statsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "Show request and injected-fault counts of a running FaultLine instance",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateStatsOutput(statsOutput); err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			summary, err := fetchStats(statsAPIURL)
+			if err != nil {
+				return err
+			}
+			return printStats(cmd.OutOrStdout(), summary, statsOutput)
+		},
+	}
+	statsCmd.Flags().StringVar(&statsAPIURL, "api-url", "http://localhost:8081", "Base URL of the running control API")
+	statsCmd.Flags().StringVarP(&statsOutput, "output", "o", "table", "Output format: table or json")
+	rootCmd.AddCommand(statsCmd)
 
-	// --- Start Servers ---
-	go func() {
-		log.Printf("✅ Control API listening on http://localhost:%d", apiPort)
-		if err := apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("API server failed: %v", err)
-		}
-	}()
+	// maintenance: fail all traffic of a running instance
+	var maintenanceAPIURL, maintenanceBody string
+	var maintenanceStatus int
+	var maintenanceCmd = &cobra.Command{
+		Use:       "maintenance [on|off]",
+		Short:     "Switch a running instance's maintenance mode, which fails every proxied request, on or off",
+		Long:      "Without an argument, shows whether maintenance mode is on. 'on' makes the proxy answer every request with --status (default 503) and --body, ignoring the rules, until 'off'.",
+		Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{"on", "off"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			var req *state.Maintenance
+			if len(args) == 1 {
+				req = &state.Maintenance{Enabled: args[0] == "on", StatusCode: maintenanceStatus, Body: maintenanceBody}
+			}
+			m, err := maintenanceRequest(maintenanceAPIURL, req)
+			if err != nil {
+				return err
+			}
+			printMaintenance(cmd.OutOrStdout(), m)
+			return nil
+		},
+	}
+	maintenanceCmd.Flags().StringVar(&maintenanceAPIURL, "api-url", "http://localhost:8081", "Base URL of the running control API")
+	maintenanceCmd.Flags().IntVar(&maintenanceStatus, "status", 0, "Status code returned with 'on' (default 503)")
+	maintenanceCmd.Flags().StringVar(&maintenanceBody, "body", "", "Response body returned with 'on'")
+	rootCmd.AddCommand(maintenanceCmd)
 
-	go func() {
-		log.Printf("✅ FaultLine Proxy listening on http://localhost:%d", proxyPort)
-		if err := proxyServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Proxy server failed: %v", err)
-		}
-	}()
+	// version: report the build, for bug reports and CI
+	var versionJSON bool
+	var versionCmd = &cobra.Command{
+		Use:   "version",
+		Short: "Print the version, git commit and build date",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printVersion(cmd.OutOrStdout(), versionJSON)
+		},
+	}
+	versionCmd.Flags().BoolVar(&versionJSON, "json", false, "Print the build information as JSON")
+	rootCmd.AddCommand(versionCmd)
+	rootCmd.Version = version
+	rootCmd.SetVersionTemplate(currentBuild().String() + "\n")
 
-	// Block until a signal is received
-	<-stopChan
-	log.Println("Shutting down servers...")
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// loadOptionalConfig loads a config file, returning a nil config when the
+// file doesn't exist.
+func loadOptionalConfig(path string) (*config.Config, error) {
+	cfg, err := config.LoadConfig(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return cfg, err
+}
 
-	if err := apiServer.Shutdown(ctx); err != nil {
-		log.Printf("API server shutdown error: %v", err)
+// seedConfigRules adds the HTTP rules defined in a config file to the rule
+// state. Rules already present (by content-derived ID) are kept as-is, and
+// ones seeded from an earlier version of the file are replaced. The rules
+// added, including any deleted at runtime since the last start, and
+// removed are logged.
+func seedConfigRules(cfg *config.Config, path string, rs *state.RuleState) {
+	added, removed := rs.SeedConfig(state.RulesFromConfig(cfg.Rules))
+	if len(cfg.Rules) > 0 {
+		log.Printf("📄 Loaded %d rule(s) from %s (%d new)", len(cfg.Rules), path, len(added))
 	}
-	if err := proxyServer.Shutdown(ctx); err != nil {
-		log.Printf("Proxy server shutdown error: %v", err)
+	for _, rule := range added {
+		log.Printf("   + %s %s: %s", rule.ID[:8], rule.TargetLabel(), rule.Failure.Summary())
 	}
+	for _, rule := range removed {
+		log.Printf("   - %s %s: %s (no longer in %s)", rule.ID[:8], rule.TargetLabel(), rule.Failure.Summary(), path)
+	}
+}
 
-	log.Println("Servers gracefully stopped.")
+// applyServerConfig fills in ports and the shutdown timeout from the config's
+// server section unless they were set explicitly on the command line, and
+// returns the CORS origins allowed to call the control API.
+func applyServerConfig(cmd *cobra.Command, sc config.ServerConf, apiPort, proxyPort *int, shutdownTimeout *time.Duration) []string {
+	if sc.APIPort > 0 && !cmd.Flags().Changed("api-port") {
+		*apiPort = sc.APIPort
+	}
+	if sc.ProxyPort > 0 && !cmd.Flags().Changed("proxy-port") {
+		*proxyPort = sc.ProxyPort
+	}
+	if sc.ShutdownTimeoutSeconds > 0 && !cmd.Flags().Changed("shutdown-timeout") {
+		*shutdownTimeout = time.Duration(sc.ShutdownTimeoutSeconds) * time.Second
+	}
+	if len(sc.CORSOrigins) > 0 {
+		return sc.CORSOrigins
+	}
+	return defaultCORSOrigins
 }
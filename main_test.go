@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"faultline/config"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	buildOnce sync.Once
+	binDir    string
+	binPath   string
+	buildErr  error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if binDir != "" {
+		os.RemoveAll(binDir)
+	}
+	os.Exit(code)
+}
+
+// buildBinary builds faultline once per test run and returns its path.
+func buildBinary(t *testing.T) string {
+	t.Helper()
+	buildOnce.Do(func() {
+		if binDir, buildErr = os.MkdirTemp("", "faultline-test"); buildErr != nil {
+			return
+		}
+		binPath = filepath.Join(binDir, "faultline")
+		if out, err := exec.Command("go", "build", "-o", binPath, ".").CombinedOutput(); err != nil {
+			buildErr = fmt.Errorf("go build: %v\n%s", err, out)
+		}
+	})
+	if buildErr != nil {
+		t.Fatal(buildErr)
+	}
+	return binPath
+}
+
+// freePort returns a TCP port nothing is listening on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// TestHelpListsCommands builds the binary and checks that --help shows the
+// whole command tree.
+func TestHelpListsCommands(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+
+	out, err := exec.Command(bin, "--help").CombinedOutput()
+	if err != nil {
+		t.Fatalf("--help: %v\n%s", err, out)
+	}
+	help := string(out)
+	if !strings.Contains(help, "faultline start  — Run the proxy server and control API") {
+		t.Errorf("--help lost the long description:\n%s", help)
+	}
+	for _, cmd := range []string{"start", "start-db", "start-all", "rules", "scenario", "stats", "maintenance", "version"} {
+		if !strings.Contains(help, "\n  "+cmd+" ") {
+			t.Errorf("--help doesn't list %q:\n%s", cmd, help)
+		}
+	}
+
+	for _, cmd := range []string{"start", "start-db"} {
+		if out, err := exec.Command(bin, cmd, "--help").CombinedOutput(); err != nil {
+			t.Errorf("%s --help: %v\n%s", cmd, err, out)
+		}
+	}
+}
+
+// smoke runs "start --smoke" on the given ports in a scratch directory.
+func smoke(t *testing.T, bin string, apiPort, proxyPort int) (string, error) {
+	t.Helper()
+	cmd := exec.Command(bin, "start", "--smoke", "--api-port", strconv.Itoa(apiPort), "--proxy-port", strconv.Itoa(proxyPort))
+	cmd.Dir = t.TempDir()
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestSmokeStartsServers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	out, err := smoke(t, buildBinary(t), freePort(t), freePort(t))
+	if err != nil || !strings.Contains(out, "Smoke check passed") {
+		t.Errorf("start --smoke: %v\n%s", err, out)
+	}
+}
+
+func TestSmokeReportsPortInUse(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+
+	// Another process holding the proxy port must fail the check, not
+	// satisfy it.
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	for _, ports := range [][2]int{{freePort(t), busyPort}, {busyPort, freePort(t)}} {
+		out, err := smoke(t, bin, ports[0], ports[1])
+		if err == nil {
+			t.Errorf("api %d, proxy %d: start --smoke exited 0 with port %d in use\n%s", ports[0], ports[1], busyPort, out)
+			continue
+		}
+		if !strings.Contains(out, "Smoke check failed") || !strings.Contains(out, "address already in use") {
+			t.Errorf("api %d, proxy %d: output doesn't report the bind error:\n%s", ports[0], ports[1], out)
+		}
+	}
+}
+
+// runServer starts bin with args in dir, waits until the control API on
+// apiPort answers and returns its base URL. The server is interrupted, and
+// must exit cleanly, when the test ends.
+func runServer(t *testing.T, bin, dir string, apiPort int, args ...string) string {
+	t.Helper()
+	var out strings.Builder
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = dir
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Signal(syscall.SIGINT)
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("%v: %v\n%s", args, err, out.String())
+			}
+		case <-time.After(10 * time.Second):
+			cmd.Process.Kill()
+			t.Errorf("%v didn't stop after SIGINT\n%s", args, out.String())
+		}
+	})
+
+	base := fmt.Sprintf("http://localhost:%d", apiPort)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		resp, err := http.Get(base + "/api/rules")
+		if err == nil {
+			resp.Body.Close()
+			return base
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v: control API not up: %v\n%s", args, err, out.String())
+		}
+	}
+}
+
+// apiRules returns the rules listed by GET /api/rules.
+func apiRules(t *testing.T, base string) []map[string]any {
+	t.Helper()
+	resp, err := http.Get(base + "/api/rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var rules []map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&rules); err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+func TestStartSeedsRulesFromConfig(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+	dir := t.TempDir()
+	yaml := "rules:\n" +
+		"  - target: http://api.local/pay\n" +
+		"    failure: {type: error, error_code: 503}\n" +
+		"  - target: http://api.local/slow\n" +
+		"    failure: {type: latency, latency_ms: 300}\n"
+	if err := os.WriteFile(filepath.Join(dir, "faultline.yaml"), []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("with --config", func(t *testing.T) {
+		apiPort := freePort(t)
+		base := runServer(t, bin, dir, apiPort, "start", "--config", "faultline.yaml", "--data", "with.json",
+			"--api-port", strconv.Itoa(apiPort), "--proxy-port", strconv.Itoa(freePort(t)))
+		targets := map[string]bool{}
+		for _, rule := range apiRules(t, base) {
+			targets[rule["target"].(string)] = true
+		}
+		if len(targets) != 2 || !targets["http://api.local/pay"] || !targets["http://api.local/slow"] {
+			t.Errorf("GET /api/rules listed %v, want the two config rules", targets)
+		}
+	})
+
+	t.Run("without --config", func(t *testing.T) {
+		apiPort := freePort(t)
+		base := runServer(t, bin, dir, apiPort, "start", "--data", "without.json",
+			"--api-port", strconv.Itoa(apiPort), "--proxy-port", strconv.Itoa(freePort(t)))
+		if rules := apiRules(t, base); len(rules) != 0 {
+			t.Errorf("GET /api/rules listed %d rule(s), want none without --config", len(rules))
+		}
+	})
+}
+
+func TestStartAllServesEveryPort(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+	dir := t.TempDir()
+	apiPort, proxyPort, dbPort := freePort(t), freePort(t), freePort(t)
+	dbAddr := fmt.Sprintf("127.0.0.1:%d", dbPort)
+	yaml := "tcpRules:\n" +
+		"  - listen: " + dbAddr + "\n" +
+		"    upstream: echo\n"
+	if err := os.WriteFile(filepath.Join(dir, "faultline.yaml"), []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Runs after the server was interrupted: every port must be released.
+	t.Cleanup(func() {
+		for _, port := range []int{apiPort, proxyPort, dbPort} {
+			if conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+				conn.Close()
+				t.Errorf("port %d still accepting after shutdown", port)
+			}
+		}
+	})
+	runServer(t, bin, dir, apiPort, "start-all", "--config", "faultline.yaml", "--data", "rules.json",
+		"--api-port", strconv.Itoa(apiPort), "--proxy-port", strconv.Itoa(proxyPort))
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/http://127.0.0.1:%d/", proxyPort, apiPort))
+	if err != nil {
+		t.Fatalf("proxy port: %v", err)
+	}
+	resp.Body.Close()
+
+	conn, err := net.DialTimeout("tcp", dbAddr, time.Second)
+	if err != nil {
+		t.Fatalf("DB proxy port: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	reply := make([]byte, 4)
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Errorf("DB proxy echoed %q (%v), want ping", reply, err)
+	}
+}
+
+func TestApplyServerConfigFlagsWin(t *testing.T) {
+	sc := config.ServerConf{APIPort: 9001, ProxyPort: 9000, ShutdownTimeoutSeconds: 30, CORSOrigins: []string{"https://app.example.com"}}
+	newCmd := func(args ...string) (*cobra.Command, *int, *int, *time.Duration) {
+		var apiPort, proxyPort int
+		var shutdownTimeout time.Duration
+		cmd := &cobra.Command{}
+		cmd.Flags().IntVar(&proxyPort, "proxy-port", 8080, "")
+		cmd.Flags().IntVar(&apiPort, "api-port", 8081, "")
+		cmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", defaultShutdownTimeout, "")
+		if err := cmd.Flags().Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return cmd, &apiPort, &proxyPort, &shutdownTimeout
+	}
+
+	cmd, apiPort, proxyPort, shutdownTimeout := newCmd()
+	origins := applyServerConfig(cmd, sc, apiPort, proxyPort, shutdownTimeout)
+	if *apiPort != 9001 || *proxyPort != 9000 || *shutdownTimeout != 30*time.Second {
+		t.Errorf("without flags: api %d, proxy %d, shutdown %s; want the config's 9001, 9000, 30s", *apiPort, *proxyPort, *shutdownTimeout)
+	}
+	if len(origins) != 1 || origins[0] != "https://app.example.com" {
+		t.Errorf("CORS origins %v, want the config's", origins)
+	}
+
+	cmd, apiPort, proxyPort, shutdownTimeout = newCmd("--api-port", "7001", "--proxy-port", "7000", "--shutdown-timeout", "5s")
+	applyServerConfig(cmd, sc, apiPort, proxyPort, shutdownTimeout)
+	if *apiPort != 7001 || *proxyPort != 7000 || *shutdownTimeout != 5*time.Second {
+		t.Errorf("with flags: api %d, proxy %d, shutdown %s; want the flags' 7001, 7000, 5s", *apiPort, *proxyPort, *shutdownTimeout)
+	}
+
+	// An explicit flag equal to the default still wins.
+	cmd, apiPort, proxyPort, shutdownTimeout = newCmd("--proxy-port", "8080")
+	origins = applyServerConfig(cmd, config.ServerConf{ProxyPort: 9000}, apiPort, proxyPort, shutdownTimeout)
+	if *proxyPort != 8080 || *apiPort != 8081 {
+		t.Errorf("explicit default: api %d, proxy %d; want 8081, 8080", *apiPort, *proxyPort)
+	}
+	if len(origins) != len(defaultCORSOrigins) {
+		t.Errorf("CORS origins %v without config, want the defaults", origins)
+	}
+}
+
+func TestValidateConfigCommand(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"faultline.yaml": "rules:\n  - target: http://api.local\n    failure: {type: latency, latency_ms: 100}\n",
+		"invalid.yaml": "rules:\n" +
+			"  - target: http://api.local\n" +
+			"    failure:\n" +
+			"      type: error\n" +
+			"      errorCode: 503\n",
+		"broken.yaml": "rules: [\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		exitCode int
+		want     []string
+	}{
+		{nil, 0, []string{"✅ faultline.yaml is valid"}},
+		{[]string{"faultline.yaml"}, 0, []string{"✅ faultline.yaml is valid"}},
+		{[]string{"invalid.yaml"}, 1, []string{
+			"❌ invalid.yaml has 2 problem(s):",
+			"line 5: field errorCode not found",
+			"line 3: rules[0].failure.error_code: must be an HTTP status code", // the missing field's parent
+			"invalid.yaml is invalid",
+		}},
+		{[]string{"broken.yaml"}, 1, []string{"load broken.yaml: yaml:"}},
+		{[]string{"missing.yaml"}, 1, []string{"load missing.yaml: open missing.yaml: no such file or directory"}},
+	} {
+		cmd := exec.Command(bin, append([]string{"validate-config"}, tc.args...)...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "FAULTLINE_NO_BANNER=1")
+		out, _ := cmd.CombinedOutput()
+		if code := cmd.ProcessState.ExitCode(); code != tc.exitCode {
+			t.Errorf("validate-config %v: exit code %d, want %d\n%s", tc.args, code, tc.exitCode, out)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(string(out), want) {
+				t.Errorf("validate-config %v: output lacks %q:\n%s", tc.args, want, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"faultline/state"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// maintenanceRequest sends a maintenance mode request to the control API at
+// apiURL and decodes the setting it answers with. A nil m reads the setting.
+func maintenanceRequest(apiURL string, m *state.Maintenance) (state.Maintenance, error) {
+	url := strings.TrimSuffix(apiURL, "/") + "/api/maintenance"
+	client := &http.Client{Timeout: statsTimeout}
+	var resp *http.Response
+	var err error
+	if m == nil {
+		resp, err = client.Get(url)
+	} else {
+		body, _ := json.Marshal(m)
+		resp, err = client.Post(url, "application/json", bytes.NewReader(body))
+	}
+	if err != nil {
+		return state.Maintenance{}, fmt.Errorf("%w (is FaultLine running with its API on %s?)", err, apiURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return state.Maintenance{}, fmt.Errorf("%s answered %s: %s", apiURL, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var got state.Maintenance
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		return state.Maintenance{}, fmt.Errorf("unexpected response from %s: %w", apiURL, err)
+	}
+	return got, nil
+}
+
+// printMaintenance describes a maintenance mode setting.
+func printMaintenance(w io.Writer, m state.Maintenance) {
+	if !m.Enabled {
+		color.New(color.FgGreen, color.Bold).Fprintln(w, "✅ Maintenance mode is off: requests are proxied normally")
+		return
+	}
+	code, body := m.Response()
+	color.New(color.FgYellow, color.Bold).Fprintf(w, "🚧 Maintenance mode is on: every proxied request gets HTTP %d %q\n", code, body)
+	if m.Since != nil {
+		fmt.Fprintf(w, "   Since %s (%s ago)\n", m.Since.Format(time.RFC3339), time.Since(*m.Since).Round(time.Second))
+	}
+}
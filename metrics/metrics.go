@@ -0,0 +1,87 @@
+// Package metrics holds FaultLine's Prometheus metrics and serves them in the
+// Prometheus exposition format.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefaultBuckets are the histogram upper bounds (in seconds) used for latencies.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry holds the metrics below. It is separate from the default
+// registry so /metrics serves FaultLine's metrics only.
+var Registry = prometheus.NewRegistry()
+
+// Metrics exported by FaultLine, served by Handler.
+var (
+	RequestsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "faultline_requests_total",
+		Help: "Total requests handled by the HTTP proxy.",
+	})
+	FaultsInjected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "faultline_faults_injected_total",
+		Help: "Faults injected by the HTTP proxy.",
+	}, []string{"type", "rule"})
+	ProxyLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "faultline_proxy_latency_seconds",
+		Help:    "End-to-end HTTP proxy request latency in seconds.",
+		Buckets: DefaultBuckets,
+	})
+	UpstreamLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "faultline_upstream_latency_seconds",
+		Help:    "Time upstreams took to answer forwarded requests in seconds, excluding injected latency.",
+		Buckets: DefaultBuckets,
+	})
+	TCPConnectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "faultline_tcp_connections_total",
+		Help: "Connections accepted by the TCP proxies.",
+	}, []string{"listen"})
+	TCPActiveConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "faultline_tcp_active_connections",
+		Help: "Currently open TCP proxy connections.",
+	}, []string{"listen"})
+)
+
+func init() {
+	Registry.MustRegister(RequestsTotal, FaultsInjected, ProxyLatency, UpstreamLatency, TCPConnectionsTotal, TCPActiveConnections)
+}
+
+// Handler serves the registered metrics for Prometheus scrapes.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Requests returns how many requests the HTTP proxy has handled.
+func Requests() uint64 {
+	var m dto.Metric
+	if err := RequestsTotal.Write(&m); err != nil {
+		return 0
+	}
+	return uint64(m.GetCounter().GetValue())
+}
+
+// EachFault calls fn with the count of every fault type and rule
+// FaultsInjected has seen.
+func EachFault(fn func(faultType, rule string, n int64)) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		FaultsInjected.Collect(ch)
+		close(ch)
+	}()
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		labels := map[string]string{}
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		fn(labels["type"], labels["rule"], int64(m.GetCounter().GetValue()))
+	}
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerExportsMetrics(t *testing.T) {
+	RequestsTotal.Inc()
+	FaultsInjected.WithLabelValues("error", "rule-1").Inc()
+	ProxyLatency.Observe(0.2)
+	TCPActiveConnections.WithLabelValues("127.0.0.1:55432").Inc()
+	defer TCPActiveConnections.WithLabelValues("127.0.0.1:55432").Dec()
+
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"faultline_requests_total ",
+		`faultline_faults_injected_total{rule="rule-1",type="error"} 1`,
+		"faultline_proxy_latency_seconds_bucket",
+		"faultline_proxy_latency_seconds_count ",
+		`faultline_tcp_active_connections{listen="127.0.0.1:55432"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("scrape is missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestEachFault(t *testing.T) {
+	FaultsInjected.WithLabelValues("latency", "rule-2").Add(3)
+
+	var got int64
+	EachFault(func(faultType, rule string, n int64) {
+		if faultType == "latency" && rule == "rule-2" {
+			got = n
+		}
+	})
+	if got != 3 {
+		t.Errorf("EachFault reported %d latency faults for rule-2, want 3", got)
+	}
+}
@@ -0,0 +1,56 @@
+package openapi
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// parseCache keeps parsed specs in memory so repeated lookups of the same
+// file within a session skip parsing. Entries are invalidated when the file's
+// modification time or size changes.
+var parseCache = struct {
+	sync.Mutex
+	entries map[string]cachedSpec
+}{entries: make(map[string]cachedSpec)}
+
+type cachedSpec struct {
+	modTime time.Time
+	size    int64
+	result  *DiscoveredEndpoints
+}
+
+// ParseOpenAPISpec parses an OpenAPI specification file and extracts all endpoints.
+// Results are cached per file until the file changes.
+func ParseOpenAPISpec(specPath string) (*DiscoveredEndpoints, error) {
+	info, err := os.Stat(specPath)
+	if err != nil {
+		// Let the parser report the error (it also accepts URLs).
+		return parseOpenAPISpec(specPath)
+	}
+
+	parseCache.Lock()
+	entry, ok := parseCache.entries[specPath]
+	parseCache.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.result.clone(), nil
+	}
+
+	result, err := parseOpenAPISpec(specPath)
+	if err != nil {
+		return nil, err
+	}
+
+	parseCache.Lock()
+	parseCache.entries[specPath] = cachedSpec{modTime: info.ModTime(), size: info.Size(), result: result}
+	parseCache.Unlock()
+	return result.clone(), nil
+}
+
+// clone returns a copy callers may modify without affecting the cache.
+func (d *DiscoveredEndpoints) clone() *DiscoveredEndpoints {
+	c := *d
+	c.Endpoints = append([]Endpoint(nil), d.Endpoints...)
+	c.BaseURLs = append([]string(nil), d.BaseURLs...)
+	return &c
+}
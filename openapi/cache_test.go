@@ -0,0 +1,123 @@
+package openapi
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeSpec writes a Swagger 2.0 spec with a GET operation for path.
+func writeSpec(t testing.TB, file, path string) {
+	t.Helper()
+	spec := fmt.Sprintf(`{"swagger": "2.0", "info": {"title": "t", "version": "1"}, "host": "api.local",
+ "paths": {%q: {"get": {"operationId": "op", "responses": {"200": {"description": "ok"}}}}}}`, path)
+	if err := os.WriteFile(file, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parsedPath(t *testing.T, file string) string {
+	t.Helper()
+	d, err := ParseOpenAPISpec(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Endpoints) != 1 {
+		t.Fatalf("got %d endpoints, want 1", len(d.Endpoints))
+	}
+	return d.Endpoints[0].Path
+}
+
+func TestParseCacheInvalidatedWhenFileChanges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spec.json")
+	writeSpec(t, file, "/aaaa")
+	if got := parsedPath(t, file); got != "/aaaa" {
+		t.Fatalf("first parse: got %s, want /aaaa", got)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same size and modification time: the cached result is served.
+	writeSpec(t, file, "/bbbb")
+	if err := os.Chtimes(file, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got := parsedPath(t, file); got != "/aaaa" {
+		t.Errorf("unchanged modtime: got %s, want the cached /aaaa", got)
+	}
+
+	// A newer modification time invalidates it.
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := parsedPath(t, file); got != "/bbbb" {
+		t.Errorf("touched file: got %s, want the reparsed /bbbb", got)
+	}
+}
+
+func TestParseCacheResultsAreCopies(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spec.json")
+	writeSpec(t, file, "/users")
+	d, err := ParseOpenAPISpec(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Endpoints[0].Path = "/changed"
+	if got := parsedPath(t, file); got != "/users" {
+		t.Errorf("cached result was modified through a returned copy: got %s", got)
+	}
+}
+
+func TestParseCacheParallel(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spec.json")
+	writeSpec(t, file, "/users")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				d, err := ParseOpenAPISpec(file)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				d.Endpoints[0].Summary = "mine"
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkParseOpenAPISpec(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	file := filepath.Join(b.TempDir(), "spec.json")
+	writeSpec(b, file, "/users")
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseOpenAPISpec(file); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := parseOpenAPISpec(file); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
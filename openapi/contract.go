@@ -0,0 +1,448 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxContractProblems bounds how many problems are reported per response.
+const maxContractProblems = 10
+
+// maxSchemaDepth bounds how deeply nested (or recursive) schemas are followed
+// when validating.
+const maxSchemaDepth = 32
+
+// Contract holds the documented responses of a spec's operations, for
+// checking real responses against them. Both Swagger 2.0 (a response
+// "schema") and OpenAPI 3 ("content" per media type, with "components"
+// references) are read.
+type Contract struct {
+	ops []contractOp
+}
+
+// contractOp is one documented operation.
+type contractOp struct {
+	method    string
+	path      string   // path template, e.g. /users/{id}
+	segments  []string // path template split at "/"
+	bases     []string // base paths the template is relative to
+	responses map[string]any
+	doc       any // whole spec, for resolving $refs
+	swagger2  bool
+}
+
+// LoadContract reads the operations and response schemas of the specs.
+func LoadContract(specPaths []string) (*Contract, error) {
+	c := &Contract{}
+	for _, path := range specPaths {
+		raw, err := loadSpecDoc(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load OpenAPI spec from %s: %w", path, err)
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse OpenAPI spec %s: %w", path, err)
+		}
+		paths, _ := doc["paths"].(map[string]any)
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("%s has no paths", path)
+		}
+		_, swagger2 := doc["swagger"]
+		bases := specBasePaths(doc)
+		for tmpl, item := range paths {
+			ops, _ := item.(map[string]any)
+			for method, op := range ops {
+				opMap, ok := op.(map[string]any)
+				if !ok || !isHTTPMethod(method) {
+					continue
+				}
+				responses, _ := opMap["responses"].(map[string]any)
+				c.ops = append(c.ops, contractOp{
+					method:    strings.ToUpper(method),
+					path:      tmpl,
+					segments:  strings.Split(strings.Trim(tmpl, "/"), "/"),
+					bases:     bases,
+					responses: responses,
+					doc:       doc,
+					swagger2:  swagger2,
+				})
+			}
+		}
+	}
+	// Literal paths are tried before templated ones, so /users/me wins
+	// over /users/{id}.
+	sort.SliceStable(c.ops, func(i, j int) bool {
+		return strings.Count(c.ops[i].path, "{") < strings.Count(c.ops[j].path, "{")
+	})
+	return c, nil
+}
+
+// Operations returns how many operations the contract covers.
+func (c *Contract) Operations() int {
+	return len(c.ops)
+}
+
+// Check compares a response to the request method and URL path against the
+// contract. It returns the documented operation (e.g. "GET /users/{id}")
+// and the ways the response deviates from it, or "" for requests the
+// contract doesn't cover. Bodies are only validated when they are JSON.
+func (c *Contract) Check(method, path string, status int, contentType string, body []byte) (operation string, problems []string) {
+	op, ok := c.find(method, path)
+	if !ok {
+		return "", nil
+	}
+	operation = op.method + " " + op.path
+
+	resp, ok := op.response(status)
+	if !ok {
+		return operation, []string{fmt.Sprintf("status %d is not documented", status)}
+	}
+	schema, ok, problem := op.schemaFor(resp, contentType)
+	if problem != "" {
+		return operation, []string{problem}
+	}
+	if !ok || (contentType != "" && !strings.Contains(mediaType(contentType), "json")) {
+		return operation, nil
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return operation, []string{fmt.Sprintf("body is not valid JSON: %v", err)}
+	}
+	v := &schemaValidator{doc: op.doc}
+	v.validate(schema, value, "$", 0)
+	return operation, v.problems
+}
+
+// find returns the operation documenting method on path.
+func (c *Contract) find(method, path string) (contractOp, bool) {
+	method = strings.ToUpper(method)
+	for _, op := range c.ops {
+		if op.method == method && op.matches(path) {
+			return op, true
+		}
+	}
+	return contractOp{}, false
+}
+
+// matches reports whether path, with or without one of the base paths,
+// fits the operation's path template.
+func (op contractOp) matches(path string) bool {
+	candidates := []string{path}
+	for _, base := range op.bases {
+		if rest, ok := strings.CutPrefix(path, base); ok && base != "" && (rest == "" || rest[0] == '/') {
+			candidates = append(candidates, rest)
+		}
+	}
+	for _, p := range candidates {
+		segs := strings.Split(strings.Trim(p, "/"), "/")
+		if len(segs) != len(op.segments) {
+			continue
+		}
+		ok := true
+		for i, seg := range op.segments {
+			if seg != segs[i] && !(strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") && segs[i] != "") {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// response returns the documented response for status: its exact code, its
+// class ("5XX") or the default response.
+func (op contractOp) response(status int) (map[string]any, bool) {
+	code := strconv.Itoa(status)
+	for _, key := range []string{code, code[:1] + "XX", code[:1] + "xx", "default"} {
+		if r, ok := op.responses[key].(map[string]any); ok {
+			return op.resolveObject(r), true
+		}
+	}
+	return nil, false
+}
+
+// schemaFor returns the response's schema for the content type. problem is
+// set when the spec lists media types and none fits.
+func (op contractOp) schemaFor(resp map[string]any, contentType string) (schema any, ok bool, problem string) {
+	if op.swagger2 {
+		schema, ok = resp["schema"]
+		return schema, ok, ""
+	}
+	content, _ := resp["content"].(map[string]any)
+	if len(content) == 0 {
+		return nil, false, ""
+	}
+	media := mediaType(contentType)
+	if media == "" {
+		media = "application/json"
+	}
+	major, _, _ := strings.Cut(media, "/")
+	for _, key := range []string{media, major + "/*", "*/*"} {
+		if m, ok := content[key].(map[string]any); ok {
+			schema, ok = m["schema"]
+			return schema, ok, ""
+		}
+	}
+	return nil, false, fmt.Sprintf("Content-Type %s is not documented", media)
+}
+
+// resolveObject follows a $ref on a response or schema object.
+func (op contractOp) resolveObject(obj map[string]any) map[string]any {
+	for range maxSchemaDepth {
+		ref, ok := obj["$ref"].(string)
+		if !ok {
+			return obj
+		}
+		next, ok := resolvePointer(op.doc, ref).(map[string]any)
+		if !ok {
+			return obj
+		}
+		obj = next
+	}
+	return obj
+}
+
+// schemaValidator checks values against JSON schemas, collecting problems.
+type schemaValidator struct {
+	doc      any
+	problems []string
+}
+
+func (v *schemaValidator) fail(at, format string, args ...any) {
+	if len(v.problems) < maxContractProblems {
+		v.problems = append(v.problems, at+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+// validate checks value at the JSON path at against schema. It supports
+// type (with nullable), enum, required, properties, additionalProperties,
+// items, allOf, anyOf and oneOf; other keywords are ignored.
+func (v *schemaValidator) validate(schema, value any, at string, depth int) {
+	s, ok := schema.(map[string]any)
+	if !ok || depth > maxSchemaDepth {
+		if b, isBool := schema.(bool); isBool && !b {
+			v.fail(at, "no value is allowed here")
+		}
+		return
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		if resolved := resolvePointer(v.doc, ref); resolved != nil {
+			v.validate(resolved, value, at, depth+1)
+		}
+		return
+	}
+
+	for _, sub := range asSlice(s["allOf"]) {
+		v.validate(sub, value, at, depth+1)
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		if alts := asSlice(s[key]); len(alts) > 0 && !v.matchesAny(alts, value, depth) {
+			v.fail(at, "matches none of the %s schemas", key)
+		}
+	}
+
+	if value == nil && s["nullable"] == true {
+		return
+	}
+	if types := schemaTypes(s); len(types) > 0 && !hasType(types, value) {
+		v.fail(at, "expected %s, got %s", strings.Join(types, " or "), jsonType(value))
+		return
+	}
+	if enum := asSlice(s["enum"]); len(enum) > 0 && !containsValue(enum, value) {
+		v.fail(at, "%s is not one of the allowed values", compactJSON(value))
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		props, _ := s["properties"].(map[string]any)
+		for _, name := range asSlice(s["required"]) {
+			if n, ok := name.(string); ok {
+				if _, present := val[n]; !present {
+					v.fail(at, "missing required property %q", n)
+				}
+			}
+		}
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := at + "." + name
+			if prop, ok := props[name]; ok {
+				v.validate(prop, val[name], child, depth+1)
+				continue
+			}
+			switch extra := s["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					v.fail(child, "property is not allowed")
+				}
+			case map[string]any:
+				v.validate(extra, val[name], child, depth+1)
+			}
+		}
+	case []any:
+		if items, ok := s["items"]; ok {
+			for i, item := range val {
+				v.validate(items, item, fmt.Sprintf("%s[%d]", at, i), depth+1)
+			}
+		}
+	}
+}
+
+// matchesAny reports whether value is valid against one of the schemas.
+func (v *schemaValidator) matchesAny(schemas []any, value any, depth int) bool {
+	for _, alt := range schemas {
+		trial := &schemaValidator{doc: v.doc}
+		trial.validate(alt, value, "", depth+1)
+		if len(trial.problems) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaTypes returns the types a schema allows: "type" as a string or, in
+// OpenAPI 3.1, a list.
+func schemaTypes(s map[string]any) []string {
+	switch t := s["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, x := range t {
+			if name, ok := x.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// hasType reports whether value is of one of the JSON schema types.
+func hasType(types []string, value any) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual || t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType names the JSON schema type of a decoded JSON value.
+func jsonType(value any) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func containsValue(values []any, value any) bool {
+	for _, x := range values {
+		if reflect.DeepEqual(x, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+func compactJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// resolvePointer resolves a local reference such as
+// "#/components/schemas/User" within doc. Other references resolve to nil.
+func resolvePointer(doc any, ref string) any {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil
+	}
+	cur := doc
+	for _, part := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(part); err == nil {
+			part = unescaped
+		}
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = obj[part]
+	}
+	return cur
+}
+
+// specBasePaths returns the path prefixes operations are relative to:
+// Swagger 2.0's basePath, or the paths of OpenAPI 3 server URLs.
+func specBasePaths(doc map[string]any) []string {
+	var bases []string
+	if bp, ok := doc["basePath"].(string); ok && bp != "/" {
+		bases = append(bases, strings.TrimSuffix(bp, "/"))
+	}
+	for _, s := range asSlice(doc["servers"]) {
+		server, _ := s.(map[string]any)
+		raw, _ := server["url"].(string)
+		if u, err := url.Parse(raw); err == nil && u.Path != "" && u.Path != "/" {
+			bases = append(bases, strings.TrimSuffix(u.Path, "/"))
+		}
+	}
+	return bases
+}
+
+// mediaType returns the media type of a Content-Type header, lower-cased
+// and without parameters.
+func mediaType(contentType string) string {
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return media
+}
+
+func isHTTPMethod(m string) bool {
+	switch strings.ToLower(m) {
+	case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+		return true
+	}
+	return false
+}
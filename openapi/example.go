@@ -0,0 +1,245 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// maxExampleDepth bounds how deeply nested (or recursive) schemas are
+// expanded when generating examples.
+const maxExampleDepth = 8
+
+// GenerateExample builds a plausible JSON body for the response of an
+// endpoint in the spec. status selects the response; zero picks the lowest
+// 2xx response. Examples given in the spec are used when present, otherwise
+// one is generated from the response schema. overrides replaces fields of the
+// generated body by dotted path (e.g. "user.name"), creating them if needed.
+func GenerateExample(specPath, method, path string, status int, overrides map[string]any) ([]byte, error) {
+	doc, err := loadSpec(specPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenAPI spec from %s: %w", specPath, err)
+	}
+	sw := doc.Spec()
+
+	op, err := findOperation(sw, method, path)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := findResponse(op, status)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+	}
+
+	var example any
+	if ex, ok := resp.Examples["application/json"]; ok {
+		example = ex
+	} else if resp.Schema != nil {
+		example = ExampleFromSchema(sw, resp.Schema)
+	} else if len(overrides) == 0 {
+		return nil, fmt.Errorf("%s %s: response has no schema or example", strings.ToUpper(method), path)
+	}
+	for field, value := range overrides {
+		example = setPath(example, strings.Split(field, "."), value)
+	}
+	return json.MarshalIndent(example, "", "  ")
+}
+
+// findOperation returns the operation for method on path.
+func findOperation(sw *spec.Swagger, method, path string) (*spec.Operation, error) {
+	if sw.Paths == nil {
+		return nil, fmt.Errorf("spec has no paths")
+	}
+	item, ok := sw.Paths.Paths[path]
+	if !ok {
+		return nil, fmt.Errorf("path %s not found in spec", path)
+	}
+	var op *spec.Operation
+	switch strings.ToUpper(method) {
+	case http.MethodGet:
+		op = item.Get
+	case http.MethodPost:
+		op = item.Post
+	case http.MethodPut:
+		op = item.Put
+	case http.MethodDelete:
+		op = item.Delete
+	case http.MethodPatch:
+		op = item.Patch
+	case http.MethodHead:
+		op = item.Head
+	case http.MethodOptions:
+		op = item.Options
+	}
+	if op == nil {
+		return nil, fmt.Errorf("%s %s not found in spec", strings.ToUpper(method), path)
+	}
+	return op, nil
+}
+
+// findResponse returns the operation's response for status, falling back to
+// the default response. Zero selects the lowest 2xx response.
+func findResponse(op *spec.Operation, status int) (*spec.Response, error) {
+	if op.Responses == nil {
+		return nil, fmt.Errorf("no responses defined")
+	}
+	if status == 0 {
+		codes := make([]int, 0, len(op.Responses.StatusCodeResponses))
+		for code := range op.Responses.StatusCodeResponses {
+			if code >= 200 && code < 300 {
+				codes = append(codes, code)
+			}
+		}
+		if len(codes) > 0 {
+			sort.Ints(codes)
+			status = codes[0]
+		}
+	}
+	if resp, ok := op.Responses.StatusCodeResponses[status]; ok {
+		return &resp, nil
+	}
+	if op.Responses.Default != nil {
+		return op.Responses.Default, nil
+	}
+	if status == 0 {
+		return nil, fmt.Errorf("no 2xx response defined")
+	}
+	return nil, fmt.Errorf("no %d response defined", status)
+}
+
+// ExampleFromSchema returns an example value matching schema: the schema's
+// own example, default or first enum value if it has one, otherwise a value
+// of the declared type built from its properties or items. References are
+// resolved against root.
+func ExampleFromSchema(root *spec.Swagger, schema *spec.Schema) any {
+	return exampleFromSchema(root, schema, 0)
+}
+
+func exampleFromSchema(root *spec.Swagger, s *spec.Schema, depth int) any {
+	if s == nil || depth > maxExampleDepth {
+		return nil
+	}
+	if s.Ref.String() != "" {
+		resolved, err := spec.ResolveRef(root, &s.Ref)
+		if err != nil {
+			return nil
+		}
+		return exampleFromSchema(root, resolved, depth+1)
+	}
+	switch {
+	case s.Example != nil:
+		return s.Example
+	case s.Default != nil:
+		return s.Default
+	case len(s.Enum) > 0:
+		return s.Enum[0]
+	}
+
+	if len(s.AllOf) > 0 {
+		merged := map[string]any{}
+		for i := range s.AllOf {
+			if part, ok := exampleFromSchema(root, &s.AllOf[i], depth+1).(map[string]any); ok {
+				for k, v := range part {
+					merged[k] = v
+				}
+			}
+		}
+		for k, v := range objectExample(root, s, depth) {
+			merged[k] = v
+		}
+		return merged
+	}
+
+	typ := ""
+	if len(s.Type) > 0 {
+		typ = s.Type[0]
+	} else if len(s.Properties) > 0 {
+		typ = "object"
+	} else if s.Items != nil {
+		typ = "array"
+	}
+
+	switch typ {
+	case "object":
+		return objectExample(root, s, depth)
+	case "array":
+		if s.Items == nil || s.Items.Schema == nil {
+			return []any{}
+		}
+		return []any{exampleFromSchema(root, s.Items.Schema, depth+1)}
+	case "string":
+		return stringExample(s.Format)
+	case "integer":
+		if s.Minimum != nil {
+			return int64(*s.Minimum)
+		}
+		return 0
+	case "number":
+		if s.Minimum != nil {
+			return *s.Minimum
+		}
+		return 0.0
+	case "boolean":
+		return false
+	}
+	return nil
+}
+
+// objectExample builds an example for each of the schema's properties.
+func objectExample(root *spec.Swagger, s *spec.Schema, depth int) map[string]any {
+	obj := make(map[string]any, len(s.Properties))
+	for name, prop := range s.Properties {
+		obj[name] = exampleFromSchema(root, &prop, depth+1)
+	}
+	return obj
+}
+
+// stringExample returns a sample string for a string format.
+func stringExample(format string) string {
+	switch format {
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "email":
+		return "user@example.com"
+	case "uuid":
+		return "00000000-0000-0000-0000-000000000000"
+	case "uri", "url":
+		return "https://example.com"
+	case "hostname":
+		return "example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "ipv6":
+		return "2001:db8::1"
+	case "byte":
+		return "ZXhhbXBsZQ=="
+	}
+	return "string"
+}
+
+// setPath sets the field at path within v, creating objects along the way,
+// and returns the updated value. Numeric segments index into arrays.
+func setPath(v any, path []string, value any) any {
+	if len(path) == 0 {
+		return value
+	}
+	if arr, ok := v.([]any); ok {
+		if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(arr) {
+			arr[i] = setPath(arr[i], path[1:], value)
+			return arr
+		}
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		obj = map[string]any{}
+	}
+	obj[path[0]] = setPath(obj[path[0]], path[1:], value)
+	return obj
+}
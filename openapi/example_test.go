@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const exampleSpec = `swagger: "2.0"
+info: {title: Users, version: "1"}
+host: api.local
+paths:
+  /users:
+    get:
+      responses:
+        "200":
+          description: users
+          schema: {type: array, items: {$ref: "#/definitions/User"}}
+  /users/{id}:
+    get:
+      parameters: [{name: id, in: path, required: true, type: integer}]
+      responses:
+        "200": {description: user, schema: {$ref: "#/definitions/User"}}
+        "404": {description: missing, schema: {$ref: "#/definitions/Error"}}
+  /users/count:
+    get:
+      responses:
+        "200": {description: count, schema: {type: integer, minimum: 1}}
+  /health:
+    get:
+      responses:
+        "200":
+          description: ok
+          schema: {type: object}
+          examples: {application/json: {status: up}}
+  /tree:
+    get:
+      responses:
+        "200": {description: tree, schema: {$ref: "#/definitions/Node"}}
+definitions:
+  User:
+    type: object
+    properties:
+      id: {type: integer, minimum: 1}
+      email: {type: string, format: email}
+      score: {type: number}
+      active: {type: boolean}
+      role: {type: string, enum: [admin, member]}
+      tags: {type: array, items: {type: string}}
+      address:
+        properties:
+          city: {type: string, default: Berlin}
+  Error:
+    allOf:
+      - properties: {code: {type: integer}}
+      - properties: {message: {type: string, example: not found}}
+  Node:
+    type: object
+    properties:
+      children: {type: array, items: {$ref: "#/definitions/Node"}}
+`
+
+func TestGenerateExampleFromSchemas(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "users.yaml")
+	if err := os.WriteFile(file, []byte(exampleSpec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	user := map[string]any{
+		"id": 1.0, "email": "user@example.com", "score": 0.0, "active": false, "role": "admin",
+		"tags": []any{"string"}, "address": map[string]any{"city": "Berlin"},
+	}
+
+	for _, tc := range []struct {
+		path      string
+		status    int
+		overrides map[string]any
+		want      any
+	}{
+		{"/users/{id}", 0, nil, user},
+		{"/users", 0, nil, []any{user}},
+		{"/users/count", 0, nil, 1.0},
+		{"/users/{id}", 404, nil, map[string]any{"code": 0.0, "message": "not found"}},
+		{"/health", 0, nil, map[string]any{"status": "up"}},
+		{"/users/{id}", 0, map[string]any{"address.city": "Lagos", "id": 7}, func() any {
+			u := map[string]any{}
+			for k, v := range user {
+				u[k] = v
+			}
+			u["id"], u["address"] = 7.0, map[string]any{"city": "Lagos"}
+			return u
+		}()},
+	} {
+		data, err := GenerateExample(file, "get", tc.path, tc.status, tc.overrides)
+		if err != nil {
+			t.Errorf("%s %d: %v", tc.path, tc.status, err)
+			continue
+		}
+		var got any
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: invalid JSON %s", tc.path, data)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s %d: got %s, want %v", tc.path, tc.status, data, tc.want)
+		}
+	}
+
+	// Recursive schemas stop at maxExampleDepth instead of looping.
+	if _, err := GenerateExample(file, "GET", "/tree", 0, nil); err != nil {
+		t.Errorf("/tree: %v", err)
+	}
+	if _, err := GenerateExample(file, "GET", "/users/{id}", 500, nil); err == nil {
+		t.Error("undocumented status: no error")
+	}
+}
@@ -2,13 +2,13 @@ package openapi
 
 import (
 	"fmt"
+	"io/fs"
 	"log"
 	"net/url"
 	"path/filepath"
 	"sort"
 	"strings"
 
-	"github.com/go-openapi/loads"
 	"github.com/go-openapi/spec"
 )
 
@@ -16,11 +16,13 @@ import (
 type Endpoint struct {
 	Path        string   `json:"path"`
 	Method      string   `json:"method"`
+	OperationID string   `json:"operationId,omitempty"`
 	Summary     string   `json:"summary,omitempty"`
 	Description string   `json:"description,omitempty"`
 	Tags        []string `json:"tags,omitempty"`
 	BaseURL     string   `json:"baseUrl,omitempty"`
 	FullURL     string   `json:"fullUrl,omitempty"`
+	Source      string   `json:"source,omitempty"` // Spec file the endpoint came from, set when merging specs
 }
 
 // DiscoveredEndpoints contains all discovered endpoints and metadata
@@ -35,22 +37,16 @@ type DiscoveredEndpoints struct {
 	Source string `json:"source"` // File path of the OpenAPI spec
 }
 
-// ParseOpenAPISpec parses an OpenAPI specification file and extracts all endpoints
-func ParseOpenAPISpec(specPath string) (*DiscoveredEndpoints, error) {
+// parseOpenAPISpec parses an OpenAPI specification file and extracts all endpoints
+func parseOpenAPISpec(specPath string) (*DiscoveredEndpoints, error) {
 	// Load the OpenAPI spec
-	doc, err := loads.Spec(specPath)
+	doc, err := loadSpec(specPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load OpenAPI spec from %s: %w", specPath, err)
 	}
 
-	// Validate the spec (optional, some specs might have minor issues)
-	// Note: Validation is optional as some specs might still be usable despite minor issues
-	/*
-		if err := doc.Spec().Validate(); err != nil {
-			log.Printf("[WARNING] OpenAPI spec validation failed: %v", err)
-			// Continue despite validation errors as some specs might still be usable
-		}
-	*/
+	// Parsing is best-effort: some specs are still usable despite minor
+	// issues. ParseOpenAPISpecStrict validates first for callers that want that.
 
 	result := &DiscoveredEndpoints{
 		Endpoints: []Endpoint{},
@@ -145,6 +141,7 @@ func extractEndpointsFromPath(path string, pathItem spec.PathItem, baseURLs []st
 		endpoint := Endpoint{
 			Path:        path,
 			Method:      method,
+			OperationID: operation.ID,
 			Summary:     operation.Summary,
 			Description: operation.Description,
 			Tags:        operation.Tags,
@@ -162,6 +159,71 @@ func extractEndpointsFromPath(path string, pathItem spec.PathItem, baseURLs []st
 	return endpoints
 }
 
+// SelectOperations returns the endpoints with the given operationIds, in the
+// order the IDs are listed, so rules can be generated from a spec without
+// picking endpoints interactively. IDs no endpoint has are reported in the
+// error.
+func SelectOperations(endpoints []Endpoint, ids []string) ([]Endpoint, error) {
+	byID := make(map[string]Endpoint, len(endpoints))
+	for _, ep := range endpoints {
+		if ep.OperationID != "" {
+			byID[ep.OperationID] = ep
+		}
+	}
+	var selected []Endpoint
+	var unknown []string
+	for _, id := range ids {
+		if ep, ok := byID[id]; ok {
+			selected = append(selected, ep)
+		} else {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown operationId(s): %s", strings.Join(unknown, ", "))
+	}
+	return selected, nil
+}
+
+// MergeDiscovered combines the endpoints of several specs into one result,
+// keeping the first endpoint seen for each method and full URL. Each endpoint
+// records the spec it came from in Source.
+func MergeDiscovered(specs []DiscoveredEndpoints) *DiscoveredEndpoints {
+	merged := &DiscoveredEndpoints{
+		Endpoints: []Endpoint{},
+		BaseURLs:  []string{},
+	}
+	seenEndpoints := make(map[string]bool)
+	seenBaseURLs := make(map[string]bool)
+	var sources []string
+
+	for _, d := range specs {
+		sources = append(sources, d.Source)
+		for _, baseURL := range d.BaseURLs {
+			if !seenBaseURLs[baseURL] {
+				seenBaseURLs[baseURL] = true
+				merged.BaseURLs = append(merged.BaseURLs, baseURL)
+			}
+		}
+		for _, ep := range d.Endpoints {
+			target := ep.FullURL
+			if target == "" {
+				target = ep.BaseURL + ep.Path
+			}
+			key := ep.Method + " " + target
+			if seenEndpoints[key] {
+				continue
+			}
+			seenEndpoints[key] = true
+			ep.Source = d.Source
+			merged.Endpoints = append(merged.Endpoints, ep)
+		}
+	}
+
+	merged.Source = strings.Join(sources, ", ")
+	return merged
+}
+
 // buildFullURL constructs a full URL from base URL and path
 func buildFullURL(baseURL, path string) string {
 	// Parse base URL
@@ -181,7 +243,8 @@ func buildFullURL(baseURL, path string) string {
 	return fullURL.String()
 }
 
-// FindOpenAPISpecs searches for OpenAPI specification files in common locations
+// FindOpenAPISpecs searches rootDir and its subdirectories for OpenAPI
+// specification files, matched by common file names.
 func FindOpenAPISpecs(rootDir string) ([]string, error) {
 	var specs []string
 
@@ -199,15 +262,34 @@ func FindOpenAPISpecs(rootDir string) ([]string, error) {
 
 	extensions := []string{".yaml", ".yml", ".json"}
 
-	for _, pattern := range patterns {
-		for _, ext := range extensions {
-			searchPattern := filepath.Join(rootDir, pattern+ext)
-			matches, err := filepath.Glob(searchPattern)
-			if err != nil {
-				continue
+	err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable directories are skipped rather than aborting the search
+			if d != nil && d.IsDir() && path != rootDir {
+				return filepath.SkipDir
 			}
-			specs = append(specs, matches...)
+			return err
 		}
+		if d.IsDir() {
+			if path != rootDir && skipSpecDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := d.Name()
+		for _, pattern := range patterns {
+			for _, ext := range extensions {
+				if ok, _ := filepath.Match(pattern+ext, name); ok {
+					specs = append(specs, path)
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Remove duplicates
@@ -223,19 +305,35 @@ func FindOpenAPISpecs(rootDir string) ([]string, error) {
 	return result, nil
 }
 
+// skipSpecDirs are directories never searched for specs.
+var skipSpecDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	".git":         true,
+}
+
 // ValidateOpenAPIFile checks if a file appears to be an OpenAPI specification
 func ValidateOpenAPIFile(filePath string) bool {
-	doc, err := loads.Spec(filePath)
+	return CheckSpec(filePath) == nil
+}
+
+// CheckSpec reports why a file or URL can't be used as an OpenAPI
+// specification, or nil if it can.
+func CheckSpec(path string) error {
+	doc, err := loadSpec(path)
 	if err != nil {
-		return false
+		return err
 	}
 
 	// Check for OpenAPI/Swagger indicators
 	spec := doc.Spec()
 	if spec == nil {
-		return false
+		return fmt.Errorf("%s is not an OpenAPI specification", path)
 	}
 
 	// Check for OpenAPI version or Swagger version
-	return spec.Swagger != "" || (spec.Info != nil && spec.Info.Title != "")
+	if spec.Swagger == "" && (spec.Info == nil || spec.Info.Title == "") {
+		return fmt.Errorf("%s is not an OpenAPI specification", path)
+	}
+	return nil
 }
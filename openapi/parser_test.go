@@ -0,0 +1,45 @@
+package openapi
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFindOpenAPISpecsSearchesSubdirectories(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"openapi.yaml",
+		"services/billing/billing-api.json",
+		"services/users/v2/swagger.yml",
+		"docs/README.md",
+		"docs/config.yaml",
+		"node_modules/some-lib/openapi.yaml",
+		"services/vendor/spec.json",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	specs, err := FindOpenAPISpecs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, spec := range specs {
+		specs[i], _ = filepath.Rel(root, spec)
+	}
+	want := []string{
+		"openapi.yaml",
+		filepath.Join("services", "billing", "billing-api.json"),
+		filepath.Join("services", "users", "v2", "swagger.yml"),
+	}
+	if !slices.Equal(specs, want) {
+		t.Errorf("found %q, want %q", specs, want)
+	}
+}
@@ -0,0 +1,148 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/loads"
+	"github.com/go-openapi/swag"
+)
+
+// RemoteAuth holds the credentials sent when fetching specs over HTTP(S).
+type RemoteAuth struct {
+	Header   string // a full header line, e.g. "Authorization: Bearer xyz" or "X-API-Key: abc"
+	Username string // HTTP basic auth, used when Header is empty
+	Password string
+}
+
+// Environment variables read when no credentials were set explicitly.
+const (
+	EnvSpecAuthHeader = "FAULTLINE_SPEC_AUTH_HEADER"
+	EnvSpecBasicAuth  = "FAULTLINE_SPEC_BASIC_AUTH" // user:password
+)
+
+var remoteAuth struct {
+	sync.RWMutex
+	auth *RemoteAuth
+}
+
+// SetRemoteAuth sets the credentials used for remote spec fetches, replacing
+// those from the environment.
+func SetRemoteAuth(a RemoteAuth) error {
+	if a.Header != "" {
+		if name, _, ok := strings.Cut(a.Header, ":"); !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid auth header %q: expected 'Name: value'", a.Header)
+		}
+	}
+	remoteAuth.Lock()
+	defer remoteAuth.Unlock()
+	remoteAuth.auth = &a
+	return nil
+}
+
+// ParseBasicAuth splits a "user:password" pair.
+func ParseBasicAuth(s string) (RemoteAuth, error) {
+	user, pass, ok := strings.Cut(s, ":")
+	if !ok || user == "" {
+		return RemoteAuth{}, fmt.Errorf("invalid basic auth %q: expected user:password", s)
+	}
+	return RemoteAuth{Username: user, Password: pass}, nil
+}
+
+// currentRemoteAuth returns the explicit credentials, or those from the environment.
+func currentRemoteAuth() RemoteAuth {
+	remoteAuth.RLock()
+	defer remoteAuth.RUnlock()
+	if remoteAuth.auth != nil {
+		return *remoteAuth.auth
+	}
+	a := RemoteAuth{Header: os.Getenv(EnvSpecAuthHeader)}
+	if basic := os.Getenv(EnvSpecBasicAuth); basic != "" && a.Header == "" {
+		a, _ = ParseBasicAuth(basic)
+	}
+	return a
+}
+
+// RemoteAuthError reports a spec server rejecting the request's credentials.
+type RemoteAuthError struct {
+	URL        string
+	StatusCode int
+	HasAuth    bool // whether credentials were sent
+}
+
+func (e *RemoteAuthError) Error() string {
+	if !e.HasAuth {
+		return fmt.Sprintf("%s requires authentication (HTTP %d); pass --spec-auth-header or set %s", e.URL, e.StatusCode, EnvSpecAuthHeader)
+	}
+	return fmt.Sprintf("%s rejected the configured credentials (HTTP %d)", e.URL, e.StatusCode)
+}
+
+// IsRemoteSpec reports whether a spec location is an HTTP(S) URL.
+func IsRemoteSpec(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// loadSpec loads a spec from a file or URL, sending the configured
+// credentials for URLs.
+func loadSpec(path string) (*loads.Document, error) {
+	return loads.Spec(path, loads.WithDocLoader(loadSpecDoc))
+}
+
+// loadSpecDoc is the document loader for loadSpec. It loads the spec
+// document itself; documents it references are fetched without credentials.
+func loadSpecDoc(path string) (json.RawMessage, error) {
+	if !IsRemoteSpec(path) {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			return swag.YAMLDoc(path)
+		}
+		return loads.JSONDoc(path)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	auth := currentRemoteAuth()
+	hasAuth := true
+	switch {
+	case auth.Header != "":
+		name, value, _ := strings.Cut(auth.Header, ":")
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	case auth.Username != "":
+		req.SetBasicAuth(auth.Username, auth.Password)
+	default:
+		hasAuth = false
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, &RemoteAuthError{URL: path, StatusCode: resp.StatusCode, HasAuth: hasAuth}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: HTTP %d", path, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Specs served as YAML are converted; JSON is valid YAML too.
+	doc, err := swag.BytesToYAMLDoc(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return swag.YAMLToJSON(doc)
+}
@@ -0,0 +1,74 @@
+package openapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemoteSpecsAreFetchedWithCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, basic := r.BasicAuth()
+		if r.Header.Get("X-API-Key") != "secret" && !(basic && user == "ci" && pass == "hunter2") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/openapi.yaml":
+			w.Write([]byte(`swagger: "2.0"
+info: {title: Remote, version: "1"}
+host: api.local
+paths:
+  /users:
+    get:
+      responses:
+        "200": {description: users}
+`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { remoteAuth.auth = nil })
+	url := srv.URL + "/openapi.yaml"
+
+	remoteAuthError := func(auth *RemoteAuth) *RemoteAuthError {
+		t.Helper()
+		remoteAuth.auth = auth
+		_, err := ParseOpenAPISpec(url)
+		var authErr *RemoteAuthError
+		if !errors.As(err, &authErr) {
+			t.Fatalf("auth %+v: got %v, want a *RemoteAuthError", auth, err)
+		}
+		return authErr
+	}
+	if e := remoteAuthError(&RemoteAuth{}); e.HasAuth || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without credentials: %+v", e)
+	}
+	if e := remoteAuthError(&RemoteAuth{Header: "X-API-Key: wrong"}); !e.HasAuth {
+		t.Errorf("with wrong credentials: %+v, want them reported as rejected", e)
+	}
+
+	for name, auth := range map[string]*RemoteAuth{
+		"header":     {Header: "X-API-Key: secret"},
+		"basic auth": {Username: "ci", Password: "hunter2"},
+	} {
+		remoteAuth.auth = auth
+		d, err := ParseOpenAPISpec(url)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(d.Endpoints) != 1 || d.Endpoints[0].Path != "/users" {
+			t.Errorf("%s: endpoints %+v, want GET /users", name, d.Endpoints)
+		}
+	}
+
+	// Without explicit credentials the environment is used.
+	remoteAuth.auth = nil
+	t.Setenv(EnvSpecBasicAuth, "ci:hunter2")
+	if _, err := ParseOpenAPISpec(url); err != nil {
+		t.Errorf("%s: %v", EnvSpecBasicAuth, err)
+	}
+}
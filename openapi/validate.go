@@ -0,0 +1,139 @@
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// ValidationError lists the problems found by strict validation of a spec.
+type ValidationError struct {
+	Spec     string   `json:"spec"`
+	Problems []string `json:"problems"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s has %d validation problem(s): %s", e.Spec, len(e.Problems), strings.Join(e.Problems, "; "))
+}
+
+// ParseSpec parses a spec leniently, or validates it first when strict is set.
+func ParseSpec(specPath string, strict bool) (*DiscoveredEndpoints, error) {
+	if strict {
+		return ParseOpenAPISpecStrict(specPath)
+	}
+	return ParseOpenAPISpec(specPath)
+}
+
+// ParseOpenAPISpecStrict validates a spec before parsing it. Instead of
+// best-effort parsing it returns a *ValidationError listing every problem.
+func ParseOpenAPISpecStrict(specPath string) (*DiscoveredEndpoints, error) {
+	doc, err := loadSpec(specPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenAPI spec from %s: %w", specPath, err)
+	}
+	if problems := validateSpec(doc.Spec()); len(problems) > 0 {
+		return nil, &ValidationError{Spec: specPath, Problems: problems}
+	}
+	return ParseOpenAPISpec(specPath)
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// validateSpec checks the structural rules of a Swagger 2.0 document that
+// best-effort parsing silently tolerates.
+func validateSpec(sw *spec.Swagger) []string {
+	var problems []string
+	if sw.Swagger != "2.0" {
+		problems = append(problems, fmt.Sprintf("swagger version must be \"2.0\", got %q", sw.Swagger))
+	}
+	if sw.Info == nil {
+		problems = append(problems, "info is required")
+	} else {
+		if sw.Info.Title == "" {
+			problems = append(problems, "info.title is required")
+		}
+		if sw.Info.Version == "" {
+			problems = append(problems, "info.version is required")
+		}
+	}
+	if sw.BasePath != "" && !strings.HasPrefix(sw.BasePath, "/") {
+		problems = append(problems, fmt.Sprintf("basePath %q must start with /", sw.BasePath))
+	}
+	if sw.Paths == nil || len(sw.Paths.Paths) == 0 {
+		return append(problems, "paths must define at least one path")
+	}
+
+	paths := make([]string, 0, len(sw.Paths.Paths))
+	for path := range sw.Paths.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	operationIDs := make(map[string]string)
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/") {
+			problems = append(problems, fmt.Sprintf("path %q must start with /", path))
+		}
+		item := sw.Paths.Paths[path]
+		for _, op := range []struct {
+			method string
+			op     *spec.Operation
+		}{{"GET", item.Get}, {"POST", item.Post}, {"PUT", item.Put}, {"DELETE", item.Delete}, {"PATCH", item.Patch}, {"HEAD", item.Head}, {"OPTIONS", item.Options}} {
+			if op.op == nil {
+				continue
+			}
+			where := op.method + " " + path
+			if op.op.Responses == nil || (op.op.Responses.Default == nil && len(op.op.Responses.StatusCodeResponses) == 0) {
+				problems = append(problems, where+": at least one response is required")
+			}
+			if id := op.op.ID; id != "" {
+				if other, dup := operationIDs[id]; dup {
+					problems = append(problems, fmt.Sprintf("%s: operationId %q is already used by %s", where, id, other))
+				} else {
+					operationIDs[id] = where
+				}
+			}
+			problems = append(problems, checkPathParams(where, path, item.Parameters, op.op.Parameters)...)
+		}
+	}
+	return problems
+}
+
+// checkPathParams reports path template variables without a matching
+// required "in: path" parameter, and path parameters missing from the template.
+func checkPathParams(where, path string, shared, own []spec.Parameter) []string {
+	declared := make(map[string]spec.Parameter)
+	for _, p := range append(append([]spec.Parameter{}, shared...), own...) {
+		if p.In == "path" {
+			declared[p.Name] = p
+		}
+	}
+
+	var problems []string
+	inTemplate := make(map[string]bool)
+	for _, m := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		name := m[1]
+		inTemplate[name] = true
+		p, ok := declared[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: path parameter %q is not declared", where, name))
+		case !p.Required:
+			problems = append(problems, fmt.Sprintf("%s: path parameter %q must be required", where, name))
+		}
+	}
+	names := make([]string, 0, len(declared))
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !inTemplate[name] {
+			problems = append(problems, fmt.Sprintf("%s: path parameter %q does not appear in the path", where, name))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,50 @@
+package openapi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStrictAndLenientParsing(t *testing.T) {
+	dir := t.TempDir()
+	sloppy := filepath.Join(dir, "sloppy.json")
+	if err := os.WriteFile(sloppy, []byte(`{"swagger": "2.0", "info": {"version": "1"}, "host": "api.local",
+ "paths": {
+  "/users/{id}": {"get": {"operationId": "getUser", "responses": {"200": {"description": "ok"}}}},
+  "/orders": {"get": {"operationId": "getUser"}}
+ }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ParseSpec(sloppy, true)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("strict: got %v, want a *ValidationError", err)
+	}
+	want := []string{
+		"info.title is required",
+		"GET /orders: at least one response is required",
+		`GET /users/{id}: operationId "getUser" is already used by GET /orders`,
+		`GET /users/{id}: path parameter "id" is not declared`,
+	}
+	if verr.Spec != sloppy || !slices.Equal(verr.Problems, want) {
+		t.Errorf("strict: problems %q in %s, want %q", verr.Problems, verr.Spec, want)
+	}
+
+	d, err := ParseSpec(sloppy, false)
+	if err != nil {
+		t.Fatalf("lenient: %v", err)
+	}
+	if len(d.Endpoints) != 2 {
+		t.Errorf("lenient: %d endpoints, want both despite the problems", len(d.Endpoints))
+	}
+
+	clean := filepath.Join(dir, "clean.json")
+	writeSpec(t, clean, "/health")
+	if _, err := ParseSpec(clean, true); err != nil {
+		t.Errorf("strict on a valid spec: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"faultline/state"
+	"sync"
+	"time"
+)
+
+// windowCounter counts a rule's matching requests in a fixed window that
+// starts with the first request counted.
+type windowCounter struct {
+	mu    sync.Mutex
+	count int
+	start time.Time
+}
+
+// counterFor returns the rule's counter in m, creating it on first use.
+func counterFor(m *sync.Map, ruleID string) *windowCounter {
+	v, _ := m.LoadOrStore(ruleID, &windowCounter{})
+	return v.(*windowCounter)
+}
+
+// hit counts a request at now and returns its number within the current
+// window and when that window started. A window of zero never ends.
+func (c *windowCounter) hit(now time.Time, window time.Duration) (int, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.count == 0 || (window > 0 && now.Sub(c.start) >= window) {
+		c.count, c.start = 0, now
+	}
+	c.count++
+	return c.count, c.start
+}
+
+// failsAttempt reports whether this request is among the first FailFirstN
+// matches of the rule, and so should get the fault. When ResetAfterSeconds is
+// set, the count starts over once that long has passed since the window's
+// first request, so the outage recurs.
+func (p *Proxy) failsAttempt(rule *state.Rule) bool {
+	reset := time.Duration(rule.Failure.ResetAfterSeconds) * time.Second
+	n, _ := counterFor(&p.attempts, rule.ID).hit(time.Now(), reset)
+	return n <= rule.Failure.FailFirstN
+}
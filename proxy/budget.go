@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"faultline/logging"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequestTimeoutHeader lets a client tell the proxy how long it will wait,
+// in milliseconds ("1500") or as a duration ("1.5s"). Injected delays and
+// the upstream call are cut short once that budget is spent.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// withBudget returns r with a deadline from its RequestTimeoutHeader, if it
+// carries a valid one, and the function releasing it.
+func withBudget(r *http.Request) (*http.Request, context.CancelFunc) {
+	v := r.Header.Get(RequestTimeoutHeader)
+	if v == "" {
+		return r, func() {}
+	}
+	d, err := time.ParseDuration(v)
+	if ms, msErr := strconv.Atoi(v); msErr == nil {
+		d, err = time.Duration(ms)*time.Millisecond, nil
+	}
+	if err != nil || d <= 0 {
+		logging.Debugf("[PROXY] Ignoring invalid %s %q (request %s)", RequestTimeoutHeader, v, requestID(r))
+		return r, func() {}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), d)
+	return r.WithContext(ctx), cancel
+}
+
+// abandonRequest handles a request whose context ended during an injected
+// delay: a client that disconnected gets nothing, one whose timeout budget
+// ran out gets a 504, as from a gateway giving up.
+func abandonRequest(w http.ResponseWriter, r *http.Request) {
+	if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		log.Printf("[PROXY] %s budget %q spent during injected delay (request %s)", RequestTimeoutHeader, r.Header.Get(RequestTimeoutHeader), requestID(r))
+		http.Error(w, "FaultLine: request timeout budget exceeded", http.StatusGatewayTimeout)
+		return
+	}
+	logging.Debugf("[PROXY] Client went away during injected delay (request %s)", requestID(r))
+}
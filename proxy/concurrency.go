@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"faultline/logging"
+	"faultline/state"
+	"net/http"
+	"time"
+)
+
+// ruleSlots is the semaphore behind a rule's MaxConcurrent, remembering the
+// limit it was built for so edits to the rule take effect.
+type ruleSlots struct {
+	limit int
+	ch    chan struct{}
+}
+
+// slotsFor returns the rule's semaphore, shared by all proxy goroutines. It
+// is rebuilt (empty) when the rule's limit changes; requests holding a slot
+// of the old one release it there.
+func (p *Proxy) slotsFor(rule *state.Rule) chan struct{} {
+	limit := rule.Failure.MaxConcurrent
+	v, _ := p.slots.LoadOrStore(rule.ID, &ruleSlots{limit: limit, ch: make(chan struct{}, limit)})
+	s := v.(*ruleSlots)
+	if s.limit != limit {
+		s = &ruleSlots{limit: limit, ch: make(chan struct{}, limit)}
+		p.slots.Store(rule.ID, s)
+	}
+	return s.ch
+}
+
+// acquireSlot takes one of the rule's MaxConcurrent slots for the request,
+// waiting up to QueueTimeoutMs for one to free up. If none does it answers
+// 503 and returns false; otherwise the caller must call release once the
+// request is done.
+func (p *Proxy) acquireSlot(w http.ResponseWriter, r *http.Request, rule *state.Rule) (release func(), ok bool) {
+	slots := p.slotsFor(rule)
+	release = func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	default:
+	}
+
+	if wait := time.Duration(rule.Failure.QueueTimeoutMs) * time.Millisecond; wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case slots <- struct{}{}:
+			return release, true
+		case <-r.Context().Done():
+			abandonRequest(w, r)
+			return nil, false
+		case <-timer.C:
+		}
+	}
+
+	logging.Infof("[CONCURRENCY] Rule %s: %d request(s) already in flight, rejecting %s (request %s)", rule.ID, rule.Failure.MaxConcurrent, p.targetFor(r), requestID(r))
+	p.recordInjection(w, rule)
+	applyResponseHeaders(w, rule.Failure)
+	writeInjectedBody(w, r, http.StatusServiceUnavailable, []byte("FaultLine: Too many concurrent requests"))
+	return nil, false
+}
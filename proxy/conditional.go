@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"faultline/logging"
+	"faultline/state"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// bufferedKey is the request context key carrying an upstream response that
+// was already fetched, which serveReverseProxy then replays instead of
+// forwarding the request again.
+type bufferedKey struct{}
+
+// serveConditional forwards the request with the upstream response held back
+// and applies the rule's failure only if the response matches the rule's
+// ResponseMatch. Unmatched responses are passed on unchanged; matched ones
+// stand in for the upstream wherever the failure would forward the request,
+// so e.g. a latency rule delays the real response. Responses larger than
+// MaxBodyBuffer, and event streams, are passed through as they arrive and
+// never match.
+func (p *Proxy) serveConditional(target string, w http.ResponseWriter, r *http.Request, rule *state.Rule) {
+	buf := &responseBuffer{header: make(http.Header), w: w, limit: cmp.Or(p.opts.MaxBodyBuffer, DefaultMaxBodyBuffer)}
+	p.serveReverseProxy(target, buf, r)
+	if buf.streamed {
+		logging.Debugf("[RESPONSE MATCH] rule=%s: response too large or streaming, passed through unmatched (request %s)", rule.ID, requestID(r))
+		return
+	}
+	if !rule.ResponseMatch.Matches(buf.status, buf.body.Bytes()) {
+		buf.writeTo(w)
+		return
+	}
+	logging.Infof("[RULE MATCH] Target: %s, upstream answered %d -> Injecting Failure: %s (request %s)", rule.TargetLabel(), buf.status, rule.Failure.Type, requestID(r))
+	p.injectFailure(w, r.WithContext(context.WithValue(r.Context(), bufferedKey{}, buf)), rule)
+}
+
+// conditional reports whether the rule's failure depends on the upstream
+// response. Upgrades and tunnels can't be buffered, so the condition is
+// ignored for them.
+func conditional(r *http.Request, rule *state.Rule) bool {
+	return rule.ResponseMatch != nil && !isUpgrade(r) && r.Method != http.MethodConnect
+}
+
+// responseBuffer is a ResponseWriter holding a response in memory, up to
+// limit bytes. A response that turns out larger, or is an event stream, is
+// sent on to w as it arrives instead, and streamed is set.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+
+	w        http.ResponseWriter
+	limit    int
+	streamed bool
+}
+
+func (b *responseBuffer) Header() http.Header { return b.header }
+
+func (b *responseBuffer) WriteHeader(code int) {
+	if b.status != 0 {
+		return
+	}
+	b.status = code
+	mediaType, _, _ := mime.ParseMediaType(b.header.Get("Content-Type"))
+	if mediaType == "text/event-stream" || b.overLimit(b.header.Get("Content-Length")) {
+		b.stream()
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	if !b.streamed && b.body.Len()+len(p) > b.limit {
+		b.stream()
+	}
+	if b.streamed {
+		return b.w.Write(p)
+	}
+	return b.body.Write(p)
+}
+
+// Flush passes flushes on once the response is streamed, so events reach
+// the client as the upstream sends them.
+func (b *responseBuffer) Flush() {
+	if b.streamed {
+		http.NewResponseController(b.w).Flush()
+	}
+}
+
+// overLimit reports whether a Content-Length header value exceeds the limit.
+func (b *responseBuffer) overLimit(contentLength string) bool {
+	n, err := strconv.ParseInt(contentLength, 10, 64)
+	return err == nil && n > int64(b.limit)
+}
+
+// stream sends what is buffered so far to w and passes the rest through.
+func (b *responseBuffer) stream() {
+	b.writeTo(b.w)
+	b.body.Reset()
+	b.streamed = true
+}
+
+// writeTo sends the buffered response to w, on top of any headers w already has.
+func (b *responseBuffer) writeTo(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
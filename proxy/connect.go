@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"faultline/logging"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// connectTarget returns the URL rules are matched against for a CONNECT
+// request to authority (host:port). The tunnelled traffic is usually TLS,
+// so only the destination is known: rules targeting the whole host apply,
+// path-specific ones can't.
+func connectTarget(authority string) string {
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		return "https://" + authority + "/"
+	}
+	switch port {
+	case "443":
+		return "https://" + host + "/"
+	case "80":
+		return "http://" + host + "/"
+	}
+	return "https://" + authority + "/"
+}
+
+// serveTunnel answers a CONNECT request, as sent by clients using FaultLine
+// as their HTTP(S)_PROXY, by relaying bytes between the client and the
+// requested host:port until either side closes.
+func (p *Proxy) serveTunnel(w http.ResponseWriter, r *http.Request) {
+	dialer := &net.Dialer{Timeout: p.opts.DialTimeout, KeepAlive: 30 * time.Second}
+	upstream, err := p.guardDial(dialer.DialContext)(r.Context(), "tcp", r.Host)
+	if err != nil {
+		p.upstreamErrorHandler(w, r, err)
+		return
+	}
+	defer upstream.Close()
+
+	client, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		log.Printf("[PROXY] Cannot tunnel to %s (request %s): %v", r.Host, requestID(r), err)
+		http.Error(w, "FaultLine: tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+	defer client.Close()
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+	logging.Debugf("[PROXY] Tunnelling to %s (request %s)", r.Host, requestID(r))
+
+	// brw may already hold the start of the client's traffic (a TLS hello).
+	done := make(chan struct{})
+	go func() {
+		io.Copy(upstream, brw)
+		closeWrite(upstream)
+		close(done)
+	}()
+	io.Copy(client, upstream)
+	closeWrite(client)
+	<-done
+}
+
+// closeWrite half-closes conn when it supports it, so the peer sees EOF while
+// data still flows the other way.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	} else {
+		conn.Close()
+	}
+}
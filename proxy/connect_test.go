@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"bufio"
+	"faultline/cli"
+	"faultline/state"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConnectTarget(t *testing.T) {
+	for authority, want := range map[string]string{
+		"api.example.com:443":  "https://api.example.com/",
+		"api.example.com:80":   "http://api.example.com/",
+		"api.example.com:8443": "https://api.example.com:8443/",
+	} {
+		if got := connectTarget(authority); got != want {
+			t.Errorf("connectTarget(%q) = %q, want %q", authority, got, want)
+		}
+	}
+}
+
+// connect opens a CONNECT tunnel to authority through the proxy at proxyAddr
+// and returns the connection with the proxy's response.
+func connect(t *testing.T, proxyAddr, authority string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", authority, authority)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp
+}
+
+func TestConnectTunnel(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	authority := echo.Addr().String()
+
+	rs := state.NewRuleState(nil, "")
+	front := httptest.NewServer(http.HandlerFunc(NewProxy(cli.NewRuleManager(rs), Options{}).HandleRequest))
+	defer front.Close()
+	proxyAddr := front.Listener.Addr().String()
+
+	t.Run("relays bytes", func(t *testing.T) {
+		conn, br, resp := connect(t, proxyAddr, authority)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("CONNECT status %d, want 200", resp.StatusCode)
+		}
+		if _, err := io.WriteString(conn, "ping"); err != nil {
+			t.Fatal(err)
+		}
+		reply := make([]byte, 4)
+		if _, err := io.ReadFull(br, reply); err != nil || string(reply) != "ping" {
+			t.Errorf("tunnel echoed %q (%v), want ping", reply, err)
+		}
+	})
+
+	t.Run("rules for the host apply", func(t *testing.T) {
+		rs.AddRule(state.Rule{ID: "down", Target: connectTarget(authority), Enabled: true, Failure: state.Failure{Type: "error", ErrorCode: 503}})
+		_, _, resp := connect(t, proxyAddr, authority)
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("CONNECT status %d, want the rule's 503", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"bytes"
+	"cmp"
+	"faultline/logging"
+	"faultline/state"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// checkContract validates an upstream response against Options.Contract,
+// logging and recording a contract-violation event when it deviates from
+// the documented operation. Compressed, streamed and oversized bodies are
+// left unchecked; the body is restored either way.
+func (p *Proxy) checkContract(resp *http.Response) {
+	r := resp.Request
+	if r.Method == http.MethodHead || resp.StatusCode == http.StatusSwitchingProtocols {
+		return
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		logging.Debugf("[CONTRACT] Not checking %s-encoded response for %s (request %s)", enc, r.URL, requestID(r))
+		return
+	}
+
+	var body []byte
+	if resp.Body != nil && resp.Body != http.NoBody {
+		limit := cmp.Or(p.opts.MaxBodyBuffer, DefaultMaxBodyBuffer)
+		buf, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(buf), resp.Body), resp.Body}
+		if err != nil || len(buf) > limit {
+			logging.Debugf("[CONTRACT] Not checking response for %s: body unreadable or over %d bytes (request %s)", r.URL, limit, requestID(r))
+			return
+		}
+		body = buf
+	}
+
+	op, problems := p.opts.Contract.Check(r.Method, r.URL.Path, resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	if op == "" || len(problems) == 0 {
+		return
+	}
+	msg := strings.Join(problems, "; ")
+	log.Printf("[CONTRACT] %d response for %s violates %s: %s (request %s)", resp.StatusCode, r.URL, op, msg, requestID(r))
+	p.events.Record(state.Event{
+		Type:      state.ContractViolationEvent,
+		Target:    r.URL.String(),
+		Method:    r.Method,
+		Message:   op + ": " + msg,
+		Status:    resp.StatusCode,
+		RequestID: requestID(r),
+	})
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"faultline/cli"
+	"faultline/openapi"
+	"faultline/state"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContractViolationsAreRecordedAndRelayed(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(spec, []byte(`{"openapi": "3.0.0", "info": {"title": "t", "version": "1"},
+ "paths": {"/users/{id}": {"get": {"responses": {
+  "200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+  "404": {"description": "missing"}}}}},
+ "components": {"schemas": {"User": {"type": "object", "required": ["id"],
+  "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	contract, err := openapi.LoadContract([]string{spec})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := map[string]string{
+		"/users/1": `{"id": 1, "name": "ada"}`,
+		"/users/2": `{"id": "2"}`,
+		"/users/3": `{"name": "grace"}`,
+		"/users/4": `not json`,
+		"/orders":  `{"anything": true}`,
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/5" {
+			http.Error(w, "teapot", http.StatusTeapot)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, bodies[r.URL.Path])
+	}))
+	t.Cleanup(upstream.Close)
+	p := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, "")), Options{DefaultUpstream: upstream.URL, Contract: contract})
+	logs := captureLog(t)
+
+	tests := []struct {
+		path string
+		want string // "" for a conforming or unchecked response
+	}{
+		{"/users/1", ""},
+		{"/users/2", "GET /users/{id}: $.id: expected integer, got string"},
+		{"/users/3", `GET /users/{id}: $: missing required property "id"`},
+		{"/users/4", "GET /users/{id}: body is not valid JSON"},
+		{"/users/5", "GET /users/{id}: status 418 is not documented"},
+		{"/orders", ""},
+	}
+	for _, tt := range tests {
+		before := len(p.events.Recent(0))
+		rec := do(p, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if want, ok := bodies[tt.path]; ok && (rec.Code != http.StatusOK || rec.Body.String() != want) {
+			t.Errorf("%s: relayed %d %q, want the upstream's 200 %q unchanged", tt.path, rec.Code, rec.Body, want)
+		}
+
+		var events []state.Event
+		for _, e := range p.events.Recent(0)[before:] {
+			if e.Type == state.ContractViolationEvent {
+				events = append(events, e)
+			}
+		}
+		if tt.want == "" {
+			if len(events) != 0 {
+				t.Errorf("%s: recorded %+v, want no violation", tt.path, events)
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Errorf("%s: recorded %d violations, want 1", tt.path, len(events))
+			continue
+		}
+		e := events[0]
+		if e.Method != http.MethodGet || !strings.HasSuffix(e.Target, tt.path) ||
+			!strings.HasPrefix(e.Message, tt.want) || e.RequestID == "" {
+			t.Errorf("%s: recorded %+v, want a violation %q", tt.path, e, tt.want)
+		}
+	}
+	if n := strings.Count(logs.String(), "[CONTRACT]"); n != 4 {
+		t.Errorf("logged %d contract violations, want 4:\n%s", n, logs)
+	}
+}
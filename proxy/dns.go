@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// dnsFailure is the error a lookup of host fails with when the name
+// doesn't exist, as the "dns" type simulates.
+func dnsFailure(host string) *net.DNSError {
+	return &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// writeDNSError answers the way the proxy does when an upstream's name
+// can't be resolved, so injected and real DNS failures look the same.
+func writeDNSError(w http.ResponseWriter, err *net.DNSError) {
+	http.Error(w, "FaultLine: could not resolve upstream host: "+err.Error(), http.StatusBadGateway)
+}
+
+// targetHost returns the host name of a target URL, or the target itself
+// when it doesn't parse.
+func targetHost(target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.Hostname() == "" {
+		return target
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"faultline/cli"
+	"faultline/state"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDNSFaultLooksLikeAnUnresolvableHost(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("dns", state.Failure{Type: "dns", LatencyMs: 30}))
+	start := time.Now()
+	rec := do(p, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("answered after %s, want the 30ms resolver delay first", elapsed)
+	}
+	want := "FaultLine: could not resolve upstream host: lookup 127.0.0.1: no such host\n"
+	if rec.Code != http.StatusBadGateway || rec.Body.String() != want {
+		t.Errorf("injected: %d %q, want 502 %q", rec.Code, rec.Body, want)
+	}
+	if rec.Header().Get(InjectedHeader) != "dns;dns" {
+		t.Errorf("%s = %q, want the fault marked", InjectedHeader, rec.Header().Get(InjectedHeader))
+	}
+
+	// A real lookup failure gets the same status and message.
+	unresolved := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, "")), Options{DefaultUpstream: "http://faultline-test.invalid"})
+	rec = do(unresolved, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if rec.Code != http.StatusBadGateway || !strings.HasPrefix(rec.Body.String(), "FaultLine: could not resolve upstream host: lookup faultline-test.invalid") {
+		t.Errorf("real: %d %q, want the same 502", rec.Code, rec.Body)
+	}
+}
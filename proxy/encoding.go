@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"net/http"
+	"strings"
+)
+
+// writeInjectedBody writes the body of a response FaultLine generates. A
+// Content-Encoding set through the rule's response headers is honored by
+// compressing the body to match, so clients don't try to decompress
+// plaintext. Encodings the client didn't accept, or that can't be produced,
+// are dropped and the body is sent as-is.
+func writeInjectedBody(w http.ResponseWriter, r *http.Request, code int, body []byte) {
+	h := w.Header()
+	if h.Get("Content-Type") == "" {
+		// Sniffing compressed bytes would mislabel the body.
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	if enc := strings.ToLower(strings.TrimSpace(h.Get("Content-Encoding"))); enc != "" {
+		h.Del("Content-Encoding")
+		if encoded, ok := encodeBody(enc, body); ok && acceptsEncoding(r, enc) {
+			h.Set("Content-Encoding", enc)
+			h.Add("Vary", "Accept-Encoding")
+			body = encoded
+		}
+	}
+	// A configured Content-Length would no longer match the body.
+	h.Del("Content-Length")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// encodeBody compresses body with a Content-Encoding; ok is false for
+// encodings FaultLine can't produce.
+func encodeBody(enc string, body []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	switch enc {
+	case "gzip", "x-gzip":
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		zw.Close()
+	case "deflate":
+		// HTTP "deflate" is the zlib format.
+		zw := zlib.NewWriter(&buf)
+		zw.Write(body)
+		zw.Close()
+	case "identity":
+		return body, true
+	default:
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// acceptsEncoding reports whether the request's Accept-Encoding allows enc.
+func acceptsEncoding(r *http.Request, enc string) bool {
+	if enc == "identity" {
+		return true
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != enc && name != "*" && !(enc == "x-gzip" && name == "gzip") {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses the encoding.
+		q := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
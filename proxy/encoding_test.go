@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"faultline/state"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInjectedBodiesMatchTheirContentEncoding(t *testing.T) {
+	body := `{"error":"overloaded"}`
+	p, _ := newTestProxy(t, Options{}, rule("gz", state.Failure{
+		Type: "mock", StatusCode: 503, Body: body,
+		ResponseHeaders: map[string]string{"Content-Encoding": "gzip", "Content-Length": "3"},
+	}))
+	request := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		return do(p, req)
+	}
+
+	rec := request("gzip, deflate")
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Content-Length") != "" {
+		t.Fatalf("headers %v, want gzip and no configured Content-Length", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("body isn't gzip: %v", err)
+	}
+	if got, err := io.ReadAll(zr); err != nil || string(got) != body {
+		t.Errorf("decompressed body %q (%v), want %q", got, err, body)
+	}
+
+	for _, accept := range []string{"", "br", "gzip;q=0"} {
+		rec := request(accept)
+		if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+			t.Errorf("Accept-Encoding %q: got Content-Encoding %q and %q, want the plain body", accept, rec.Header().Get("Content-Encoding"), rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// hiddenFaultWriter removes the headers that mark a response as injected
+// just before it is sent, for tests that need faults to be
+// indistinguishable from real upstream failures.
+type hiddenFaultWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (h *hiddenFaultWriter) stripHeaders() {
+	if h.wroteHeader {
+		return
+	}
+	h.wroteHeader = true
+	for _, name := range []string{FaultHeader, RuleHeader, InjectedHeader} {
+		h.Header().Del(name)
+	}
+}
+
+func (h *hiddenFaultWriter) WriteHeader(code int) {
+	h.stripHeaders()
+	h.ResponseWriter.WriteHeader(code)
+}
+
+func (h *hiddenFaultWriter) Write(b []byte) (int, error) {
+	h.stripHeaders()
+	return h.ResponseWriter.Write(b)
+}
+
+// Hijack strips the headers too: the reverse proxy writes the response to a
+// protocol switch (WebSocket) straight to the hijacked connection.
+func (h *hiddenFaultWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.stripHeaders()
+	return http.NewResponseController(h.ResponseWriter).Hijack()
+}
+
+func (h *hiddenFaultWriter) Unwrap() http.ResponseWriter { return h.ResponseWriter }
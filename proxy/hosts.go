@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// errForbiddenTarget marks upstreams the host policy refuses to forward to.
+var errForbiddenTarget = errors.New("forwarding to this host is not allowed")
+
+// metadataHosts are cloud metadata service names, refused like link-local
+// addresses unless explicitly allowed.
+var metadataHosts = []string{"metadata.google.internal", "metadata"}
+
+// matchHost reports whether host matches a policy entry: an exact host name,
+// a "*.example.com" wildcard (which also matches subdomains), an IP address
+// or a CIDR range.
+func matchHost(entry, host string) bool {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if _, cidr, err := net.ParseCIDR(entry); err == nil {
+		ip := net.ParseIP(host)
+		return ip != nil && cidr.Contains(ip)
+	}
+	if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	if ip := net.ParseIP(entry); ip != nil {
+		return ip.Equal(net.ParseIP(host))
+	}
+	return entry == host
+}
+
+func matchAny(entries []string, host string) bool {
+	for _, e := range entries {
+		if matchHost(e, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMetadataIP reports whether ip is link-local, the range cloud metadata
+// services (169.254.169.254) live in.
+func isMetadataIP(ip net.IP) bool {
+	return ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+}
+
+// checkHost applies the allowed/blocked host lists to an upstream host name
+// or IP. Blocked entries win over allowed ones.
+func (p *Proxy) checkHost(host string) error {
+	if matchAny(p.opts.BlockedHosts, host) {
+		return fmt.Errorf("%w: %s is in blockedHosts", errForbiddenTarget, host)
+	}
+	if len(p.opts.AllowedHosts) > 0 && !matchAny(p.opts.AllowedHosts, host) {
+		return fmt.Errorf("%w: %s is not in allowedHosts", errForbiddenTarget, host)
+	}
+	if matchAny(p.opts.AllowedHosts, host) {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && isMetadataIP(ip) {
+		return fmt.Errorf("%w: %s is a link-local/metadata address", errForbiddenTarget, host)
+	}
+	for _, m := range metadataHosts {
+		if strings.EqualFold(strings.TrimSuffix(host, "."), m) {
+			return fmt.Errorf("%w: %s is a metadata service", errForbiddenTarget, host)
+		}
+	}
+	return nil
+}
+
+// guardDial wraps dial so that host names resolving to blocked or metadata
+// addresses are refused too. It dials the checked IPs directly, so the name
+// can't be re-resolved to a different address in between.
+func (p *Proxy) guardDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		hostAllowed := matchAny(p.opts.AllowedHosts, host)
+		var lastErr error = &net.AddrError{Err: "no addresses", Addr: host}
+		for _, ip := range ips {
+			s := ip.IP.String()
+			if matchAny(p.opts.BlockedHosts, s) || (isMetadataIP(ip.IP) && !hostAllowed && !matchAny(p.opts.AllowedHosts, s)) {
+				lastErr = fmt.Errorf("%w: %s resolves to %s", errForbiddenTarget, host, s)
+				continue
+			}
+			conn, err := dial(ctx, network, net.JoinHostPort(s, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
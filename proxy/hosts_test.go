@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"faultline/cli"
+	"faultline/state"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHostPolicy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	local := "/" + upstream.URL + "/items"
+	byName := "/http://localhost:" + upstream.URL[strings.LastIndex(upstream.URL, ":")+1:] + "/items"
+
+	cases := []struct {
+		name    string
+		opts    Options
+		path    string
+		allowed bool
+	}{
+		{"no lists", Options{}, local, true},
+		{"allowed", Options{AllowedHosts: []string{"127.0.0.1"}}, local, true},
+		{"allowed by CIDR", Options{AllowedHosts: []string{"127.0.0.0/8"}}, local, true},
+		{"not in allowedHosts", Options{AllowedHosts: []string{"*.example.com"}}, local, false},
+		{"blocked", Options{BlockedHosts: []string{"127.0.0.1"}}, local, false},
+		{"blocked wins over allowed", Options{AllowedHosts: []string{"127.0.0.1"}, BlockedHosts: []string{"127.0.0.0/8"}}, local, false},
+		{"name resolving to a blocked IP", Options{BlockedHosts: []string{"127.0.0.0/8", "::1"}}, byName, false},
+		{"metadata IP", Options{}, "/http://169.254.169.254/latest/meta-data", false},
+		{"metadata name", Options{}, "/http://metadata.google.internal/computeMetadata/v1", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, "")), c.opts)
+			got := get(p, c.path)
+			if c.allowed && got != http.StatusOK {
+				t.Errorf("status %d, want the request forwarded", got)
+			}
+			if !c.allowed && got != http.StatusForbidden {
+				t.Errorf("status %d, want 403", got)
+			}
+		})
+	}
+}
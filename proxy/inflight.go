@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inFlight tracks the requests being handled, and until when the injected
+// delays among them run, so a shutdown can report what it would cut off.
+type inFlight struct {
+	requests   atomic.Int64
+	delayUntil atomic.Int64 // unix nanos at which the latest injected delay ends
+
+	skipDelays     chan struct{} // closed by SkipInjectedDelays
+	skipDelaysOnce sync.Once
+}
+
+// InFlight returns how many requests the proxy is currently handling.
+func (p *Proxy) InFlight() int {
+	return int(p.inFlight.requests.Load())
+}
+
+// InjectedDelayRemaining returns how long the in-flight requests still spend
+// in delays FaultLine injected; zero when none is waiting.
+func (p *Proxy) InjectedDelayRemaining() time.Duration {
+	if p.InFlight() == 0 {
+		return 0
+	}
+	return max(time.Until(time.Unix(0, p.inFlight.delayUntil.Load())), 0)
+}
+
+// SkipInjectedDelays ends the injected delays of in-flight requests, and
+// skips any still to come, so the requests carry on at once. A shutdown
+// uses it when the delays would outlast its timeout.
+func (p *Proxy) SkipInjectedDelays() {
+	p.inFlight.skipDelaysOnce.Do(func() { close(p.inFlight.skipDelays) })
+}
+
+// sleepInjected waits out an injected delay, recording when it ends. If the
+// request's context ends first, it answers the request through
+// abandonRequest and returns false; after SkipInjectedDelays it returns
+// true straight away.
+func (p *Proxy) sleepInjected(w http.ResponseWriter, r *http.Request, d time.Duration) bool {
+	if !p.waitInjected(r.Context(), d) {
+		abandonRequest(w, r)
+		return false
+	}
+	return true
+}
+
+// waitInjected is sleepInjected for delays with no response left to write,
+// such as those inside a hijacked connection: it returns false once ctx
+// ends, leaving the caller to give up.
+func (p *Proxy) waitInjected(ctx context.Context, d time.Duration) bool {
+	p.markInjectedDelay(d)
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-p.inFlight.skipDelays:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// markInjectedDelay records that a request is held for d from now.
+func (p *Proxy) markInjectedDelay(d time.Duration) {
+	end := time.Now().Add(d).UnixNano()
+	for {
+		cur := p.inFlight.delayUntil.Load()
+		if cur >= end || p.inFlight.delayUntil.CompareAndSwap(cur, end) {
+			return
+		}
+	}
+}
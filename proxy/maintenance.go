@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"faultline/logging"
+	"faultline/metrics"
+	"faultline/state"
+	"net/http"
+)
+
+// maintenanceFault is the failure type, and the rule ID, maintenance
+// responses are counted and marked with.
+const maintenanceFault = "maintenance"
+
+// serveMaintenance answers a request with maintenance mode's error
+// instead of proxying it.
+func (p *Proxy) serveMaintenance(w http.ResponseWriter, r *http.Request, m state.Maintenance) {
+	code, body := m.Response()
+	logging.Debugf("[MAINTENANCE] %s %s -> %d (request %s)", r.Method, p.targetFor(r), code, requestID(r))
+	metrics.FaultsInjected.WithLabelValues(maintenanceFault, maintenanceFault).Inc()
+	w.Header().Set(FaultHeader, maintenanceFault)
+	w.Header().Set(RuleHeader, maintenanceFault)
+	w.Header().Set(InjectedHeader, maintenanceFault+";"+maintenanceFault)
+	writeInjectedBody(w, r, code, []byte(body))
+}
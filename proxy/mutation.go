@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"faultline/state"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// mutateRequest returns a copy of r rewritten as the "request-mutation"
+// type describes, ready to be forwarded. A replaced body gets a matching
+// Content-Length instead of the client's.
+func mutateRequest(r *http.Request, m *state.RequestMutation) *http.Request {
+	out := r.Clone(r.Context())
+	if m == nil {
+		return out
+	}
+	if m.Method != "" {
+		out.Method = strings.ToUpper(m.Method)
+	}
+	for _, name := range m.RemoveHeaders {
+		out.Header.Del(name)
+	}
+	for name, value := range m.SetHeaders {
+		out.Header.Set(name, value)
+	}
+	if m.Body != nil {
+		body := *m.Body
+		out.Body = http.NoBody
+		if body != "" {
+			out.Body = io.NopCloser(strings.NewReader(body))
+		}
+		out.GetBody = nil
+		out.ContentLength = int64(len(body))
+		out.TransferEncoding = nil
+		out.Header.Del("Content-Length")
+	}
+	return out
+}
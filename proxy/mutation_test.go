@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"faultline/cli"
+	"faultline/state"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestMutationRewritesForwardedRequests(t *testing.T) {
+	type seen struct {
+		method, body, auth, role string
+		length                   int64
+	}
+	var got seen
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = seen{r.Method, string(body), r.Header.Get("Authorization"), r.Header.Get("X-Role"), r.ContentLength}
+	}))
+	t.Cleanup(upstream.Close)
+
+	send := func(m *state.RequestMutation) seen {
+		t.Helper()
+		rs := state.NewRuleState(nil, "")
+		rs.AddRule(rule("m", state.Failure{Type: "request-mutation", RequestMutation: m}))
+		p := NewProxy(cli.NewRuleManager(rs), Options{DefaultUpstream: upstream.URL})
+		req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"widget"}`))
+		req.Header.Set("Authorization", "Bearer token")
+		if rec := do(p, req); rec.Header().Get(InjectedHeader) != "m;request-mutation" {
+			t.Errorf("%s = %q, want the mutation marked as injected", InjectedHeader, rec.Header().Get(InjectedHeader))
+		}
+		return got
+	}
+
+	injected := `{"name":null}`
+	if s := send(&state.RequestMutation{Method: "put", Body: &injected}); s.method != http.MethodPut || s.body != injected || s.length != int64(len(injected)) {
+		t.Errorf("method and body override: upstream got %+v", s)
+	}
+	empty := ""
+	if s := send(&state.RequestMutation{Method: "GET", Body: &empty}); s.method != http.MethodGet || s.body != "" || s.length != 0 {
+		t.Errorf("emptied body: upstream got %+v", s)
+	}
+	s := send(&state.RequestMutation{RemoveHeaders: []string{"Authorization"}, SetHeaders: map[string]string{"X-Role": "admin"}})
+	if s.method != http.MethodPost || s.body != `{"name":"widget"}` || s.auth != "" || s.role != "admin" {
+		t.Errorf("header changes: upstream got %+v, want the original request without Authorization and with X-Role", s)
+	}
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"bufio"
+	"faultline/state"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// FaultFunc injects a custom failure. It is called for requests matching a
+// rule whose Failure.Type it was registered under, and owns the response:
+// it either writes one itself or calls forward to proxy the request to the
+// upstream as usual. Handlers that inject a fault should call RecordInjection
+// before writing, so metrics and the X-FaultLine headers stay accurate.
+type FaultFunc func(w http.ResponseWriter, r *http.Request, rule *state.Rule, forward func())
+
+var (
+	faultHandlersMu sync.RWMutex
+	faultHandlers   = make(map[string]FaultFunc)
+)
+
+// RegisterFaultHandler makes fn handle rules with Failure.Type name. Custom
+// handlers are consulted before the built-in types, so a built-in name can be
+// overridden; registering a name again replaces the earlier handler. It is
+// typically called from an init function in a program embedding the proxy.
+func RegisterFaultHandler(name string, fn FaultFunc) {
+	if name == "" || fn == nil {
+		panic("proxy: RegisterFaultHandler needs a name and a handler")
+	}
+	faultHandlersMu.Lock()
+	defer faultHandlersMu.Unlock()
+	faultHandlers[name] = fn
+}
+
+// faultHandler returns the custom handler registered for a failure type.
+func faultHandler(name string) (FaultFunc, bool) {
+	faultHandlersMu.RLock()
+	defer faultHandlersMu.RUnlock()
+	fn, ok := faultHandlers[name]
+	return fn, ok
+}
+
+// RecordInjection counts a fault injected by a custom handler, tags the
+// response with the X-FaultLine headers and updates the rule's LastFired
+// time. Call it before writing the response.
+func RecordInjection(w http.ResponseWriter, rule *state.Rule) {
+	countInjection(w, rule)
+	for {
+		if fw, ok := w.(*firingWriter); ok {
+			fw.fired()
+			return
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = u.Unwrap()
+	}
+}
+
+// firingWriter is the ResponseWriter handed to custom fault handlers, so
+// RecordInjection can tell the proxy that the rule fired. A handler that
+// only forwards the request leaves the rule's LastFired untouched.
+type firingWriter struct {
+	http.ResponseWriter
+	fired func()
+}
+
+func (f *firingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(f.ResponseWriter).Hijack()
+}
+
+func (f *firingWriter) Flush() {
+	http.NewResponseController(f.ResponseWriter).Flush()
+}
+
+func (f *firingWriter) Unwrap() http.ResponseWriter { return f.ResponseWriter }
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"faultline/state"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCustomFaultHandler(t *testing.T) {
+	// The README's coinflip, with a coin that alternates.
+	var flips atomic.Int64
+	RegisterFaultHandler("test-coinflip", func(w http.ResponseWriter, r *http.Request, rule *state.Rule, forward func()) {
+		if flips.Add(1)%2 == 1 {
+			forward()
+			return
+		}
+		RecordInjection(w, rule)
+		http.Error(w, "FaultLine: tails", http.StatusServiceUnavailable)
+	})
+	p, _ := newTestProxy(t, Options{}, rule("coin", state.Failure{Type: "test-coinflip"}))
+
+	heads := do(p, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("x")))
+	if heads.Code != http.StatusOK || heads.Body.String() != "upstream:x" || heads.Header().Get(RuleHeader) != "" {
+		t.Errorf("heads: got %d %q, rule header %q; want the upstream's untagged response", heads.Code, heads.Body.String(), heads.Header().Get(RuleHeader))
+	}
+	if lastFired(t, p, "coin") != nil {
+		t.Error("forwarding marked the rule fired")
+	}
+
+	tails := do(p, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if tails.Code != http.StatusServiceUnavailable || tails.Header().Get(RuleHeader) != "coin" {
+		t.Errorf("tails: got %d, rule header %q; want the handler's tagged 503", tails.Code, tails.Header().Get(RuleHeader))
+	}
+	if lastFired(t, p, "coin") == nil {
+		t.Error("the injected fault didn't mark the rule fired")
+	}
+}
@@ -1,42 +1,152 @@
 package proxy
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"faultline/cli"
+	"faultline/logging"
+	"faultline/metrics"
+	"faultline/openapi"
 	"faultline/state"
+	"fmt"
+	"io"
 	"log"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// Response headers set on requests a fault was injected into.
+const (
+	FaultHeader    = "X-FaultLine-Fault"    // failure type
+	RuleHeader     = "X-FaultLine-Rule"     // ID of the matching rule
+	InjectedHeader = "X-FaultLine-Injected" // "<rule ID>;<failure type>"
+)
+
+// defaultTimeoutMs is how long a "timeout" rule without a LatencyMs holds
+// requests before answering 504.
+const defaultTimeoutMs = 30000
+
+// Options controls optional proxy behavior.
+type Options struct {
+	// DryRun logs the faults matching rules would inject, but proxies every
+	// request normally.
+	DryRun bool
+
+	// Upstream timeouts. Zero means no limit.
+	DialTimeout           time.Duration // establishing the TCP connection
+	ResponseHeaderTimeout time.Duration // waiting for the upstream's response headers
+	RequestTimeout        time.Duration // the whole upstream round trip, including the body
+
+	// DefaultUpstream (e.g. "http://localhost:3000") receives requests whose
+	// path doesn't embed an absolute target URL, so FaultLine can front a
+	// single backend as a plain reverse proxy.
+	DefaultUpstream string
+
+	// TraceBodies logs the headers and bodies of proxied requests and their
+	// responses, keeping the first TraceBodyLimit bytes of each body
+	// (DefaultTraceBodyLimit when zero). Headers in TraceRedact are masked;
+	// nil means DefaultTraceRedact.
+	TraceBodies    bool
+	TraceBodyLimit int
+	TraceRedact    []string
+
+	// AllowedHosts, when set, limits the upstreams requests may be forwarded
+	// to; BlockedHosts are always refused. Entries are host names,
+	// "*.example.com" wildcards, IPs or CIDR ranges. Link-local and cloud
+	// metadata addresses are refused unless allowed explicitly.
+	AllowedHosts []string
+	BlockedHosts []string
+
+	// MatchStrategy picks between several matching rules: state.MatchPriority
+	// (the default) or state.MatchWeighted.
+	MatchStrategy string
+
+	// SlowRequestThreshold logs a warning for forwarded requests taking at
+	// least this long, including latency FaultLine injected. Zero disables it.
+	SlowRequestThreshold time.Duration
+
+	// Recorder, when set, records each forwarded request and its upstream
+	// response. The caller closes it after the proxy has stopped.
+	Recorder *Recorder
+
+	// MaxBodyBuffer caps how many bytes of a request body are held in memory
+	// for body matching (DefaultMaxBodyBuffer when zero). Larger bodies are
+	// streamed to the upstream unread, and rules with a bodyMatch skip them.
+	// It caps upstream responses held for a responseMatch the same way.
+	MaxBodyBuffer int
+
+	// PassthroughCORS forwards OPTIONS preflight requests like any other,
+	// so the upstream's own CORS policy is what clients see. By default the
+	// proxy answers them itself, allowing any origin.
+	PassthroughCORS bool
+
+	// Contract, when set, checks upstream responses against the OpenAPI
+	// operations it documents and records contract-violation events for
+	// those that don't conform.
+	Contract *openapi.Contract
+
+	// HideFaultHeaders leaves out the X-FaultLine-Fault, -Rule and -Injected
+	// headers, so injected faults look exactly like upstream failures.
+	HideFaultHeaders bool
+}
+
 // Proxy holds a reference to the shared rule state and manager.
 type Proxy struct {
 	ruleState   *state.RuleState
 	ruleManager *cli.RuleManager
+	events      *state.EventLog
+	opts        Options
+	counters    sync.Map // rule ID -> *uint64, per-rule match counters
+	attempts    sync.Map // rule ID -> *windowCounter, for Failure.FailFirstN
+	quotas      sync.Map // rule ID -> *windowCounter, for "quota" rules
+	limiters    sync.Map // rule ID -> *ruleLimiter, for "ratelimit" rules
+	proxies     sync.Map // scheme://host -> *httputil.ReverseProxy
+	slots       sync.Map // rule ID -> *ruleSlots, for Failure.MaxConcurrent
+	inFlight    inFlight
 }
 
 // NewProxy creates and initializes the proxy.
-func NewProxy(rm *cli.RuleManager) *Proxy {
+func NewProxy(rm *cli.RuleManager, opts Options) *Proxy {
 	return &Proxy{
 		ruleState:   rm.GetRuleState(),
 		ruleManager: rm,
+		events:      rm.GetEventLog(),
+		opts:        opts,
+		inFlight:    inFlight{skipDelays: make(chan struct{})},
 	}
 }
 
 // HandleRequest is the core logic for the proxy.
 func (p *Proxy) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	p.inFlight.requests.Add(1)
+	defer p.inFlight.requests.Add(-1)
+	metrics.RequestsTotal.Inc()
+	defer func() { metrics.ProxyLatency.Observe(time.Since(start).Seconds()) }()
+
 	// Check if rules file has been modified and reload if necessary (for CLI changes)
 	if err := p.ruleState.CheckAndReloadIfModified(); err != nil {
 		log.Printf("[WARNING] Failed to reload rules: %v", err)
 	}
 
-	// Handle CORS preflight requests (OPTIONS) directly. Only set CORS
-	// headers here for preflight responses. For proxied responses we use
-	// the reverse proxy's ModifyResponse to normalize headers, to avoid
-	// sending duplicate Access-Control-Allow-* values.
-	if r.Method == http.MethodOptions {
+	// Handle CORS preflight requests (OPTIONS) directly, so browsers can
+	// call any upstream through the proxy. Only preflight responses get CORS
+	// headers here; proxied responses keep the upstream's own, to avoid
+	// sending duplicate Access-Control-Allow-* values. With PassthroughCORS
+	// the preflight goes to the upstream too.
+	if r.Method == http.MethodOptions && !p.opts.PassthroughCORS {
 		w.Header().Set("Access-Control-Allow-Origin", "*") // Allow any origin
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
@@ -44,14 +154,61 @@ func (p *Proxy) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	targetURLString := strings.TrimPrefix(r.URL.Path, "/")
-	if r.URL.RawQuery != "" {
-		targetURLString += "?" + r.URL.RawQuery
+	if p.opts.HideFaultHeaders {
+		w = &hiddenFaultWriter{ResponseWriter: w}
+	}
+	id := ensureRequestID(w, r)
+	r, cancel := withBudget(r)
+	defer cancel()
+	if m := p.ruleState.Maintenance(); m.Enabled {
+		p.serveMaintenance(w, r, m)
+		return
+	}
+	targetURLString := p.targetFor(r)
+
+	match := state.Request{Target: targetURLString, Method: r.Method, Header: r.Header, Query: r.URL.Query()}
+	if p.ruleState.NeedsRequestBody() {
+		match.Body = bufferBody(r, cmp.Or(p.opts.MaxBodyBuffer, DefaultMaxBodyBuffer))
 	}
 
 	// Check if any rule matches the requested URL (category is ignored here; UI uses it for grouping only)
-	if rule, ok := p.ruleState.FindRuleForTarget(targetURLString); ok {
-		log.Printf("[RULE MATCH] Target: %s -> Injecting Failure: %s", rule.Target, rule.Failure.Type)
+	if rule, ok := p.findRule(match); ok {
+		if !inRollout(r, rule) {
+			logging.Debugf("[ROLLOUT] rule=%s leaves out this client (request %s)", rule.ID, id)
+			p.serveReverseProxy(targetURLString, w, r)
+			return
+		}
+		if pr := rule.Failure.Probability; pr > 0 && rand.Float64() >= pr {
+			logging.Debugf("[PROBABILITY] rule=%s spared this request (p=%g, request %s)", rule.ID, pr, id)
+			p.serveReverseProxy(targetURLString, w, r)
+			return
+		}
+		if p.opts.DryRun {
+			logging.Infof("[DRY RUN] rule=%s target=%s method=%s failure=%s details=%q request=%s", rule.ID, targetURLString, r.Method, rule.Failure.Type, rule.Failure.Summary(), id)
+			p.events.Record(state.Event{
+				Type:      "dry-run",
+				RuleID:    rule.ID,
+				Target:    targetURLString,
+				Method:    r.Method,
+				Failure:   rule.Failure.Type,
+				Message:   "would inject " + rule.Failure.Summary(),
+				RequestID: id,
+			})
+			p.serveReverseProxy(targetURLString, w, r)
+			return
+		}
+		if rule.Failure.MaxConcurrent > 0 {
+			release, ok := p.acquireSlot(w, r, rule)
+			if !ok {
+				return
+			}
+			defer release()
+		}
+		if conditional(r, rule) {
+			p.serveConditional(targetURLString, w, r, rule)
+			return
+		}
+		logging.Infof("[RULE MATCH] Target: %s -> Injecting Failure: %s (request %s)", rule.TargetLabel(), rule.Failure.Type, id)
 		p.injectFailure(w, r, rule)
 		return
 	}
@@ -60,18 +217,208 @@ func (p *Proxy) HandleRequest(w http.ResponseWriter, r *http.Request) {
 	p.serveReverseProxy(targetURLString, w, r)
 }
 
+// findRule returns the rule to apply to a request: an armed one-shot rule
+// if one matches, otherwise the stored rule chosen by the match strategy.
+func (p *Proxy) findRule(req state.Request) (*state.Rule, bool) {
+	if rule, ok := p.ruleState.TakeOneShot(req); ok {
+		return rule, true
+	}
+	if p.opts.MatchStrategy == state.MatchWeighted {
+		return p.ruleState.PickWeightedRule(req)
+	}
+	return p.ruleState.FindRuleForRequest(req)
+}
+
+// targetFor returns the upstream URL a request is aimed at. The path normally
+// embeds it (GET /https://api.example.com/users); otherwise the path is
+// resolved against the default upstream, when one is configured. Clients
+// using FaultLine as their HTTP proxy send the full URL instead, or CONNECT
+// to a host:port.
+func (p *Proxy) targetFor(r *http.Request) string {
+	if r.Method == http.MethodConnect {
+		return connectTarget(r.Host)
+	}
+	if r.URL.IsAbs() {
+		return r.URL.String()
+	}
+	target := strings.TrimPrefix(r.URL.Path, "/")
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	if p.opts.DefaultUpstream == "" || isAbsoluteURL(target) {
+		return target
+	}
+	return strings.TrimSuffix(p.opts.DefaultUpstream, "/") + "/" + target
+}
+
+// isAbsoluteURL reports whether s parses as a URL with both a scheme and a host.
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// DefaultMaxBodyBuffer is how much of a request body is buffered for body
+// matching unless Options.MaxBodyBuffer says otherwise.
+const DefaultMaxBodyBuffer = 1 << 20 // 1 MiB
+
+// bufferBody reads the request body for rule matching and restores it so it is
+// still forwarded intact. Bodies larger than limit are not matched against
+// (nil is returned) but are still streamed to the upstream in full; when the
+// Content-Length already says so, nothing is read up front.
+func bufferBody(r *http.Request, limit int) []byte {
+	if r.Body == nil || r.Body == http.NoBody {
+		return []byte{}
+	}
+	if r.ContentLength > int64(limit) {
+		logging.Debugf("[BODY] %d-byte request body exceeds the %d-byte buffer; streaming it without body matching", r.ContentLength, limit)
+		return nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	if err != nil {
+		log.Printf("[WARNING] Failed to read request body for matching: %v", err)
+	}
+	if err != nil || len(buf) > limit {
+		if err == nil {
+			logging.Debugf("[BODY] request body exceeds the %d-byte buffer; streaming it without body matching", limit)
+		}
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(buf))
+	return buf
+}
+
+// readCloser pairs a reader with the Close of the original body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
 // injectFailure applies the failure logic defined in a rule.
 func (p *Proxy) injectFailure(w http.ResponseWriter, r *http.Request, rule *state.Rule) {
-	targetURLString := strings.TrimPrefix(r.URL.Path, "/")
+	targetURLString := p.targetFor(r)
+
+	if fn, ok := faultHandler(rule.Failure.Type); ok {
+		fw := &firingWriter{ResponseWriter: w, fired: func() { p.ruleState.MarkFired(rule.ID, time.Now()) }}
+		fn(fw, r, rule, func() { p.serveReverseProxy(targetURLString, w, r) })
+		return
+	}
+
+	// A retry-storm rule only fails the first attempts, then lets requests through.
+	if rule.Failure.FailFirstN > 0 && !p.failsAttempt(rule) {
+		p.serveReverseProxy(targetURLString, w, r)
+		return
+	}
 
 	switch rule.Failure.Type {
 	case "latency":
-		time.Sleep(time.Duration(rule.Failure.LatencyMs) * time.Millisecond)
-		p.serveReverseProxy(targetURLString, w, r)
+		p.recordInjection(w, rule)
+		delay := time.Duration(rule.Failure.LatencyMs) * time.Millisecond
+		if step := rule.Failure.LatencyStepMs; step > 0 {
+			// A degrading backend: every request waits a step longer.
+			delay += time.Duration(p.nextCount(rule.ID)) * time.Duration(step) * time.Millisecond
+		}
+		if !p.sleepInjected(w, r, delay) {
+			return
+		}
+		p.serveReverseProxy(targetURLString, w, withInjectedDelay(r, delay))
 
 	case "error":
-		w.WriteHeader(rule.Failure.ErrorCode)
-		w.Write([]byte("FaultLine: Injected Error Response"))
+		p.recordInjection(w, rule)
+		// An optional delay models a backend that is slow *and* failing.
+		if rule.Failure.LatencyMs > 0 && !p.sleepInjected(w, r, time.Duration(rule.Failure.LatencyMs)*time.Millisecond) {
+			return
+		}
+		code := rule.Failure.ErrorCode
+		applyResponseHeaders(w, rule.Failure)
+		if rule.Failure.RetryAfterSeconds > 0 && (code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable) {
+			w.Header().Set("Retry-After", strconv.Itoa(rule.Failure.RetryAfterSeconds))
+		}
+		writeInjectedBody(w, r, code, []byte("FaultLine: Injected Error Response"))
+
+	case "timeout":
+		// An upstream that never answers: hold the request, then give up
+		// the way a gateway would, unless the client gives up first.
+		p.recordInjection(w, rule)
+		wait := time.Duration(cmp.Or(rule.Failure.LatencyMs, defaultTimeoutMs)) * time.Millisecond
+		p.markInjectedDelay(wait)
+		select {
+		case <-time.After(wait):
+		case <-p.inFlight.skipDelays:
+		case <-r.Context().Done():
+			// Out of timeout budget, the client still gets the 504.
+			if !errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+				return
+			}
+		}
+		applyResponseHeaders(w, rule.Failure)
+		writeInjectedBody(w, r, http.StatusGatewayTimeout, []byte("FaultLine: Injected Timeout"))
+
+	case "sequence":
+		if len(rule.Failure.Sequence) == 0 {
+			p.serveReverseProxy(targetURLString, w, r)
+			return
+		}
+		n := p.nextCount(rule.ID)
+		code := rule.Failure.Sequence[n%uint64(len(rule.Failure.Sequence))]
+		if code < 400 {
+			p.serveReverseProxy(targetURLString, w, r)
+			return
+		}
+		p.recordInjection(w, rule)
+		applyResponseHeaders(w, rule.Failure)
+		writeInjectedBody(w, r, code, []byte("FaultLine: Injected Error Response"))
+
+	case "ratelimit":
+		p.serveRateLimited(targetURLString, w, r, rule)
+
+	case "quota":
+		p.serveQuota(targetURLString, w, r, rule)
+
+	case "stream":
+		p.serveStream(targetURLString, w, r, rule)
+
+	case "mock":
+		if r.Method == http.MethodConnect {
+			// A tunnel's (encrypted) contents can't be mocked.
+			p.serveReverseProxy(targetURLString, w, r)
+			return
+		}
+		p.recordInjection(w, rule)
+		if rule.Failure.LatencyMs > 0 && !p.sleepInjected(w, r, time.Duration(rule.Failure.LatencyMs)*time.Millisecond) {
+			return
+		}
+		applyResponseHeaders(w, rule.Failure)
+		body := []byte(rule.Failure.Body)
+		if w.Header().Get("Content-Type") == "" && json.Valid(body) {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		writeInjectedBody(w, r, cmp.Or(rule.Failure.StatusCode, http.StatusOK), body)
+
+	case "dns":
+		// A backend whose name doesn't resolve; an optional delay models
+		// a slow resolver giving up.
+		p.recordInjection(w, rule)
+		if rule.Failure.LatencyMs > 0 && !p.sleepInjected(w, r, time.Duration(rule.Failure.LatencyMs)*time.Millisecond) {
+			return
+		}
+		writeDNSError(w, dnsFailure(targetHost(targetURLString)))
+
+	case "refused":
+		p.recordInjection(w, rule)
+		log.Printf("[PROXY] Refusing connection for %s (request %s)", targetURLString, requestID(r))
+		refuseConnection(w)
+
+	case "request-mutation":
+		if r.Method == http.MethodConnect {
+			// A tunnel's (encrypted) requests can't be rewritten.
+			p.serveReverseProxy(targetURLString, w, r)
+			return
+		}
+		p.recordInjection(w, rule)
+		p.serveReverseProxy(targetURLString, w, mutateRequest(r, rule.Failure.RequestMutation))
 
 	default:
 		log.Printf("Unknown failure type: %s. Proxying normally.", rule.Failure.Type)
@@ -79,44 +426,221 @@ func (p *Proxy) injectFailure(w http.ResponseWriter, r *http.Request, rule *stat
 	}
 }
 
+// recordInjection notes that the rule fired, for its LastFired time, and
+// counts and tags the injected fault through countInjection. It is called
+// only where a fault is actually applied, not for requests let through.
+func (p *Proxy) recordInjection(w http.ResponseWriter, rule *state.Rule) {
+	p.ruleState.MarkFired(rule.ID, time.Now())
+	countInjection(w, rule)
+}
+
+// countInjection counts an injected fault in the exported metrics and tags
+// the response so clients (e.g. replay) can tell injected faults apart.
+func countInjection(w http.ResponseWriter, rule *state.Rule) {
+	metrics.FaultsInjected.WithLabelValues(rule.Failure.Type, rule.ID).Inc()
+	w.Header().Set(FaultHeader, rule.Failure.Type)
+	w.Header().Set(RuleHeader, rule.ID)
+	w.Header().Set(InjectedHeader, rule.ID+";"+rule.Failure.Type)
+}
+
+// nextCount returns how many times the rule has been counted before this call.
+// It is safe for concurrent use by proxy goroutines.
+func (p *Proxy) nextCount(ruleID string) uint64 {
+	c, _ := p.counters.LoadOrStore(ruleID, new(uint64))
+	return atomic.AddUint64(c.(*uint64), 1) - 1
+}
+
+// applyResponseHeaders writes the rule's custom headers onto an injected response.
+// It is only used for responses FaultLine generates itself; proxied responses keep
+// the upstream headers (and the proxy's CORS handling) untouched.
+func applyResponseHeaders(w http.ResponseWriter, f state.Failure) {
+	for name, value := range f.ResponseHeaders {
+		w.Header().Set(name, value)
+	}
+}
+
+// targetKey is the request context key carrying the parsed target URL to the Director.
+type targetKey struct{}
+
 // serveReverseProxy forwards the request to the original destination.
 func (p *Proxy) serveReverseProxy(target string, w http.ResponseWriter, r *http.Request) {
+	if buf, ok := r.Context().Value(bufferedKey{}).(*responseBuffer); ok {
+		buf.writeTo(w)
+		return
+	}
 	remote, err := url.Parse(target)
 	if err != nil {
 		log.Printf("Error parsing target URL: %v", err)
 		http.Error(w, "Invalid target URL", http.StatusBadRequest)
 		return
 	}
+	// A path like /api/users (no --default-upstream) or /http:/// parses, but
+	// names no upstream to forward to.
+	if remote.Scheme == "" || remote.Host == "" {
+		log.Printf("[PROXY] Cannot forward %s %s: target %q has no scheme or host", r.Method, r.URL.Path, target)
+		msg := fmt.Sprintf("FaultLine: target %q is not an absolute URL; request <proxy>/<scheme>://<host>/<path> or start the proxy with --default-upstream", target)
+		http.Error(w, msg, http.StatusBadGateway)
+		return
+	}
 
-	proxy := httputil.NewSingleHostReverseProxy(remote)
+	if err := p.checkHost(remote.Hostname()); err != nil {
+		log.Printf("[PROXY] Refusing to forward to %s: %v", target, err)
+		http.Error(w, "FaultLine: "+err.Error(), http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		p.serveTunnel(w, r)
+		return
+	}
 
-	// *** THE DEFINITIVE FIX IS HERE ***
 	// The original request to our proxy is, for example, GET /https://jsonplaceholder.typicode.com/users
-	// The 'Director' must correctly rewrite this to be a valid request to the final server.
-	originalPath := r.URL.Path
+	// The cached proxy's Director rewrites it using the target carried in the context.
+	ctx := context.WithValue(r.Context(), targetKey{}, remote)
+	// Upgraded connections (WebSocket) live on after the handshake, so the
+	// request timeout would cut them off.
+	upgrade := isUpgrade(r)
+	if p.opts.RequestTimeout > 0 && !upgrade {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.RequestTimeout)
+		defer cancel()
+	}
+	r = r.WithContext(ctx)
 
-	director := func(req *http.Request) {
-		// Set the scheme and host to the target's
-		req.URL.Scheme = remote.Scheme
-		req.URL.Host = remote.Host
+	logging.Debugf("[PROXY] Forwarding request for %s (request %s)", target, requestID(r))
+	rp := p.reverseProxyFor(remote)
+	serve := rp.ServeHTTP
+	if p.opts.Recorder != nil {
+		serve = func(w http.ResponseWriter, r *http.Request) { p.serveRecorded(target, w, r, rp.ServeHTTP) }
+	}
+	start := time.Now()
+	if p.opts.TraceBodies {
+		p.serveTraced(target, w, r, serve)
+	} else {
+		serve(w, r)
+	}
+	if !upgrade {
+		p.observeUpstream(target, r, time.Since(start))
+	}
+}
 
-		// The path sent to the final server should be the target's path, not the one
-		// that includes the full URL.
-		req.URL.Path = remote.Path
+// reverseProxyFor returns the reverse proxy for the target's scheme and host,
+// creating it on first use. Reusing one proxy (and transport) per upstream keeps
+// keep-alive connections pooled across requests.
+func (p *Proxy) reverseProxyFor(remote *url.URL) *httputil.ReverseProxy {
+	key := remote.Scheme + "://" + remote.Host
+	if rp, ok := p.proxies.Load(key); ok {
+		return rp.(*httputil.ReverseProxy)
+	}
 
-		// Copy the query parameters.
-		req.URL.RawQuery = remote.RawQuery
+	rp := &httputil.ReverseProxy{
+		Director:       director,
+		Transport:      p.newTransport(),
+		ErrorHandler:   p.upstreamErrorHandler,
+		ModifyResponse: p.modifyResponse,
+	}
+	actual, _ := p.proxies.LoadOrStore(key, rp)
+	return actual.(*httputil.ReverseProxy)
+}
 
-		// Set the host of the request to the target host.
-		req.Host = remote.Host
+// newTransport builds an upstream transport honoring the configured timeouts.
+func (p *Proxy) newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if p.opts.DialTimeout > 0 {
+		dialer := &net.Dialer{Timeout: p.opts.DialTimeout, KeepAlive: 30 * time.Second}
+		t.DialContext = dialer.DialContext
+	}
+	t.DialContext = p.guardDial(t.DialContext)
+	// A custom dialer turns off HTTP/2 unless asked for; keep using it with
+	// upstreams that negotiate it over TLS.
+	t.ForceAttemptHTTP2 = true
+	t.ResponseHeaderTimeout = p.opts.ResponseHeaderTimeout
+	return t
+}
 
-		// Clean up the RequestURI to avoid conflicts.
-		req.RequestURI = ""
+// upstreamErrorHandler reports upstream failures, answering timeouts with a 504
+// rather than the reverse proxy's generic 502, and records them as events.
+func (p *Proxy) upstreamErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errForbiddenTarget) {
+		log.Printf("[PROXY] Refusing to forward to %s (request %s): %v", r.URL.String(), requestID(r), err)
+		http.Error(w, "FaultLine: "+err.Error(), http.StatusForbidden)
+		return
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		log.Printf("[PROXY] Upstream timeout for %s (request %s): %v", r.URL.String(), requestID(r), err)
+		p.recordUpstreamError(r, http.StatusGatewayTimeout, "timeout", err.Error())
+		http.Error(w, "FaultLine: upstream timed out", http.StatusGatewayTimeout)
+		return
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		log.Printf("[PROXY] Upstream DNS failure for %s (request %s): %v", r.URL.String(), requestID(r), err)
+		p.recordUpstreamError(r, http.StatusBadGateway, "dns", err.Error())
+		writeDNSError(w, dnsErr)
+		return
+	}
+	log.Printf("[PROXY] Upstream error for %s (request %s): %v", r.URL.String(), requestID(r), err)
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		p.recordUpstreamError(r, http.StatusBadGateway, "refused", err.Error())
+	case !errors.Is(err, context.Canceled): // not just the client going away
+		p.recordUpstreamError(r, http.StatusBadGateway, "", err.Error())
+	}
+	http.Error(w, "FaultLine: upstream request failed", http.StatusBadGateway)
+}
 
-		log.Printf("Rewriting request from [%s] to [%s%s]", originalPath, req.URL.Host, req.URL.Path)
+// modifyResponse records upstream error responses, and those breaking the
+// contract, before they are relayed.
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	if resp.StatusCode >= 400 {
+		p.recordUpstreamError(resp.Request, resp.StatusCode, "", resp.Status)
 	}
-	proxy.Director = director
+	if p.opts.Contract != nil {
+		p.checkContract(resp)
+	}
+	return dropEchoedRequestID(resp)
+}
+
+// recordUpstreamError adds an upstream failure of the forwarded request r to
+// the event log, from which rules reproducing it are suggested.
+func (p *Proxy) recordUpstreamError(r *http.Request, status int, fault, msg string) {
+	target := r.URL.String()
+	if r.Method == http.MethodConnect {
+		target = connectTarget(r.Host)
+	}
+	p.events.Record(state.Event{
+		Type:      state.UpstreamErrorEvent,
+		Target:    target,
+		Method:    r.Method,
+		Failure:   fault,
+		Message:   msg,
+		Status:    status,
+		RequestID: requestID(r),
+	})
+}
+
+// director rewrites an incoming proxy request into a request to the real target.
+func director(req *http.Request) {
+	remote := req.Context().Value(targetKey{}).(*url.URL)
+	originalPath := req.URL.Path
+
+	// Set the scheme and host to the target's
+	req.URL.Scheme = remote.Scheme
+	req.URL.Host = remote.Host
+
+	// The path sent to the final server should be the target's path, not the one
+	// that includes the full URL.
+	req.URL.Path = remote.Path
+	req.URL.RawPath = ""
+
+	// Copy the query parameters.
+	req.URL.RawQuery = remote.RawQuery
+
+	// Set the host of the request to the target host.
+	req.Host = remote.Host
+
+	// Clean up the RequestURI to avoid conflicts.
+	req.RequestURI = ""
 
-	log.Printf("[PROXY] Forwarding request for %s", target)
-	proxy.ServeHTTP(w, r)
+	logging.Debugf("Rewriting request from [%s] to [%s%s]", originalPath, req.URL.Host, req.URL.Path)
 }
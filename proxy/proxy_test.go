@@ -0,0 +1,987 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"faultline/cli"
+	"faultline/config"
+	"faultline/state"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestProxy returns a proxy holding rules whose requests for relative
+// paths go to an upstream answering 200 "upstream:" followed by the request
+// body.
+func newTestProxy(t *testing.T, opts Options, rules ...state.Rule) (*Proxy, *httptest.Server) {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "upstream:")
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(upstream.Close)
+
+	rs := state.NewRuleState(nil, "")
+	for _, rule := range rules {
+		if !rs.AddRule(rule) {
+			t.Fatalf("AddRule(%s) failed", rule.ID)
+		}
+	}
+	opts.DefaultUpstream = upstream.URL
+	return NewProxy(cli.NewRuleManager(rs), opts), upstream
+}
+
+// do sends req through the proxy and returns the recorded response.
+func do(p *Proxy, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	p.HandleRequest(rec, req)
+	return rec
+}
+
+// get sends a GET for path through the proxy and returns the status code.
+func get(p *Proxy, path string) int {
+	return do(p, httptest.NewRequest(http.MethodGet, path, nil)).Code
+}
+
+// captureLog collects the standard logger's output until the test ends.
+func captureLog(t *testing.T) *strings.Builder {
+	t.Helper()
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// rule returns an enabled rule for every path under the default upstream.
+func rule(id string, f state.Failure) state.Rule {
+	return state.Rule{ID: id, Target: "http://127.0.0.1", Enabled: true, Failure: f}
+}
+
+func TestSequenceCyclesThroughCodes(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("seq", state.Failure{Type: "sequence", Sequence: []int{200, 500, 200, 503}}))
+
+	want := []int{200, 500, 200, 503, 200, 500, 200, 503, 200}
+	for i, code := range want {
+		if got := get(p, "/items"); got != code {
+			t.Fatalf("request %d: status %d, want %d (sequence so far should be %v)", i, got, code, want[:i+1])
+		}
+	}
+}
+
+func TestSequenceIsSharedAcrossConcurrentRequests(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("seq", state.Failure{Type: "sequence", Sequence: []int{200, 500}}))
+
+	var mu sync.Mutex
+	counts := map[int]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code := get(p, "/items")
+			mu.Lock()
+			counts[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if counts[200] != 50 || counts[500] != 50 {
+		t.Errorf("got %v, want 50 of each code", counts)
+	}
+}
+
+// BenchmarkServeReverseProxy compares forwarding through the cached reverse
+// proxy of an upstream with building a proxy and transport per request, as
+// the proxy used to.
+func BenchmarkServeReverseProxy(b *testing.B) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "upstream")
+	}))
+	defer upstream.Close()
+	target := upstream.URL + "/items"
+
+	b.Run("cached", func(b *testing.B) {
+		p := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, "")), Options{})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p.serveReverseProxy(target, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/"+target, nil))
+		}
+	})
+
+	b.Run("per-request", func(b *testing.B) {
+		remote, _ := url.Parse(upstream.URL)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rp := httputil.NewSingleHostReverseProxy(remote)
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			rp.Transport = transport
+			req := httptest.NewRequest(http.MethodGet, "/items", nil)
+			rp.ServeHTTP(httptest.NewRecorder(), req)
+			transport.CloseIdleConnections()
+		}
+	})
+}
+
+func TestBodyMatch(t *testing.T) {
+	bodyRule := rule("big-orders", state.Failure{Type: "error", ErrorCode: 500})
+	bodyRule.BodyMatch = &state.BodyMatch{Path: "order.amount", Equals: "5000"}
+	p, _ := newTestProxy(t, Options{}, bodyRule)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		return do(p, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+	}
+	if rec := post(`{"order": {"amount": 5000}}`); rec.Code != http.StatusInternalServerError {
+		t.Errorf("matching body: status %d, want 500", rec.Code)
+	}
+	for _, body := range []string{`{"order": {"amount": 20}}`, `{"order": {}}`, `not json`, ``} {
+		rec := post(body)
+		if rec.Code != http.StatusOK || rec.Body.String() != "upstream:"+body {
+			t.Errorf("body %q: got %d %q, want it forwarded intact", body, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestBodyMatchContains(t *testing.T) {
+	bodyRule := rule("boom", state.Failure{Type: "error", ErrorCode: 503})
+	bodyRule.BodyMatch = &state.BodyMatch{Contains: "boom"}
+	p, _ := newTestProxy(t, Options{}, bodyRule)
+
+	if rec := do(p, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("a boom b"))); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("matching body: status %d, want 503", rec.Code)
+	}
+	if rec := do(p, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("quiet"))); rec.Code != http.StatusOK {
+		t.Errorf("other body: status %d, want 200", rec.Code)
+	}
+}
+
+func TestBodyMatchSkipsBodiesOverTheBuffer(t *testing.T) {
+	bodyRule := rule("boom", state.Failure{Type: "error", ErrorCode: 503})
+	bodyRule.BodyMatch = &state.BodyMatch{Contains: "boom"}
+	p, _ := newTestProxy(t, Options{MaxBodyBuffer: 16}, bodyRule)
+
+	body := "boom" + strings.Repeat("x", 100)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.ContentLength = -1 // unknown, so the body has to be read to find out
+	rec := do(p, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "upstream:"+body {
+		t.Errorf("oversized body: got %d with %d bytes, want it streamed through unmatched", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestConfigRulesAreInjected(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "upstream")
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "faultline.yaml")
+	yaml := "rules:\n" +
+		"  - target: " + upstream.URL + "/pay\n" +
+		"    failure: {type: error, error_code: 503}\n" +
+		"  - target: " + upstream.URL + "/maybe\n" +
+		"    failure: {type: error, error_code: 500, probability: 0.5}\n"
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxy(cli.NewRuleManager(state.NewRuleState(cfg.Rules, "")), Options{DefaultUpstream: upstream.URL})
+
+	if got := get(p, "/pay"); got != http.StatusServiceUnavailable {
+		t.Errorf("/pay: status %d, want the configured 503", got)
+	}
+	if got := get(p, "/other"); got != http.StatusOK {
+		t.Errorf("/other: status %d, want 200", got)
+	}
+
+	failed := 0
+	for i := 0; i < 400; i++ {
+		if get(p, "/maybe") == http.StatusInternalServerError {
+			failed++
+		}
+	}
+	if failed < 140 || failed > 260 {
+		t.Errorf("probability 0.5 failed %d of 400 requests, want about 200", failed)
+	}
+}
+
+func TestHeaderMatch(t *testing.T) {
+	tenantRule := rule("beta", state.Failure{Type: "error", ErrorCode: 503})
+	tenantRule.HeaderMatch = map[string]string{"X-Tenant": "beta", "x-region": "eu"}
+	p, _ := newTestProxy(t, Options{}, tenantRule)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"all headers", map[string]string{"X-Tenant": "beta", "X-Region": "eu"}, http.StatusServiceUnavailable},
+		{"names in other case", map[string]string{"x-tenant": "beta", "X-REGION": "eu"}, http.StatusServiceUnavailable},
+		{"one header missing", map[string]string{"X-Tenant": "beta"}, http.StatusOK},
+		{"other value", map[string]string{"X-Tenant": "alpha", "X-Region": "eu"}, http.StatusOK},
+		{"value in other case", map[string]string{"X-Tenant": "Beta", "X-Region": "eu"}, http.StatusOK},
+		{"no headers", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		if got := do(p, req).Code; got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFailFirstN(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("storm", state.Failure{Type: "error", ErrorCode: 503, FailFirstN: 3}))
+
+	for i := 0; i < 5; i++ {
+		want := http.StatusOK
+		if i < 3 {
+			want = http.StatusServiceUnavailable
+		}
+		if got := get(p, "/items"); got != want {
+			t.Errorf("request %d: status %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestFailFirstNStartsOverAfterReset(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("storm", state.Failure{Type: "error", ErrorCode: 503, FailFirstN: 1, ResetAfterSeconds: 1}))
+
+	if got := get(p, "/items"); got != http.StatusServiceUnavailable {
+		t.Fatalf("first request: status %d, want 503", got)
+	}
+	if got := get(p, "/items"); got != http.StatusOK {
+		t.Fatalf("second request: status %d, want 200", got)
+	}
+	// Age the window rather than waiting for it to end.
+	counterFor(&p.attempts, "storm").start = time.Now().Add(-2 * time.Second)
+	if got := get(p, "/items"); got != http.StatusServiceUnavailable {
+		t.Errorf("after the reset: status %d, want 503 again", got)
+	}
+}
+
+func TestRateLimitLetsThroughTheConfiguredRate(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("limit", state.Failure{Type: "ratelimit", RequestsPerSecond: 10, Burst: 3}))
+
+	// The burst goes through at once, then requests arriving faster than
+	// the rate are turned away.
+	for i := 0; i < 5; i++ {
+		rec := do(p, httptest.NewRequest(http.MethodGet, "/items", nil))
+		want := http.StatusOK
+		if i >= 3 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("request %d: Retry-After %q, want 1", i, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	// A token is back every 100ms.
+	time.Sleep(120 * time.Millisecond)
+	if got := get(p, "/items"); got != http.StatusOK {
+		t.Errorf("after a token refilled: status %d, want 200", got)
+	}
+	if got := get(p, "/items"); got != http.StatusTooManyRequests {
+		t.Errorf("right after: status %d, want 429", got)
+	}
+}
+
+func TestQuotaResetsAfterTheWindow(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("quota", state.Failure{Type: "quota", MaxRequests: 2, WindowSeconds: 60}))
+
+	for i := 0; i < 4; i++ {
+		rec := do(p, httptest.NewRequest(http.MethodGet, "/items", nil))
+		want := http.StatusOK
+		if i >= 2 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "60" {
+			t.Errorf("request %d: Retry-After %q, want 60", i, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	// End the window rather than waiting a minute for it.
+	counterFor(&p.quotas, "quota").start = time.Now().Add(-time.Minute)
+	for i := 0; i < 3; i++ {
+		want := http.StatusOK
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		if got := get(p, "/items"); got != want {
+			t.Errorf("new window, request %d: status %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestQuotaUsesTheRuleErrorCode(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("quota", state.Failure{Type: "quota", MaxRequests: 1, ErrorCode: 503}))
+
+	if got := get(p, "/items"); got != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", got)
+	}
+	rec := do(p, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "" {
+		t.Errorf("over quota: got %d with Retry-After %q, want 503 without one (no window)", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	queryRule := rule("debug", state.Failure{Type: "error", ErrorCode: 500})
+	queryRule.QueryMatch = map[string]string{"debug": "true", "lang": "en"}
+	p, _ := newTestProxy(t, Options{}, queryRule)
+
+	for path, want := range map[string]int{
+		"/search?debug=true&lang=en":     http.StatusInternalServerError,
+		"/search?lang=en&q=a&debug=true": http.StatusInternalServerError,
+		"/search?lang=en":                http.StatusOK,
+		"/search":                        http.StatusOK,
+	} {
+		if got := get(p, path); got != want {
+			t.Errorf("%s: status %d, want %d", path, got, want)
+		}
+	}
+}
+
+func TestCatchAllRuleAppliesToTheRest(t *testing.T) {
+	def := rule("default", state.Failure{Type: "error", ErrorCode: 502})
+	def.Target = state.CatchAllTarget
+	p, upstream := newTestProxy(t, Options{}, def)
+	p.ruleState.AddRule(state.Rule{ID: "pay", Target: upstream.URL + "/pay", Enabled: true, Failure: state.Failure{Type: "error", ErrorCode: 503}})
+
+	if got := get(p, "/pay"); got != http.StatusServiceUnavailable {
+		t.Errorf("/pay: status %d, want the specific rule's 503", got)
+	}
+	if got := get(p, "/orders"); got != http.StatusBadGateway {
+		t.Errorf("/orders: status %d, want the default rule's 502", got)
+	}
+}
+
+func TestResponseMatch(t *testing.T) {
+	var hits atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "db down")
+			return
+		}
+		io.WriteString(w, "fine")
+	}))
+	defer upstream.Close()
+
+	newProxy := func(rule state.Rule) *Proxy {
+		rule.ResponseMatch = &state.ResponseMatch{Status: []string{"5xx"}}
+		rs := state.NewRuleState(nil, "")
+		rs.AddRule(rule)
+		return NewProxy(cli.NewRuleManager(rs), Options{DefaultUpstream: upstream.URL})
+	}
+
+	t.Run("error replaces matched responses", func(t *testing.T) {
+		p := newProxy(rule("gw", state.Failure{Type: "error", ErrorCode: 502}))
+		hits.Store(0)
+		if got := get(p, "/broken"); got != http.StatusBadGateway {
+			t.Errorf("500 from upstream: status %d, want the injected 502", got)
+		}
+		if rec := do(p, httptest.NewRequest(http.MethodGet, "/ok", nil)); rec.Code != http.StatusOK || rec.Body.String() != "fine" {
+			t.Errorf("200 from upstream: got %d %q, want it passed on unchanged", rec.Code, rec.Body.String())
+		}
+		if n := hits.Load(); n != 2 {
+			t.Errorf("upstream saw %d requests, want each forwarded once", n)
+		}
+	})
+
+	t.Run("latency delays the real response", func(t *testing.T) {
+		p := newProxy(rule("slow", state.Failure{Type: "latency", LatencyMs: 100}))
+		hits.Store(0)
+		start := time.Now()
+		rec := do(p, httptest.NewRequest(http.MethodGet, "/broken", nil))
+		if took := time.Since(start); took < 100*time.Millisecond {
+			t.Errorf("matched response took %s, want it delayed 100ms", took)
+		}
+		if rec.Code != http.StatusInternalServerError || rec.Body.String() != "db down" {
+			t.Errorf("matched response: got %d %q, want the upstream's 500", rec.Code, rec.Body.String())
+		}
+		if n := hits.Load(); n != 1 {
+			t.Errorf("upstream saw %d requests, want the buffered response replayed", n)
+		}
+
+		start = time.Now()
+		get(p, "/ok")
+		if took := time.Since(start); took >= 100*time.Millisecond {
+			t.Errorf("unmatched response took %s, want no delay", took)
+		}
+	})
+
+	t.Run("timeout replaces matched responses", func(t *testing.T) {
+		p := newProxy(rule("to", state.Failure{Type: "timeout", LatencyMs: 50}))
+		if got := get(p, "/broken"); got != http.StatusGatewayTimeout {
+			t.Errorf("500 from upstream: status %d, want the injected 504", got)
+		}
+		if rec := do(p, httptest.NewRequest(http.MethodGet, "/ok", nil)); rec.Code != http.StatusOK || rec.Body.String() != "fine" {
+			t.Errorf("200 from upstream: got %d %q, want it passed on unchanged", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+// blockingUpstream answers requests only once release is closed, counting
+// how many it holds at once.
+type blockingUpstream struct {
+	release      chan struct{}
+	active, peak atomic.Int64
+	*httptest.Server
+}
+
+func newBlockingUpstream(t *testing.T) *blockingUpstream {
+	u := &blockingUpstream{release: make(chan struct{})}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := u.active.Add(1)
+		defer u.active.Add(-1)
+		for {
+			peak := u.peak.Load()
+			if n <= peak || u.peak.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		<-u.release
+		io.WriteString(w, "upstream")
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+// waitActive waits until the upstream holds n requests.
+func (u *blockingUpstream) waitActive(t *testing.T, n int64) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); u.active.Load() < n; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("upstream holds %d request(s), want %d", u.active.Load(), n)
+		}
+	}
+}
+
+func TestMaxConcurrentRejectsRequestsOverTheLimit(t *testing.T) {
+	upstream := newBlockingUpstream(t)
+	limited := rule("limited", state.Failure{Type: "latency", LatencyMs: 1, MaxConcurrent: 2})
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(limited)
+	p := NewProxy(cli.NewRuleManager(rs), Options{DefaultUpstream: upstream.URL})
+
+	codes := make(chan int, 5)
+	for i := 0; i < 2; i++ {
+		go func() { codes <- get(p, "/items") }()
+	}
+	upstream.waitActive(t, 2)
+	for i := 0; i < 3; i++ {
+		go func() { codes <- get(p, "/items") }()
+	}
+	for i := 0; i < 3; i++ {
+		if code := <-codes; code != http.StatusServiceUnavailable {
+			t.Errorf("request over the limit: status %d, want 503", code)
+		}
+	}
+	close(upstream.release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("request within the limit: status %d, want 200", code)
+		}
+	}
+	if peak := upstream.peak.Load(); peak != 2 {
+		t.Errorf("upstream held %d requests at once, want at most 2", peak)
+	}
+}
+
+func TestMaxConcurrentQueuesUntilASlotFrees(t *testing.T) {
+	upstream := newBlockingUpstream(t)
+	limited := rule("limited", state.Failure{Type: "latency", LatencyMs: 1, MaxConcurrent: 1, QueueTimeoutMs: 5000})
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(limited)
+	p := NewProxy(cli.NewRuleManager(rs), Options{DefaultUpstream: upstream.URL})
+
+	codes := make(chan int, 2)
+	go func() { codes <- get(p, "/items") }()
+	upstream.waitActive(t, 1)
+	go func() { codes <- get(p, "/items") }()
+
+	time.Sleep(50 * time.Millisecond)
+	if n := upstream.active.Load(); n != 1 {
+		t.Fatalf("upstream holds %d requests, want the second one queued", n)
+	}
+	close(upstream.release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("request %d: status %d, want 200 once a slot freed", i, code)
+		}
+	}
+	if peak := upstream.peak.Load(); peak != 1 {
+		t.Errorf("upstream held %d requests at once, want 1", peak)
+	}
+}
+
+// lastFired returns the LastFired time of the rule with id.
+func lastFired(t *testing.T, p *Proxy, id string) *time.Time {
+	t.Helper()
+	rule, ok := p.ruleState.RuleByRef(id)
+	if !ok {
+		t.Fatalf("no rule %s", id)
+	}
+	return rule.LastFired
+}
+
+func TestLastFiredOnlyWhenAFaultIsApplied(t *testing.T) {
+	passthroughs := map[string]state.Failure{
+		"sequence below 400": {Type: "sequence", Sequence: []int{200}},
+		"quota under limit":  {Type: "quota", MaxRequests: 10},
+		"ratelimit in rate":  {Type: "ratelimit", RequestsPerSecond: 100, Burst: 10},
+		"plugin forwarding":  {Type: "test-forward"},
+	}
+	RegisterFaultHandler("test-forward", func(w http.ResponseWriter, r *http.Request, rule *state.Rule, forward func()) {
+		forward()
+	})
+	for name, f := range passthroughs {
+		p, _ := newTestProxy(t, Options{}, rule("r", f))
+		if got := get(p, "/items"); got != http.StatusOK {
+			t.Fatalf("%s: status %d, want 200", name, got)
+		}
+		if at := lastFired(t, p, "r"); at != nil {
+			t.Errorf("%s: LastFired set to %s for a request let through", name, at)
+		}
+	}
+}
+
+func TestLastFiredUpdatesWhenTheRuleFires(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("r", state.Failure{Type: "error", ErrorCode: 503, FailFirstN: 1}))
+
+	before := time.Now()
+	get(p, "/items")
+	fired := lastFired(t, p, "r")
+	if fired == nil || fired.Before(before) {
+		t.Fatalf("LastFired = %v after an injected 503, want a time after %s", fired, before)
+	}
+
+	// Past FailFirstN requests are proxied, which isn't firing.
+	if got := get(p, "/items"); got != http.StatusOK {
+		t.Fatalf("second request: status %d, want 200", got)
+	}
+	if again := lastFired(t, p, "r"); again == nil || !again.Equal(*fired) {
+		t.Errorf("LastFired moved from %s to %v on a request let through", fired, again)
+	}
+}
+
+func TestLastFiredFromPlugins(t *testing.T) {
+	RegisterFaultHandler("test-teapot", func(w http.ResponseWriter, r *http.Request, rule *state.Rule, forward func()) {
+		RecordInjection(w, rule)
+		w.WriteHeader(http.StatusTeapot)
+	})
+	p, _ := newTestProxy(t, Options{HideFaultHeaders: true}, rule("r", state.Failure{Type: "test-teapot"}))
+
+	rec := do(p, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if rec.Code != http.StatusTeapot || rec.Header().Get(RuleHeader) != "" {
+		t.Fatalf("got %d with rule header %q, want a bare 418", rec.Code, rec.Header().Get(RuleHeader))
+	}
+	if lastFired(t, p, "r") == nil {
+		t.Error("LastFired not set after the plugin recorded an injection")
+	}
+}
+
+func TestRolloutByHeader(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("canary", state.Failure{Type: "error", ErrorCode: 503, Rollout: &state.Rollout{Percent: 50, Header: "X-User-ID"}}))
+
+	failed := 0
+	for i := 0; i < 400; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.Header.Set("X-User-ID", user)
+		code := do(p, req).Code
+		if want := (&state.Rollout{Percent: 50}).Includes(user); want != (code == http.StatusServiceUnavailable) {
+			t.Fatalf("%s: status %d, want failed: %v", user, code, want)
+		}
+		if code == http.StatusServiceUnavailable {
+			failed++
+		}
+	}
+	if failed < 160 || failed > 240 {
+		t.Errorf("50%% rollout failed %d of 400 users, want about 200", failed)
+	}
+	if got := get(p, "/items"); got != http.StatusOK {
+		t.Errorf("no X-User-ID: status %d, want the request let through", got)
+	}
+}
+
+func TestRolloutByClientIP(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("canary", state.Failure{Type: "error", ErrorCode: 503, Rollout: &state.Rollout{Percent: 50}}))
+
+	for i := 0; i < 50; i++ {
+		ip := fmt.Sprintf("10.0.0.%d", i)
+		want := http.StatusOK
+		if (&state.Rollout{Percent: 50}).Includes(ip) {
+			want = http.StatusServiceUnavailable
+		}
+		for port := 1000; port < 1003; port++ {
+			req := httptest.NewRequest(http.MethodGet, "/items", nil)
+			req.RemoteAddr = fmt.Sprintf("%s:%d", ip, port)
+			if got := do(p, req).Code; got != want {
+				t.Fatalf("%s: status %d, want %d for every connection", req.RemoteAddr, got, want)
+			}
+		}
+	}
+}
+
+func TestResponseMatchPassesLargeResponsesThrough(t *testing.T) {
+	big := strings.Repeat("x", 100)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sized" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(big)))
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, big[:50])
+		io.WriteString(w, big[50:])
+	}))
+	defer upstream.Close()
+
+	gw := rule("gw", state.Failure{Type: "error", ErrorCode: 502})
+	gw.ResponseMatch = &state.ResponseMatch{Status: []string{"5xx"}}
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(gw)
+	p := NewProxy(cli.NewRuleManager(rs), Options{DefaultUpstream: upstream.URL, MaxBodyBuffer: 64})
+
+	for _, path := range []string{"/sized", "/chunked"} {
+		rec := do(p, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusInternalServerError || rec.Body.String() != big {
+			t.Errorf("%s: got %d with %d bytes, want the upstream's 500 passed through whole", path, rec.Code, rec.Body.Len())
+		}
+	}
+}
+
+func TestResponseMatchStreamsEventStreams(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	slow := rule("slow", state.Failure{Type: "latency", LatencyMs: 1000})
+	slow.ResponseMatch = &state.ResponseMatch{Status: []string{"2xx"}}
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(slow)
+	front := httptest.NewServer(http.HandlerFunc(NewProxy(cli.NewRuleManager(rs), Options{DefaultUpstream: upstream.URL}).HandleRequest))
+	defer front.Close()
+
+	resp, err := http.Get(front.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	line := make(chan string, 1)
+	go func() {
+		l, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- l
+	}()
+	select {
+	case l := <-line:
+		if l != "data: first\n" {
+			t.Errorf("first line %q, want the first event", l)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("the first event was held back")
+	}
+}
+
+func TestDryRunForwardsWithoutInjecting(t *testing.T) {
+	for _, f := range []state.Failure{
+		{Type: "error", ErrorCode: 503},
+		{Type: "latency", LatencyMs: 500},
+	} {
+		p, _ := newTestProxy(t, Options{DryRun: true}, rule("dry", f))
+		start := time.Now()
+		rec := do(p, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("payload")))
+		if took := time.Since(start); took >= 250*time.Millisecond {
+			t.Errorf("%s: request took %s, want no injected delay", f.Type, took)
+		}
+		if rec.Code != http.StatusOK || rec.Body.String() != "upstream:payload" {
+			t.Errorf("%s: got %d %q, want the upstream's response", f.Type, rec.Code, rec.Body.String())
+		}
+		if lastFired(t, p, "dry") != nil {
+			t.Errorf("%s: rule marked fired in a dry run", f.Type)
+		}
+	}
+}
+
+func TestRequestTimeoutAnswersSlowUpstreamsWith504(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	p := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, "")), Options{DefaultUpstream: upstream.URL, RequestTimeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	if got := get(p, "/slow"); got != http.StatusGatewayTimeout {
+		t.Errorf("status %d, want 504", got)
+	}
+	if took := time.Since(start); took >= time.Second {
+		t.Errorf("request took %s, want it cut off after the 50ms timeout", took)
+	}
+}
+
+func TestInjectedLatencyEndsWithTheRequest(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("slow", state.Failure{Type: "latency", LatencyMs: 5000}))
+
+	t.Run("client cancels", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		start := time.Now()
+		do(p, httptest.NewRequest(http.MethodGet, "/items", nil).WithContext(ctx))
+		if took := time.Since(start); took >= time.Second {
+			t.Errorf("proxy held the request %s after the client left", took)
+		}
+	})
+
+	t.Run("timeout budget", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.Header.Set(RequestTimeoutHeader, "50")
+		start := time.Now()
+		rec := do(p, req)
+		if took := time.Since(start); took >= time.Second {
+			t.Errorf("proxy held the request %s past its 50ms budget", took)
+		}
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Errorf("status %d, want 504 once the budget is spent", rec.Code)
+		}
+	})
+}
+
+func TestTargetsWithoutSchemeOrHostGet502(t *testing.T) {
+	p := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, "")), Options{})
+	for _, path := range []string{"/api/users", "/http:///users"} {
+		rec := do(p, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "not an absolute URL") {
+			t.Errorf("%s: got %d %q, want a 502 explaining the target", path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRulesFileChangesApplyWithoutTheAPI(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	dataFile := filepath.Join(t.TempDir(), "rules.json")
+	p := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, dataFile)), Options{DefaultUpstream: upstream.URL})
+
+	if got := get(p, "/pay"); got != http.StatusOK {
+		t.Fatalf("before the edit: status %d, want 200", got)
+	}
+	// As written by the CLI of another process.
+	edited := `[{"id": "pay", "target": "` + upstream.URL + `/pay", "enabled": true, "failure": {"type": "error", "errorCode": 503}}]`
+	if err := os.WriteFile(dataFile, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(p, "/pay"); got != http.StatusServiceUnavailable {
+		t.Errorf("after the edit: status %d, want the new rule's 503", got)
+	}
+}
+
+func TestDefaultUpstreamAndEmbeddedTargets(t *testing.T) {
+	named := func(name string) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, name+" "+r.URL.RequestURI())
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+	def, other := named("default"), named("other")
+
+	cases := []struct {
+		defaultUpstream string
+		path            string
+		want            string
+	}{
+		{def.URL, "/users?page=2", "default /users?page=2"},
+		{def.URL + "/", "/users", "default /users"},
+		{def.URL, "/" + other.URL + "/users?page=2", "other /users?page=2"},
+		{"", "/" + other.URL + "/users", "other /users"},
+	}
+	for _, c := range cases {
+		p := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, "")), Options{DefaultUpstream: c.defaultUpstream})
+		rec := do(p, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != c.want {
+			t.Errorf("default %q, %s: got %d %q, want %q", c.defaultUpstream, c.path, rec.Code, rec.Body.String(), c.want)
+		}
+	}
+
+	// Rules see the resolved URL.
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(state.Rule{ID: "users", Target: def.URL + "/users", Enabled: true, Failure: state.Failure{Type: "error", ErrorCode: 503}})
+	p := NewProxy(cli.NewRuleManager(rs), Options{DefaultUpstream: def.URL})
+	if got := get(p, "/users"); got != http.StatusServiceUnavailable {
+		t.Errorf("rule on the default upstream: status %d, want 503", got)
+	}
+	if got := get(p, "/"+other.URL+"/users"); got != http.StatusOK {
+		t.Errorf("same path on another upstream: status %d, want 200", got)
+	}
+}
+
+func TestErrorWithLatencyArrivesAfterTheDelay(t *testing.T) {
+	p, _ := newTestProxy(t, Options{}, rule("slow-503", state.Failure{Type: "error", ErrorCode: 503, LatencyMs: 100}))
+	start := time.Now()
+	code := get(p, "/items")
+	if took := time.Since(start); took < 100*time.Millisecond {
+		t.Errorf("error arrived after %s, want it delayed 100ms", took)
+	}
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", code)
+	}
+}
+
+func TestRetryAfterOnInjectedErrors(t *testing.T) {
+	for code, want := range map[int]string{
+		http.StatusTooManyRequests:     "30",
+		http.StatusServiceUnavailable:  "30",
+		http.StatusInternalServerError: "",
+	} {
+		p, _ := newTestProxy(t, Options{}, rule("e", state.Failure{Type: "error", ErrorCode: code, RetryAfterSeconds: 30}))
+		rec := do(p, httptest.NewRequest(http.MethodGet, "/items", nil))
+		if rec.Code != code || rec.Header().Get("Retry-After") != want {
+			t.Errorf("error %d: got %d with Retry-After %q, want %q", code, rec.Code, rec.Header().Get("Retry-After"), want)
+		}
+	}
+	p, _ := newTestProxy(t, Options{}, rule("e", state.Failure{Type: "error", ErrorCode: 503}))
+	if got := do(p, httptest.NewRequest(http.MethodGet, "/items", nil)).Header().Get("Retry-After"); got != "" {
+		t.Errorf("503 without retryAfterSeconds: Retry-After %q, want none", got)
+	}
+}
+
+func TestResponseHeadersOnInjectedResponses(t *testing.T) {
+	headers := map[string]string{"X-Request-Region": "eu-west-1", "Cache-Control": "no-store"}
+	for _, f := range []state.Failure{
+		{Type: "error", ErrorCode: 503, ResponseHeaders: headers},
+		{Type: "mock", Body: `{"ok":true}`, ResponseHeaders: headers},
+		{Type: "timeout", LatencyMs: 1, ResponseHeaders: headers},
+	} {
+		p, _ := newTestProxy(t, Options{}, rule("h", f))
+		rec := do(p, httptest.NewRequest(http.MethodGet, "/items", nil))
+		for name, want := range headers {
+			if got := rec.Header().Get(name); got != want {
+				t.Errorf("%s: %s = %q, want %q", f.Type, name, got, want)
+			}
+		}
+	}
+
+	// Proxied responses are the upstream's own.
+	p, _ := newTestProxy(t, Options{}, rule("h", state.Failure{Type: "latency", LatencyMs: 1, ResponseHeaders: headers}))
+	if got := do(p, httptest.NewRequest(http.MethodGet, "/items", nil)).Header().Get("X-Request-Region"); got != "" {
+		t.Errorf("latency: X-Request-Region = %q on a proxied response, want none", got)
+	}
+}
+
+func TestMockAnswersWithoutTheUpstream(t *testing.T) {
+	var hits atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	t.Cleanup(upstream.Close)
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(rule("json", state.Failure{Type: "mock", Body: `{"items":[]}`}))
+	rs.AddRule(state.Rule{ID: "text", Target: upstream.URL + "/health", Enabled: true,
+		Failure: state.Failure{Type: "mock", StatusCode: 418, Body: "teapot", ResponseHeaders: map[string]string{"Content-Type": "text/plain"}}})
+	p := NewProxy(cli.NewRuleManager(rs), Options{DefaultUpstream: upstream.URL})
+
+	rec := do(p, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("ignored")))
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"items":[]}` || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("json mock: %d %q (%s), want 200 with the canned JSON", rec.Code, rec.Body, rec.Header().Get("Content-Type"))
+	}
+	rec = do(p, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusTeapot || rec.Body.String() != "teapot" || rec.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("text mock: %d %q (%s), want 418 teapot as text/plain", rec.Code, rec.Body, rec.Header().Get("Content-Type"))
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("upstream contacted %d time(s), want none", n)
+	}
+	if lastFired(t, p, "json") == nil {
+		t.Error("mock rule didn't record firing")
+	}
+}
+
+func TestInjectedHeaderNamesRuleAndType(t *testing.T) {
+	for _, tc := range []struct {
+		f    state.Failure
+		want string
+	}{
+		{state.Failure{Type: "error", ErrorCode: 500}, "r;error"},
+		{state.Failure{Type: "latency", LatencyMs: 1}, "r;latency"},
+		{state.Failure{Type: "mock", Body: "ok"}, "r;mock"},
+		{state.Failure{Type: "sequence", Sequence: []int{200}}, ""}, // let through
+	} {
+		p, _ := newTestProxy(t, Options{}, rule("r", tc.f))
+		if got := do(p, httptest.NewRequest(http.MethodGet, "/items", nil)).Header().Get(InjectedHeader); got != tc.want {
+			t.Errorf("%s: %s = %q, want %q", tc.f.Type, InjectedHeader, got, tc.want)
+		}
+	}
+
+	p, _ := newTestProxy(t, Options{HideFaultHeaders: true}, rule("r", state.Failure{Type: "error", ErrorCode: 500}))
+	if got := do(p, httptest.NewRequest(http.MethodGet, "/items", nil)).Header().Get(InjectedHeader); got != "" {
+		t.Errorf("HideFaultHeaders: %s = %q, want none", InjectedHeader, got)
+	}
+}
+
+func TestCORSPreflights(t *testing.T) {
+	var preflights atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		preflights.Add(1)
+		w.Header().Set("Access-Control-Allow-Origin", "https://app.example")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(upstream.Close)
+	preflight := func(opts Options) *httptest.ResponseRecorder {
+		opts.DefaultUpstream = upstream.URL
+		p := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, "")), opts)
+		req := httptest.NewRequest(http.MethodOptions, "/items", nil)
+		req.Header.Set("Origin", "https://evil.example")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		return do(p, req)
+	}
+
+	rec := preflight(Options{})
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "*" || !strings.Contains(rec.Header().Get("Access-Control-Allow-Methods"), "PUT") {
+		t.Errorf("default: %d %v, want the proxy to allow any origin", rec.Code, rec.Header())
+	}
+	if n := preflights.Load(); n != 0 {
+		t.Errorf("default: upstream got %d preflight(s), want none", n)
+	}
+
+	rec = preflight(Options{PassthroughCORS: true})
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example" {
+		t.Errorf("passthrough: %d %v, want the upstream's answer", rec.Code, rec.Header())
+	}
+	if n := preflights.Load(); n != 1 {
+		t.Errorf("passthrough: upstream got %d preflight(s), want 1", n)
+	}
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"faultline/state"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// serveQuota proxies the first MaxRequests matching requests of each quota
+// window and answers the rest with the rule's error code (429 by default)
+// and a Retry-After of when the window resets.
+func (p *Proxy) serveQuota(target string, w http.ResponseWriter, r *http.Request, rule *state.Rule) {
+	now := time.Now()
+	window := time.Duration(rule.Failure.WindowSeconds) * time.Second
+	n, start := counterFor(&p.quotas, rule.ID).hit(now, window)
+	if n <= rule.Failure.MaxRequests {
+		p.serveReverseProxy(target, w, r)
+		return
+	}
+
+	p.recordInjection(w, rule)
+	applyResponseHeaders(w, rule.Failure)
+	if window > 0 {
+		wait := start.Add(window).Sub(now)
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(wait.Seconds())), 1)))
+	}
+	code := rule.Failure.ErrorCode
+	if code == 0 {
+		code = http.StatusTooManyRequests
+	}
+	writeInjectedBody(w, r, code, []byte("FaultLine: Quota exceeded"))
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"faultline/state"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ruleLimiter is the token bucket behind a "ratelimit" rule, remembering the
+// settings it was built from so edits to the rule take effect.
+type ruleLimiter struct {
+	rps     float64
+	burst   int
+	limiter *rate.Limiter
+}
+
+// limiterFor returns the rule's token bucket, shared by all proxy goroutines.
+// The bucket is rebuilt (full) when the rule's rate or burst changes.
+func (p *Proxy) limiterFor(rule *state.Rule) *rate.Limiter {
+	rps, burst := rule.Failure.RequestsPerSecond, max(rule.Failure.Burst, 1)
+	v, _ := p.limiters.LoadOrStore(rule.ID, newRuleLimiter(rps, burst))
+	l := v.(*ruleLimiter)
+	if l.rps != rps || l.burst != burst {
+		l = newRuleLimiter(rps, burst)
+		p.limiters.Store(rule.ID, l)
+	}
+	return l.limiter
+}
+
+func newRuleLimiter(rps float64, burst int) *ruleLimiter {
+	return &ruleLimiter{rps: rps, burst: burst, limiter: rate.NewLimiter(rate.Limit(rps), burst)}
+}
+
+// serveRateLimited proxies the request if the rule's bucket has a token, and
+// otherwise answers 429 with a Retry-After of when the next token is due.
+func (p *Proxy) serveRateLimited(target string, w http.ResponseWriter, r *http.Request, rule *state.Rule) {
+	now := time.Now()
+	res := p.limiterFor(rule).ReserveN(now, 1)
+	wait := res.DelayFrom(now)
+	if res.OK() && wait == 0 {
+		p.serveReverseProxy(target, w, r)
+		return
+	}
+	res.CancelAt(now)
+
+	p.recordInjection(w, rule)
+	applyResponseHeaders(w, rule.Failure)
+	retryAfter := 1
+	if res.OK() {
+		retryAfter = max(int(math.Ceil(wait.Seconds())), 1)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeInjectedBody(w, r, http.StatusTooManyRequests, []byte("FaultLine: Rate limit exceeded"))
+}
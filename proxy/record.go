@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultRecordBodyLimit is how many bytes of each body a Recorder keeps
+// unless told otherwise.
+const DefaultRecordBodyLimit = 64 << 10
+
+// recordQueueSize is how many recordings may wait to be written before new
+// ones are dropped rather than slowing down the proxy.
+const recordQueueSize = 1024
+
+// recording is one proxied request and its upstream response, written as a
+// line of JSON. The top-level fields match what replay reads.
+type recording struct {
+	Time          time.Time         `json:"time"`
+	Method        string            `json:"method"`
+	URL           string            `json:"url"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Body          string            `json:"body,omitempty"`
+	BodyTruncated bool              `json:"bodyTruncated,omitempty"`
+	Response      recordedResponse  `json:"response"`
+	DurationMs    int64             `json:"durationMs"`
+}
+
+// recordedResponse is the upstream's answer to a recorded request.
+type recordedResponse struct {
+	Status       int               `json:"status"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Body         string            `json:"body,omitempty"`
+	BodyEncoding string            `json:"bodyEncoding,omitempty"` // "base64" for binary bodies
+	Truncated    bool              `json:"truncated,omitempty"`
+}
+
+// Recorder appends proxied requests and their responses to a JSONL file, for
+// replaying or mocking later. Writes happen in the background; when they
+// can't keep up, recordings are dropped instead of delaying traffic.
+type Recorder struct {
+	bodyLimit int
+	redact    []string
+	entries   chan recording
+	dropped   atomic.Int64
+	done      chan struct{}
+	mu        sync.RWMutex // guards closed against sends on a closed queue
+	closed    bool
+	err       error
+}
+
+// NewRecorder opens path for appending and starts writing recordings to it.
+// Bodies are cut to bodyLimit bytes (DefaultRecordBodyLimit when zero) and
+// the values of headers named in redact are masked.
+func NewRecorder(path string, bodyLimit int, redact []string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if bodyLimit <= 0 {
+		bodyLimit = DefaultRecordBodyLimit
+	}
+	rec := &Recorder{
+		bodyLimit: bodyLimit,
+		redact:    redact,
+		entries:   make(chan recording, recordQueueSize),
+		done:      make(chan struct{}),
+	}
+	go rec.write(f)
+	return rec, nil
+}
+
+// write encodes recordings until the queue is closed, then flushes.
+func (rec *Recorder) write(f *os.File) {
+	defer close(rec.done)
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	for e := range rec.entries {
+		if err := enc.Encode(e); err != nil && rec.err == nil {
+			rec.err = err
+		}
+		// Flush whenever the queue is drained so the file stays current.
+		if len(rec.entries) == 0 {
+			bw.Flush()
+		}
+	}
+	if err := bw.Flush(); err != nil && rec.err == nil {
+		rec.err = err
+	}
+	if err := f.Close(); err != nil && rec.err == nil {
+		rec.err = err
+	}
+}
+
+// Close stops recording and waits for queued recordings to be written.
+// Requests still in flight afterwards are not recorded.
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	if rec.closed {
+		rec.mu.Unlock()
+		<-rec.done
+		return rec.err
+	}
+	rec.closed = true
+	close(rec.entries)
+	rec.mu.Unlock()
+
+	<-rec.done
+	if n := rec.dropped.Load(); n > 0 {
+		log.Printf("[RECORD] %d request(s) were not recorded because writing fell behind", n)
+	}
+	return rec.err
+}
+
+// add queues a recording without blocking.
+func (rec *Recorder) add(e recording) {
+	rec.mu.RLock()
+	defer rec.mu.RUnlock()
+	if rec.closed {
+		return
+	}
+	select {
+	case rec.entries <- e:
+	default:
+		rec.dropped.Add(1)
+	}
+}
+
+// headers flattens h for a recording, masking redacted headers.
+func (rec *Recorder) headers(h http.Header) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(h))
+	for name, values := range h {
+		value := strings.Join(values, ", ")
+		for _, r := range rec.redact {
+			if strings.EqualFold(name, r) {
+				value = "[REDACTED]"
+				break
+			}
+		}
+		m[name] = value
+	}
+	return m
+}
+
+// serveRecorded forwards the request like serve and records it together with
+// the response.
+func (p *Proxy) serveRecorded(target string, w http.ResponseWriter, r *http.Request, serve func(http.ResponseWriter, *http.Request)) {
+	rec := p.opts.Recorder
+	e := recording{
+		Time:    time.Now(),
+		Method:  r.Method,
+		URL:     target,
+		Headers: rec.headers(r.Header),
+	}
+	reqBody := &capture{limit: rec.bodyLimit}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = tracedBody{io.TeeReader(r.Body, reqBody), r.Body}
+	}
+	rw := &traceWriter{ResponseWriter: w, body: &capture{limit: rec.bodyLimit}}
+
+	serve(rw, r)
+
+	e.DurationMs = time.Since(e.Time).Milliseconds()
+	e.Body = string(reqBody.buf)
+	e.BodyTruncated = reqBody.total > int64(len(reqBody.buf))
+	e.Response = recordedResponse{
+		Status:    rw.status,
+		Headers:   rec.headers(w.Header()),
+		Body:      string(rw.body.buf),
+		Truncated: rw.body.total > int64(len(rw.body.buf)),
+	}
+	if !utf8.Valid(rw.body.buf) {
+		e.Response.Body = base64.StdEncoding.EncodeToString(rw.body.buf)
+		e.Response.BodyEncoding = "base64"
+	}
+	rec.add(e)
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderWritesOneEntryPerRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	rec, err := NewRecorder(path, 16, []string{"Authorization"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, upstream := newTestProxy(t, Options{Recorder: rec})
+
+	req := httptest.NewRequest(http.MethodPost, "/items?page=2", strings.NewReader("hi"))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Trace", "abc")
+	do(p, req)
+	do(p, httptest.NewRequest(http.MethodPost, "/long", strings.NewReader(strings.Repeat("x", 40))))
+	do(p, httptest.NewRequest(http.MethodPost, "/binary", strings.NewReader("\xff\xfe")))
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []recording
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var e recording
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("line %q isn't a recording: %v", sc.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+
+	e := entries[0]
+	if e.Method != http.MethodPost || e.URL != upstream.URL+"/items?page=2" || e.Body != "hi" {
+		t.Errorf("request recorded as %s %s %q", e.Method, e.URL, e.Body)
+	}
+	if e.Headers["Authorization"] != "[REDACTED]" || e.Headers["X-Trace"] != "abc" {
+		t.Errorf("request headers %v, want Authorization redacted and X-Trace kept", e.Headers)
+	}
+	if e.Response.Status != http.StatusOK || e.Response.Body != "upstream:hi" || e.Response.Truncated {
+		t.Errorf("response recorded as %+v", e.Response)
+	}
+
+	e = entries[1]
+	if !e.BodyTruncated || len(e.Body) != 16 || !e.Response.Truncated || len(e.Response.Body) != 16 {
+		t.Errorf("40-byte bodies with a 16-byte limit: request %q (truncated %v), response %q (truncated %v)",
+			e.Body, e.BodyTruncated, e.Response.Body, e.Response.Truncated)
+	}
+
+	e = entries[2]
+	body, err := base64.StdEncoding.DecodeString(e.Response.Body)
+	if e.Response.BodyEncoding != "base64" || err != nil || string(body) != "upstream:\xff\xfe" {
+		t.Errorf("binary response recorded as %q (%s)", e.Response.Body, e.Response.BodyEncoding)
+	}
+}
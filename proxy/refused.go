@@ -0,0 +1,21 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+)
+
+// refuseConnection drops the client's connection without any response, as
+// the "refused" type does to model a backend that is down: TCP connections
+// are reset rather than closed cleanly. Connections that can't be hijacked
+// (HTTP/2) get their stream aborted instead.
+func refuseConnection(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	conn.Close()
+}
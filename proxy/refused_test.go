@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"errors"
+	"faultline/cli"
+	"faultline/state"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestRefusedDropsTheConnection(t *testing.T) {
+	var hits atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	t.Cleanup(upstream.Close)
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(rule("down", state.Failure{Type: "refused"}))
+	p := NewProxy(cli.NewRuleManager(rs), Options{DefaultUpstream: upstream.URL})
+	srv := httptest.NewServer(http.HandlerFunc(p.HandleRequest))
+	t.Cleanup(srv.Close)
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get(srv.URL + "/items")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("got a %d response, want a connection error", resp.StatusCode)
+	}
+	if !errors.Is(err, syscall.ECONNRESET) && !errors.Is(err, io.EOF) {
+		t.Errorf("error %v, want the connection reset or closed", err)
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("upstream contacted %d time(s), want none", n)
+	}
+	if lastFired(t, p, "down") == nil {
+		t.Error("refused rule didn't record firing")
+	}
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID that ties a proxied request to FaultLine's
+// logs and events. It is forwarded upstream and echoed on the response.
+const RequestIDHeader = "X-FaultLine-Request-ID"
+
+// ensureRequestID returns the request's correlation ID, reusing one sent by
+// the client in RequestIDHeader or X-Request-ID and generating one
+// otherwise. The ID is set on the request, so it reaches the upstream, and
+// on the response.
+func ensureRequestID(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		id = r.Header.Get("X-Request-ID")
+	}
+	if id == "" {
+		id = uuid.NewString()
+	}
+	r.Header.Set(RequestIDHeader, id)
+	w.Header().Set(RequestIDHeader, id)
+	return id
+}
+
+// requestID returns the correlation ID set by ensureRequestID.
+func requestID(r *http.Request) string {
+	return r.Header.Get(RequestIDHeader)
+}
+
+// dropEchoedRequestID removes a request ID the upstream echoed back, as the
+// response already carries it.
+func dropEchoedRequestID(resp *http.Response) error {
+	resp.Header.Del(RequestIDHeader)
+	return nil
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"faultline/cli"
+	"faultline/state"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRequestIDReachesUpstreamAndLogs(t *testing.T) {
+	var seen []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, r.Header.Get(RequestIDHeader)) // echoed back
+	}))
+	t.Cleanup(upstream.Close)
+	p := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, "")), Options{DefaultUpstream: upstream.URL})
+
+	for _, tc := range []struct{ header, value, want string }{
+		{RequestIDHeader, "fl-1", "fl-1"},
+		{"X-Request-ID", "client-2", "client-2"},
+		{"", "", ""}, // generated
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		rec := do(p, req)
+		got := rec.Header().Values(RequestIDHeader)
+		if len(got) != 1 || got[0] != seen[len(seen)-1] {
+			t.Errorf("%q: response IDs %q, upstream saw %q; want one matching ID", tc.value, got, seen[len(seen)-1])
+			continue
+		}
+		if tc.want == "" {
+			if _, err := uuid.Parse(got[0]); err != nil {
+				t.Errorf("generated ID %q isn't a UUID", got[0])
+			}
+		} else if got[0] != tc.want {
+			t.Errorf("%s %q: ID %q, want it reused", tc.header, tc.value, got[0])
+		}
+	}
+
+	// Upstream failures are logged with the ID.
+	logs := captureLog(t)
+	upstream.Close()
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("X-Request-ID", "req-down")
+	if rec := do(p, req); rec.Code != http.StatusBadGateway {
+		t.Fatalf("closed upstream: status %d, want 502", rec.Code)
+	}
+	if !strings.Contains(logs.String(), "(request req-down)") {
+		t.Errorf("log %q lacks the request ID", logs)
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"faultline/state"
+	"net"
+	"net/http"
+)
+
+// inRollout reports whether the rule's failure applies to the client
+// making r: always, unless the rule has a rollout leaving the client out.
+func inRollout(r *http.Request, rule *state.Rule) bool {
+	ro := rule.Failure.Rollout
+	if ro == nil {
+		return true
+	}
+	if ro.Header != "" {
+		return ro.Includes(r.Header.Get(ro.Header))
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return ro.Includes(ip)
+}
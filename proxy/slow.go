@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"context"
+	"faultline/metrics"
+	"log"
+	"net/http"
+	"time"
+)
+
+// injectedDelayKey is the request context key carrying the latency FaultLine
+// added before forwarding a request.
+type injectedDelayKey struct{}
+
+// withInjectedDelay records on the request that FaultLine delayed it by d.
+func withInjectedDelay(r *http.Request, d time.Duration) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), injectedDelayKey{}, d))
+}
+
+// observeUpstream records how long the upstream took to answer and warns
+// about slow requests, saying how much of the delay FaultLine added itself.
+func (p *Proxy) observeUpstream(target string, r *http.Request, upstream time.Duration) {
+	metrics.UpstreamLatency.Observe(upstream.Seconds())
+
+	if p.opts.SlowRequestThreshold <= 0 {
+		return
+	}
+	injected, _ := r.Context().Value(injectedDelayKey{}).(time.Duration)
+	total := injected + upstream
+	if total < p.opts.SlowRequestThreshold {
+		return
+	}
+	cause := "no latency injected by FaultLine"
+	if injected > 0 {
+		cause = "FaultLine injected " + injected.String()
+	}
+	log.Printf("[SLOW] %s %s took %s (upstream %s; %s; request %s)", r.Method, target,
+		total.Round(time.Millisecond), upstream.Round(time.Millisecond), cause, requestID(r))
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"faultline/cli"
+	"faultline/state"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowRequestsAreLogged(t *testing.T) {
+	opts := Options{SlowRequestThreshold: 30 * time.Millisecond}
+
+	t.Run("fast requests stay quiet", func(t *testing.T) {
+		logs := captureLog(t)
+		p, _ := newTestProxy(t, opts)
+		get(p, "/items")
+		if strings.Contains(logs.String(), "[SLOW]") {
+			t.Errorf("fast request logged as slow: %s", logs)
+		}
+	})
+
+	t.Run("injected latency is blamed on FaultLine", func(t *testing.T) {
+		logs := captureLog(t)
+		p, _ := newTestProxy(t, opts, rule("lat", state.Failure{Type: "latency", LatencyMs: 40}))
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.Header.Set("X-Request-ID", "req-slow")
+		do(p, req)
+		for _, want := range []string{"[SLOW] GET", "FaultLine injected 40ms", "request req-slow"} {
+			if !strings.Contains(logs.String(), want) {
+				t.Errorf("log %q lacks %q", logs, want)
+			}
+		}
+	})
+
+	t.Run("slow upstreams are not", func(t *testing.T) {
+		logs := captureLog(t)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(40 * time.Millisecond)
+		}))
+		t.Cleanup(upstream.Close)
+		o := opts
+		o.DefaultUpstream = upstream.URL
+		p := NewProxy(cli.NewRuleManager(state.NewRuleState(nil, "")), o)
+		get(p, "/items")
+		if !strings.Contains(logs.String(), "[SLOW]") || !strings.Contains(logs.String(), "no latency injected by FaultLine") {
+			t.Errorf("log %q doesn't report a slow upstream", logs)
+		}
+	})
+}
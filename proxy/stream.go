@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"faultline/logging"
+	"faultline/state"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes that carry (the start of) a message.
+const (
+	wsOpText   = 0x1
+	wsOpBinary = 0x2
+)
+
+// errStreamClosed is returned once a "stream" rule has closed the connection.
+var errStreamClosed = errors.New("connection closed by FaultLine")
+
+// serveStream forwards a WebSocket request, applying the rule's per-message
+// faults to the upgraded connection in both directions. Other requests are
+// proxied normally.
+func (p *Proxy) serveStream(target string, w http.ResponseWriter, r *http.Request, rule *state.Rule) {
+	if !isUpgrade(r) || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		p.serveReverseProxy(target, w, r)
+		return
+	}
+	p.recordInjection(w, rule)
+	p.serveReverseProxy(target, &streamWriter{ResponseWriter: w, p: p, ctx: r.Context(), rule: rule, target: target}, r)
+}
+
+// streamWriter hands the reverse proxy a faulty connection when it hijacks
+// the client connection for a protocol switch.
+type streamWriter struct {
+	http.ResponseWriter
+	p      *Proxy
+	ctx    context.Context // the upgrade request's
+	rule   *state.Rule
+	target string
+}
+
+func (s *streamWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(s.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	sc := &streamConn{Conn: conn, p: s.p, ctx: s.ctx, rule: s.rule, target: s.target}
+	sc.in.conn, sc.out.conn = sc, sc
+	return sc, brw, nil
+}
+
+func (s *streamWriter) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+// streamConn is the client side of a proxied WebSocket. Reads carry client
+// frames to the upstream and writes carry upstream frames to the client;
+// both pass through a frameFilter that applies the rule's faults.
+type streamConn struct {
+	net.Conn
+	p      *Proxy
+	ctx    context.Context
+	rule   *state.Rule
+	target string
+
+	in, out frameFilter
+
+	mu       sync.Mutex
+	messages int // data messages forwarded so far, in both directions
+	closed   bool
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	for {
+		if out := c.in.pending(b); out > 0 {
+			return out, nil
+		}
+		buf := make([]byte, len(b))
+		n, err := c.Conn.Read(buf)
+		if n > 0 {
+			c.in.feed(buf[:n])
+		}
+		if err != nil {
+			if out := c.in.pending(b); out > 0 {
+				return out, nil
+			}
+			return 0, err
+		}
+	}
+}
+
+func (c *streamConn) Write(b []byte) (int, error) {
+	c.out.feed(b)
+	for {
+		frame := c.out.next()
+		if frame == nil {
+			return len(b), nil
+		}
+		if _, err := c.Conn.Write(frame); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// message decides what happens to a data message: it may be delayed, dropped
+// or, once CloseAfterFrames messages went through, end the connection.
+func (c *streamConn) message() (drop bool, err error) {
+	f := c.rule.Failure
+	if f.LatencyMs > 0 && !c.p.waitInjected(c.ctx, time.Duration(f.LatencyMs)*time.Millisecond) {
+		return true, errStreamClosed
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return true, errStreamClosed
+	}
+	if f.DropProbability > 0 && rand.Float64() < f.DropProbability {
+		return true, nil
+	}
+	c.messages++
+	if f.CloseAfterFrames > 0 && c.messages > f.CloseAfterFrames {
+		c.closed = true
+		logging.Infof("[STREAM] Closing %s after %d message(s)", c.target, f.CloseAfterFrames)
+		c.Conn.Close()
+		return true, errStreamClosed
+	}
+	return false, nil
+}
+
+// frameFilter splits a WebSocket byte stream into frames and lets through
+// those that survive the connection's faults. Control frames (ping, pong,
+// close) always pass; a dropped message takes its continuation frames along.
+type frameFilter struct {
+	conn     *streamConn
+	buf      []byte // bytes not yet forming a complete frame
+	ready    []byte // filtered bytes waiting to be returned by Read
+	dropping bool   // the current fragmented message is being dropped
+}
+
+func (f *frameFilter) feed(b []byte) { f.buf = append(f.buf, b...) }
+
+// pending copies filtered bytes into b, processing buffered frames first.
+func (f *frameFilter) pending(b []byte) int {
+	for len(f.ready) == 0 {
+		frame := f.next()
+		if frame == nil {
+			break
+		}
+		f.ready = append(f.ready, frame...)
+	}
+	n := copy(b, f.ready)
+	f.ready = f.ready[n:]
+	return n
+}
+
+// next returns the next complete frame to forward, skipping dropped frames,
+// or nil when more bytes are needed.
+func (f *frameFilter) next() []byte {
+	for {
+		size, ok := wsFrameSize(f.buf)
+		if !ok {
+			return nil
+		}
+		frame := f.buf[:size:size]
+		f.buf = f.buf[size:]
+
+		fin, opcode := frame[0]&0x80 != 0, frame[0]&0x0f
+		switch {
+		case opcode >= 0x8: // control frame
+			return frame
+		case opcode == wsOpText || opcode == wsOpBinary:
+			drop, err := f.conn.message()
+			if err != nil {
+				f.buf = nil
+				return nil
+			}
+			f.dropping = drop && !fin
+			if !drop {
+				return frame
+			}
+		default: // continuation
+			dropping := f.dropping
+			if fin {
+				f.dropping = false
+			}
+			if !dropping {
+				return frame
+			}
+		}
+	}
+}
+
+// wsFrameSize returns the length of the WebSocket frame at the start of b,
+// and false if b doesn't hold a complete frame yet.
+func wsFrameSize(b []byte) (int, bool) {
+	if len(b) < 2 {
+		return 0, false
+	}
+	size := 2
+	length := uint64(b[1] & 0x7f)
+	switch length {
+	case 126:
+		if len(b) < 4 {
+			return 0, false
+		}
+		length = uint64(binary.BigEndian.Uint16(b[2:4]))
+		size += 2
+	case 127:
+		if len(b) < 10 {
+			return 0, false
+		}
+		length = binary.BigEndian.Uint64(b[2:10])
+		size += 8
+	}
+	if b[1]&0x80 != 0 { // masked
+		size += 4
+	}
+	total := uint64(size) + length
+	if uint64(len(b)) < total {
+		return 0, false
+	}
+	return int(total), true
+}
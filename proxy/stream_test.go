@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"faultline/state"
+	"testing"
+	"time"
+)
+
+func TestStreamLatencyDelaysEachMessage(t *testing.T) {
+	_, addr := wsProxy(t, rule("ws", state.Failure{Type: "stream", LatencyMs: 100}))
+	conn, br := wsDial(t, addr, "/ws")
+
+	start := time.Now()
+	if _, err := conn.Write(wsFrame("hello", true)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := wsRead(br); err != nil || got != "hello" {
+		t.Fatalf("echoed %q (%v), want hello", got, err)
+	}
+	// Delayed once on the way up and once on the way back.
+	if took := time.Since(start); took < 200*time.Millisecond {
+		t.Errorf("round trip took %s, want at least 200ms", took)
+	}
+}
+
+func TestSkipInjectedDelaysEndsStreamLatency(t *testing.T) {
+	p, addr := wsProxy(t, rule("ws", state.Failure{Type: "stream", LatencyMs: 5000}))
+	conn, br := wsDial(t, addr, "/ws")
+
+	start := time.Now()
+	if _, err := conn.Write(wsFrame("hello", true)); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(50*time.Millisecond, p.SkipInjectedDelays)
+	if got, err := wsRead(br); err != nil || got != "hello" {
+		t.Fatalf("echoed %q (%v), want hello", got, err)
+	}
+	if took := time.Since(start); took >= time.Second {
+		t.Errorf("message held %s after injected delays were skipped", took)
+	}
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultTraceBodyLimit is how many bytes of each body are logged when
+// tracing, unless Options.TraceBodyLimit says otherwise.
+const DefaultTraceBodyLimit = 1024
+
+// DefaultTraceRedact lists the headers masked in traces by default.
+var DefaultTraceRedact = []string{"Authorization"}
+
+// capture keeps the first limit bytes written to it and counts the rest.
+type capture struct {
+	limit int
+	buf   []byte
+	total int64
+}
+
+func (c *capture) Write(b []byte) (int, error) {
+	c.total += int64(len(b))
+	if room := c.limit - len(c.buf); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		c.buf = append(c.buf, b...)
+	}
+	return len(b), nil
+}
+
+func (c *capture) String() string {
+	if c.total == 0 {
+		return "(empty)"
+	}
+	if c.total > int64(len(c.buf)) {
+		return fmt.Sprintf("%q... (%d bytes, truncated)", c.buf, c.total)
+	}
+	return fmt.Sprintf("%q (%d bytes)", c.buf, c.total)
+}
+
+// tracedBody copies a request body into a capture as the upstream reads it.
+type tracedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// traceWriter records the status and body of a proxied response.
+type traceWriter struct {
+	http.ResponseWriter
+	status int
+	body   *capture
+}
+
+func (t *traceWriter) WriteHeader(code int) {
+	if t.status == 0 {
+		t.status = code
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *traceWriter) Write(b []byte) (int, error) {
+	if t.status == 0 {
+		t.status = http.StatusOK
+	}
+	t.body.Write(b)
+	return t.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streaming responses are still flushed.
+func (t *traceWriter) Unwrap() http.ResponseWriter { return t.ResponseWriter }
+
+// serveTraced forwards the request like serve, logging both bodies
+// (truncated to the trace limit) and the request headers once it completes.
+func (p *Proxy) serveTraced(target string, w http.ResponseWriter, r *http.Request, serve func(http.ResponseWriter, *http.Request)) {
+	limit := p.opts.TraceBodyLimit
+	if limit <= 0 {
+		limit = DefaultTraceBodyLimit
+	}
+	reqBody := &capture{limit: limit}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = tracedBody{io.TeeReader(r.Body, reqBody), r.Body}
+	}
+	headers := p.traceHeaders(r.Header)
+	tw := &traceWriter{ResponseWriter: w, body: &capture{limit: limit}}
+
+	serve(tw, r)
+
+	log.Printf("[TRACE] %s %s headers: %s | request body: %s | response %d body: %s",
+		r.Method, target, headers, reqBody, tw.status, tw.body)
+}
+
+// traceHeaders formats headers for a trace, masking the redacted ones.
+func (p *Proxy) traceHeaders(h http.Header) string {
+	redact := p.opts.TraceRedact
+	if redact == nil {
+		redact = DefaultTraceRedact
+	}
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(h[name], ", ")
+		for _, r := range redact {
+			if strings.EqualFold(name, r) {
+				value = "[REDACTED]"
+				break
+			}
+		}
+		parts = append(parts, name+"="+value)
+	}
+	if len(parts) == 0 {
+		return "(none)"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceBodiesLogsTruncatedBodies(t *testing.T) {
+	logs := captureLog(t)
+	p, _ := newTestProxy(t, Options{TraceBodies: true, TraceBodyLimit: 8})
+
+	req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("0123456789abcdef"))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Tenant", "beta")
+	if rec := do(p, req); rec.Body.String() != "upstream:0123456789abcdef" {
+		t.Fatalf("traced request got %q, want the whole body forwarded", rec.Body.String())
+	}
+
+	out := logs.String()
+	for _, want := range []string{
+		`request body: "01234567"... (16 bytes, truncated)`,
+		`response 200 body: "upstream"... (25 bytes, truncated)`,
+		"Authorization=[REDACTED]",
+		"X-Tenant=beta",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("trace doesn't contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret") {
+		t.Errorf("trace leaks the Authorization header:\n%s", out)
+	}
+
+	logs.Reset()
+	do(p, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("ab")))
+	if out := logs.String(); !strings.Contains(out, `request body: "ab" (2 bytes) |`) {
+		t.Errorf("a body within the limit isn't logged whole:\n%s", out)
+	}
+	logs.Reset()
+	do(p, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if out := logs.String(); !strings.Contains(out, "request body: (empty)") {
+		t.Errorf("an empty body isn't logged as such:\n%s", out)
+	}
+}
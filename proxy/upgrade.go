@@ -0,0 +1,23 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isUpgrade reports whether r asks to switch protocols (e.g. to WebSocket).
+// httputil.ReverseProxy relays such requests and, once the upstream answers
+// 101 Switching Protocols, copies bytes both ways on the hijacked connection.
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
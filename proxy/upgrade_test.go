@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"faultline/cli"
+	"faultline/state"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wsEchoUpstream is a WebSocket server sending every text message back.
+func wsEchoUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUpgrade(r) {
+			http.Error(w, "websocket only", http.StatusBadRequest)
+			return
+		}
+		sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			base64.StdEncoding.EncodeToString(sum[:]))
+		for {
+			msg, err := wsRead(brw.Reader)
+			if err != nil {
+				return
+			}
+			if _, err := conn.Write(wsFrame(msg, false)); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// wsDial opens a WebSocket to path on the server at addr.
+func wsDial(t *testing.T, addr, path string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", path, addr)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status %d, want 101", resp.StatusCode)
+	}
+	return conn, br
+}
+
+// wsFrame encodes msg as a single text frame, masked as clients must.
+func wsFrame(msg string, masked bool) []byte {
+	frame := []byte{0x80 | wsOpText}
+	switch n := len(msg); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	default:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	}
+	if !masked {
+		return append(frame, msg...)
+	}
+	frame[1] |= 0x80
+	var key [4]byte
+	rand.Read(key[:])
+	frame = append(frame, key[:]...)
+	for i := range len(msg) {
+		frame = append(frame, msg[i]^key[i%4])
+	}
+	return frame
+}
+
+// wsRead reads a single frame and returns its unmasked payload.
+func wsRead(r *bufio.Reader) (string, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return "", err
+	}
+	n := int(head[1] & 0x7f)
+	if n == 126 {
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	var key [4]byte
+	masked := head[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return "", err
+		}
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return string(payload), nil
+}
+
+// wsProxy serves a proxy holding rules in front of a WebSocket echo upstream
+// and returns its address.
+func wsProxy(t *testing.T, rules ...state.Rule) (*Proxy, string) {
+	t.Helper()
+	upstream := wsEchoUpstream(t)
+	rs := state.NewRuleState(nil, "")
+	for _, rule := range rules {
+		rs.AddRule(rule)
+	}
+	p := NewProxy(cli.NewRuleManager(rs), Options{DefaultUpstream: upstream.URL})
+	front := httptest.NewServer(http.HandlerFunc(p.HandleRequest))
+	t.Cleanup(front.Close)
+	return p, front.Listener.Addr().String()
+}
+
+func TestWebSocketEchoThroughTheProxy(t *testing.T) {
+	_, addr := wsProxy(t)
+	conn, br := wsDial(t, addr, "/ws")
+	for _, msg := range []string{"hello", strings.Repeat("x", 300)} {
+		if _, err := conn.Write(wsFrame(msg, true)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := wsRead(br)
+		if err != nil || got != msg {
+			t.Errorf("echoed %d bytes (%v), want the %d sent", len(got), err, len(msg))
+		}
+	}
+}
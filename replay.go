@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"faultline/proxy"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// replayRequest is one recorded request to send through the proxy.
+type replayRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// replayResult is the outcome of replaying one request.
+type replayResult struct {
+	req     replayRequest
+	status  int
+	latency time.Duration
+	fault   string // injected failure type, empty if none
+	err     error
+}
+
+// harFile is the subset of the HAR format replay understands.
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// loadReplayFile reads requests from a JSON list, a JSONL file with one
+// request per line (as written by start --record) or a HAR file.
+func loadReplayFile(path string) ([]replayRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var reqs []replayRequest
+		if err := json.Unmarshal(data, &reqs); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		return reqs, nil
+	}
+	if first, _, _ := bytes.Cut(trimmed, []byte("\n")); isJSONLRequest(first) {
+		var reqs []replayRequest
+		for i, line := range bytes.Split(trimmed, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var r replayRequest
+			if err := json.Unmarshal(line, &r); err != nil {
+				return nil, fmt.Errorf("parse %s line %d: %w", path, i+1, err)
+			}
+			reqs = append(reqs, r)
+		}
+		return reqs, nil
+	}
+
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("parse %s as HAR: %w", path, err)
+	}
+	reqs := make([]replayRequest, 0, len(har.Log.Entries))
+	for _, e := range har.Log.Entries {
+		r := replayRequest{Method: e.Request.Method, URL: e.Request.URL, Body: e.Request.PostData.Text}
+		for _, h := range e.Request.Headers {
+			// Pseudo-headers (HTTP/2) and hop-specific headers don't replay.
+			if strings.HasPrefix(h.Name, ":") || strings.EqualFold(h.Name, "Host") || strings.EqualFold(h.Name, "Content-Length") {
+				continue
+			}
+			if r.Headers == nil {
+				r.Headers = make(map[string]string)
+			}
+			r.Headers[h.Name] = h.Value
+		}
+		reqs = append(reqs, r)
+	}
+	return reqs, nil
+}
+
+// isJSONLRequest reports whether line is a complete JSON request on its own,
+// as opposed to the start of a multi-line document such as a HAR file.
+func isJSONLRequest(line []byte) bool {
+	var r replayRequest
+	return json.Unmarshal(line, &r) == nil && r.URL != ""
+}
+
+// replay sends each request through the proxy at proxyURL with up to
+// concurrency requests in flight, returning results in input order.
+func replay(reqs []replayRequest, proxyURL string, concurrency int, timeout time.Duration) []replayResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	client := &http.Client{Timeout: timeout}
+	results := make([]replayResult, len(reqs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, req := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req replayRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = replayOne(client, proxyURL, req)
+		}(i, req)
+	}
+	wg.Wait()
+	return results
+}
+
+func replayOne(client *http.Client, proxyURL string, req replayRequest) replayResult {
+	res := replayResult{req: req}
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	// The proxy reads the target from the path: <proxy>/<target URL>
+	httpReq, err := http.NewRequest(method, strings.TrimSuffix(proxyURL, "/")+"/"+req.URL, strings.NewReader(req.Body))
+	if err != nil {
+		res.err = err
+		return res
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		res.latency = time.Since(start)
+		res.err = err
+		return res
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	res.latency = time.Since(start)
+	res.status = resp.StatusCode
+	res.fault = resp.Header.Get(proxy.FaultHeader)
+	return res
+}
+
+// printReplayReport prints a row per request followed by a summary.
+func printReplayReport(results []replayResult) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header("#", "Method", "URL", "Status", "Latency", "Fault")
+
+	statuses := make(map[int]int)
+	faults := make(map[string]int)
+	failed := 0
+	var total time.Duration
+	for i, r := range results {
+		status := fmt.Sprintf("%d", r.status)
+		if r.err != nil {
+			status = "ERR"
+			failed++
+		} else {
+			statuses[r.status]++
+		}
+		if r.fault != "" {
+			faults[r.fault]++
+		}
+		total += r.latency
+
+		method := r.req.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		url := r.req.URL
+		if len(url) > 60 {
+			url = url[:57] + "..."
+		}
+		fault := r.fault
+		if fault == "" {
+			fault = "-"
+		}
+		table.Append([]string{fmt.Sprintf("%d", i+1), method, url, status, r.latency.Round(time.Millisecond).String(), fault})
+	}
+	table.Render()
+
+	header := color.New(color.FgMagenta, color.Bold)
+	fmt.Println()
+	header.Println("📊 Replay summary")
+	fmt.Printf("  Requests: %d (%d failed to complete)\n", len(results), failed)
+	if len(results) > 0 {
+		fmt.Printf("  Average latency: %s\n", (total / time.Duration(len(results))).Round(time.Millisecond))
+	}
+
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Printf("  HTTP %d: %d\n", code, statuses[code])
+	}
+
+	for _, r := range results {
+		if r.err != nil {
+			color.New(color.FgRed).Printf("  ❌ %s %s: %v\n", r.req.Method, r.req.URL, r.err)
+		}
+	}
+
+	if len(faults) == 0 {
+		fmt.Println("  Injected faults: none")
+		return
+	}
+	types := make([]string, 0, len(faults))
+	for t := range faults {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	fmt.Println("  Injected faults:")
+	for _, t := range types {
+		fmt.Printf("    %s: %d\n", t, faults[t])
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"faultline/cli"
+	"faultline/proxy"
+	"faultline/state"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// captureStdout returns what f prints to standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, colorOutput := os.Stdout, color.Output
+	os.Stdout, color.Output = w, w
+	defer func() { os.Stdout, color.Output = stdout, colorOutput }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestLoadReplayFile(t *testing.T) {
+	want := []replayRequest{
+		{Method: "GET", URL: "http://api.local/users"},
+		{Method: "POST", URL: "http://api.local/orders", Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"qty":1}`},
+	}
+	files := map[string]string{
+		"list.json": `[{"method": "GET", "url": "http://api.local/users"},
+ {"method": "POST", "url": "http://api.local/orders", "headers": {"Content-Type": "application/json"}, "body": "{\"qty\":1}"}]`,
+		// As written by start --record; the response is ignored.
+		"record.jsonl": `{"method": "GET", "url": "http://api.local/users", "response": {"status": 200}}
+
+{"method": "POST", "url": "http://api.local/orders", "headers": {"Content-Type": "application/json"}, "body": "{\"qty\":1}", "response": {"status": 201}}
+`,
+		"session.har": `{"log": {"entries": [
+ {"request": {"method": "GET", "url": "http://api.local/users", "headers": [{"name": ":authority", "value": "api.local"}, {"name": "Host", "value": "api.local"}]}},
+ {"request": {"method": "POST", "url": "http://api.local/orders",
+  "headers": [{"name": "Content-Type", "value": "application/json"}, {"name": "Content-Length", "value": "9"}],
+  "postData": {"text": "{\"qty\":1}"}}}]}}`,
+	}
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadReplayFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", name, got, want)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.jsonl")
+	os.WriteFile(bad, []byte("{\"url\": \"http://api.local/a\"}\n{oops\n"), 0644)
+	if _, err := loadReplayFile(bad); err == nil {
+		t.Error("malformed JSONL line: got no error")
+	}
+}
+
+func TestReplayThroughTheProxy(t *testing.T) {
+	var bodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.Method+" "+r.URL.Path+" "+r.Header.Get("X-Test")+" "+string(b))
+	}))
+	t.Cleanup(upstream.Close)
+
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(state.Rule{ID: "down", Target: upstream.URL + "/orders", Enabled: true, Failure: state.Failure{Type: "error", ErrorCode: 503}})
+	p := httptest.NewServer(http.HandlerFunc(proxy.NewProxy(cli.NewRuleManager(rs), proxy.Options{}).HandleRequest))
+	t.Cleanup(p.Close)
+
+	results := replay([]replayRequest{
+		{URL: upstream.URL + "/users", Headers: map[string]string{"X-Test": "yes"}},
+		{Method: "POST", URL: upstream.URL + "/orders", Body: "qty=1"},
+		{Method: "PUT", URL: upstream.URL + "/users/1", Body: "name=ada"},
+	}, p.URL+"/", 1, 5*time.Second)
+
+	want := []struct {
+		status int
+		fault  string
+	}{{200, ""}, {503, "error"}, {200, ""}}
+	for i, r := range results {
+		if r.err != nil || r.status != want[i].status || r.fault != want[i].fault {
+			t.Errorf("result %d: %d fault %q err %v, want %d fault %q", i, r.status, r.fault, r.err, want[i].status, want[i].fault)
+		}
+	}
+	wantBodies := []string{"GET /users yes ", "PUT /users/1  name=ada"}
+	if !reflect.DeepEqual(bodies, wantBodies) {
+		t.Errorf("upstream got %q, want %q", bodies, wantBodies)
+	}
+
+	results = replay([]replayRequest{{URL: upstream.URL}}, "http://127.0.0.1:1", 1, time.Second)
+	if results[0].err == nil {
+		t.Error("replay to a closed port: got no error")
+	}
+	out := captureStdout(t, func() { printReplayReport(results) })
+	if !strings.Contains(out, "1 failed to complete") {
+		t.Errorf("report doesn't count the failure:\n%s", out)
+	}
+}
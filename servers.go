@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"faultline/api"
+	"faultline/cli"
+	"faultline/config"
+	"faultline/proxy"
+	"faultline/state"
+	"faultline/tcp"
+	"faultline/ui"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+)
+
+// defaultCORSOrigins are the control panel dev servers allowed to call the API
+// when the config doesn't list any.
+var defaultCORSOrigins = []string{"http://localhost:5173", "http://localhost:5174"}
+
+// runServers sets up and starts the API and proxy servers, blocking until a
+// shutdown signal is received. In smoke mode it instead returns once both
+// servers are listening, or exits non-zero if they can't be started.
+func runServers(apiPort, proxyPort int, corsOrigins []string, rm *cli.RuleManager, proxyOpts proxy.Options, shutdownTimeout time.Duration, serveUI, smoke bool) {
+	servers, err := startHTTPServers(apiPort, proxyPort, corsOrigins, rm, proxyOpts, shutdownTimeout, serveUI)
+	if err != nil {
+		if smoke {
+			log.Fatalf("❌ Smoke check failed: %v", err)
+		}
+		log.Fatalf("❌ %v", err)
+	}
+
+	if smoke {
+		servers.shutdown()
+		log.Println("✅ Smoke check passed: control API and proxy are listening")
+		return
+	}
+
+	// Block until a signal is received
+	waitForSignal()
+	log.Println("Shutting down servers...")
+	servers.shutdown()
+}
+
+// defaultShutdownTimeout is how long a graceful shutdown waits for in-flight
+// requests unless --shutdown-timeout or the config says otherwise.
+const defaultShutdownTimeout = 5 * time.Second
+
+// httpServers holds the running control API and proxy servers.
+type httpServers struct {
+	api             *http.Server
+	proxy           *http.Server
+	handler         *proxy.Proxy
+	recorder        *proxy.Recorder
+	hangup          chan os.Signal
+	shutdownTimeout time.Duration
+}
+
+// startHTTPServers binds the control API and proxy ports and serves them in
+// the background, so a port already in use is reported before either server
+// is considered running. With serveUI the embedded control panel is mounted
+// at / on the API server.
+func startHTTPServers(apiPort, proxyPort int, corsOrigins []string, rm *cli.RuleManager, proxyOpts proxy.Options, shutdownTimeout time.Duration, serveUI bool) (*httpServers, error) {
+
+	// --- Setup Control API Server ---
+	apiRouter := mux.NewRouter()
+	api.RegisterHandlers(apiRouter, rm)
+	if serveUI {
+		if h, ok := ui.Handler(); ok {
+			apiRouter.PathPrefix("/").Handler(h).Methods("GET", "HEAD")
+			log.Printf("🖥️  Control panel served at http://localhost:%d/", apiPort)
+		} else {
+			log.Println("[WARNING] --ui: this binary was built without control panel assets; run the control panel with 'npm run dev' or rebuild after building it into ui/dist")
+		}
+	}
+
+	c := cors.New(cors.Options{
+		AllowedOrigins:   corsOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type"},
+		AllowCredentials: true,
+	})
+	apiHandler := c.Handler(apiRouter)
+
+	apiServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", apiPort),
+		Handler: apiHandler,
+	}
+
+	// --- Setup Proxy Server ---
+	p := proxy.NewProxy(rm, proxyOpts)
+	proxyServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", proxyPort),
+		Handler: http.HandlerFunc(p.HandleRequest),
+	}
+
+	// --- Start Servers ---
+	apiLn, err := net.Listen("tcp", apiServer.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("control API: %w", err)
+	}
+	proxyLn, err := net.Listen("tcp", proxyServer.Addr)
+	if err != nil {
+		apiLn.Close()
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+
+	log.Printf("✅ Control API listening on http://localhost:%d", apiPort)
+	go func() {
+		if err := apiServer.Serve(apiLn); err != nil && err != http.ErrServerClosed {
+			log.Printf("API server failed: %v", err)
+		}
+	}()
+
+	log.Printf("✅ FaultLine Proxy listening on http://localhost:%d", proxyPort)
+	go func() {
+		if err := proxyServer.Serve(proxyLn); err != nil && err != http.ErrServerClosed {
+			log.Printf("Proxy server failed: %v", err)
+		}
+	}()
+
+	s := &httpServers{
+		api:             apiServer,
+		proxy:           proxyServer,
+		handler:         p,
+		recorder:        proxyOpts.Recorder,
+		hangup:          make(chan os.Signal, 1),
+		shutdownTimeout: shutdownTimeout,
+	}
+	signal.Notify(s.hangup, syscall.SIGHUP)
+	go reloadOnHangup(s.hangup, rm.GetRuleState())
+	return s, nil
+}
+
+// reloadOnHangup re-reads the rules file each time SIGHUP arrives on hangup,
+// so edited rules apply without a restart. It returns once hangup is closed.
+func reloadOnHangup(hangup <-chan os.Signal, rs *state.RuleState) {
+	for range hangup {
+		n, err := rs.Reload()
+		if err != nil {
+			log.Printf("[WARNING] SIGHUP: failed to reload rules: %v", err)
+			continue
+		}
+		log.Printf("🔄 SIGHUP: reloaded %d rule(s)", n)
+	}
+}
+
+// shutdown gracefully stops both servers, giving in-flight requests up to
+// the shutdown timeout to finish.
+func (s *httpServers) shutdown() {
+	signal.Stop(s.hangup)
+	close(s.hangup)
+
+	if n := s.handler.InFlight(); n > 0 {
+		log.Printf("Waiting up to %s for %d in-flight request(s)...", s.shutdownTimeout, n)
+		if d := s.handler.InjectedDelayRemaining(); d > s.shutdownTimeout {
+			// Waiting out the delay would run past the deadline and cut
+			// the requests off; skip it so they are forwarded in time.
+			log.Printf("[WARNING] Injected latency still has %s to run; skipping it so in-flight requests finish (raise --shutdown-timeout to let it run)", d.Round(time.Millisecond))
+			s.handler.SkipInjectedDelays()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	if err := s.api.Shutdown(ctx); err != nil {
+		log.Printf("API server shutdown error: %v", err)
+	}
+	if err := s.proxy.Shutdown(ctx); err != nil {
+		log.Printf("Proxy server shutdown error: %v (%d request(s) still in flight)", err, s.handler.InFlight())
+		s.proxy.Close()
+	}
+	if s.recorder != nil {
+		if err := s.recorder.Close(); err != nil {
+			log.Printf("Failed to write recording: %v", err)
+		}
+	}
+
+	log.Println("Servers gracefully stopped.")
+}
+
+// tcpProxies runs the DB (TCP) proxies for the enabled TCP rules and keeps
+// them in sync as rules are added, changed or disabled at runtime.
+type tcpProxies struct {
+	manager *tcp.Manager
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+// tcpReloadInterval is how often TCP rule changes are picked up.
+const tcpReloadInterval = time.Second
+
+// startTCPProxies starts a TCP fault-injection proxy for each enabled TCP rule
+// and watches the rule state for changes in the background. If any of their
+// addresses can't be bound, none are left running and the bind errors are
+// returned.
+func startTCPProxies(rs *state.RuleState, drainTimeout time.Duration) (*tcpProxies, error) {
+	tp := &tcpProxies{
+		manager: tcp.NewManager(drainTimeout),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if _, _, _, err := tp.manager.Apply(enabledTCPRules(rs)); err != nil {
+		tp.manager.StopAll()
+		return nil, err
+	}
+
+	go func() {
+		defer close(tp.done)
+		ticker := time.NewTicker(tcpReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-tp.stopCh:
+				return
+			case <-ticker.C:
+				if err := rs.CheckAndReloadTCPIfModified(); err != nil {
+					log.Printf("[WARNING] Failed to reload TCP rules: %v", err)
+				}
+				started, stopped, _, err := tp.manager.Apply(enabledTCPRules(rs))
+				if started+stopped > 0 {
+					log.Printf("[DB] TCP rules changed: %d proxy(ies) started, %d stopped", started, stopped)
+				}
+				if err != nil {
+					log.Printf("[WARNING] Failed to start DB proxy: %v", err)
+				}
+			}
+		}
+	}()
+	return tp, nil
+}
+
+// enabledTCPRules returns the enabled TCP rules in the form the tcp package runs.
+func enabledTCPRules(rs *state.RuleState) []config.TCPRule {
+	var rules []config.TCPRule
+	for _, r := range rs.GetTCPRules() {
+		if r.Enabled {
+			rules = append(rules, r.Config())
+		}
+	}
+	return rules
+}
+
+// stop closes all listeners and waits for connections to drain.
+func (tp *tcpProxies) stop() {
+	close(tp.stopCh)
+	<-tp.done
+	log.Printf("[DB] Stopping proxies (drain timeout %s)...", tp.manager.DrainTimeout)
+	tp.manager.StopAll()
+	log.Println("[DB] All proxies stopped.")
+}
+
+// waitForSignal blocks until SIGINT or SIGTERM is received.
+func waitForSignal() {
+	stopChan := make(chan os.Signal, 1)
+	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
+	<-stopChan
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"faultline/cli"
+	"faultline/proxy"
+	"faultline/state"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// slowRequest starts servers delaying every request by latency, sends one
+// request through the proxy and returns once it is held in the delay. The
+// request's status and body arrive on the returned channel.
+func slowRequest(t *testing.T, latency, shutdownTimeout time.Duration) (*httpServers, <-chan string) {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "upstream")
+	}))
+	t.Cleanup(upstream.Close)
+
+	rs := state.NewRuleState(nil, "")
+	rs.AddRule(state.Rule{ID: "slow", Target: upstream.URL, Enabled: true, Failure: state.Failure{Type: "latency", LatencyMs: int(latency / time.Millisecond)}})
+	proxyPort := freePort(t)
+	servers, err := startHTTPServers(freePort(t), proxyPort, nil, cli.NewRuleManager(rs), proxy.Options{DefaultUpstream: upstream.URL}, shutdownTimeout, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%d/items", proxyPort))
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		result <- fmt.Sprintf("%d %s", resp.StatusCode, body)
+	}()
+
+	for deadline := time.Now().Add(2 * time.Second); servers.handler.InjectedDelayRemaining() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the request never reached the injected delay")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return servers, result
+}
+
+func TestShutdownSkipsLatencyBeyondTheTimeout(t *testing.T) {
+	timeout := 500 * time.Millisecond
+	servers, result := slowRequest(t, 10*time.Second, timeout)
+
+	start := time.Now()
+	servers.shutdown()
+	if took := time.Since(start); took > timeout {
+		t.Errorf("shutdown took %s, want at most the %s timeout", took, timeout)
+	}
+	select {
+	case got := <-result:
+		if got != "200 upstream" {
+			t.Errorf("in-flight request got %q, want it forwarded", got)
+		}
+	case <-time.After(time.Second):
+		t.Error("in-flight request was not answered")
+	}
+}
+
+func TestShutdownWaitsOutLatencyWithinTheTimeout(t *testing.T) {
+	latency := 300 * time.Millisecond
+	servers, result := slowRequest(t, latency, 5*time.Second)
+
+	start := time.Now()
+	servers.shutdown()
+	if took := time.Since(start); took < latency/2 {
+		t.Errorf("shutdown took %s, want it to wait for the %s delay", took, latency)
+	}
+	if got := <-result; got != "200 upstream" {
+		t.Errorf("in-flight request got %q, want it forwarded", got)
+	}
+}
+
+func TestSIGHUPReloadsRules(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "rules.json")
+	rs := state.NewRuleState(nil, dataFile)
+	rs.AddRule(state.Rule{ID: "old", Target: "http://api.local/old", Enabled: true, Failure: state.Failure{Type: "error", ErrorCode: 500}})
+	servers, err := startHTTPServers(freePort(t), freePort(t), nil, cli.NewRuleManager(rs), proxy.Options{}, time.Second, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer servers.shutdown()
+
+	edited := `[{"id": "new", "target": "http://api.local/new", "enabled": true, "failure": {"type": "error", "errorCode": 503}}]`
+	if err := os.WriteFile(dataFile, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		rules := rs.GetRules()
+		if len(rules) == 1 && rules[0].ID == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rules after SIGHUP: %+v, want the edited file's", rules)
+		}
+	}
+	if rule, ok := rs.FindRuleForRequest(state.Request{Target: "http://api.local/new", Method: http.MethodGet}); !ok || rule.ID != "new" {
+		t.Errorf("the reloaded rule doesn't match requests")
+	}
+}
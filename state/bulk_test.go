@@ -0,0 +1,85 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// countWrites counts writes of the rules file until the test ends.
+func countWrites(t *testing.T) *int {
+	t.Helper()
+	n := new(int)
+	orig := writeFile
+	writeFile = func(name string, data []byte, perm os.FileMode) error {
+		*n++
+		return orig(name, data, perm)
+	}
+	t.Cleanup(func() { writeFile = orig })
+	return n
+}
+
+func TestSetEnabledBulkWritesOnce(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "rules.json")
+	rs := NewRuleState(nil, dataFile)
+	for _, id := range []string{"a", "b", "c"} {
+		rs.AddRule(errorRule(id, "http://api.local/"+id, 0))
+	}
+	writes := countWrites(t)
+
+	if err := rs.SetEnabledBulk([]string{"a", "c"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if *writes != 1 {
+		t.Errorf("disabling two rules wrote the file %d times, want once", *writes)
+	}
+	// An unknown ID fails the whole batch, changing and writing nothing.
+	if err := rs.SetEnabledBulk([]string{"b", "missing"}, false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown ID: error %v, want ErrNotFound", err)
+	}
+	if *writes != 1 {
+		t.Errorf("a failed batch wrote the file")
+	}
+
+	want := map[string]bool{"a": false, "b": true, "c": false}
+	// Both in memory and as saved.
+	for _, s := range []*RuleState{rs, NewRuleState(nil, dataFile)} {
+		for _, rule := range s.GetRules() {
+			if rule.Enabled != want[rule.ID] {
+				t.Errorf("rule %s enabled=%v, want %v", rule.ID, rule.Enabled, want[rule.ID])
+			}
+		}
+	}
+}
+
+func TestSetEnabledByTarget(t *testing.T) {
+	rs := newTestState(t,
+		errorRule("pay", "https://api.example.com/payments", 0),
+		errorRule("refund", "https://api.example.com/payments/refunds", 0),
+		errorRule("users", "https://api.example.com/users", 0),
+		errorRule("other", "https://other.example.com/payments", 0),
+	)
+	cases := []struct {
+		pattern string
+		want    []string // the rules disabled
+	}{
+		{"payments", []string{"pay", "refund", "other"}},
+		{"https://api.example.com/*", []string{"pay", "refund", "users"}},
+		{"*/payments", []string{"pay", "other"}},
+		{"https://api.example.com/user?", []string{"users"}},
+		{"nothing", nil},
+	}
+	for _, c := range cases {
+		rs.SetEnabledBulk([]string{"pay", "refund", "users", "other"}, true)
+		if n := rs.SetEnabledByTarget(c.pattern, false); n != len(c.want) {
+			t.Errorf("%q: matched %d rules, want %d", c.pattern, n, len(c.want))
+		}
+		for _, rule := range rs.GetRules() {
+			if disabled := !rule.Enabled; disabled != slices.Contains(c.want, rule.ID) {
+				t.Errorf("%q: rule %s enabled=%v", c.pattern, rule.ID, rule.Enabled)
+			}
+		}
+	}
+}
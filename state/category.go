@@ -0,0 +1,33 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultCategory is assumed for rules created without a category.
+const DefaultCategory = "api"
+
+// Categories lists the rule categories the UI groups rules by.
+var Categories = []string{"api", "database", "cache", "queue", "external"}
+
+// ValidateCategory returns an error unless c is empty or a known category.
+func ValidateCategory(c string) error {
+	if c == "" {
+		return nil
+	}
+	for _, known := range Categories {
+		if c == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown category %q (expected one of: %s)", c, strings.Join(Categories, ", "))
+}
+
+// EffectiveCategory returns the rule's category, or DefaultCategory when unset.
+func (rule Rule) EffectiveCategory() string {
+	if rule.Category == "" {
+		return DefaultCategory
+	}
+	return rule.Category
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"sync"
+	"time"
+)
+
+// Event records something notable the proxy did with a request, such as a
+// would-be injection in dry-run mode. Events are kept in memory only.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // e.g., "dry-run", "upstream-error"
+	RuleID  string    `json:"ruleId,omitempty"`
+	Target  string    `json:"target"`
+	Method  string    `json:"method,omitempty"`
+	Failure string    `json:"failure,omitempty"`
+	Message string    `json:"message,omitempty"`
+	// Status is the response status of an upstream error: the upstream's
+	// own, or the 502/504 the proxy answered a failed request with.
+	Status int `json:"status,omitempty"`
+	// RequestID is the proxied request's X-FaultLine-Request-ID.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// ContractViolationEvent is the event type recorded for upstream responses
+// that don't match the OpenAPI spec the proxy checks them against.
+const ContractViolationEvent = "contract-violation"
+
+// EventLog is a bounded, thread-safe log of recent events.
+type EventLog struct {
+	mu     sync.RWMutex
+	events []Event
+	max    int
+}
+
+// NewEventLog creates an event log that keeps at most max events.
+func NewEventLog(max int) *EventLog {
+	return &EventLog{max: max}
+}
+
+// Record appends an event, dropping the oldest one when the log is full.
+func (l *EventLog) Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+	if l.max > 0 && len(l.events) > l.max {
+		l.events = l.events[len(l.events)-l.max:]
+	}
+}
+
+// Recent returns up to n of the most recent events, oldest first. n <= 0 returns all.
+func (l *EventLog) Recent(n int) []Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	start := 0
+	if n > 0 && len(l.events) > n {
+		start = len(l.events) - n
+	}
+	out := make([]Event, len(l.events)-start)
+	copy(out, l.events[start:])
+	return out
+}
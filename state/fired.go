@@ -0,0 +1,34 @@
+package state
+
+import "time"
+
+// firedSaveDelay batches the rules file writes caused by rules firing, so a
+// busy proxy doesn't rewrite the file on every request.
+const firedSaveDelay = 2 * time.Second
+
+// MarkFired records that the rule with the given ID injected its failure at
+// the given time. The timestamp is kept in memory right away and written to
+// the rules file within firedSaveDelay. Unknown IDs, such as fired one-shot
+// rules, are ignored.
+func (rs *RuleState) MarkFired(id string, at time.Time) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rule, ok := rs.rules[id]
+	if !ok {
+		return
+	}
+	rule.LastFired = &at
+	rs.rules[id] = rule
+	if !rs.firedSavePending {
+		rs.firedSavePending = true
+		time.AfterFunc(firedSaveDelay, rs.saveFired)
+	}
+}
+
+// saveFired writes the timestamps recorded by MarkFired to the rules file.
+func (rs *RuleState) saveFired() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.firedSavePending = false
+	rs.saveToFile()
+}
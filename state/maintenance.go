@@ -0,0 +1,60 @@
+package state
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Maintenance is the kill switch that fails every proxied request with
+// StatusCode (503 when unset) and Body, whatever the rules say. Like
+// one-shot rules it lives in memory only.
+type Maintenance struct {
+	Enabled    bool       `json:"enabled"`
+	StatusCode int        `json:"statusCode,omitempty"`
+	Body       string     `json:"body,omitempty"`
+	Since      *time.Time `json:"since,omitempty"` // when it was switched on
+}
+
+// DefaultMaintenanceBody is sent when maintenance mode has no body of its own.
+const DefaultMaintenanceBody = "FaultLine: maintenance in progress"
+
+// ValidateMaintenance returns an error for a status code that isn't an
+// HTTP error (400-599); zero means the default 503.
+func ValidateMaintenance(m Maintenance) error {
+	if m.StatusCode != 0 && (m.StatusCode < 400 || m.StatusCode > 599) {
+		return fmt.Errorf("invalid statusCode %d: use an error status between 400 and 599", m.StatusCode)
+	}
+	return nil
+}
+
+// Response returns the status code and body maintenance mode answers with.
+func (m Maintenance) Response() (int, string) {
+	return cmp.Or(m.StatusCode, http.StatusServiceUnavailable), cmp.Or(m.Body, DefaultMaintenanceBody)
+}
+
+// SetMaintenance switches maintenance mode on or off and returns the new
+// setting. Switching it off clears the status code and body.
+func (rs *RuleState) SetMaintenance(m Maintenance) Maintenance {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	switch {
+	case !m.Enabled:
+		m = Maintenance{}
+	case rs.maintenance.Enabled:
+		m.Since = rs.maintenance.Since
+	default:
+		now := time.Now()
+		m.Since = &now
+	}
+	rs.maintenance = m
+	return m
+}
+
+// Maintenance returns the current maintenance mode setting.
+func (rs *RuleState) Maintenance() Maintenance {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.maintenance
+}
@@ -0,0 +1,276 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Request describes an incoming proxy request for rule matching.
+type Request struct {
+	Target string // target URL, including any query string
+	Method string
+	Body   []byte // buffered request body; nil when the body was not buffered
+	Header http.Header
+	// Query holds the parsed query parameters; when nil they are parsed
+	// from Target as needed.
+	Query url.Values
+
+	// Category, when set, limits matching to rules of that category.
+	Category string
+}
+
+// BodyMatch restricts a rule to requests whose body matches. Contains is a
+// plain substring check on the raw body; Path/Equals compares the value at a
+// dotted JSON path (e.g. "order.amount" or "$.items.0.sku") with Equals.
+type BodyMatch struct {
+	Contains string `json:"contains,omitempty" yaml:"contains,omitempty"`
+	Path     string `json:"path,omitempty" yaml:"path,omitempty"`
+	Equals   string `json:"equals,omitempty" yaml:"equals,omitempty"`
+}
+
+// ResponseMatch makes a rule conditional on the upstream's response: the
+// request is forwarded first and the failure only applied to responses that
+// match. Status lists codes ("500") or classes ("5xx"), any of which may
+// match; BodyContains is a substring of the raw response body.
+type ResponseMatch struct {
+	Status       []string `json:"status,omitempty" yaml:"status,omitempty"`
+	BodyContains string   `json:"bodyContains,omitempty" yaml:"bodyContains,omitempty"`
+}
+
+// ValidateResponseMatch returns an error for status patterns that are
+// neither a code nor a class like 5xx; a nil match is valid.
+func ValidateResponseMatch(m *ResponseMatch) error {
+	if m == nil {
+		return nil
+	}
+	for _, s := range m.Status {
+		if !validStatusPattern(s) {
+			return fmt.Errorf("invalid response status %q: use a code such as 503 or a class such as 5xx", s)
+		}
+	}
+	return nil
+}
+
+// validStatusPattern reports whether s is a status code (100-599) or class (1xx-5xx).
+func validStatusPattern(s string) bool {
+	if len(s) != 3 || s[0] < '1' || s[0] > '5' {
+		return false
+	}
+	if strings.EqualFold(s[1:], "xx") {
+		return true
+	}
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// Matches reports whether an upstream response with the given status and
+// body satisfies every condition of the match.
+func (m *ResponseMatch) Matches(status int, body []byte) bool {
+	if len(m.Status) > 0 && !slices.ContainsFunc(m.Status, func(s string) bool { return statusMatches(s, status) }) {
+		return false
+	}
+	return bytes.Contains(body, []byte(m.BodyContains))
+}
+
+// statusMatches reports whether status is the code or in the class pattern names.
+func statusMatches(pattern string, status int) bool {
+	code := strconv.Itoa(status)
+	if len(pattern) == 3 && strings.EqualFold(pattern[1:], "xx") {
+		return pattern[0] == code[0]
+	}
+	return pattern == code
+}
+
+// targetPattern returns a matcher of rule targets for pattern, which selects
+// rules for bulk changes. A pattern with '*' (any run of characters,
+// including '/') or '?' (one character) must match the whole target, e.g.
+// "https://*.example.com/*"; any other pattern is a plain substring.
+func targetPattern(pattern string) func(target string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return func(target string) bool { return strings.Contains(target, pattern) }
+	}
+	var re strings.Builder
+	re.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String()).MatchString
+}
+
+// CatchAllTarget is the reserved target of a default rule: it matches every
+// request, but any rule with a real target that matches takes precedence.
+const CatchAllTarget = "*"
+
+// IsCatchAll reports whether the rule is a default rule for all requests.
+func (rule Rule) IsCatchAll() bool { return rule.Target == CatchAllTarget }
+
+// matches reports whether rule applies to req.
+func (rule Rule) matches(req Request) bool {
+	if !rule.Enabled || !rule.matchesTarget(req.Target) {
+		return false
+	}
+	if rule.HostMatch != "" && !hostMatches(rule.HostMatch, req.Target) {
+		return false
+	}
+	if rule.Method != "" && !strings.EqualFold(rule.Method, req.Method) {
+		return false
+	}
+	if req.Category != "" && rule.EffectiveCategory() != req.Category {
+		return false
+	}
+	if rule.BodyMatch != nil && !rule.BodyMatch.Matches(req.Body) {
+		return false
+	}
+	return rule.matchesHeaders(req.Header) && rule.matchesQuery(req)
+}
+
+// matchesTarget reports whether the rule's target is a prefix of the request
+// URL without its query string, so query parameters never stop a rule from
+// firing; QueryMatch is how a rule selects on them. Targets that include a
+// '?' themselves are compared with the full URL, as they always were.
+func (rule Rule) matchesTarget(target string) bool {
+	if rule.Target == "" {
+		return rule.HostMatch != "" // a host rule covers every path
+	}
+	if rule.IsCatchAll() {
+		return true
+	}
+	if !strings.Contains(rule.Target, "?") {
+		target, _, _ = strings.Cut(target, "?")
+	}
+	return strings.HasPrefix(target, rule.Target)
+}
+
+// hostMatches reports whether the target URL's host is pattern, ignoring
+// case. A pattern with a port must match the port too; "*.example.com"
+// matches any subdomain of example.com but not example.com itself.
+func hostMatches(pattern, target string) bool {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if strings.Contains(strings.TrimPrefix(pattern, "*."), ":") {
+		host = u.Host
+	}
+	host, pattern = strings.ToLower(host), strings.ToLower(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
+// TargetLabel describes what the rule matches for display: its target, or
+// the host of a host-wide rule.
+func (rule Rule) TargetLabel() string {
+	if rule.Target == "" && rule.HostMatch != "" {
+		return "host " + rule.HostMatch
+	}
+	return rule.Target
+}
+
+// matchesHeaders reports whether every header in the rule's HeaderMatch is
+// present with exactly the given value. Header names are case-insensitive.
+func (rule Rule) matchesHeaders(h http.Header) bool {
+	for name, want := range rule.HeaderMatch {
+		if h.Get(name) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesQuery reports whether every parameter in the rule's QueryMatch is
+// present in the request's query string with the given value among its values.
+func (rule Rule) matchesQuery(req Request) bool {
+	if len(rule.QueryMatch) == 0 {
+		return true
+	}
+	q := req.Query
+	if q == nil {
+		u, err := url.Parse(req.Target)
+		if err != nil {
+			return false
+		}
+		q = u.Query()
+	}
+	for name, want := range rule.QueryMatch {
+		if !slices.Contains(q[name], want) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether body satisfies every condition of the match.
+// A nil body (not buffered) never matches.
+func (m *BodyMatch) Matches(body []byte) bool {
+	if body == nil {
+		return false
+	}
+	if m.Contains != "" && !bytes.Contains(body, []byte(m.Contains)) {
+		return false
+	}
+	if m.Path == "" {
+		return true
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return false
+	}
+	value, ok := lookupJSONPath(doc, m.Path)
+	if !ok {
+		return false
+	}
+	if s, isString := value.(string); isString {
+		return s == m.Equals
+	}
+	// Compare non-string values by their JSON encoding, e.g. 1000, true, null.
+	encoded, err := json.Marshal(value)
+	return err == nil && string(encoded) == m.Equals
+}
+
+// lookupJSONPath walks a decoded JSON document along a dotted path.
+func lookupJSONPath(doc interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return doc, true
+	}
+
+	cur := doc
+	for _, seg := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			v, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
@@ -0,0 +1,41 @@
+package state
+
+import "testing"
+
+func TestHostMatchCoversEveryPathOfTheHost(t *testing.T) {
+	cases := []struct {
+		hostMatch string
+		target    string
+		want      bool
+	}{
+		{"payments.internal", "https://payments.internal/charge", true},
+		{"payments.internal", "http://payments.internal/refunds/42?full=1", true},
+		{"payments.internal", "https://PAYMENTS.internal:8443/", true},
+		{"payments.internal", "https://payments.internal.evil.com/charge", false},
+		{"payments.internal", "https://users.internal/payments.internal", false},
+		{"payments.internal:8443", "https://payments.internal:8443/charge", true},
+		{"payments.internal:8443", "https://payments.internal/charge", false},
+		{"*.example.com", "https://api.example.com/users", true},
+		{"*.example.com", "https://eu.api.example.com/users", true},
+		{"*.example.com", "https://example.com/users", false},
+		{"*.example.com", "https://notexample.com/users", false},
+	}
+	for _, c := range cases {
+		rule := Rule{ID: "host", HostMatch: c.hostMatch, Enabled: true}
+		if got := rule.matches(Request{Target: c.target}); got != c.want {
+			t.Errorf("hostMatch %q, target %q: matches = %v, want %v", c.hostMatch, c.target, got, c.want)
+		}
+	}
+}
+
+func TestHostMatchWithTargetNeedsBoth(t *testing.T) {
+	rule := Rule{ID: "both", Target: "https://payments.internal/charge", HostMatch: "payments.internal", Enabled: true}
+	for target, want := range map[string]bool{
+		"https://payments.internal/charge/42": true,
+		"https://payments.internal/refunds":   false,
+	} {
+		if got := rule.matches(Request{Target: target}); got != want {
+			t.Errorf("%s: matches = %v, want %v", target, got, want)
+		}
+	}
+}
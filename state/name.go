@@ -0,0 +1,58 @@
+package state
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// nameRe is the slug format of rule names: lowercase letters, digits and
+// single hyphens, e.g. "payment-latency".
+var nameRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// maxNameLength keeps names short enough to type and to show in tables.
+const maxNameLength = 64
+
+// ValidateRuleName returns an error unless name is empty or a slug. Names
+// made only of digits are refused, as the CLI reads those as rule numbers.
+func ValidateRuleName(name string) error {
+	if name == "" {
+		return nil
+	}
+	if len(name) > maxNameLength || !nameRe.MatchString(name) {
+		return fmt.Errorf("invalid rule name %q: use up to %d lowercase letters, digits and hyphens, e.g. payment-latency", name, maxNameLength)
+	}
+	if strings.Trim(name, "0123456789") == "" {
+		return fmt.Errorf("invalid rule name %q: a name can't be only digits", name)
+	}
+	return nil
+}
+
+// nameTaken reports whether another rule already uses the rule's name.
+func (rs *RuleState) nameTaken(rule Rule) bool {
+	if rule.Name == "" {
+		return false
+	}
+	for id, other := range rs.rules {
+		if id != rule.ID && other.Name == rule.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleByRef returns the rule whose ID or name is ref, so the CLI and API
+// accept either.
+func (rs *RuleState) RuleByRef(ref string) (Rule, bool) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if rule, ok := rs.rules[ref]; ok {
+		return rule, true
+	}
+	for _, rule := range rs.rules {
+		if rule.Name != "" && rule.Name == ref {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRuleName(t *testing.T) {
+	for _, name := range []string{"", "payment-latency", "v2", "a-1-b"} {
+		if err := ValidateRuleName(name); err != nil {
+			t.Errorf("%q: %v, want it accepted", name, err)
+		}
+	}
+	for _, name := range []string{"Payment", "pay_latency", "-pay", "pay-", "pay--latency", "has space", "42", string(make([]byte, maxNameLength+1))} {
+		if err := ValidateRuleName(name); err == nil {
+			t.Errorf("%q was accepted", name)
+		}
+	}
+}
+
+func TestRuleByRef(t *testing.T) {
+	named := errorRule("3f2a", "http://api.local/pay", 0)
+	named.Name = "pay-errors"
+	rs := newTestState(t, named, errorRule("9c1b", "http://api.local/orders", 0))
+
+	for _, ref := range []string{"3f2a", "pay-errors"} {
+		if rule, ok := rs.RuleByRef(ref); !ok || rule.ID != "3f2a" {
+			t.Errorf("RuleByRef(%q) = %v, %v; want the named rule", ref, rule.ID, ok)
+		}
+	}
+	if _, ok := rs.RuleByRef("orders-errors"); ok {
+		t.Error("RuleByRef found a name no rule has")
+	}
+}
+
+func TestRuleNamesAreUnique(t *testing.T) {
+	first := errorRule("a", "http://api.local/pay", 0)
+	first.Name = "pay-errors"
+	rs := newTestState(t, first, errorRule("b", "http://api.local/orders", 0))
+
+	second := errorRule("c", "http://api.local/users", 0)
+	second.Name = "pay-errors"
+	if rs.AddRule(second) {
+		t.Error("AddRule accepted a name already in use")
+	}
+	if _, _, err := rs.AddRuleIfNew(second); !errors.Is(err, ErrNameInUse) {
+		t.Errorf("AddRuleIfNew: %v, want ErrNameInUse", err)
+	}
+
+	renamed := errorRule("b", "http://api.local/orders", 0)
+	renamed.Name = "pay-errors"
+	if err := rs.UpdateRule(renamed); !errors.Is(err, ErrNameInUse) {
+		t.Errorf("UpdateRule to a taken name: %v, want ErrNameInUse", err)
+	}
+
+	// A rule keeps its own name when updated.
+	first.Failure.ErrorCode = 503
+	if err := rs.UpdateRule(first); err != nil {
+		t.Errorf("UpdateRule keeping its name: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package state
+
+import (
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// ArmOneShot queues a fault for the next request matching rule and returns
+// it with its assigned ID. One-shot rules are kept in memory only, take
+// precedence over stored rules and are dropped once they fire.
+func (rs *RuleState) ArmOneShot(rule Rule) Rule {
+	rule.ID = uuid.New().String()
+	rule.Enabled = true
+	rs.mu.Lock()
+	rs.oneShots = append(rs.oneShots, rule)
+	rs.mu.Unlock()
+	return rule
+}
+
+// TakeOneShot removes and returns the earliest armed one-shot rule matching
+// req, so each fires exactly once.
+func (rs *RuleState) TakeOneShot(req Request) (*Rule, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for i, rule := range rs.oneShots {
+		if rule.matches(req) {
+			rs.oneShots = slices.Delete(rs.oneShots, i, i+1)
+			return &rule, true
+		}
+	}
+	return nil, false
+}
+
+// OneShots returns the one-shot rules that have not fired yet, oldest first.
+func (rs *RuleState) OneShots() []Rule {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return append([]Rule{}, rs.oneShots...)
+}
@@ -0,0 +1,49 @@
+package state
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Rollout limits a failure to Percent (0-100) of clients, chosen by hashing
+// an identity: the value of Header (e.g. X-User-ID) or, when no header is
+// named, the client IP. The same identity always gets the same decision,
+// and since the hash doesn't depend on the rule, the clients failed at 10%
+// are among those failed at 20% by any other rule. Requests without the
+// header are never failed.
+type Rollout struct {
+	Percent float64 `json:"percent" yaml:"percent"`
+	Header  string  `json:"header,omitempty" yaml:"header,omitempty"`
+}
+
+// rolloutBuckets is how finely identities are split; percentages are
+// honored to two decimal places.
+const rolloutBuckets = 10000
+
+// ValidateRollout returns an error for a percentage outside 0-100; a nil
+// rollout is valid.
+func ValidateRollout(r *Rollout) error {
+	if r != nil && (r.Percent < 0 || r.Percent > 100) {
+		return fmt.Errorf("invalid rollout percent %g: use a value from 0 to 100", r.Percent)
+	}
+	return nil
+}
+
+// Includes reports whether the failure applies to the client with this
+// identity. An empty identity (no header) is never included.
+func (r *Rollout) Includes(identity string) bool {
+	if identity == "" {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(identity))
+	return float64(h.Sum64()%rolloutBuckets) < r.Percent*rolloutBuckets/100
+}
+
+// summary describes who the rollout applies to.
+func (r *Rollout) summary() string {
+	if r.Header == "" {
+		return fmt.Sprintf("%g%% of client IPs", r.Percent)
+	}
+	return fmt.Sprintf("%g%% of %s values", r.Percent, r.Header)
+}
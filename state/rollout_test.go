@@ -0,0 +1,65 @@
+package state
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRolloutIsSticky(t *testing.T) {
+	r := &Rollout{Percent: 30}
+	for i := 0; i < 200; i++ {
+		id := fmt.Sprintf("user-%d", i)
+		first := r.Includes(id)
+		for j := 0; j < 5; j++ {
+			if r.Includes(id) != first {
+				t.Fatalf("%s got different decisions", id)
+			}
+		}
+	}
+}
+
+func TestRolloutSplitFollowsPercent(t *testing.T) {
+	const clients = 20000
+	for _, percent := range []float64{0, 5, 25, 50, 90, 100} {
+		r := &Rollout{Percent: percent}
+		in := 0
+		for i := 0; i < clients; i++ {
+			if r.Includes(fmt.Sprintf("user-%d", i)) {
+				in++
+			}
+		}
+		got := float64(in) * 100 / clients
+		if got < percent-2 || got > percent+2 {
+			t.Errorf("%g%% rollout included %.1f%% of clients", percent, got)
+		}
+	}
+}
+
+func TestRolloutGrowsAsASuperset(t *testing.T) {
+	small, large := &Rollout{Percent: 10}, &Rollout{Percent: 20}
+	for i := 0; i < 5000; i++ {
+		id := fmt.Sprintf("user-%d", i)
+		if small.Includes(id) && !large.Includes(id) {
+			t.Fatalf("%s is in the 10%% rollout but not the 20%% one", id)
+		}
+	}
+}
+
+func TestRolloutLeavesOutMissingIdentity(t *testing.T) {
+	if (&Rollout{Percent: 100}).Includes("") {
+		t.Error("a request without an identity was included")
+	}
+}
+
+func TestValidateRollout(t *testing.T) {
+	for _, r := range []*Rollout{nil, {Percent: 0}, {Percent: 12.5}, {Percent: 100}} {
+		if err := ValidateRollout(r); err != nil {
+			t.Errorf("%+v: %v", r, err)
+		}
+	}
+	for _, r := range []*Rollout{{Percent: -1}, {Percent: 100.5}} {
+		if err := ValidateRollout(r); err == nil {
+			t.Errorf("%+v was accepted", r)
+		}
+	}
+}
@@ -1,28 +1,285 @@
 package state
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
 	"faultline/config"
+	"fmt"
+	"math/rand"
+	"net/http"
 	"os"
+	"reflect"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
-// Rule defines the structure for a failure rule, including JSON tags for API communication.
+// Rule defines the structure for a failure rule, including JSON tags for API communication
+// and matching YAML tags for rule files.
 type Rule struct {
-	ID       string  `json:"id"`
-	Target   string  `json:"target"`
-	Failure  Failure `json:"failure"`
-	Enabled  bool    `json:"enabled"`
-	Category string  `json:"category,omitempty"` // e.g., "api" | "database"
+	ID string `json:"id" yaml:"id"`
+	// Name is an optional unique slug (e.g. "payment-latency") accepted in
+	// place of the ID by the CLI and API.
+	Name   string `json:"name,omitempty" yaml:"name,omitempty"`
+	Target string `json:"target" yaml:"target"`
+	// HostMatch restricts the rule to requests for this upstream host
+	// (e.g. payments.internal, or *.example.com for its subdomains); with
+	// no Target it covers every path on the host.
+	HostMatch string  `json:"hostMatch,omitempty" yaml:"hostMatch,omitempty"`
+	Failure   Failure `json:"failure" yaml:"failure"`
+	Enabled   bool    `json:"enabled" yaml:"enabled"`
+	Category  string  `json:"category,omitempty" yaml:"category,omitempty"` // one of Categories; empty means DefaultCategory
+	Priority  int     `json:"priority,omitempty" yaml:"priority,omitempty"` // Higher priority wins when several rules match
+	Method    string  `json:"method,omitempty" yaml:"method,omitempty"`     // Optional HTTP method; empty matches any
+	Weight    int     `json:"weight,omitempty" yaml:"weight,omitempty"`     // Share of matches with the weighted strategy
+	// BodyMatch optionally restricts the rule to requests whose body matches.
+	BodyMatch *BodyMatch `json:"bodyMatch,omitempty" yaml:"bodyMatch,omitempty"`
+	// HeaderMatch optionally restricts the rule to requests carrying all of
+	// these headers with exactly these values (e.g. X-Tenant: beta).
+	HeaderMatch map[string]string `json:"headerMatch,omitempty" yaml:"headerMatch,omitempty"`
+	// QueryMatch optionally restricts the rule to requests whose query string
+	// has all of these parameters with these values (e.g. debug: "true"), in
+	// any order.
+	QueryMatch map[string]string `json:"queryMatch,omitempty" yaml:"queryMatch,omitempty"`
+	// ResponseMatch, when set, applies the failure only to requests whose
+	// real upstream response matches (e.g. turn 500s into timeouts).
+	ResponseMatch *ResponseMatch `json:"responseMatch,omitempty" yaml:"responseMatch,omitempty"`
+	// Tags are free-form labels (e.g. release-1.2, payment-team) for
+	// organizing and filtering rules; they don't affect matching.
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// ScenarioID names the scenario the rule was loaded from, if any.
+	ScenarioID string `json:"scenarioId,omitempty" yaml:"scenarioId,omitempty"`
+	// FromConfig marks rules seeded from the config file (see SeedConfig).
+	FromConfig bool `json:"fromConfig,omitempty" yaml:"fromConfig,omitempty"`
+	// LastFired is when the proxy last applied the rule's failure; nil if
+	// it never did. It is maintained by the proxy (see MarkFired).
+	LastFired *time.Time `json:"lastFired,omitempty" yaml:"lastFired,omitempty"`
 }
 
 // Failure defines the specifics of a failure, using camelCase JSON tags.
 type Failure struct {
-	Type      string `json:"type"`
-	LatencyMs int    `json:"latencyMs,omitempty"`
-	ErrorCode int    `json:"errorCode,omitempty"`
+	Type      string `json:"type" yaml:"type"`
+	LatencyMs int    `json:"latencyMs,omitempty" yaml:"latencyMs,omitempty"`
+	ErrorCode int    `json:"errorCode,omitempty" yaml:"errorCode,omitempty"`
+	// LatencyStepMs makes a "latency" rule degrade: each matching request is
+	// delayed this much longer than the one before, starting at LatencyMs.
+	LatencyStepMs int `json:"latencyStepMs,omitempty" yaml:"latencyStepMs,omitempty"`
+	// RetryAfterSeconds is sent as a Retry-After header on injected 429/503 errors.
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty" yaml:"retryAfterSeconds,omitempty"`
+	// ResponseHeaders are written on injected (non-proxied) responses.
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty" yaml:"responseHeaders,omitempty"`
+	// Sequence lists the status codes cycled through by the "sequence" type.
+	// Codes below 400 let the request through to the upstream.
+	Sequence []int `json:"sequence,omitempty" yaml:"sequence,omitempty"`
+	// FailFirstN, when set, injects the failure into only the first N matching
+	// requests and proxies the rest, modelling an outage that clears up after
+	// retries. ResetAfterSeconds starts the count over that long after the
+	// first failed request.
+	FailFirstN        int `json:"failFirstN,omitempty" yaml:"failFirstN,omitempty"`
+	ResetAfterSeconds int `json:"resetAfterSeconds,omitempty" yaml:"resetAfterSeconds,omitempty"`
+	// RequestsPerSecond and Burst configure the token bucket of the
+	// "ratelimit" type; requests beyond it get a 429. Burst defaults to 1.
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty" yaml:"requestsPerSecond,omitempty"`
+	Burst             int     `json:"burst,omitempty" yaml:"burst,omitempty"`
+	// MaxRequests matching requests are let through per WindowSeconds by the
+	// "quota" type; the rest get ErrorCode (429 when unset) until the window,
+	// which starts with its first request, ends. A zero window never resets.
+	MaxRequests   int `json:"maxRequests,omitempty" yaml:"maxRequests,omitempty"`
+	WindowSeconds int `json:"windowSeconds,omitempty" yaml:"windowSeconds,omitempty"`
+	// StatusCode (200 when unset) and Body are served by the "mock" type
+	// without contacting any upstream, so a rule can stand in for a service.
+	StatusCode int    `json:"statusCode,omitempty" yaml:"statusCode,omitempty"`
+	Body       string `json:"body,omitempty" yaml:"body,omitempty"`
+	// DropProbability and CloseAfterFrames apply to WebSocket messages under
+	// the "stream" type, along with LatencyMs as a per-message delay. The
+	// connection is closed once CloseAfterFrames messages went through.
+	DropProbability  float64 `json:"dropProbability,omitempty" yaml:"dropProbability,omitempty"`
+	CloseAfterFrames int     `json:"closeAfterFrames,omitempty" yaml:"closeAfterFrames,omitempty"`
+	// MaxConcurrent, when set, lets only that many matching requests be in
+	// flight at once, like a saturated or single-threaded backend. Others
+	// wait up to QueueTimeoutMs for a slot and then get a 503; without a
+	// queue timeout they get the 503 straight away.
+	MaxConcurrent  int `json:"maxConcurrent,omitempty" yaml:"maxConcurrent,omitempty"`
+	QueueTimeoutMs int `json:"queueTimeoutMs,omitempty" yaml:"queueTimeoutMs,omitempty"`
+	// Rollout, when set, applies the failure to a stable share of clients
+	// only; requests from the others are proxied normally.
+	Rollout *Rollout `json:"rollout,omitempty" yaml:"rollout,omitempty"`
+	// Probability, between 0 and 1, is the chance that a matching request
+	// gets the failure; the rest are proxied normally. Zero means always.
+	Probability float64 `json:"probability,omitempty" yaml:"probability,omitempty"`
+	// RequestMutation is how the "request-mutation" type rewrites the
+	// request before forwarding it, to see how the upstream copes.
+	RequestMutation *RequestMutation `json:"requestMutation,omitempty" yaml:"requestMutation,omitempty"`
+}
+
+// RequestMutation rewrites a proxied request. Method replaces its method;
+// RemoveHeaders are dropped before SetHeaders are set; Body, when present,
+// replaces the body ("" sends none) and Content-Length is recomputed.
+type RequestMutation struct {
+	Method        string            `json:"method,omitempty" yaml:"method,omitempty"`
+	SetHeaders    map[string]string `json:"setHeaders,omitempty" yaml:"setHeaders,omitempty"`
+	RemoveHeaders []string          `json:"removeHeaders,omitempty" yaml:"removeHeaders,omitempty"`
+	Body          *string           `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// Validate returns an error for parameters the proxy can't apply, such as
+// an error rule without a valid status code or a ratelimit without a rate.
+func (f Failure) Validate() error {
+	switch f.Type {
+	case "error":
+		if err := validateStatusCode("errorCode", f.ErrorCode); err != nil {
+			return err
+		}
+	case "sequence":
+		if len(f.Sequence) == 0 {
+			return errors.New("a sequence failure needs at least one status code")
+		}
+		for _, code := range f.Sequence {
+			if err := validateStatusCode("sequence", code); err != nil {
+				return err
+			}
+		}
+	case "ratelimit":
+		if f.RequestsPerSecond <= 0 {
+			return fmt.Errorf("invalid requestsPerSecond %g: a ratelimit failure needs a rate above 0", f.RequestsPerSecond)
+		}
+	case "quota":
+		if f.ErrorCode != 0 {
+			if err := validateStatusCode("errorCode", f.ErrorCode); err != nil {
+				return err
+			}
+		}
+	case "mock":
+		if f.StatusCode != 0 {
+			if err := validateStatusCode("statusCode", f.StatusCode); err != nil {
+				return err
+			}
+		}
+	}
+	if f.Burst < 0 {
+		return fmt.Errorf("invalid burst %d: must not be negative", f.Burst)
+	}
+	if f.Probability < 0 || f.Probability > 1 {
+		return fmt.Errorf("invalid probability %g: use a value from 0 to 1", f.Probability)
+	}
+	return ValidateRollout(f.Rollout)
+}
+
+// validateStatusCode returns an error unless code is an HTTP status code.
+func validateStatusCode(field string, code int) error {
+	if code < 100 || code > 599 {
+		return fmt.Errorf("invalid %s %d: use an HTTP status code from 100 to 599", field, code)
+	}
+	return nil
+}
+
+// Summary returns a short human-readable description of the failure.
+func (f Failure) Summary() string {
+	s := f.typeSummary()
+	if f.FailFirstN > 0 {
+		s += fmt.Sprintf(" for the first %d request(s)", f.FailFirstN)
+		if f.ResetAfterSeconds > 0 {
+			s += fmt.Sprintf(", every %ds", f.ResetAfterSeconds)
+		}
+	}
+	if f.MaxConcurrent > 0 {
+		s += fmt.Sprintf(", at most %d at a time", f.MaxConcurrent)
+	}
+	if f.Rollout != nil {
+		s += ", for " + f.Rollout.summary()
+	}
+	if f.Probability > 0 && f.Probability < 1 {
+		s += fmt.Sprintf(", %g%% of requests", f.Probability*100)
+	}
+	return s
+}
+
+// typeSummary describes the failure type's own parameters.
+func (f Failure) typeSummary() string {
+	switch f.Type {
+	case "latency":
+		if f.LatencyStepMs > 0 {
+			return fmt.Sprintf("%dms delay, +%dms per request", f.LatencyMs, f.LatencyStepMs)
+		}
+		return fmt.Sprintf("%dms delay", f.LatencyMs)
+	case "error":
+		if f.LatencyMs > 0 {
+			return fmt.Sprintf("HTTP %d after %dms", f.ErrorCode, f.LatencyMs)
+		}
+		return fmt.Sprintf("HTTP %d", f.ErrorCode)
+	case "timeout":
+		return "Timeout"
+	case "ratelimit":
+		return fmt.Sprintf("%g req/s (burst %d)", f.RequestsPerSecond, max(f.Burst, 1))
+	case "quota":
+		if f.WindowSeconds > 0 {
+			return fmt.Sprintf("%d requests per %ds", f.MaxRequests, f.WindowSeconds)
+		}
+		return fmt.Sprintf("%d requests", f.MaxRequests)
+	case "mock":
+		return fmt.Sprintf("mock HTTP %d (%d-byte body)", cmp.Or(f.StatusCode, http.StatusOK), len(f.Body))
+	case "stream":
+		var parts []string
+		if f.LatencyMs > 0 {
+			parts = append(parts, fmt.Sprintf("%dms per message", f.LatencyMs))
+		}
+		if f.DropProbability > 0 {
+			parts = append(parts, fmt.Sprintf("%g%% dropped", f.DropProbability*100))
+		}
+		if f.CloseAfterFrames > 0 {
+			parts = append(parts, fmt.Sprintf("closed after %d message(s)", f.CloseAfterFrames))
+		}
+		if len(parts) == 0 {
+			return "stream passthrough"
+		}
+		return "stream: " + strings.Join(parts, ", ")
+	case "refused":
+		return "connection refused"
+	case "dns":
+		if f.LatencyMs > 0 {
+			return fmt.Sprintf("DNS failure after %dms", f.LatencyMs)
+		}
+		return "DNS failure"
+	case "request-mutation":
+		return f.RequestMutation.summary()
+	case "sequence":
+		parts := make([]string, len(f.Sequence))
+		for i, code := range f.Sequence {
+			parts[i] = strconv.Itoa(code)
+		}
+		return strings.Join(parts, " → ")
+	}
+	return ""
+}
+
+// summary describes the changes a mutation makes to the request.
+func (m *RequestMutation) summary() string {
+	if m == nil {
+		return "request passthrough"
+	}
+	var parts []string
+	if m.Method != "" {
+		parts = append(parts, "method "+strings.ToUpper(m.Method))
+	}
+	if len(m.RemoveHeaders) > 0 {
+		parts = append(parts, "drop "+strings.Join(m.RemoveHeaders, ", "))
+	}
+	if len(m.SetHeaders) > 0 {
+		parts = append(parts, fmt.Sprintf("set %d header(s)", len(m.SetHeaders)))
+	}
+	if m.Body != nil {
+		parts = append(parts, fmt.Sprintf("%d-byte body", len(*m.Body)))
+	}
+	if len(parts) == 0 {
+		return "request passthrough"
+	}
+	return "request: " + strings.Join(parts, ", ")
 }
 
 // RuleState holds the current set of rules in a thread-safe manner.
@@ -31,24 +288,162 @@ type RuleState struct {
 	rules       map[string]Rule
 	dataFile    string    // Path to persistent storage file
 	fileModTime time.Time // Last modification time of the data file
+	fileSize    int64     // Size of the data file when last loaded or saved
+
+	// reloadMu serializes CheckAndReloadIfModified so concurrent requests
+	// don't all re-read a changed file. It is always taken before mu.
+	reloadMu sync.Mutex
+
+	tcpRules       map[string]TCPRule
+	tcpFileModTime time.Time // Last modification time of the TCP rules file
+
+	oneShots []Rule // armed by ArmOneShot, in arming order; never persisted
+
+	maintenance Maintenance // see SetMaintenance; never persisted
+
+	firedSavePending bool // a save of MarkFired timestamps is scheduled
 }
 
+// Errors returned by RuleState updates.
+var (
+	ErrNotFound    = errors.New("rule not found")
+	ErrListenInUse = errors.New("listen address already used by another TCP rule")
+	ErrNameInUse   = errors.New("rule name already used by another rule")
+)
+
 // NewRuleState creates a new, thread-safe rule store.
-// initialRules can be nil. dataFile specifies where to persist rules.
+// initialRules can be nil; otherwise they are seeded on top of the rules loaded
+// from dataFile. dataFile specifies where to persist rules.
 func NewRuleState(initialRules []config.Rule, dataFile string) *RuleState {
 	rs := &RuleState{
 		rules:    make(map[string]Rule),
+		tcpRules: make(map[string]TCPRule),
 		dataFile: dataFile,
 	}
 
 	// Load rules from file if it exists
 	if dataFile != "" {
 		rs.loadFromFile()
+		rs.loadTCPFromFile()
+	}
+
+	if len(initialRules) > 0 {
+		rs.SeedConfig(RulesFromConfig(initialRules))
 	}
 
 	return rs
 }
 
+// SetDataFile switches the persistent storage file and reloads rules from it.
+// It is used once command-line flags have been parsed.
+func (rs *RuleState) SetDataFile(dataFile string) error {
+	rs.mu.Lock()
+	rs.dataFile = dataFile
+	rs.rules = make(map[string]Rule)
+	rs.fileModTime = time.Time{}
+	rs.fileSize = 0
+	rs.tcpRules = make(map[string]TCPRule)
+	rs.tcpFileModTime = time.Time{}
+	rs.mu.Unlock()
+
+	if dataFile == "" {
+		return nil
+	}
+	if err := rs.loadFromFile(); err != nil {
+		return err
+	}
+	return rs.loadTCPFromFile()
+}
+
+// RulesFromConfig converts rules defined in a config file into runtime rules.
+// IDs are derived from the rule's target and whole failure, so seeding the
+// same file again doesn't create duplicates while any edited parameter makes
+// a new rule. Config rules are enabled and default to the "api" category.
+func RulesFromConfig(cfgRules []config.Rule) []Rule {
+	rules := make([]Rule, 0, len(cfgRules))
+	for _, cr := range cfgRules {
+		failure, _ := json.Marshal(cr.Failure)
+		key := "faultline:config:" + cr.Target + "|" + string(failure)
+		rules = append(rules, Rule{
+			ID:     uuid.NewSHA1(uuid.NameSpaceURL, []byte(key)).String(),
+			Target: cr.Target,
+			Failure: Failure{
+				Type:        cr.Failure.Type,
+				LatencyMs:   cr.Failure.LatencyMs,
+				ErrorCode:   cr.Failure.ErrorCode,
+				Probability: cr.Failure.Probability,
+			},
+			Enabled:    true,
+			Category:   DefaultCategory,
+			FromConfig: true,
+		})
+	}
+	return rules
+}
+
+// Seed adds rules whose IDs aren't already present and persists once.
+// Existing rules, and rules duplicating one (see Duplicates), are left
+// untouched so runtime changes (e.g. disabling a seeded rule) survive a
+// restart; a seeded rule that was deleted is added again. It returns the
+// rules it added.
+func (rs *RuleState) Seed(rules []Rule) []Rule {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	var added []Rule
+	for _, rule := range rules {
+		if rs.hasDuplicate(rule) {
+			continue
+		}
+		rs.rules[rule.ID] = rule
+		added = append(added, rule)
+	}
+	if len(added) > 0 {
+		rs.saveToFile()
+	}
+	return added
+}
+
+// SeedConfig seeds the rules of a config file (see RulesFromConfig) and
+// removes rules seeded from the config earlier that it no longer defines,
+// so edits to the file replace the rules they change. It returns the rules
+// added and removed.
+func (rs *RuleState) SeedConfig(rules []Rule) (added, removed []Rule) {
+	keep := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		keep[rule.ID] = true
+	}
+	rs.mu.Lock()
+	for id, rule := range rs.rules {
+		if rule.FromConfig && !keep[id] {
+			delete(rs.rules, id)
+			removed = append(removed, rule)
+		}
+	}
+	if len(removed) > 0 {
+		rs.saveToFile()
+	}
+	rs.mu.Unlock()
+	return rs.Seed(rules), removed
+}
+
+// hasDuplicate reports whether a rule with the rule's ID, or one matching
+// the same requests with the same failure, is present. rs.mu must be held.
+func (rs *RuleState) hasDuplicate(rule Rule) bool {
+	if _, ok := rs.rules[rule.ID]; ok {
+		return true
+	}
+	for _, other := range rs.rules {
+		if rule.Duplicates(other) {
+			return true
+		}
+	}
+	return false
+}
+
 // loadFromFile loads rules from the persistent storage file
 func (rs *RuleState) loadFromFile() error {
 	fileInfo, err := os.Stat(rs.dataFile)
@@ -75,6 +470,7 @@ func (rs *RuleState) loadFromFile() error {
 
 	// Update modification time
 	rs.fileModTime = fileInfo.ModTime()
+	rs.fileSize = fileInfo.Size()
 	// Clear existing rules and load from file
 	rs.rules = make(map[string]Rule)
 	for _, rule := range rules {
@@ -84,6 +480,9 @@ func (rs *RuleState) loadFromFile() error {
 	return nil
 }
 
+// writeFile writes the rules file; tests replace it to count writes.
+var writeFile = os.WriteFile
+
 // saveToFile saves the current rules to the persistent storage file
 func (rs *RuleState) saveToFile() error {
 	if rs.dataFile == "" {
@@ -96,7 +495,14 @@ func (rs *RuleState) saveToFile() error {
 		return err
 	}
 
-	return os.WriteFile(rs.dataFile, data, 0644)
+	if err := writeFile(rs.dataFile, data, 0644); err != nil {
+		return err
+	}
+	// Remember our own write so it isn't mistaken for an outside edit.
+	if fileInfo, err := os.Stat(rs.dataFile); err == nil {
+		rs.fileModTime, rs.fileSize = fileInfo.ModTime(), fileInfo.Size()
+	}
+	return nil
 }
 
 // getRulesInternal returns rules without locking (internal use)
@@ -121,24 +527,121 @@ func (rs *RuleState) GetRules() []Rule {
 	return rs.getRulesInternal()
 }
 
-// AddRule adds a new rule to the store and persists to file.
-func (rs *RuleState) AddRule(rule Rule) {
+// GetRulesByCategory returns the rules in category, sorted by ID.
+func (rs *RuleState) GetRulesByCategory(category string) []Rule {
+	var rules []Rule
+	for _, rule := range rs.GetRules() {
+		if rule.EffectiveCategory() == category {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// GetRulesByTag returns the rules labeled with tag, sorted by ID.
+func (rs *RuleState) GetRulesByTag(tag string) []Rule {
+	var rules []Rule
+	for _, rule := range rs.GetRules() {
+		if rule.HasTag(tag) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// HasTag reports whether the rule is labeled with tag, ignoring case.
+func (rule Rule) HasTag(tag string) bool {
+	return slices.ContainsFunc(rule.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+}
+
+// AddRule adds a new rule to the store and persists to file. It returns
+// false if another rule already has the same name.
+func (rs *RuleState) AddRule(rule Rule) bool {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
+	if rs.nameTaken(rule) {
+		return false
+	}
 	rs.rules[rule.ID] = rule
 	rs.saveToFile() // Auto-save after adding
+	return true
 }
 
-// UpdateRule updates an existing rule and persists to file. Returns false if the rule is not found.
-func (rs *RuleState) UpdateRule(rule Rule) bool {
+// AddRuleIfNew adds rule unless an existing rule has the same content (see
+// Duplicates). It returns the stored rule and false when a duplicate was
+// skipped, and ErrNameInUse if another rule already has the rule's name.
+func (rs *RuleState) AddRuleIfNew(rule Rule) (Rule, bool, error) {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
-	if _, ok := rs.rules[rule.ID]; !ok {
+	for _, existing := range rs.getRulesInternal() {
+		if existing.Duplicates(rule) {
+			return existing, false, nil
+		}
+	}
+	if rs.nameTaken(rule) {
+		return Rule{}, false, ErrNameInUse
+	}
+	rs.rules[rule.ID] = rule
+	rs.saveToFile()
+	return rule, true, nil
+}
+
+// Duplicates reports whether two rules match the same requests and inject the
+// same failure, ignoring ID, enabled state, category, priority and tags.
+func (rule Rule) Duplicates(other Rule) bool {
+	return rule.Target == other.Target &&
+		strings.EqualFold(rule.HostMatch, other.HostMatch) &&
+		strings.EqualFold(rule.Method, other.Method) &&
+		reflect.DeepEqual(rule.BodyMatch, other.BodyMatch) &&
+		sameHeaderMatch(rule.HeaderMatch, other.HeaderMatch) &&
+		sameQueryMatch(rule.QueryMatch, other.QueryMatch) &&
+		reflect.DeepEqual(rule.ResponseMatch, other.ResponseMatch) &&
+		reflect.DeepEqual(rule.Failure, other.Failure)
+}
+
+// sameQueryMatch compares query conditions; nil and empty are the same.
+func sameQueryMatch(a, b map[string]string) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
+}
+
+// sameHeaderMatch compares header conditions, ignoring header name case.
+func sameHeaderMatch(a, b map[string]string) bool {
+	if len(a) != len(b) {
 		return false
 	}
+	for name, value := range a {
+		found := false
+		for other, v := range b {
+			if strings.EqualFold(name, other) && v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateRule updates an existing rule and persists to file. The error
+// reports a missing rule or a name already used by another rule.
+func (rs *RuleState) UpdateRule(rule Rule) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	old, ok := rs.rules[rule.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if rs.nameTaken(rule) {
+		return ErrNameInUse
+	}
+	if rule.LastFired == nil {
+		rule.LastFired = old.LastFired // edits don't reset the rule's history
+	}
 	rs.rules[rule.ID] = rule
 	rs.saveToFile() // Auto-save after updating
-	return true
+	return nil
 }
 
 // DeleteRule removes a rule by its ID and persists to file. Returns false if the rule is not found.
@@ -153,30 +656,204 @@ func (rs *RuleState) DeleteRule(id string) bool {
 	return true
 }
 
+// SetEnabledBulk enables or disables the rules with the given IDs under a
+// single lock and persists once. If any ID is unknown nothing is changed and
+// the error wraps ErrNotFound.
+func (rs *RuleState) SetEnabledBulk(ids []string, enabled bool) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := rs.rules[id]; !ok {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+	}
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	rs.setEnabledWhere(func(rule Rule) bool { return want[rule.ID] }, enabled)
+	return nil
+}
+
+// SetEnabledByCategory enables or disables every rule in category at once and
+// returns how many rules it has.
+func (rs *RuleState) SetEnabledByCategory(category string, enabled bool) int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.setEnabledWhere(func(rule Rule) bool { return rule.EffectiveCategory() == category }, enabled)
+}
+
+// SetEnabledByTarget enables or disables every rule whose target matches
+// pattern (a substring, or a glob with '*' and '?') at once and returns how
+// many matched.
+func (rs *RuleState) SetEnabledByTarget(pattern string, enabled bool) int {
+	matches := targetPattern(pattern)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.setEnabledWhere(func(rule Rule) bool { return matches(rule.Target) }, enabled)
+}
+
+// setEnabledWhere sets the enabled state of the rules match selects, saving
+// once if any were selected, and returns their count. rs.mu must be held.
+func (rs *RuleState) setEnabledWhere(match func(Rule) bool, enabled bool) int {
+	n := 0
+	for id, rule := range rs.rules {
+		if match(rule) {
+			rule.Enabled = enabled
+			rs.rules[id] = rule
+			n++
+		}
+	}
+	if n > 0 {
+		rs.saveToFile()
+	}
+	return n
+}
+
 // FindRuleForTarget checks if any enabled rule matches the given target URL.
 func (rs *RuleState) FindRuleForTarget(targetURL string) (*Rule, bool) {
+	return rs.FindRuleForRequest(Request{Target: targetURL})
+}
+
+// FindRuleForRequest returns the enabled rule that best matches the request.
+// When several rules match, the one with the highest Priority wins; ties are
+// broken by the longest (most specific) target, then by ID for stability.
+func (rs *RuleState) FindRuleForRequest(req Request) (*Rule, bool) {
 	rs.mu.RLock()
 	defer rs.mu.RUnlock()
 
+	var best *Rule
 	for _, rule := range rs.rules {
-		// A rule matches if it's enabled and its target is a prefix of the request URL.
-		if rule.Enabled && len(rule.Target) > 0 && len(targetURL) >= len(rule.Target) && targetURL[:len(rule.Target)] == rule.Target {
-			// Return a copy of the rule to prevent data races.
+		if !rule.matches(req) {
+			continue
+		}
+		if best == nil || outranks(rule, *best) {
+			// Keep a copy of the rule to prevent data races.
 			r := rule
-			return &r, true
+			best = &r
+		}
+	}
+	return best, best != nil
+}
+
+// Strategies for choosing between several rules that match a request.
+const (
+	MatchPriority = "priority" // the best-ranked rule always wins (default)
+	MatchWeighted = "weighted" // a rule is drawn at random in proportion to its Weight
+)
+
+// ValidateMatchStrategy reports an error for unknown strategies; empty means MatchPriority.
+func ValidateMatchStrategy(s string) error {
+	switch s {
+	case "", MatchPriority, MatchWeighted:
+		return nil
+	}
+	return fmt.Errorf("unknown match strategy %q (valid: %s, %s)", s, MatchPriority, MatchWeighted)
+}
+
+// PickWeightedRule chooses among the matching rules with a positive Weight at
+// random, each in proportion to its weight, so overlapping rules can model a
+// mix of failures (e.g. 70% latency, 30% errors). When no weighted rule
+// matches it falls back to FindRuleForRequest. Catch-all rules never take
+// part in the draw, so they only apply when nothing more specific matches.
+func (rs *RuleState) PickWeightedRule(req Request) (*Rule, bool) {
+	rs.mu.RLock()
+	var weighted []Rule
+	total := 0
+	for _, rule := range rs.rules {
+		if rule.Weight > 0 && !rule.IsCatchAll() && rule.matches(req) {
+			weighted = append(weighted, rule)
+			total += rule.Weight
+		}
+	}
+	rs.mu.RUnlock()
+
+	if total == 0 {
+		return rs.FindRuleForRequest(req)
+	}
+	// Map iteration order is random; sort so a draw maps to a stable rule.
+	sort.Slice(weighted, func(i, j int) bool { return outranks(weighted[i], weighted[j]) })
+	n := rand.Intn(total)
+	for _, rule := range weighted {
+		if n < rule.Weight {
+			return &rule, true
+		}
+		n -= rule.Weight
+	}
+	return &weighted[len(weighted)-1], true
+}
+
+// FindMatchingRules returns every enabled rule matching the request, best first.
+// The first entry is the rule FindRuleForRequest would pick.
+func (rs *RuleState) FindMatchingRules(req Request) []Rule {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	var matched []Rule
+	for _, rule := range rs.rules {
+		if rule.matches(req) {
+			matched = append(matched, rule)
 		}
 	}
-	return nil, false
+	sort.Slice(matched, func(i, j int) bool { return outranks(matched[i], matched[j]) })
+	return matched
+}
+
+// NeedsRequestBody reports whether any enabled rule inspects request bodies,
+// so the proxy only buffers bodies when it has to.
+func (rs *RuleState) NeedsRequestBody() bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	for _, rule := range rs.rules {
+		if rule.Enabled && rule.BodyMatch != nil {
+			return true
+		}
+	}
+	return slices.ContainsFunc(rs.oneShots, func(rule Rule) bool { return rule.BodyMatch != nil })
+}
+
+// outranks reports whether rule a should be preferred over rule b when both
+// match. Catch-all rules lose to any other rule, whatever their priority.
+func outranks(a, b Rule) bool {
+	if a.IsCatchAll() != b.IsCatchAll() {
+		return b.IsCatchAll()
+	}
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if len(a.Target) != len(b.Target) {
+		return len(a.Target) > len(b.Target)
+	}
+	return a.ID < b.ID
 }
 
-// CheckAndReloadIfModified checks if the data file has been modified since last load
-// and reloads the rules if necessary. This is used by the proxy to detect CLI changes.
+// Reload re-reads the rules file, replacing the rules in memory, and returns
+// how many rules are loaded.
+func (rs *RuleState) Reload() (int, error) {
+	if err := rs.loadFromFile(); err != nil {
+		return 0, err
+	}
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return len(rs.rules), nil
+}
+
+// CheckAndReloadIfModified reloads the rules if the data file changed since it
+// was last loaded or saved, e.g. by the CLI in another process. Any change of
+// modification time or size counts, so a file restored from an older copy is
+// picked up too. The proxy calls it on every request.
 func (rs *RuleState) CheckAndReloadIfModified() error {
-	if rs.dataFile == "" {
+	rs.reloadMu.Lock()
+	defer rs.reloadMu.Unlock()
+
+	rs.mu.RLock()
+	path, modTime, size := rs.dataFile, rs.fileModTime, rs.fileSize
+	rs.mu.RUnlock()
+	if path == "" {
 		return nil // No file to check
 	}
 
-	fileInfo, err := os.Stat(rs.dataFile)
+	fileInfo, err := os.Stat(path)
 	if os.IsNotExist(err) {
 		return nil // File doesn't exist
 	}
@@ -184,10 +861,8 @@ func (rs *RuleState) CheckAndReloadIfModified() error {
 		return err
 	}
 
-	// Check if file has been modified
-	if fileInfo.ModTime().After(rs.fileModTime) {
-		return rs.loadFromFile()
+	if fileInfo.ModTime().Equal(modTime) && fileInfo.Size() == size {
+		return nil
 	}
-
-	return nil
+	return rs.loadFromFile()
 }
@@ -0,0 +1,325 @@
+package state
+
+import (
+	"faultline/config"
+	"path/filepath"
+	"testing"
+)
+
+// newTestState returns a rule state holding rules, not backed by a file.
+func newTestState(t *testing.T, rules ...Rule) *RuleState {
+	t.Helper()
+	rs := NewRuleState(nil, "")
+	for _, rule := range rules {
+		if !rs.AddRule(rule) {
+			t.Fatalf("AddRule(%s) failed", rule.ID)
+		}
+	}
+	return rs
+}
+
+func errorRule(id, target string, priority int) Rule {
+	return Rule{ID: id, Target: target, Enabled: true, Priority: priority, Failure: Failure{Type: "error", ErrorCode: 500}}
+}
+
+func TestFindRuleForTargetPrefersMoreSpecificTarget(t *testing.T) {
+	rs := newTestState(t,
+		errorRule("a", "http://api.local/api", 0),
+		errorRule("b", "http://api.local/api/users", 0),
+	)
+	for i := 0; i < 50; i++ {
+		rule, ok := rs.FindRuleForTarget("http://api.local/api/users/1")
+		if !ok || rule.ID != "b" {
+			t.Fatalf("attempt %d: got %v, want the /api/users rule", i, rule)
+		}
+	}
+	if rule, ok := rs.FindRuleForTarget("http://api.local/api/orders"); !ok || rule.ID != "a" {
+		t.Errorf("/api/orders matched %v, want the /api rule", rule)
+	}
+}
+
+func TestFindRuleForTargetPriorityBeatsSpecificity(t *testing.T) {
+	rs := newTestState(t,
+		errorRule("broad", "http://api.local/api", 10),
+		errorRule("narrow", "http://api.local/api/users", 0),
+	)
+	for i := 0; i < 50; i++ {
+		rule, ok := rs.FindRuleForTarget("http://api.local/api/users")
+		if !ok || rule.ID != "broad" {
+			t.Fatalf("attempt %d: got %v, want the higher-priority rule", i, rule)
+		}
+	}
+}
+
+func TestFindRuleForTargetTieBrokenByID(t *testing.T) {
+	rs := newTestState(t,
+		errorRule("rule-b", "http://api.local/api", 0),
+		errorRule("rule-a", "http://api.local/api", 0),
+	)
+	for i := 0; i < 50; i++ {
+		if rule, _ := rs.FindRuleForTarget("http://api.local/api"); rule.ID != "rule-a" {
+			t.Fatalf("attempt %d: got %s, want rule-a", i, rule.ID)
+		}
+	}
+}
+
+func TestFindRuleForTargetSkipsDisabledRules(t *testing.T) {
+	disabled := errorRule("narrow", "http://api.local/api/users", 0)
+	disabled.Enabled = false
+	rs := newTestState(t, errorRule("broad", "http://api.local/api", 0), disabled)
+
+	if rule, ok := rs.FindRuleForTarget("http://api.local/api/users"); !ok || rule.ID != "broad" {
+		t.Errorf("got %v, want the enabled /api rule", rule)
+	}
+}
+
+func TestRulesFromConfigKeepsFailureParameters(t *testing.T) {
+	rules := RulesFromConfig([]config.Rule{
+		{Target: "http://api.local/pay", Failure: config.Failure{Type: "error", ErrorCode: 503, Probability: 0.25}},
+		{Target: "http://api.local/slow", Failure: config.Failure{Type: "latency", LatencyMs: 300}},
+	})
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(rules))
+	}
+	pay, slow := rules[0], rules[1]
+	if pay.Failure.Type != "error" || pay.Failure.ErrorCode != 503 || pay.Failure.Probability != 0.25 {
+		t.Errorf("pay rule failure = %+v, want error 503 with probability 0.25", pay.Failure)
+	}
+	if slow.Failure.LatencyMs != 300 || slow.Failure.Probability != 0 {
+		t.Errorf("slow rule failure = %+v, want 300ms latency", slow.Failure)
+	}
+	for _, rule := range rules {
+		if !rule.Enabled || rule.Category != DefaultCategory || rule.ID == "" {
+			t.Errorf("rule %+v: want enabled, in %q, with an ID", rule, DefaultCategory)
+		}
+	}
+
+	again := RulesFromConfig([]config.Rule{{Target: "http://api.local/pay", Failure: config.Failure{Type: "error", ErrorCode: 503, Probability: 0.25}}})
+	if again[0].ID != pay.ID {
+		t.Errorf("seeding the same rule again gave ID %s, want %s", again[0].ID, pay.ID)
+	}
+}
+
+func TestFailureValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		f       Failure
+		wantErr bool
+	}{
+		{"error", Failure{Type: "error", ErrorCode: 503}, false},
+		{"error without code", Failure{Type: "error"}, true},
+		{"error code too high", Failure{Type: "error", ErrorCode: 600}, true},
+		{"error code too low", Failure{Type: "error", ErrorCode: 99}, true},
+		{"sequence", Failure{Type: "sequence", Sequence: []int{200, 503}}, false},
+		{"empty sequence", Failure{Type: "sequence"}, true},
+		{"sequence with bad code", Failure{Type: "sequence", Sequence: []int{200, 0}}, true},
+		{"ratelimit", Failure{Type: "ratelimit", RequestsPerSecond: 0.5}, false},
+		{"ratelimit without rate", Failure{Type: "ratelimit"}, true},
+		{"ratelimit with negative rate", Failure{Type: "ratelimit", RequestsPerSecond: -1}, true},
+		{"negative burst", Failure{Type: "ratelimit", RequestsPerSecond: 5, Burst: -1}, true},
+		{"quota with default code", Failure{Type: "quota", MaxRequests: 5}, false},
+		{"quota with bad code", Failure{Type: "quota", MaxRequests: 5, ErrorCode: 1000}, true},
+		{"mock with bad status", Failure{Type: "mock", StatusCode: 42}, true},
+		{"latency", Failure{Type: "latency", LatencyMs: 100}, false},
+		{"probability above 1", Failure{Type: "latency", LatencyMs: 100, Probability: 1.5}, true},
+		{"rollout above 100%", Failure{Type: "latency", LatencyMs: 100, Rollout: &Rollout{Percent: 120}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.f.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestQueryMatchIgnoresParameterOrder(t *testing.T) {
+	debug := errorRule("debug", "http://api.local/search", 0)
+	debug.QueryMatch = map[string]string{"debug": "true", "lang": "en"}
+	rs := newTestState(t, debug)
+
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"http://api.local/search?debug=true&lang=en", true},
+		{"http://api.local/search?lang=en&debug=true", true},
+		{"http://api.local/search?q=x&lang=en&page=2&debug=true", true},
+		{"http://api.local/search?lang=fr&lang=en&debug=true", true}, // any of a repeated parameter's values
+		{"http://api.local/search?debug=true", false},
+		{"http://api.local/search?debug=false&lang=en", false},
+		{"http://api.local/search", false},
+	}
+	for _, tt := range tests {
+		if _, ok := rs.FindRuleForTarget(tt.target); ok != tt.want {
+			t.Errorf("%s: matched %v, want %v", tt.target, ok, tt.want)
+		}
+	}
+}
+
+func TestTargetMatchIgnoresQueryString(t *testing.T) {
+	rs := newTestState(t, errorRule("users", "http://api.local/users", 0))
+
+	for _, target := range []string{
+		"http://api.local/users",
+		"http://api.local/users?page=2",
+		"http://api.local/users/7?expand=orders&sort=asc",
+	} {
+		if _, ok := rs.FindRuleForTarget(target); !ok {
+			t.Errorf("%s: no match, want the /users rule", target)
+		}
+	}
+	if _, ok := rs.FindRuleForTarget("http://api.local/orders?next=/users"); ok {
+		t.Error("a query string mentioning the target matched the rule")
+	}
+}
+
+func TestTargetWithQueryStringMatchesFullURL(t *testing.T) {
+	rs := newTestState(t, errorRule("page2", "http://api.local/users?page=2", 0))
+
+	if _, ok := rs.FindRuleForTarget("http://api.local/users?page=2&size=10"); !ok {
+		t.Error("URL starting with the target's query string did not match")
+	}
+	for _, target := range []string{"http://api.local/users", "http://api.local/users?page=3"} {
+		if _, ok := rs.FindRuleForTarget(target); ok {
+			t.Errorf("%s matched a target with another query string", target)
+		}
+	}
+}
+
+func TestCatchAllRuleIsOverriddenBySpecificRules(t *testing.T) {
+	def := Rule{ID: "default", Target: CatchAllTarget, Enabled: true, Priority: 100, Failure: Failure{Type: "latency", LatencyMs: 200}}
+	rs := newTestState(t, def, errorRule("pay", "http://api.local/pay", 0))
+
+	if rule, ok := rs.FindRuleForTarget("http://api.local/pay/123"); !ok || rule.ID != "pay" {
+		t.Errorf("/pay matched %v, want the specific rule despite the default's priority", rule)
+	}
+	if rule, ok := rs.FindRuleForTarget("http://other.local/anything"); !ok || rule.ID != "default" {
+		t.Errorf("unmatched target got %v, want the catch-all rule", rule)
+	}
+}
+
+func TestRulesFromConfigIDsCoverTheWholeFailure(t *testing.T) {
+	rules := RulesFromConfig([]config.Rule{
+		{Target: "http://api.local/pay", Failure: config.Failure{Type: "error", ErrorCode: 503, Probability: 0.25}},
+		{Target: "http://api.local/pay", Failure: config.Failure{Type: "error", ErrorCode: 503, Probability: 0.5}},
+	})
+	if rules[0].ID == rules[1].ID {
+		t.Fatal("rules differing only in probability got the same ID")
+	}
+	rs := NewRuleState(nil, "")
+	if added, _ := rs.SeedConfig(rules); len(added) != 2 {
+		t.Errorf("seeded %d rule(s), want both", len(added))
+	}
+}
+
+func TestSeedConfigReplacesEditedRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.json")
+	manual := errorRule("manual", "http://api.local/manual", 0)
+	rs := NewRuleState(nil, file)
+	rs.AddRule(manual)
+
+	first := RulesFromConfig([]config.Rule{
+		{Target: "http://api.local/pay", Failure: config.Failure{Type: "error", ErrorCode: 503, Probability: 0.25}},
+		{Target: "http://api.local/slow", Failure: config.Failure{Type: "latency", LatencyMs: 300}},
+	})
+	rs.SeedConfig(first)
+	if err := rs.SetEnabledBulk([]string{first[1].ID}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next start, after probability was edited in the file.
+	rs = NewRuleState(nil, file)
+	second := RulesFromConfig([]config.Rule{
+		{Target: "http://api.local/pay", Failure: config.Failure{Type: "error", ErrorCode: 503, Probability: 0.5}},
+		{Target: "http://api.local/slow", Failure: config.Failure{Type: "latency", LatencyMs: 300}},
+	})
+	added, removed := rs.SeedConfig(second)
+	if len(added) != 1 || added[0].ID != second[0].ID || len(removed) != 1 || removed[0].ID != first[0].ID {
+		t.Fatalf("added %v, removed %v; want the edited rule replaced", added, removed)
+	}
+
+	rules := rs.GetRules()
+	if len(rules) != 3 {
+		t.Fatalf("got %d rules, want the manual one and the two config rules", len(rules))
+	}
+	if rule, ok := rs.RuleByRef(second[0].ID); !ok || rule.Failure.Probability != 0.5 {
+		t.Errorf("pay rule = %+v, want probability 0.5", rule)
+	}
+	if rule, _ := rs.RuleByRef(second[1].ID); rule.Enabled {
+		t.Error("disabling the unchanged config rule didn't survive the restart")
+	}
+	if _, ok := rs.RuleByRef("manual"); !ok {
+		t.Error("a rule added at runtime was removed")
+	}
+}
+
+func TestSeedSkipsDuplicates(t *testing.T) {
+	rs := newTestState(t, errorRule("existing", "http://api.local/pay", 0))
+	if added := rs.Seed([]Rule{errorRule("copy", "http://api.local/pay", 5)}); len(added) != 0 {
+		t.Errorf("Seed added %v, a duplicate of an existing rule", added)
+	}
+}
+
+func TestAddRuleIfNewSkipsTheSameLogicalRule(t *testing.T) {
+	rs := newTestState(t)
+	first := errorRule("a", "http://api.local/pay", 0)
+	first.Method = "POST"
+	first.HeaderMatch = map[string]string{"X-Tenant": "beta"}
+	if _, added, err := rs.AddRuleIfNew(first); !added || err != nil {
+		t.Fatalf("first add: added=%v err=%v", added, err)
+	}
+
+	// A new ID, enabled state, priority and tags, and differently cased
+	// method and header name, don't make it a different rule.
+	again := first
+	again.ID, again.Enabled, again.Priority, again.Tags = "b", false, 5, []string{"retry"}
+	again.Method = "post"
+	again.HeaderMatch = map[string]string{"x-tenant": "beta"}
+	existing, added, err := rs.AddRuleIfNew(again)
+	if added || err != nil || existing.ID != "a" {
+		t.Errorf("second add: added=%v err=%v existing=%s, want the first rule returned", added, err, existing.ID)
+	}
+	if n := len(rs.GetRules()); n != 1 {
+		t.Errorf("%d rules stored, want 1", n)
+	}
+
+	other := first
+	other.ID = "c"
+	other.Failure.ErrorCode = 503
+	if _, added, _ := rs.AddRuleIfNew(other); !added {
+		t.Error("a rule with a different failure was treated as a duplicate")
+	}
+}
+
+func TestPickWeightedRuleSplitsByWeight(t *testing.T) {
+	weighted := func(id string, weight int) Rule {
+		r := errorRule(id, "http://api.local/pay", 0)
+		r.Weight = weight
+		return r
+	}
+	off := weighted("off", 100)
+	off.Enabled = false
+	rs := newTestState(t, weighted("a", 70), weighted("b", 30), errorRule("plain", "http://api.local/pay", 10), off)
+	req := Request{Target: "http://api.local/pay"}
+
+	counts := map[string]int{}
+	const draws = 10000
+	for range draws {
+		rule, ok := rs.PickWeightedRule(req)
+		if !ok {
+			t.Fatal("no rule picked")
+		}
+		counts[rule.ID]++
+	}
+	if counts["a"] < 6500 || counts["a"] > 7500 || counts["a"]+counts["b"] != draws {
+		t.Errorf("picked %v in %d draws, want about 70%% a and 30%% b only", counts, draws)
+	}
+
+	// Without a weighted match, the usual priority order applies.
+	if rule, ok := rs.PickWeightedRule(Request{Target: "http://api.local/other"}); ok {
+		t.Errorf("picked %s for a request no rule matches", rule.ID)
+	}
+	rs = newTestState(t, errorRule("low", "http://api.local/pay", 0), errorRule("high", "http://api.local/pay", 5))
+	if rule, ok := rs.PickWeightedRule(req); !ok || rule.ID != "high" {
+		t.Errorf("without weights: picked %v, want the highest priority rule", rule)
+	}
+}
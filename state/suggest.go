@@ -0,0 +1,110 @@
+package state
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// UpstreamErrorEvent is the event type the proxy records for real upstream
+// failures: error responses, and requests that failed at the transport
+// level, whose Failure then names the fault type reproducing them ("dns",
+// "refused" or "timeout").
+const UpstreamErrorEvent = "upstream-error"
+
+// SuggestedTag marks rules created from suggestions.
+const SuggestedTag = "suggested"
+
+// RuleSuggestion is a rule reproducing upstream failures the proxy has seen.
+type RuleSuggestion struct {
+	Rule     Rule      `json:"rule"`
+	Observed int       `json:"observed"` // upstream errors it is based on
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// SuggestRules derives disabled rules from the upstream-error events: one
+// per target (without its query string) and method, injecting the failure
+// seen most often there. Only errors whose status matches one of the
+// patterns ("503", "5xx") count when any are given, and targets with fewer
+// than minObserved of them are skipped, as are suggestions duplicating an
+// existing rule. The most observed come first.
+func SuggestRules(events []Event, existing []Rule, minObserved int, status []string) ([]RuleSuggestion, error) {
+	for _, s := range status {
+		if !validStatusPattern(s) {
+			return nil, fmt.Errorf("invalid status %q: use a code such as 503 or a class such as 5xx", s)
+		}
+	}
+
+	type group struct {
+		target, method string
+		failures       map[string]int // failureKey -> count
+		seen           int
+		last           time.Time
+		lastEvent      map[string]Event // failureKey -> an event with that failure
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, e := range events {
+		if e.Type != UpstreamErrorEvent {
+			continue
+		}
+		if len(status) > 0 && !slices.ContainsFunc(status, func(s string) bool { return statusMatches(s, e.Status) }) {
+			continue
+		}
+		target, _, _ := strings.Cut(e.Target, "?")
+		key := e.Method + " " + target
+		g, ok := groups[key]
+		if !ok {
+			g = &group{target: target, method: e.Method, failures: make(map[string]int), lastEvent: make(map[string]Event)}
+			groups[key] = g
+			order = append(order, key)
+		}
+		fk := fmt.Sprintf("%s/%d", e.Failure, e.Status)
+		g.failures[fk]++
+		g.lastEvent[fk] = e
+		g.seen++
+		if e.Time.After(g.last) {
+			g.last = e.Time
+		}
+	}
+
+	suggestions := []RuleSuggestion{}
+	for _, key := range order {
+		g := groups[key]
+		if g.seen < max(minObserved, 1) {
+			continue
+		}
+		// The most frequent failure wins; ties go to the latest seen.
+		var best string
+		for fk, n := range g.failures {
+			if best == "" || n > g.failures[best] || n == g.failures[best] && g.lastEvent[fk].Time.After(g.lastEvent[best].Time) {
+				best = fk
+			}
+		}
+		rule := Rule{
+			Target:  g.target,
+			Method:  g.method,
+			Failure: suggestedFailure(g.lastEvent[best]),
+			Tags:    []string{SuggestedTag},
+		}
+		if slices.ContainsFunc(existing, rule.Duplicates) {
+			continue
+		}
+		suggestions = append(suggestions, RuleSuggestion{Rule: rule, Observed: g.seen, LastSeen: g.last})
+	}
+	slices.SortStableFunc(suggestions, func(a, b RuleSuggestion) int {
+		return cmp.Compare(b.Observed, a.Observed)
+	})
+	return suggestions, nil
+}
+
+// suggestedFailure returns the failure reproducing an upstream error event.
+func suggestedFailure(e Event) Failure {
+	switch e.Failure {
+	case "dns", "refused", "timeout":
+		return Failure{Type: e.Failure}
+	}
+	return Failure{Type: "error", ErrorCode: e.Status}
+}
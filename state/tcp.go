@@ -0,0 +1,213 @@
+package state
+
+import (
+	"encoding/json"
+	"faultline/config"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// TCPRule is a DB/TCP proxy rule managed at runtime, alongside the HTTP rules.
+type TCPRule struct {
+	ID       string           `json:"id" yaml:"id"`
+	Listen   string           `json:"listen" yaml:"listen"`
+	Upstream string           `json:"upstream" yaml:"upstream"`
+	Faults   config.TCPFaults `json:"faults" yaml:"faults"`
+	Protocol string           `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Enabled  bool             `json:"enabled" yaml:"enabled"`
+}
+
+// Config returns the rule in the form the tcp package runs.
+func (r TCPRule) Config() config.TCPRule {
+	return config.TCPRule{Listen: r.Listen, Upstream: r.Upstream, Faults: r.Faults, Protocol: r.Protocol}
+}
+
+// TCPRulesFromConfig converts tcpRules from a config file into runtime rules.
+// Like RulesFromConfig, IDs are derived from the listen and upstream addresses
+// so seeding the same file twice is idempotent.
+func TCPRulesFromConfig(cfgRules []config.TCPRule) []TCPRule {
+	rules := make([]TCPRule, 0, len(cfgRules))
+	for _, cr := range cfgRules {
+		key := fmt.Sprintf("faultline:config:tcp:%s|%s", cr.Listen, cr.Upstream)
+		rules = append(rules, TCPRule{
+			ID:       uuid.NewSHA1(uuid.NameSpaceURL, []byte(key)).String(),
+			Listen:   cr.Listen,
+			Upstream: cr.Upstream,
+			Faults:   cr.Faults,
+			Protocol: cr.Protocol,
+			Enabled:  true,
+		})
+	}
+	return rules
+}
+
+// tcpDataFileFor derives the TCP rules file from the HTTP rules file,
+// e.g. faultline-rules.json -> faultline-rules-tcp.json.
+func tcpDataFileFor(dataFile string) string {
+	if dataFile == "" {
+		return ""
+	}
+	ext := filepath.Ext(dataFile)
+	return strings.TrimSuffix(dataFile, ext) + "-tcp" + ext
+}
+
+// loadTCPFromFile loads TCP rules from their persistent storage file
+func (rs *RuleState) loadTCPFromFile() error {
+	path := tcpDataFileFor(rs.dataFile)
+	fileInfo, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var rules []TCPRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.tcpFileModTime = fileInfo.ModTime()
+	rs.tcpRules = make(map[string]TCPRule)
+	for _, rule := range rules {
+		rs.tcpRules[rule.ID] = rule
+	}
+	return nil
+}
+
+// saveTCPToFile saves the current TCP rules to their persistent storage file
+func (rs *RuleState) saveTCPToFile() error {
+	path := tcpDataFileFor(rs.dataFile)
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(rs.getTCPRulesInternal(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// getTCPRulesInternal returns TCP rules sorted by ID without locking (internal use)
+func (rs *RuleState) getTCPRulesInternal() []TCPRule {
+	rules := make([]TCPRule, 0, len(rs.tcpRules))
+	for _, rule := range rs.tcpRules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+	return rules
+}
+
+// GetTCPRules returns all TCP rules in consistent order (sorted by ID).
+func (rs *RuleState) GetTCPRules() []TCPRule {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.getTCPRulesInternal()
+}
+
+// AddTCPRule adds a TCP rule and persists to file. It returns false if another
+// rule already listens on the same address.
+func (rs *RuleState) AddTCPRule(rule TCPRule) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.listenTaken(rule) {
+		return false
+	}
+	rs.tcpRules[rule.ID] = rule
+	rs.saveTCPToFile()
+	return true
+}
+
+// UpdateTCPRule replaces an existing TCP rule and persists to file. The error
+// reports a missing rule or a listen address already used by another rule.
+func (rs *RuleState) UpdateTCPRule(rule TCPRule) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if _, ok := rs.tcpRules[rule.ID]; !ok {
+		return ErrNotFound
+	}
+	if rs.listenTaken(rule) {
+		return ErrListenInUse
+	}
+	rs.tcpRules[rule.ID] = rule
+	rs.saveTCPToFile()
+	return nil
+}
+
+// DeleteTCPRule removes a TCP rule by ID and persists to file. Returns false if not found.
+func (rs *RuleState) DeleteTCPRule(id string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if _, ok := rs.tcpRules[id]; !ok {
+		return false
+	}
+	delete(rs.tcpRules, id)
+	rs.saveTCPToFile()
+	return true
+}
+
+// SeedTCPRules adds TCP rules whose IDs aren't already present and persists once.
+func (rs *RuleState) SeedTCPRules(rules []TCPRule) int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	added := 0
+	for _, rule := range rules {
+		if _, ok := rs.tcpRules[rule.ID]; ok || rs.listenTaken(rule) {
+			continue
+		}
+		rs.tcpRules[rule.ID] = rule
+		added++
+	}
+	if added > 0 {
+		rs.saveTCPToFile()
+	}
+	return added
+}
+
+// listenTaken reports whether a different rule already uses rule.Listen.
+func (rs *RuleState) listenTaken(rule TCPRule) bool {
+	for id, other := range rs.tcpRules {
+		if id != rule.ID && other.Listen == rule.Listen {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAndReloadTCPIfModified reloads TCP rules if their file changed since the
+// last load, so a running start-db picks up edits made through the API or CLI.
+func (rs *RuleState) CheckAndReloadTCPIfModified() error {
+	path := tcpDataFileFor(rs.dataFile)
+	if path == "" {
+		return nil
+	}
+
+	fileInfo, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if fileInfo.ModTime().After(rs.tcpFileModTime) {
+		return rs.loadTCPFromFile()
+	}
+	return nil
+}
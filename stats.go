@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"faultline/api"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// statsTimeout bounds the request to the control API.
+const statsTimeout = 5 * time.Second
+
+// fetchStats reads the metrics summary of the control API at apiURL.
+func fetchStats(apiURL string) (*api.MetricsSummary, error) {
+	client := &http.Client{Timeout: statsTimeout}
+	resp, err := client.Get(strings.TrimSuffix(apiURL, "/") + "/api/metrics")
+	if err != nil {
+		return nil, fmt.Errorf("%w (is FaultLine running with its API on %s?)", err, apiURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", apiURL, resp.Status)
+	}
+	var summary api.MetricsSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		return nil, fmt.Errorf("unexpected response from %s: %w", apiURL, err)
+	}
+	return &summary, nil
+}
+
+// validateStatsOutput reports an error for output formats printStats lacks.
+func validateStatsOutput(output string) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("unknown output format %q (table or json)", output)
+	}
+	return nil
+}
+
+// printStats renders the summary as tables, or as JSON when output is "json".
+func printStats(w io.Writer, s *api.MetricsSummary, output string) error {
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	header := color.New(color.FgMagenta, color.Bold)
+	header.Fprintln(w, "📊 HTTP proxy")
+	fmt.Fprintf(w, "  Requests: %d\n  Injected faults: %d\n", s.RequestsTotal, s.FaultsInjected)
+	if len(s.Rules) > 0 {
+		table := tablewriter.NewWriter(w)
+		table.Header("Rule", "Target", "Type", "Faults")
+		for _, r := range s.Rules {
+			rule, target := r.ID, r.Target
+			if r.Name != "" {
+				rule = r.Name
+			}
+			if target == "" {
+				target = "(deleted)"
+			}
+			table.Append([]string{rule, target, r.Type, fmt.Sprintf("%d", r.Faults)})
+		}
+		table.Render()
+	}
+
+	if len(s.TCP) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	header.Fprintln(w, "📊 DB proxies")
+	table := tablewriter.NewWriter(w)
+	table.Header("Listen", "Upstream", "Connections", "Refused", "Resets", "Drops", "Corrupted", "Query errors", "Bytes in/out")
+	for _, t := range s.TCP {
+		table.Append([]string{
+			t.Listen, t.Upstream,
+			fmt.Sprintf("%d", t.Connections), fmt.Sprintf("%d", t.Refused), fmt.Sprintf("%d", t.Resets),
+			fmt.Sprintf("%d", t.Drops), fmt.Sprintf("%d", t.CorruptedBytes), fmt.Sprintf("%d", t.QueryErrors),
+			fmt.Sprintf("%d/%d", t.BytesUpstream, t.BytesDownstream),
+		})
+	}
+	table.Render()
+	return nil
+}
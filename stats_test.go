@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"faultline/api"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const metricsJSON = `{"requestsTotal": 42, "faultsInjected": 7,
+ "rules": [{"id": "r1", "name": "checkout-500", "target": "http://pay.local", "type": "error", "faults": 5},
+  {"id": "r2", "type": "latency", "faults": 2}],
+ "tcp": [{"listen": ":15432", "upstream": "db:5432", "connections": 3, "resets": 1, "bytesUpstream": 100, "bytesDownstream": 200}]}`
+
+func TestStatsFromTheMetricsEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, metricsJSON)
+	}))
+	t.Cleanup(srv.Close)
+
+	s, err := fetchStats(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.RequestsTotal != 42 || s.FaultsInjected != 7 || len(s.Rules) != 2 || len(s.TCP) != 1 {
+		t.Fatalf("fetched %+v", s)
+	}
+
+	var table strings.Builder
+	if err := printStats(&table, s, "table"); err != nil {
+		t.Fatal(err)
+	}
+	out := table.String()
+	for _, want := range []string{"Requests: 42", "Injected faults: 7", "checkout-500", "http://pay.local", "(deleted)", ":15432", "db:5432", "100/200"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("table lacks %q:\n%s", want, out)
+		}
+	}
+
+	var raw strings.Builder
+	if err := printStats(&raw, s, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var round api.MetricsSummary
+	if err := json.Unmarshal([]byte(raw.String()), &round); err != nil || !reflect.DeepEqual(&round, s) {
+		t.Errorf("json: %v, got %+v, want %+v", err, round, *s)
+	}
+	if err := validateStatsOutput("yaml"); err == nil {
+		t.Error("-o yaml: got no error")
+	}
+}
+
+func TestStatsErrors(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	t.Cleanup(broken.Close)
+
+	for url, want := range map[string]string{
+		broken.URL:           "answered 500 Internal Server Error",
+		"http://127.0.0.1:1": "is FaultLine running with its API on http://127.0.0.1:1?",
+	} {
+		if _, err := fetchStats(url); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v, want an error mentioning %q", url, err, want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package tcp
+
+import (
+	"io"
+	"net"
+)
+
+// newEchoConn returns an in-memory upstream that sends back everything
+// written to it, for rules whose upstream is config.EchoUpstream. It stops
+// echoing once closed.
+func newEchoConn() net.Conn {
+	conn, loop := net.Pipe()
+	go func() {
+		_, _ = io.Copy(loop, loop)
+		_ = loop.Close()
+	}()
+	return conn
+}
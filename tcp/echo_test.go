@@ -0,0 +1,29 @@
+package tcp
+
+import (
+	"faultline/config"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEchoUpstream(t *testing.T) {
+	_, addr := serve(t, config.TCPRule{Upstream: config.EchoUpstream})
+	conn := dial(t, addr)
+
+	for _, msg := range []string{"ping", strings.Repeat("x", 64*1024)} {
+		if took := roundTrip(t, conn, msg); took >= time.Second {
+			t.Errorf("%d-byte echo took %s", len(msg), took)
+		}
+	}
+
+	// Half-closing the client ends the echo, and with it the connection.
+	if err := conn.(interface{ CloseWrite() error }).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if rest, err := io.ReadAll(conn); err != nil || len(rest) != 0 {
+		t.Errorf("after the client closed: read %d bytes, %v; want a clean EOF", len(rest), err)
+	}
+}
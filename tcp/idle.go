@@ -0,0 +1,76 @@
+package tcp
+
+import (
+	"errors"
+	"faultline/logging"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errIdle is returned by idle-tracked reads once the connection was evicted.
+var errIdle = errors.New("connection idle timeout")
+
+// idleTimer closes a proxied connection pair once no bytes have flowed in
+// either direction for the timeout, like a server reaping idle connections.
+type idleTimer struct {
+	timeout time.Duration
+	last    atomic.Int64 // unix nanos of the last read with data, either direction
+	once    sync.Once
+	onEvict func()
+}
+
+func newIdleTimer(timeout time.Duration, onEvict func()) *idleTimer {
+	t := &idleTimer{timeout: timeout, onEvict: onEvict}
+	t.touch()
+	return t
+}
+
+func (t *idleTimer) touch() { t.last.Store(time.Now().UnixNano()) }
+
+func (t *idleTimer) deadline() time.Time {
+	return time.Unix(0, t.last.Load()).Add(t.timeout)
+}
+
+// reader wraps one side of the connection so its reads count as activity
+// and time out when the whole connection has been idle.
+func (t *idleTimer) reader(c net.Conn) io.Reader {
+	return &idleReader{conn: c, t: t}
+}
+
+type idleReader struct {
+	conn net.Conn
+	t    *idleTimer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	for {
+		_ = r.conn.SetReadDeadline(r.t.deadline())
+		n, err := r.conn.Read(p)
+		if n > 0 {
+			r.t.touch()
+		}
+		var ne net.Error
+		if n == 0 && errors.As(err, &ne) && ne.Timeout() {
+			// The other direction may have been active meanwhile.
+			if time.Now().Before(r.t.deadline()) {
+				continue
+			}
+			r.t.once.Do(r.t.onEvict)
+			return 0, errIdle
+		}
+		return n, err
+	}
+}
+
+// evictIdle returns the eviction callback for a client/upstream pair.
+func (p *Proxy) evictIdle(client, upstream net.Conn, timeout time.Duration) func() {
+	return func() {
+		logging.Infof("[DB] Idle eviction of %s after %s without traffic (rule=%s)", client.RemoteAddr(), timeout, p.rule.Listen)
+		p.stats.update(func(t *StatsSnapshot) { t.IdleEvictions++ })
+		_ = client.Close()
+		_ = upstream.Close()
+	}
+}
@@ -0,0 +1,34 @@
+package tcp
+
+import (
+	"faultline/config"
+	"testing"
+	"time"
+)
+
+func TestIdleConnectionsAreClosed(t *testing.T) {
+	timeout := 100 * time.Millisecond
+	p, addr := serve(t, config.TCPRule{
+		Upstream: config.EchoUpstream,
+		Faults:   config.TCPFaults{IdleTimeoutMs: int(timeout / time.Millisecond)},
+	})
+	conn := dial(t, addr)
+
+	// Traffic keeps the connection open past the timeout.
+	for range 3 {
+		roundTrip(t, conn, "ping")
+		time.Sleep(timeout / 2)
+	}
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("read %d bytes from an idle connection, want it closed", n)
+	}
+	if took := time.Since(start); took >= time.Second {
+		t.Errorf("idle connection closed after %s, want about %s", took, timeout)
+	}
+	if n := p.stats.Snapshot().IdleEvictions; n != 1 {
+		t.Errorf("%d idle evictions recorded, want 1", n)
+	}
+}
@@ -0,0 +1,130 @@
+package tcp
+
+import (
+	"errors"
+	"faultline/config"
+	"log"
+	"sync"
+	"time"
+)
+
+// Manager runs a set of TCP proxies keyed by listen address and reconciles
+// them against a desired rule set, so rules can change while running.
+type Manager struct {
+	DrainTimeout time.Duration
+
+	mu      sync.Mutex
+	running map[string]*managedProxy // listen address -> proxy
+	// failed holds rules whose address couldn't be bound; they aren't
+	// retried (and the error not repeated) until the rule changes.
+	failed map[string]config.TCPRule
+}
+
+type managedProxy struct {
+	rule config.TCPRule
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewManager creates a manager with no running proxies.
+func NewManager(drainTimeout time.Duration) *Manager {
+	return &Manager{
+		DrainTimeout: drainTimeout,
+		running:      make(map[string]*managedProxy),
+		failed:       make(map[string]config.TCPRule),
+	}
+}
+
+// Apply starts proxies for new rules, restarts those whose rule changed and
+// stops those no longer present. It returns how many proxies were started,
+// stopped and left running unchanged, and the errors of listeners that
+// couldn't bind (e.g. a port in use), joined; the other proxies still run.
+func (m *Manager) Apply(rules []config.TCPRule) (started, stopped, kept int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	desired := make(map[string]config.TCPRule, len(rules))
+	for _, r := range rules {
+		desired[r.Listen] = r
+	}
+
+	for listen, mp := range m.running {
+		if r, ok := desired[listen]; ok && r == mp.rule {
+			continue
+		}
+		m.stopLocked(listen, mp)
+		stopped++
+	}
+
+	for listen, r := range m.failed {
+		if desired[listen] != r {
+			delete(m.failed, listen)
+		}
+	}
+
+	var errs []error
+	for listen, r := range desired {
+		if _, ok := m.running[listen]; ok {
+			kept++
+			continue
+		}
+		if _, ok := m.failed[listen]; ok {
+			continue
+		}
+		if err := m.startLocked(r); err != nil {
+			m.failed[listen] = r
+			errs = append(errs, err)
+			continue
+		}
+		started++
+	}
+	return started, stopped, kept, errors.Join(errs...)
+}
+
+// StopAll stops every running proxy, draining connections.
+func (m *Manager) StopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for listen, mp := range m.running {
+		m.stopLocked(listen, mp)
+	}
+}
+
+// Rules returns the rules of the currently running proxies.
+func (m *Manager) Rules() []config.TCPRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := make([]config.TCPRule, 0, len(m.running))
+	for _, mp := range m.running {
+		rules = append(rules, mp.rule)
+	}
+	return rules
+}
+
+// startLocked binds the rule's address and serves it in the background; a
+// proxy whose address can't be bound isn't started.
+func (m *Manager) startLocked(rule config.TCPRule) error {
+	rp := NewProxy(rule)
+	rp.DrainTimeout = m.DrainTimeout
+	ln, err := rp.Listen()
+	if err != nil {
+		return err
+	}
+	mp := &managedProxy{rule: rule, stop: make(chan struct{}), done: make(chan struct{})}
+	m.running[rule.Listen] = mp
+
+	go func() {
+		defer close(mp.done)
+		if err := rp.Serve(ln, mp.stop); err != nil {
+			log.Printf("[DB] Proxy %s -> %s exited: %v", rule.Listen, rule.Upstream, err)
+		}
+	}()
+	return nil
+}
+
+func (m *Manager) stopLocked(listen string, mp *managedProxy) {
+	close(mp.stop)
+	<-mp.done
+	delete(m.running, listen)
+	log.Printf("[DB] Stopped proxy %s -> %s", mp.rule.Listen, mp.rule.Upstream)
+}
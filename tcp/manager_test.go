@@ -0,0 +1,56 @@
+package tcp
+
+import (
+	"faultline/config"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a local address nothing is listening on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestManagerApplyReportsBindErrors(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	m := NewManager(time.Second)
+	defer m.StopAll()
+	free := config.TCPRule{Listen: freeAddr(t), Upstream: config.EchoUpstream}
+	taken := config.TCPRule{Listen: busy.Addr().String(), Upstream: config.EchoUpstream}
+
+	started, _, _, err := m.Apply([]config.TCPRule{free, taken})
+	if started != 1 {
+		t.Errorf("started %d proxies, want the one whose port is free", started)
+	}
+	if err == nil || !strings.Contains(err.Error(), taken.Listen) {
+		t.Errorf("Apply error %v, want one naming %s", err, taken.Listen)
+	}
+	if conn, err := net.Dial("tcp", free.Listen); err != nil {
+		t.Errorf("proxy on the free port isn't listening: %v", err)
+	} else {
+		conn.Close()
+	}
+
+	// The failed rule isn't retried, nor its error repeated, until it changes.
+	if _, _, kept, err := m.Apply([]config.TCPRule{free, taken}); kept != 1 || err != nil {
+		t.Errorf("reapplying: kept %d, error %v; want 1 kept and no error", kept, err)
+	}
+	busy.Close()
+	taken.Faults.LatencyMs = 10
+	if started, _, _, err := m.Apply([]config.TCPRule{free, taken}); started != 1 || err != nil {
+		t.Errorf("after freeing the port: started %d, error %v; want the changed rule started", started, err)
+	}
+}
@@ -0,0 +1,102 @@
+package tcp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"faultline/config"
+	"strconv"
+)
+
+const (
+	mysqlComQuery   = 0x03
+	mysqlClientSSL  = 0x0800 // capability flag set by an SSLRequest packet
+	mysqlMaxPayload = 0xFFFFFF
+)
+
+// mysqlErrors holds the usual SQLSTATE and text for error codes commonly simulated.
+var mysqlErrors = map[int]struct{ sqlState, message string }{
+	1040: {"08004", "Too many connections"},
+	1045: {"28000", "Access denied for user"},
+	1053: {"08S01", "Server shutdown in progress"},
+	1062: {"23000", "Duplicate entry for key 'PRIMARY'"},
+	1205: {"HY000", "Lock wait timeout exceeded; try restarting transaction"},
+	1213: {"40001", "Deadlock found when trying to get lock; try restarting transaction"},
+	1317: {"70100", "Query execution was interrupted"},
+	3024: {"HY000", "Query execution was interrupted, maximum statement execution time exceeded"},
+}
+
+// mysqlUnknownError is ER_UNKNOWN_ERROR, used when the configured code isn't numeric.
+const mysqlUnknownError = 1105
+
+// mysqlFatal reports whether the server drops the connection after raising code.
+func mysqlFatal(code int) bool {
+	switch code {
+	case 1040, 1053:
+		return true
+	}
+	return false
+}
+
+// mysqlHandler parses the client side of the MySQL protocol.
+type mysqlHandler struct {
+	started bool // the handshake response has been seen
+}
+
+func (h *mysqlHandler) next(r *bufio.Reader) (msg []byte, query, opaque bool, err error) {
+	// Packets: 3-byte little-endian payload length, sequence id, payload.
+	hdr, err := readFull(r, 4)
+	if err != nil {
+		return nil, false, false, err
+	}
+	n := int(hdr[0]) | int(hdr[1])<<8 | int(hdr[2])<<16
+	payload, err := readFull(r, n)
+	if err != nil {
+		return nil, false, false, err
+	}
+	msg = append(hdr, payload...)
+
+	if !h.started {
+		h.started = true
+		// An SSLRequest is a truncated handshake response; TLS follows and
+		// can't be inspected.
+		if n == 32 && binary.LittleEndian.Uint32(payload[:4])&mysqlClientSSL != 0 {
+			return msg, false, true, nil
+		}
+		return msg, false, false, nil
+	}
+
+	// Commands start a new sequence (id 0); auth exchanges continue an old one.
+	// Queries split over several packets are let through.
+	query = hdr[3] == 0 && n > 0 && n < mysqlMaxPayload && payload[0] == mysqlComQuery
+	return msg, query, false, nil
+}
+
+func (h *mysqlHandler) errorResponse(msg []byte, qe config.QueryError) ([]byte, bool) {
+	code, err := strconv.Atoi(qe.Code)
+	if err != nil || code <= 0 || code > 0xFFFF {
+		code = mysqlUnknownError
+	}
+	known := mysqlErrors[code]
+	sqlState := qe.SQLState
+	if sqlState == "" {
+		sqlState = known.sqlState
+	}
+	if len(sqlState) != 5 {
+		sqlState = "HY000"
+	}
+	text := qe.Message
+	if text == "" {
+		text = known.message
+	}
+	if text == "" {
+		text = "FaultLine injected error"
+	}
+
+	// ERR packet: 0xFF, error code, '#', SQLSTATE, message.
+	payload := []byte{0xFF, byte(code), byte(code >> 8), '#'}
+	payload = append(payload, sqlState...)
+	payload = append(payload, text...)
+
+	resp := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), msg[3] + 1}
+	return append(resp, payload...), mysqlFatal(code)
+}
@@ -0,0 +1,61 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"faultline/config"
+	"io"
+	"testing"
+)
+
+// mysqlPacket frames payload as a MySQL packet with sequence id seq.
+func mysqlPacket(seq byte, payload []byte) []byte {
+	n := len(payload)
+	return append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, payload...)
+}
+
+// readMysqlPacket reads one packet and returns its sequence id and payload.
+func readMysqlPacket(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, int(hdr[0])|int(hdr[1])<<8|int(hdr[2])<<16)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return hdr[3], payload
+}
+
+func TestMysqlQueryGetsErrPacket(t *testing.T) {
+	_, addr := serve(t, config.TCPRule{
+		Upstream: config.EchoUpstream,
+		Protocol: "mysql",
+		Faults:   config.TCPFaults{QueryError: config.QueryError{Code: "1205"}},
+	})
+	conn := dial(t, addr)
+	r := bufio.NewReader(conn)
+
+	// The handshake response goes through to the (echo) upstream.
+	login := mysqlPacket(1, append(make([]byte, 32), "app\x00"...))
+	conn.Write(login)
+	echoed := make([]byte, len(login))
+	if _, err := io.ReadFull(r, echoed); err != nil || !bytes.Equal(echoed, login) {
+		t.Fatalf("handshake response not forwarded: %q, %v", echoed, err)
+	}
+
+	conn.Write(mysqlPacket(0, append([]byte{mysqlComQuery}, "SELECT 1"...)))
+	seq, payload := readMysqlPacket(t, r)
+	if seq != 1 {
+		t.Errorf("sequence id %d, want 1 after the query's 0", seq)
+	}
+	if len(payload) < 9 || payload[0] != 0xFF {
+		t.Fatalf("reply %q, want an ERR packet", payload)
+	}
+	code, state, msg := binary.LittleEndian.Uint16(payload[1:3]), string(payload[3:9]), string(payload[9:])
+	if code != 1205 || state != "#HY000" || msg != mysqlErrors[1205].message {
+		t.Errorf("ERR packet %d %s %q, want 1205 #HY000 with the server's usual message", code, state, msg)
+	}
+}
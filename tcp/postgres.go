@@ -0,0 +1,130 @@
+package tcp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"faultline/config"
+	"strings"
+)
+
+// Postgres startup request codes (the protocol version field of a startup packet).
+const (
+	pgSSLRequest    = 80877103
+	pgGSSENCRequest = 80877104
+	pgCancelRequest = 80877102
+)
+
+// maxPostgresMessage bounds message lengths so a corrupt stream can't force huge allocations.
+const maxPostgresMessage = 1 << 30
+
+// pgErrorMessages holds the server's usual text for SQLSTATEs commonly
+// simulated (see tools/pg_scenarios for reproducing them against a real server).
+var pgErrorMessages = map[string]string{
+	"23505": "duplicate key value violates unique constraint",
+	"28P01": "password authentication failed",
+	"3D000": "database does not exist",
+	"40001": "could not serialize access due to concurrent update",
+	"40P01": "deadlock detected",
+	"42501": "permission denied",
+	"53300": "sorry, too many clients already",
+	"57014": "canceling statement due to statement timeout",
+	"57P01": "terminating connection due to administrator command",
+}
+
+// pgFatal reports whether Postgres ends the session when raising code.
+func pgFatal(code string) bool {
+	switch {
+	case strings.HasPrefix(code, "28"), strings.HasPrefix(code, "3D"), strings.HasPrefix(code, "57P"), code == "53300":
+		return true
+	}
+	return false
+}
+
+// postgresHandler parses the frontend side of the Postgres v3 protocol.
+type postgresHandler struct {
+	started bool // the startup message has been seen
+}
+
+func (h *postgresHandler) next(r *bufio.Reader) (msg []byte, query, opaque bool, err error) {
+	if !h.started {
+		// Startup packets have no type byte: int32 length, int32 code, payload.
+		hdr, err := readFull(r, 8)
+		if err != nil {
+			return nil, false, false, err
+		}
+		n := int(binary.BigEndian.Uint32(hdr[:4]))
+		if n < 8 || n > maxPostgresMessage {
+			return hdr, false, true, nil
+		}
+		body, err := readFull(r, n-8)
+		if err != nil {
+			return nil, false, false, err
+		}
+		msg = append(hdr, body...)
+		switch binary.BigEndian.Uint32(hdr[4:8]) {
+		case pgSSLRequest, pgGSSENCRequest:
+			// Encrypted sessions can't be inspected; stop parsing.
+			return msg, false, true, nil
+		case pgCancelRequest:
+			return msg, false, false, nil
+		}
+		h.started = true
+		return msg, false, false, nil
+	}
+
+	// Regular messages: type byte, int32 length (including itself), payload.
+	hdr, err := readFull(r, 5)
+	if err != nil {
+		return nil, false, false, err
+	}
+	n := int(binary.BigEndian.Uint32(hdr[1:5]))
+	if n < 4 || n > maxPostgresMessage {
+		return hdr, false, true, nil
+	}
+	body, err := readFull(r, n-4)
+	if err != nil {
+		return nil, false, false, err
+	}
+	return append(hdr, body...), hdr[0] == 'Q', false, nil
+}
+
+func (h *postgresHandler) errorResponse(msg []byte, qe config.QueryError) ([]byte, bool) {
+	fatal := pgFatal(qe.Code)
+	severity := "ERROR"
+	if fatal {
+		severity = "FATAL"
+	}
+	text := qe.Message
+	if text == "" {
+		text = pgErrorMessages[qe.Code]
+	}
+	if text == "" {
+		text = "FaultLine injected error"
+	}
+
+	var fields []byte
+	for _, f := range []struct {
+		typ byte
+		val string
+	}{{'S', severity}, {'V', severity}, {'C', qe.Code}, {'M', text}} {
+		fields = append(fields, f.typ)
+		fields = append(fields, f.val...)
+		fields = append(fields, 0)
+	}
+	fields = append(fields, 0)
+
+	resp := pgMessage('E', fields)
+	if !fatal {
+		// The session stays usable: tell the client we're ready for the next query.
+		resp = append(resp, pgMessage('Z', []byte{'I'})...)
+	}
+	return resp, fatal
+}
+
+// pgMessage frames a backend message: type byte, int32 length, payload.
+func pgMessage(typ byte, payload []byte) []byte {
+	msg := make([]byte, 5, 5+len(payload))
+	msg[0] = typ
+	binary.BigEndian.PutUint32(msg[1:], uint32(4+len(payload)))
+	return append(msg, payload...)
+}
@@ -0,0 +1,67 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"faultline/config"
+	"io"
+	"testing"
+)
+
+// pgStartup builds a protocol 3.0 startup message for user.
+func pgStartup(user string) []byte {
+	payload := binary.BigEndian.AppendUint32(nil, 196608)
+	payload = append(payload, "user\x00"+user+"\x00\x00"...)
+	return append(binary.BigEndian.AppendUint32(nil, uint32(4+len(payload))), payload...)
+}
+
+// readPgMessage reads one backend message and returns its type and payload.
+func readPgMessage(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(hdr[1:])-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return hdr[0], payload
+}
+
+func TestPostgresQueryGetsErrorResponse(t *testing.T) {
+	_, addr := serve(t, config.TCPRule{
+		Upstream: config.EchoUpstream,
+		Protocol: "postgres",
+		Faults:   config.TCPFaults{QueryError: config.QueryError{Code: "57014"}},
+	})
+	conn := dial(t, addr)
+	r := bufio.NewReader(conn)
+
+	// The startup message goes through to the (echo) upstream.
+	startup := pgStartup("app")
+	conn.Write(startup)
+	echoed := make([]byte, len(startup))
+	if _, err := io.ReadFull(r, echoed); err != nil || !bytes.Equal(echoed, startup) {
+		t.Fatalf("startup message not forwarded: %q, %v", echoed, err)
+	}
+
+	conn.Write(pgMessage('Q', []byte("SELECT 1\x00")))
+	typ, payload := readPgMessage(t, r)
+	if typ != 'E' {
+		t.Fatalf("reply type %q, want an ErrorResponse", typ)
+	}
+	fields := map[byte]string{}
+	for _, f := range bytes.Split(bytes.TrimSuffix(payload, []byte{0, 0}), []byte{0}) {
+		if len(f) > 0 {
+			fields[f[0]] = string(f[1:])
+		}
+	}
+	if fields['S'] != "ERROR" || fields['C'] != "57014" || fields['M'] != pgErrorMessages["57014"] {
+		t.Errorf("ErrorResponse fields %q, want ERROR 57014 with the server's usual message", fields)
+	}
+	if typ, payload := readPgMessage(t, r); typ != 'Z' || string(payload) != "I" {
+		t.Errorf("followed by %q %q, want ReadyForQuery (idle)", typ, payload)
+	}
+}
@@ -0,0 +1,107 @@
+package tcp
+
+import (
+	"bufio"
+	"faultline/config"
+	"faultline/logging"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// protocolHandler parses the client side of a database wire protocol so
+// faults can target individual queries rather than raw bytes.
+type protocolHandler interface {
+	// next reads one complete client message. query reports whether the
+	// message runs a query; opaque reports that the rest of the stream can't
+	// be parsed (e.g. the client negotiated TLS) and must be copied as-is.
+	next(r *bufio.Reader) (msg []byte, query, opaque bool, err error)
+
+	// errorResponse builds the reply sent to the client instead of forwarding
+	// the query msg. closeConn reports that the server would drop the
+	// connection after this error.
+	errorResponse(msg []byte, qe config.QueryError) (resp []byte, closeConn bool)
+}
+
+// newProtocolHandler returns the handler for a TCPRule protocol, or nil when
+// traffic should be proxied opaquely.
+func newProtocolHandler(protocol string) protocolHandler {
+	switch protocol {
+	case "postgres":
+		return &postgresHandler{}
+	case "mysql":
+		return &mysqlHandler{}
+	}
+	return nil
+}
+
+// ValidateProtocol reports an error for protocols the TCP proxy doesn't understand.
+func ValidateProtocol(protocol string) error {
+	switch protocol {
+	case "", "postgres", "mysql":
+		return nil
+	}
+	return fmt.Errorf("unsupported protocol %q (supported: postgres, mysql)", protocol)
+}
+
+// lockedWriter serializes writes from the forwarding goroutine and injected
+// responses so they never interleave on the client connection.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(b)
+}
+
+// copyProtocol forwards client messages to upstream one at a time, answering
+// queries with the rule's QueryError instead when the fault fires.
+func (p *Proxy) copyProtocol(upstream, client net.Conn, clientR io.Reader, clientW io.Writer, h protocolHandler, qe config.QueryError, s *dirStats) {
+	r := bufio.NewReader(clientR)
+	for {
+		msg, query, opaque, err := h.next(r)
+		if err != nil {
+			return
+		}
+		s.chunks++
+
+		if query && (qe.Probability <= 0 || rng.Float64() < qe.Probability) {
+			resp, closeConn := h.errorResponse(msg, qe)
+			if _, err := clientW.Write(resp); err != nil {
+				return
+			}
+			p.stats.update(func(t *StatsSnapshot) { t.QueryErrors++ })
+			logging.Infof("[DB] Injected %s error %s on %s", p.rule.Protocol, qe.Code, p.rule.Listen)
+			if closeConn {
+				_ = client.Close()
+				_ = upstream.Close()
+				return
+			}
+			continue
+		}
+
+		n, err := upstream.Write(msg)
+		s.writes++
+		s.bytes += int64(n)
+		if err != nil {
+			return
+		}
+
+		if opaque {
+			n, _ := io.Copy(upstream, r)
+			s.bytes += n
+			return
+		}
+	}
+}
+
+// readFull reads exactly n bytes from r.
+func readFull(r *bufio.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
@@ -0,0 +1,100 @@
+package tcp
+
+import (
+	"sort"
+	"sync"
+)
+
+// Stats accumulates fault-injection counters for one listen address across
+// all of its connections. It is safe for concurrent use.
+type Stats struct {
+	mu   sync.Mutex
+	snap StatsSnapshot
+}
+
+// StatsSnapshot is a point-in-time copy of the counters for one listen address.
+type StatsSnapshot struct {
+	Listen          string `json:"listen"`
+	Upstream        string `json:"upstream"`
+	Connections     int64  `json:"connections"`
+	Refused         int64  `json:"refused"`
+	Resets          int64  `json:"resets"`
+	AcceptDelays    int64  `json:"acceptDelays"`    // connections stalled by a saturated pool
+	SimulatedDown   int64  `json:"simulatedDown"`   // connections reset by SimulateUpstreamDown
+	QueryErrors     int64  `json:"queryErrors"`     // database errors injected by protocol-aware rules
+	IdleEvictions   int64  `json:"idleEvictions"`   // connections closed by the idle timeout
+	BytesUpstream   int64  `json:"bytesUpstream"`   // client -> upstream
+	BytesDownstream int64  `json:"bytesDownstream"` // upstream -> client
+	Chunks          int64  `json:"chunks"`
+	Drops           int64  `json:"drops"`
+	CorruptedBytes  int64  `json:"corruptedBytes"` // bytes altered by CorruptProbability
+	LatencySleepMs  int64  `json:"latencySleepMs"`
+	ThrottleSleepMs int64  `json:"throttleSleepMs"`
+}
+
+// Stats are kept per listen address so counters survive a proxy being
+// restarted with a changed rule.
+var (
+	statsMu sync.Mutex
+	stats   = make(map[string]*Stats)
+)
+
+// statsFor returns the accumulator for a listen address, creating it if needed.
+func statsFor(listen, upstream string) *Stats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	s, ok := stats[listen]
+	if !ok {
+		s = &Stats{}
+		s.snap.Listen = listen
+		stats[listen] = s
+	}
+	s.mu.Lock()
+	s.snap.Upstream = upstream
+	s.mu.Unlock()
+	return s
+}
+
+// AllStats returns a snapshot of the counters of every listen address that has
+// run a proxy in this process, sorted by listen address.
+func AllStats() []StatsSnapshot {
+	statsMu.Lock()
+	all := make([]*Stats, 0, len(stats))
+	for _, s := range stats {
+		all = append(all, s)
+	}
+	statsMu.Unlock()
+
+	snaps := make([]StatsSnapshot, 0, len(all))
+	for _, s := range all {
+		snaps = append(snaps, s.Snapshot())
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Listen < snaps[j].Listen })
+	return snaps
+}
+
+// Snapshot returns a copy of the current counters.
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snap
+}
+
+func (s *Stats) update(fn func(*StatsSnapshot)) {
+	s.mu.Lock()
+	fn(&s.snap)
+	s.mu.Unlock()
+}
+
+// addConn folds the per-direction counters of a finished connection into the totals.
+func (s *Stats) addConn(up, down *dirStats) {
+	s.update(func(t *StatsSnapshot) {
+		t.BytesUpstream += up.bytes
+		t.BytesDownstream += down.bytes
+		t.Chunks += up.chunks + down.chunks
+		t.Drops += up.drops + down.drops
+		t.CorruptedBytes += up.corrupted + down.corrupted
+		t.LatencySleepMs += (up.latencySleep + down.latencySleep).Milliseconds()
+		t.ThrottleSleepMs += (up.throttleSleep + down.throttleSleep).Milliseconds()
+	})
+}
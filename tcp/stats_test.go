@@ -0,0 +1,34 @@
+package tcp
+
+import (
+	"faultline/config"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStatsCountTraffic(t *testing.T) {
+	p, addr := serve(t, config.TCPRule{Upstream: config.EchoUpstream, Faults: config.TCPFaults{LatencyMs: 20}})
+	for range 2 {
+		conn := dial(t, addr)
+		roundTrip(t, conn, "ping")
+		conn.Close()
+	}
+
+	// Byte counts are folded in once the proxy is done with each connection.
+	var snap StatsSnapshot
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if snap = p.stats.Snapshot(); snap.BytesDownstream == 8 {
+			break
+		}
+	}
+	if snap.Connections != 2 || snap.BytesUpstream != 8 || snap.BytesDownstream != 8 {
+		t.Errorf("connections=%d up=%d down=%d, want 2 connections of 4 bytes each way", snap.Connections, snap.BytesUpstream, snap.BytesDownstream)
+	}
+	if snap.Chunks != 4 || snap.LatencySleepMs < 4*10 {
+		t.Errorf("chunks=%d latencySleepMs=%d, want 4 chunks each delayed", snap.Chunks, snap.LatencySleepMs)
+	}
+	if !slices.ContainsFunc(AllStats(), func(s StatsSnapshot) bool { return s.Listen == addr && s.Connections == 2 }) {
+		t.Errorf("AllStats doesn't report %s", addr)
+	}
+}
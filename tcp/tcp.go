@@ -3,6 +3,8 @@ package tcp
 import (
 	"errors"
 	"faultline/config"
+	"faultline/logging"
+	"faultline/metrics"
 	"io"
 	"log"
 	"math/rand"
@@ -14,9 +16,27 @@ import (
 // Local RNG for randomized faults (drop/reset probabilities), avoids deprecated global seeding.
 var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
 
+// DefaultDrainTimeout is how long Start waits for in-flight connections after stop.
+const DefaultDrainTimeout = 5 * time.Second
+
 // Proxy represents a single TCP proxy instance with configured faults.
 type Proxy struct {
 	rule config.TCPRule
+
+	// DrainTimeout bounds how long in-flight connections may keep running
+	// after the stop signal before they are force-closed.
+	DrainTimeout time.Duration
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{} // active client and upstream connections
+	clients int                   // active client connections
+
+	// closing is closed when connections are force-closed, cutting short
+	// injected delays that would otherwise outlive them.
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	stats *Stats // shared with other proxies on the same listen address
 }
 
 // dirStats holds per-direction counters for a single proxied connection.
@@ -24,6 +44,7 @@ type dirStats struct {
 	bytes         int64
 	chunks        int64
 	drops         int64
+	corrupted     int64 // bytes altered by CorruptProbability
 	writes        int64
 	throttleSleep time.Duration
 	latencySleep  time.Duration
@@ -31,16 +52,40 @@ type dirStats struct {
 
 // NewProxy creates a new TCP proxy for the given rule.
 func NewProxy(rule config.TCPRule) *Proxy {
-	return &Proxy{rule: rule}
+	return &Proxy{
+		rule:         rule,
+		DrainTimeout: DefaultDrainTimeout,
+		conns:        make(map[net.Conn]struct{}),
+		closing:      make(chan struct{}),
+		stats:        statsFor(rule.Listen, rule.Upstream),
+	}
 }
 
 // Start begins listening on the rule.Listen address and proxies to rule.Upstream.
 func (p *Proxy) Start(stop <-chan struct{}) error {
-	ln, err := net.Listen("tcp", p.rule.Listen)
+	ln, err := p.Listen()
 	if err != nil {
 		return err
 	}
+	return p.Serve(ln, stop)
+}
+
+// Listen binds the rule.Listen address, so a port already in use is
+// reported before the proxy is considered running.
+func (p *Proxy) Listen() (net.Listener, error) {
+	ln, err := net.Listen("tcp", p.rule.Listen)
+	if err != nil {
+		return nil, err
+	}
 	log.Printf("[DB] Listening on %s -> %s", p.rule.Listen, p.rule.Upstream)
+	// Export the gauge from the start, so it reads 0 rather than missing.
+	metrics.TCPActiveConnections.WithLabelValues(p.rule.Listen)
+	return ln, nil
+}
+
+// Serve proxies connections accepted on ln to rule.Upstream until stop is
+// closed, then drains them.
+func (p *Proxy) Serve(ln net.Listener, stop <-chan struct{}) error {
 
 	var wg sync.WaitGroup
 
@@ -74,43 +119,160 @@ func (p *Proxy) Start(stop <-chan struct{}) error {
 		}(conn)
 	}
 
-	wg.Wait()
+	// Stop accepting, then give in-flight connections a grace period to finish.
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(p.DrainTimeout):
+		n := p.closeActive()
+		log.Printf("[DB] Drain timeout (%s) on %s: force-closed %d connection(s)", p.DrainTimeout, p.rule.Listen, n)
+		select {
+		case <-done:
+		case <-time.After(forceCloseWait):
+			log.Printf("[DB] Connections on %s still closing after %s, not waiting for them", p.rule.Listen, forceCloseWait)
+		}
+	}
 	return nil
 }
 
+// forceCloseWait bounds how long Serve waits for connection handlers to
+// return once their connections were force-closed. Only a handler still
+// dialing the upstream can take that long.
+const forceCloseWait = time.Second
+
+// sleepOrStop waits for d, returning early with false once stop is closed.
+func sleepOrStop(d time.Duration, stop <-chan struct{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// track registers a connection so it can be force-closed on shutdown.
+// Connections opened after that are closed straight away.
+func (p *Proxy) track(c net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.closing:
+		_ = c.Close()
+	default:
+		p.conns[c] = struct{}{}
+	}
+}
+
+// untrack removes a connection once it has been closed.
+func (p *Proxy) untrack(c net.Conn) {
+	p.mu.Lock()
+	delete(p.conns, c)
+	p.mu.Unlock()
+}
+
+// addClient adjusts the active client count by delta and returns the new count.
+func (p *Proxy) addClient(delta int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clients += delta
+	return p.clients
+}
+
+// closeActive closes all tracked connections and returns how many were
+// closed. Pending injected delays end with them.
+func (p *Proxy) closeActive() int {
+	p.closeOnce.Do(func() { close(p.closing) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.conns)
+	for c := range p.conns {
+		_ = c.Close()
+	}
+	return n
+}
+
 func (p *Proxy) handleConn(client net.Conn) {
 	faults := p.rule.Faults
 	clientAddr := client.RemoteAddr().String()
 	start := time.Now()
 
+	p.track(client)
+	defer p.untrack(client)
+	active := p.addClient(1)
+	defer p.addClient(-1)
+
+	metrics.TCPConnectionsTotal.WithLabelValues(p.rule.Listen).Inc()
+	metrics.TCPActiveConnections.WithLabelValues(p.rule.Listen).Inc()
+	defer metrics.TCPActiveConnections.WithLabelValues(p.rule.Listen).Dec()
+	p.stats.update(func(t *StatsSnapshot) { t.Connections++ })
+
 	if faults.RefuseConnections {
 		// Immediately close connection to simulate refusal
-		log.Printf("[DB] Refusing connection from %s (rule=%s -> %s)", clientAddr, p.rule.Listen, p.rule.Upstream)
+		logging.Infof("[DB] Refusing connection from %s (rule=%s -> %s)", clientAddr, p.rule.Listen, p.rule.Upstream)
+		p.stats.update(func(t *StatsSnapshot) { t.Refused++ })
 		_ = client.Close()
 		return
 	}
 
-	// Optional initial latency per-connection
-	if faults.LatencyMs > 0 {
-		d := time.Duration(faults.LatencyMs) * time.Millisecond
-		time.Sleep(d)
-		log.Printf("[DB] Applied initial latency %s for %s", d, clientAddr)
+	// Pool saturation: past MaxConnections, hold the client connected but idle
+	// as if waiting for a free connection, or refuse it outright.
+	if faults.MaxConnections > 0 && active > faults.MaxConnections {
+		if faults.AcceptDelayMs <= 0 {
+			logging.Infof("[DB] Pool exhausted (%d/%d), refusing %s", active, faults.MaxConnections, clientAddr)
+			p.stats.update(func(t *StatsSnapshot) { t.Refused++ })
+			_ = client.Close()
+			return
+		}
+		d := time.Duration(faults.AcceptDelayMs) * time.Millisecond
+		logging.Infof("[DB] Pool saturated (%d/%d), stalling %s for %s", active, faults.MaxConnections, clientAddr, d)
+		if !sleepOrStop(d, p.closing) {
+			_ = client.Close()
+			return
+		}
+		p.stats.update(func(t *StatsSnapshot) { t.AcceptDelays++ })
 	}
 
 	// Randomly reset after accept
 	if faults.ResetProbability > 0 && rng.Float64() < faults.ResetProbability {
-		log.Printf("[DB] Resetting connection immediately after accept for %s (p=%.2f)", clientAddr, faults.ResetProbability)
+		logging.Infof("[DB] Resetting connection immediately after accept for %s (p=%.2f)", clientAddr, faults.ResetProbability)
+		p.stats.update(func(t *StatsSnapshot) { t.Resets++ })
 		_ = client.Close()
 		return
 	}
 
-	upstream, err := net.DialTimeout("tcp", p.rule.Upstream, 5*time.Second)
-	if err != nil {
-		log.Printf("[DB] Upstream dial error for %s: %v", p.rule.Upstream, err)
-		_ = client.Close()
+	// Simulated outage: behave as if the upstream couldn't be reached,
+	// without contacting it.
+	if faults.SimulateUpstreamDown {
+		logging.Infof("[DB] Simulating upstream %s down, resetting %s (rule=%s)", p.rule.Upstream, clientAddr, p.rule.Listen)
+		p.stats.update(func(t *StatsSnapshot) { t.SimulatedDown++ })
+		resetConns(client)
 		return
 	}
-	log.Printf("[DB] %s connected -> upstream %s", clientAddr, p.rule.Upstream)
+
+	// Echo rules loop the client's bytes back instead of dialing anything.
+	echo := p.rule.Upstream == config.EchoUpstream
+	var upstream net.Conn
+	if echo {
+		upstream = newEchoConn()
+	} else {
+		var err error
+		upstream, err = net.DialTimeout("tcp", p.rule.Upstream, 5*time.Second)
+		if err != nil {
+			log.Printf("[DB] Upstream dial error for %s: %v", p.rule.Upstream, err)
+			_ = client.Close()
+			return
+		}
+	}
+	p.track(upstream)
+	defer p.untrack(upstream)
+	logging.Debugf("[DB] %s connected -> upstream %s", clientAddr, p.rule.Upstream)
 
 	// Bi-directional piping with optional throttling/drops
 	var wg sync.WaitGroup
@@ -120,33 +282,89 @@ func (p *Proxy) handleConn(client net.Conn) {
 	upStats := &dirStats{}   // client -> upstream
 	downStats := &dirStats{} // upstream -> client
 
+	// In protocol-aware mode client messages are parsed and forwarded intact,
+	// so query errors can be injected; byte faults apply to responses only.
+	clientW := &lockedWriter{w: client}
+	handler := newProtocolHandler(p.rule.Protocol)
+
+	// Reads from either side go through the idle timer when one is configured.
+	var clientR, upstreamR io.Reader = client, upstream
+	if faults.IdleTimeoutMs > 0 {
+		timeout := time.Duration(faults.IdleTimeoutMs) * time.Millisecond
+		idle := newIdleTimer(timeout, p.evictIdle(client, upstream, timeout))
+		clientR, upstreamR = idle.reader(client), idle.reader(upstream)
+	}
+
 	go func() {
 		defer wg.Done()
-		copyWithFaults(upstream, client, faults, "c->u", upStats)
+		if echo {
+			// Nothing else ends the loop once the client stops sending.
+			defer upstream.Close()
+		}
+		if handler != nil && faults.QueryError.Code != "" {
+			p.copyProtocol(upstream, client, clientR, clientW, handler, faults.QueryError, upStats)
+			return
+		}
+		if copyWithFaults(upstream, clientR, faults, "c->u", upStats, p.closing) {
+			resetConns(client, upstream)
+		}
 	}()
 
 	go func() {
 		defer wg.Done()
-		copyWithFaults(client, upstream, faults, "u->c", downStats)
+		if copyWithFaults(clientW, upstreamR, faults, "u->c", downStats, p.closing) {
+			resetConns(client, upstream)
+		}
 	}()
 
 	wg.Wait()
 	_ = client.Close()
 	_ = upstream.Close()
+	p.stats.addConn(upStats, downStats)
 
 	dur := time.Since(start)
-	log.Printf("[DB] Conn %s closed after %s | c->u bytes=%d chunks=%d drops=%d slept(lat=%s,thr=%s) | u->c bytes=%d chunks=%d drops=%d slept(lat=%s,thr=%s)",
+	logging.Infof("[DB] Conn %s closed after %s | c->u bytes=%d chunks=%d drops=%d corrupt=%d slept(lat=%s,thr=%s) | u->c bytes=%d chunks=%d drops=%d corrupt=%d slept(lat=%s,thr=%s)",
 		clientAddr, dur,
-		upStats.bytes, upStats.chunks, upStats.drops, upStats.latencySleep, upStats.throttleSleep,
-		downStats.bytes, downStats.chunks, downStats.drops, downStats.latencySleep, downStats.throttleSleep,
+		upStats.bytes, upStats.chunks, upStats.drops, upStats.corrupted, upStats.latencySleep, upStats.throttleSleep,
+		downStats.bytes, downStats.chunks, downStats.drops, downStats.corrupted, downStats.latencySleep, downStats.throttleSleep,
 	)
 }
 
-// copyWithFaults copies data from src to dst applying drop and bandwidth throttling.
-func copyWithFaults(dst net.Conn, src net.Conn, f config.TCPFaults, dir string, s *dirStats) {
-	// Simple chunked copy
-	bufSize := 32 * 1024
-	buf := make([]byte, bufSize)
+// resetConns aborts both sides of a proxied connection with a TCP reset,
+// as peers see after unrecoverable loss, rather than an orderly close.
+func resetConns(conns ...net.Conn) {
+	for _, c := range conns {
+		if tc, ok := c.(*net.TCPConn); ok {
+			_ = tc.SetLinger(0)
+		}
+		_ = c.Close()
+	}
+}
+
+// DefaultBufferSize is the read size used when a rule doesn't set BufferSize.
+const DefaultBufferSize = 32 * 1024
+
+// corruptChunk flips at least one bit of a random byte of b in place.
+func corruptChunk(b []byte) {
+	b[rng.Intn(len(b))] ^= byte(1 + rng.Intn(255))
+}
+
+// delayedChunk is data read from one side, due to be written at due.
+type delayedChunk struct {
+	data []byte
+	due  time.Time
+}
+
+// copyWithFaults copies data from src to dst applying latency, drops,
+// corruption and bandwidth throttling. It reports dropped when a drop fired: TCP is a
+// reliable stream, so losing a chunk can't be survived like a lost packet
+// and the caller resets the connection instead of leaving a hole in the data.
+// Closing stop abandons any data still held back by latency or throttling.
+func copyWithFaults(dst io.Writer, src io.Reader, f config.TCPFaults, dir string, s *dirStats, stop <-chan struct{}) (dropped bool) {
+	bufSize := f.BufferSize
+	if bufSize <= 0 {
+		bufSize = DefaultBufferSize
+	}
 	var bwPerSec int64
 	if f.BandwidthKbps > 0 {
 		bwPerSec = int64(f.BandwidthKbps) * 1024 // bytes per second
@@ -154,56 +372,107 @@ func copyWithFaults(dst net.Conn, src net.Conn, f config.TCPFaults, dir string,
 	var sentThisWindow int64
 	windowStart := time.Now()
 
-	for {
-		// Apply per-chunk latency if configured (approximate)
-		if f.LatencyMs > 0 {
-			d := time.Duration(f.LatencyMs) * time.Millisecond
-			time.Sleep(d)
-			s.latencySleep += d
-		}
-
-		n, readErr := src.Read(buf)
-		if n > 0 {
-			s.chunks++
-			// Randomly drop this chunk
-			if f.DropProbability > 0 && rng.Float64() < f.DropProbability {
-				// drop silently
-				s.drops++
-				log.Printf("[DB] drop dir=%s size=%d", dir, n)
-			} else {
-				// Bandwidth throttling: ensure we don't exceed bwPerSec
-				if bwPerSec > 0 {
-					now := time.Now()
-					if now.Sub(windowStart) >= time.Second {
-						windowStart = now
-						sentThisWindow = 0
-					}
-					// If sending this chunk would exceed budget, sleep
-					if sentThisWindow+int64(n) > bwPerSec {
-						sleepDur := time.Second - now.Sub(windowStart)
-						if sleepDur > 0 {
-							time.Sleep(sleepDur)
-							s.throttleSleep += sleepDur
-							windowStart = time.Now()
-							sentThisWindow = 0
-						}
+	// deliver forwards one chunk, reporting false once the copy must stop.
+	deliver := func(b []byte) bool {
+		s.chunks++
+		// Randomly lose this chunk, which ends the connection
+		if f.DropProbability > 0 && rng.Float64() < f.DropProbability {
+			s.drops++
+			dropped = true
+			logging.Debugf("[DB] drop dir=%s size=%d: resetting connection", dir, len(b))
+			return false
+		}
+		// Randomly damage one byte of this chunk, leaving the stream intact
+		if f.CorruptProbability > 0 && rng.Float64() < f.CorruptProbability {
+			corruptChunk(b)
+			s.corrupted++
+			logging.Debugf("[DB] corrupt dir=%s size=%d", dir, len(b))
+		}
+
+		// Bandwidth throttling: ensure we don't exceed bwPerSec
+		if bwPerSec > 0 {
+			now := time.Now()
+			if now.Sub(windowStart) >= time.Second {
+				windowStart = now
+				sentThisWindow = 0
+			}
+			// If sending this chunk would exceed budget, sleep
+			if sentThisWindow+int64(len(b)) > bwPerSec {
+				sleepDur := time.Second - now.Sub(windowStart)
+				if sleepDur > 0 {
+					if !sleepOrStop(sleepDur, stop) {
+						return false
 					}
+					s.throttleSleep += sleepDur
+					windowStart = time.Now()
+					sentThisWindow = 0
 				}
+			}
+		}
+
+		wn, writeErr := dst.Write(b)
+		sentThisWindow += int64(wn)
+		s.writes++
+		s.bytes += int64(wn)
+		return writeErr == nil
+	}
+
+	if f.LatencyMs <= 0 && f.LatencyRampMsPerSec <= 0 {
+		buf := make([]byte, bufSize)
+		for {
+			n, readErr := src.Read(buf)
+			if n > 0 && !deliver(buf[:n]) {
+				return
+			}
+			if readErr != nil {
+				return
+			}
+		}
+	}
 
-				wn, writeErr := dst.Write(buf[:n])
-				sentThisWindow += int64(wn)
-				s.writes++
-				s.bytes += int64(wn)
-				if writeErr != nil {
+	// Latency is a one-way delay: every byte is forwarded LatencyMs after it
+	// was read, however the stream happens to be split into reads. Reading
+	// continues meanwhile, so a response arriving in many small reads is
+	// delayed once rather than once per read. A ramp makes the delay grow
+	// with the connection's age; as it only grows, chunks stay in order.
+	began := time.Now()
+	delayAt := func(now time.Time) time.Duration {
+		ms := float64(f.LatencyMs) + float64(f.LatencyRampMsPerSec)*now.Sub(began).Seconds()
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	chunks := make(chan delayedChunk, 64)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(chunks)
+		buf := make([]byte, bufSize)
+		for {
+			n, readErr := src.Read(buf)
+			if n > 0 {
+				now := time.Now()
+				c := delayedChunk{data: append([]byte(nil), buf[:n]...), due: now.Add(delayAt(now))}
+				select {
+				case chunks <- c:
+				case <-done:
 					return
 				}
 			}
+			if readErr != nil {
+				return
+			}
 		}
-		if readErr != nil {
-			if errors.Is(readErr, io.EOF) {
+	}()
+
+	for c := range chunks {
+		if wait := time.Until(c.due); wait > 0 {
+			if !sleepOrStop(wait, stop) {
 				return
 			}
+			s.latencySleep += wait
+		}
+		if !deliver(c.data) {
 			return
 		}
 	}
+	return
 }
@@ -0,0 +1,308 @@
+package tcp
+
+import (
+	"bytes"
+	"errors"
+	"faultline/config"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// serve runs a proxy for rule on a free local port until the test ends and
+// returns it with its address. The port is bound first, so each proxy gets
+// the stats of its own address.
+func serve(t *testing.T, rule config.TCPRule) (*Proxy, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule.Listen = ln.Addr().String()
+	p := NewProxy(rule)
+	p.DrainTimeout = time.Second
+	stop := make(chan struct{})
+	served := make(chan struct{})
+	go func() {
+		p.Serve(ln, stop)
+		close(served)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-served
+	})
+	return p, ln.Addr().String()
+}
+
+// dial connects to addr, closing the connection when the test ends.
+func dial(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestLatencyDoesNotDependOnChunking(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	latency := 50 * time.Millisecond
+
+	for _, bufSize := range []int{16, 128, 4096} {
+		var dst bytes.Buffer
+		f := config.TCPFaults{LatencyMs: int(latency / time.Millisecond), BufferSize: bufSize}
+		var s dirStats
+		start := time.Now()
+		copyWithFaults(&dst, bytes.NewReader(payload), f, "test", &s, nil)
+		elapsed := time.Since(start)
+
+		if !bytes.Equal(dst.Bytes(), payload) {
+			t.Errorf("buffer %d: payload changed in transit", bufSize)
+		}
+		if elapsed < latency || elapsed > 3*latency {
+			t.Errorf("buffer %d: %d chunks took %s, want about %s", bufSize, s.chunks, elapsed, latency)
+		}
+	}
+}
+
+func TestLatencyIsAppliedOncePerDirection(t *testing.T) {
+	latency := 150 * time.Millisecond
+	_, addr := serve(t, config.TCPRule{
+		Upstream: config.EchoUpstream,
+		Faults:   config.TCPFaults{LatencyMs: int(latency / time.Millisecond)},
+	})
+	conn := dial(t, addr)
+	start := time.Now()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	rtt := time.Since(start)
+
+	if string(reply) != "ping" {
+		t.Errorf("echoed %q, want ping", reply)
+	}
+	// Once on the way up and once on the way back, and no extra delay when
+	// the connection is accepted.
+	if rtt < 2*latency || rtt >= 3*latency {
+		t.Errorf("round trip took %s, want about %s", rtt, 2*latency)
+	}
+}
+
+func TestShutdownCutsInjectedDelaysShort(t *testing.T) {
+	cases := map[string]config.TCPFaults{
+		"latency":    {LatencyMs: 10000},
+		"pool stall": {MaxConnections: 1, AcceptDelayMs: 10000},
+		"throttling": {BandwidthKbps: 1, BufferSize: 512},
+	}
+	for name, faults := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := NewProxy(config.TCPRule{Listen: "127.0.0.1:0", Upstream: config.EchoUpstream, Faults: faults})
+			p.DrainTimeout = 100 * time.Millisecond
+			ln, err := p.Listen()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stop := make(chan struct{})
+			served := make(chan struct{})
+			go func() {
+				p.Serve(ln, stop)
+				close(served)
+			}()
+
+			// Two long-lived connections, each with data queued behind a delay.
+			for range 2 {
+				conn, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				if _, err := conn.Write(bytes.Repeat([]byte("x"), 2048)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			start := time.Now()
+			close(stop)
+			select {
+			case <-served:
+				if took := time.Since(start); took > p.DrainTimeout+500*time.Millisecond {
+					t.Errorf("shutdown took %s, want it within the %s grace period", took, p.DrainTimeout)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("shutdown waited out the injected delay")
+			}
+		})
+	}
+}
+
+// roundTrip sends msg on conn and returns how long the echo took.
+func roundTrip(t *testing.T, conn net.Conn, msg string) time.Duration {
+	t.Helper()
+	start := time.Now()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != msg {
+		t.Errorf("echoed %q, want %q", reply, msg)
+	}
+	return time.Since(start)
+}
+
+func TestPoolExhaustionOnlyPastMaxConnections(t *testing.T) {
+	delay := 300 * time.Millisecond
+	p, addr := serve(t, config.TCPRule{
+		Upstream: config.EchoUpstream,
+		Faults:   config.TCPFaults{MaxConnections: 1, AcceptDelayMs: int(delay / time.Millisecond)},
+	})
+
+	first := dial(t, addr)
+	if took := roundTrip(t, first, "one"); took >= delay {
+		t.Errorf("connection within the pool took %s, want no stall", took)
+	}
+	second := dial(t, addr)
+	if took := roundTrip(t, second, "two"); took < delay {
+		t.Errorf("connection past the pool took %s, want it stalled %s", took, delay)
+	}
+	if n := p.stats.Snapshot().AcceptDelays; n != 1 {
+		t.Errorf("%d accept delays recorded, want 1", n)
+	}
+}
+
+func TestPoolExhaustionRefusesWithoutDelay(t *testing.T) {
+	_, addr := serve(t, config.TCPRule{Upstream: config.EchoUpstream, Faults: config.TCPFaults{MaxConnections: 1}})
+
+	roundTrip(t, dial(t, addr), "one")
+	second := dial(t, addr)
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := second.Read(make([]byte, 1)); err == nil {
+		t.Errorf("read %d bytes past the pool, want the connection closed", n)
+	}
+}
+
+func TestDropResetsTheConnection(t *testing.T) {
+	p, addr := serve(t, config.TCPRule{Upstream: config.EchoUpstream, Faults: config.TCPFaults{DropProbability: 1}})
+	conn := dial(t, addr)
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err := conn.Read(make([]byte, 4))
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("read error %v, want a connection reset", err)
+	}
+	// The stats are folded in once the proxy is done with the connection.
+	for deadline := time.Now().Add(time.Second); p.stats.Snapshot().Drops == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := p.stats.Snapshot().Drops; n != 1 {
+		t.Errorf("%d drops recorded, want 1", n)
+	}
+}
+
+func TestLatencyRampGrowsWithConnectionAge(t *testing.T) {
+	_, addr := serve(t, config.TCPRule{Upstream: config.EchoUpstream, Faults: config.TCPFaults{LatencyMs: 10, LatencyRampMsPerSec: 500}})
+	conn := dial(t, addr)
+
+	var prev time.Duration
+	for i := range 4 {
+		rtt := roundTrip(t, conn, "ping")
+		if rtt <= prev {
+			t.Errorf("round trip %d took %s, want longer than the previous %s", i, rtt, prev)
+		}
+		prev = rtt
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestCorruptionKeepsLengthAndAltersEveryChunk(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	var dst bytes.Buffer
+	var s dirStats
+	copyWithFaults(&dst, bytes.NewReader(payload), config.TCPFaults{CorruptProbability: 1, BufferSize: 64}, "test", &s, nil)
+
+	got := dst.Bytes()
+	if len(got) != len(payload) {
+		t.Fatalf("%d bytes delivered, want all %d", len(got), len(payload))
+	}
+	for i := 0; i < len(payload); i += 64 {
+		diff := 0
+		for j := i; j < i+64; j++ {
+			if got[j] != payload[j] {
+				diff++
+			}
+		}
+		if diff != 1 {
+			t.Errorf("chunk at %d has %d altered bytes, want 1", i, diff)
+		}
+	}
+	if s.corrupted != s.chunks {
+		t.Errorf("%d of %d chunks counted as corrupted, want all", s.corrupted, s.chunks)
+	}
+}
+
+func TestSimulatedOutagesNeverDialTheUpstream(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	dialed := make(chan struct{}, 1)
+	go func() {
+		for {
+			c, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			dialed <- struct{}{}
+			c.Close()
+		}
+	}()
+
+	cases := map[string]struct {
+		faults config.TCPFaults
+		count  func(StatsSnapshot) int64
+		reset  bool
+	}{
+		"upstream down": {config.TCPFaults{SimulateUpstreamDown: true}, func(s StatsSnapshot) int64 { return s.SimulatedDown }, true},
+		"refused":       {config.TCPFaults{RefuseConnections: true}, func(s StatsSnapshot) int64 { return s.Refused }, false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			p, addr := serve(t, config.TCPRule{Upstream: upstream.Addr().String(), Faults: c.faults})
+			// The reset can arrive before the dial even returns.
+			conn, err := net.Dial("tcp", addr)
+			if err == nil {
+				defer conn.Close()
+				conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+				_, err = conn.Read(make([]byte, 1))
+			}
+			if c.reset && !errors.Is(err, syscall.ECONNRESET) {
+				t.Errorf("read error %v, want a connection reset", err)
+			}
+			if !c.reset && err != io.EOF {
+				t.Errorf("read error %v, want the connection closed", err)
+			}
+			if n := c.count(p.stats.Snapshot()); n != 1 {
+				t.Errorf("counted %d, want 1", n)
+			}
+			select {
+			case <-dialed:
+				t.Error("the upstream was dialed")
+			default:
+			}
+		})
+	}
+}
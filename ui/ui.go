@@ -0,0 +1,64 @@
+// Package ui serves the built control panel from files embedded in the
+// binary, so it can run without a separate dev server.
+package ui
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// dist holds the control panel build. It is empty (apart from a placeholder)
+// unless the UI was built into ui/dist before compiling:
+//
+//	cd control-panel && npm run build -- --outDir ../ui/dist --emptyOutDir
+//
+//go:embed all:dist
+var dist embed.FS
+
+// Assets returns the embedded control panel files, or false when the binary
+// was built without them.
+func Assets() (fs.FS, bool) {
+	return assetsIn(dist)
+}
+
+// assetsIn returns the control panel build under root's dist directory.
+func assetsIn(root fs.FS) (fs.FS, bool) {
+	sub, err := fs.Sub(root, "dist")
+	if err != nil {
+		return nil, false
+	}
+	if _, err := fs.Stat(sub, "index.html"); err != nil {
+		return nil, false
+	}
+	return sub, true
+}
+
+// Handler serves the embedded control panel. It returns false when no
+// assets are embedded.
+func Handler() (http.Handler, bool) {
+	assets, ok := Assets()
+	if !ok {
+		return nil, false
+	}
+	return serve(assets), true
+}
+
+// serve serves the files of assets. Paths that don't name a file get
+// index.html, so client-side routes survive a reload.
+func serve(assets fs.FS) http.Handler {
+	files := http.FileServerFS(assets)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name != "" {
+			if _, err := fs.Stat(assets, name); errors.Is(err, fs.ErrNotExist) {
+				http.ServeFileFS(w, r, assets, "index.html")
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
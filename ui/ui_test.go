@@ -0,0 +1,64 @@
+package ui
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServeBuiltAssets(t *testing.T) {
+	assets, ok := assetsIn(fstest.MapFS{
+		"dist/.gitkeep":           {},
+		"dist/index.html":         {Data: []byte(`<div id="root"></div>`)},
+		"dist/assets/index-1.js":  {Data: []byte("console.log(1)")},
+		"dist/assets/index-1.css": {Data: []byte("body{}")},
+	})
+	if !ok {
+		t.Fatal("a build with index.html was not found")
+	}
+	h := serve(assets)
+	tests := []struct {
+		path, body, contentType string
+	}{
+		{"/", `<div id="root"></div>`, "text/html"},
+		{"/assets/index-1.js", "console.log(1)", "text/javascript"},
+		{"/assets/index-1.css", "body{}", "text/css"},
+		{"/rules/abc", `<div id="root"></div>`, "text/html"}, // a client-side route
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != tt.body || !strings.HasPrefix(rec.Header().Get("Content-Type"), tt.contentType) {
+			t.Errorf("GET %s: %d %s %q, want 200 %s %q", tt.path, rec.Code, rec.Header().Get("Content-Type"), rec.Body, tt.contentType, tt.body)
+		}
+	}
+}
+
+func TestPlaceholderIsNoBuild(t *testing.T) {
+	if _, ok := assetsIn(fstest.MapFS{"dist/.gitkeep": {}}); ok {
+		t.Error("the placeholder alone was taken for a build")
+	}
+}
+
+func TestEmbeddedAssets(t *testing.T) {
+	assets, ok := Assets()
+	h, served := Handler()
+	if ok != served {
+		t.Fatalf("Assets() %t but Handler() %t", ok, served)
+	}
+	if !ok {
+		t.Skip("built without the control panel in ui/dist")
+	}
+	index, err := fs.ReadFile(assets, "index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != string(index) {
+		t.Errorf("GET /: %d, want 200 with the embedded index.html", rec.Code)
+	}
+}
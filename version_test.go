@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestVersionFields(t *testing.T) {
+	defer func(v, c, d string) { version, commit, buildDate = v, c, d }(version, commit, buildDate)
+	version, commit, buildDate = "v1.2.0", "abc123", "2026-10-01T12:00:00Z"
+
+	var text strings.Builder
+	if err := printVersion(&text, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "faultline v1.2.0 (commit abc123, built 2026-10-01T12:00:00Z, " + runtime.Version() + ")\n"
+	if text.String() != want {
+		t.Errorf("text: got %q, want %q", text.String(), want)
+	}
+
+	var raw strings.Builder
+	if err := printVersion(&raw, true); err != nil {
+		t.Fatal(err)
+	}
+	var got buildInfo
+	if err := json.Unmarshal([]byte(raw.String()), &got); err != nil {
+		t.Fatalf("JSON: %v in %q", err, raw.String())
+	}
+	if got != (buildInfo{Version: "v1.2.0", Commit: "abc123", BuildDate: "2026-10-01T12:00:00Z", GoVersion: runtime.Version()}) {
+		t.Errorf("JSON: got %+v", got)
+	}
+
+	// Without ldflags, the fields are filled in rather than left empty.
+	version, commit, buildDate = "dev", "", ""
+	b := currentBuild()
+	if b.Version != "dev" || b.Commit == "" || b.BuildDate != "unknown" {
+		t.Errorf("unset: got %+v, want dev with a commit (or unknown) and an unknown build date", b)
+	}
+}
+
+func TestVersionFlagMatchesCommand(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+	flag, err := exec.Command(bin, "--version").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := exec.Command(bin, "version").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(flag) != string(cmd) || !strings.HasPrefix(string(cmd), "faultline dev (commit ") {
+		t.Errorf("--version printed %q and version %q, want the same dev build line", flag, cmd)
+	}
+}